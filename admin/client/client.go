@@ -13,6 +13,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ipni/go-libipni/apierror"
 	"github.com/ipni/storetheindex/admin/model"
@@ -22,13 +23,20 @@ import (
 
 const (
 	assignedPath        = "assigned"
+	backupPath          = "backup"
 	freezePath          = "freeze"
+	healthCheckPath     = "healthcheck"
 	importPath          = "import"
 	importProvidersPath = "importproviders"
+	indexCountsPath     = "indexcounts"
 	ingestPath          = "ingest"
+	labelsPath          = "labels"
+	pollingPath         = "polling"
 	preferredPath       = "preferred"
 	reloadConfigPath    = "reloadconfig"
 	statusPath          = "status"
+	unfreezePath        = "unfreeze"
+	valueStorePath      = "valuestore"
 )
 
 // Client is an http client for the indexer finder API,
@@ -262,6 +270,31 @@ func (c *Client) ReloadConfig(ctx context.Context) error {
 	return nil
 }
 
+// HealthCheck checks that the indexer's admin server is responding and that
+// its value store is usable.
+func (c *Client) HealthCheck(ctx context.Context) error {
+	u := c.baseURL.JoinPath(healthCheckPath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return apierror.FromResponse(resp.StatusCode, body)
+	}
+	return nil
+}
+
 // ListAssignedPeers gets a list of explicitly allowed peers, if indexer is
 // configured to work with an assigner service.
 func (c *Client) ListAssignedPeers(ctx context.Context) (map[peer.ID]peer.ID, error) {
@@ -379,6 +412,222 @@ func (c *Client) Block(ctx context.Context, peerID peer.ID) error {
 	return c.ingestRequest(ctx, peerID, "block", http.MethodPut, nil)
 }
 
+// ListLabeled gets the labels of all providers that have labels matching all
+// of the given label selectors. A selector is either "key=value" or "key". If
+// no selectors are given, then all providers that have labels are returned.
+func (c *Client) ListLabeled(ctx context.Context, selectors ...string) ([]model.ProviderLabels, error) {
+	u := c.baseURL.JoinPath(labelsPath)
+	if len(selectors) != 0 {
+		q := url.Values{}
+		for _, selector := range selectors {
+			q.Add("label", selector)
+		}
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apierror.FromResponse(resp.StatusCode, body)
+	}
+
+	var labeled []model.ProviderLabels
+	if err = json.Unmarshal(body, &labeled); err != nil {
+		return nil, err
+	}
+	return labeled, nil
+}
+
+// GetLabels gets all the labels of a provider.
+func (c *Client) GetLabels(ctx context.Context, providerID peer.ID) ([]model.Label, error) {
+	u := c.baseURL.JoinPath(labelsPath, providerID.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apierror.FromResponse(resp.StatusCode, body)
+	}
+
+	var labels []model.Label
+	if err = json.Unmarshal(body, &labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// SetLabel sets a label on a provider, replacing any existing label with the
+// same key.
+func (c *Client) SetLabel(ctx context.Context, providerID peer.ID, label model.Label) error {
+	data, err := json.Marshal(&label)
+	if err != nil {
+		return err
+	}
+	u := c.baseURL.JoinPath(labelsPath, providerID.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.doRequest(req)
+}
+
+// DeleteLabel removes a label from a provider.
+func (c *Client) DeleteLabel(ctx context.Context, providerID peer.ID, key string) error {
+	u := c.baseURL.JoinPath(labelsPath, providerID.String())
+	u.RawQuery = url.Values{"key": []string{key}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	return c.doRequest(req)
+}
+
+func (c *Client) doRequest(req *http.Request) error {
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return apierror.FromResponse(resp.StatusCode, body)
+	}
+	return nil
+}
+
+// GetPollStatus gets the polling configuration and status of a provider.
+func (c *Client) GetPollStatus(ctx context.Context, providerID peer.ID) (*model.PollStatus, error) {
+	u := c.baseURL.JoinPath(pollingPath, providerID.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apierror.FromResponse(resp.StatusCode, body)
+	}
+
+	var status model.PollStatus
+	if err = json.Unmarshal(body, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ListPollOverrides gets the polling configuration and status of all
+// providers that have polling overrides.
+func (c *Client) ListPollOverrides(ctx context.Context) ([]model.PollStatus, error) {
+	u := c.baseURL.JoinPath(pollingPath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apierror.FromResponse(resp.StatusCode, body)
+	}
+
+	var statuses []model.PollStatus
+	if err = json.Unmarshal(body, &statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// SetPollOverride sets polling values for a provider that override the
+// indexer's normal polling configuration. The override is persisted by the
+// indexer.
+func (c *Client) SetPollOverride(ctx context.Context, providerID peer.ID, override model.PollOverride) error {
+	data, err := json.Marshal(&override)
+	if err != nil {
+		return err
+	}
+	return c.pollingRequest(ctx, providerID, http.MethodPut, data)
+}
+
+// DeletePollOverride removes a provider's polling override that was set using
+// SetPollOverride.
+func (c *Client) DeletePollOverride(ctx context.Context, providerID peer.ID) error {
+	return c.pollingRequest(ctx, providerID, http.MethodDelete, nil)
+}
+
+func (c *Client) pollingRequest(ctx context.Context, providerID peer.ID, method string, data []byte) error {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewBuffer(data)
+	}
+
+	u := c.baseURL.JoinPath(pollingPath, providerID.String())
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.doRequest(req)
+}
+
 func (c *Client) ListLogSubSystems(ctx context.Context) ([]string, error) {
 	u := c.baseURL.JoinPath("config", "log", "subsystems")
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
@@ -475,6 +724,246 @@ func (c *Client) Status(ctx context.Context) (*model.Status, error) {
 	return &status, nil
 }
 
+// Unfreeze takes a frozen indexer out of frozen mode, and starts re-syncing
+// the advertisements of publishers that were frozen. Use UnfreezeStatus to
+// get the progress of re-syncing.
+func (c *Client) Unfreeze(ctx context.Context) (*model.UnfreezeStatus, error) {
+	return c.unfreezeRequest(ctx, http.MethodPut)
+}
+
+// UnfreezeStatus gets the progress of re-syncing publishers after the indexer
+// was unfrozen.
+func (c *Client) UnfreezeStatus(ctx context.Context) (*model.UnfreezeStatus, error) {
+	return c.unfreezeRequest(ctx, http.MethodGet)
+}
+
+func (c *Client) unfreezeRequest(ctx context.Context, method string) (*model.UnfreezeStatus, error) {
+	u := c.baseURL.JoinPath(unfreezePath)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apierror.FromResponse(resp.StatusCode, body)
+	}
+
+	var status model.UnfreezeStatus
+	if err = json.Unmarshal(body, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Backup starts writing a backup of the running indexer to the indexer's
+// configured backup storage. If name is empty, the indexer names the backup.
+// Ingestion is paused while the backup is written. Use BackupStatus to get
+// the progress of the backup.
+func (c *Client) Backup(ctx context.Context, name string) (*model.BackupStatus, error) {
+	u := c.baseURL.JoinPath(backupPath)
+	if name != "" {
+		q := url.Values{}
+		q.Add("name", name)
+		u.RawQuery = q.Encode()
+	}
+	return c.backupRequest(ctx, http.MethodPut, u)
+}
+
+// BackupStatus gets the progress of the most recent backup.
+func (c *Client) BackupStatus(ctx context.Context) (*model.BackupStatus, error) {
+	return c.backupRequest(ctx, http.MethodGet, c.baseURL.JoinPath(backupPath))
+}
+
+func (c *Client) backupRequest(ctx context.Context, method string, u *url.URL) (*model.BackupStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apierror.FromResponse(resp.StatusCode, body)
+	}
+
+	var status model.BackupStatus
+	if err = json.Unmarshal(body, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ReconcileCounts starts reconciling the indexer's persisted index counts
+// with counts from the source, which is model.ReconcileSourceValueStore or
+// model.ReconcileSourceMirror. If rewrite is true, then persisted counts that
+// differ are corrected. Use ReconcileCountsStatus to get the progress and
+// result of reconciliation.
+func (c *Client) ReconcileCounts(ctx context.Context, source string, rewrite bool) (*model.ReconcileStatus, error) {
+	u := c.baseURL.JoinPath(indexCountsPath, "reconcile")
+	q := url.Values{}
+	if source != "" {
+		q.Add("source", source)
+	}
+	q.Add("rewrite", strconv.FormatBool(rewrite))
+	u.RawQuery = q.Encode()
+	return c.reconcileRequest(ctx, http.MethodPut, u)
+}
+
+// ReconcileCountsStatus gets the progress and result of the most recent index
+// count reconciliation.
+func (c *Client) ReconcileCountsStatus(ctx context.Context) (*model.ReconcileStatus, error) {
+	return c.reconcileRequest(ctx, http.MethodGet, c.baseURL.JoinPath(indexCountsPath, "reconcile"))
+}
+
+func (c *Client) reconcileRequest(ctx context.Context, method string, u *url.URL) (*model.ReconcileStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apierror.FromResponse(resp.StatusCode, body)
+	}
+
+	var status model.ReconcileStatus
+	if err = json.Unmarshal(body, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// RebuildFromMirror starts rebuilding the index of the publisher's
+// advertisement chain from the indexer's advertisement mirror, without
+// contacting the publisher. Use RebuildStatus to get the progress and result
+// of the rebuild.
+func (c *Client) RebuildFromMirror(ctx context.Context, publisherID peer.ID) (*model.RebuildStatus, error) {
+	return c.rebuildRequest(ctx, http.MethodPut, c.baseURL.JoinPath(ingestPath, "rebuild", publisherID.String()))
+}
+
+// RebuildStatus gets the progress and result of the most recent rebuild from
+// the advertisement mirror.
+func (c *Client) RebuildStatus(ctx context.Context) (*model.RebuildStatus, error) {
+	return c.rebuildRequest(ctx, http.MethodGet, c.baseURL.JoinPath(ingestPath, "rebuild"))
+}
+
+func (c *Client) rebuildRequest(ctx context.Context, method string, u *url.URL) (*model.RebuildStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apierror.FromResponse(resp.StatusCode, body)
+	}
+
+	var status model.RebuildStatus
+	if err = json.Unmarshal(body, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ValueStoreGC starts value store garbage collection. If limit is not zero,
+// then garbage collection stops after that amount of time. If throttle is
+// true, garbage collection pauses periodically to let ingestion proceed.
+func (c *Client) ValueStoreGC(ctx context.Context, limit time.Duration, throttle bool) (*model.MaintenanceStatus, error) {
+	return c.startMaintenance(ctx, "gc", limit, throttle)
+}
+
+// ValueStoreCompact starts value store compaction. If limit is not zero, then
+// compaction stops after that amount of time. If throttle is true, compaction
+// pauses periodically to let ingestion proceed.
+func (c *Client) ValueStoreCompact(ctx context.Context, limit time.Duration, throttle bool) (*model.MaintenanceStatus, error) {
+	return c.startMaintenance(ctx, "compact", limit, throttle)
+}
+
+// ValueStoreMaintenance gets the status of value store garbage collection and
+// compaction.
+func (c *Client) ValueStoreMaintenance(ctx context.Context) (*model.MaintenanceStatus, error) {
+	return c.maintenanceRequest(ctx, http.MethodGet, c.baseURL.JoinPath(valueStorePath, "gc"))
+}
+
+func (c *Client) startMaintenance(ctx context.Context, op string, limit time.Duration, throttle bool) (*model.MaintenanceStatus, error) {
+	u := c.baseURL.JoinPath(valueStorePath, op)
+	q := url.Values{}
+	if limit != 0 {
+		q.Add("limit", limit.String())
+	}
+	q.Add("throttle", strconv.FormatBool(throttle))
+	u.RawQuery = q.Encode()
+	return c.maintenanceRequest(ctx, http.MethodPut, u)
+}
+
+func (c *Client) maintenanceRequest(ctx context.Context, method string, u *url.URL) (*model.MaintenanceStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apierror.FromResponse(resp.StatusCode, body)
+	}
+
+	var status model.MaintenanceStatus
+	if err = json.Unmarshal(body, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
 func (c *Client) ingestRequest(ctx context.Context, peerID peer.ID, action, method string, data []byte, queryPairs ...string) error {
 	var body io.Reader
 	if data != nil {
@@ -1,6 +1,9 @@
 package model
 
 import (
+	"time"
+
+	"github.com/ipni/storetheindex/config"
 	"github.com/libp2p/go-libp2p/core/peer"
 )
 
@@ -18,4 +21,186 @@ type Status struct {
 	Frozen bool
 	ID     peer.ID
 	Usage  float64
+	// PressureLevel is the current disk pressure level. Level 0 means there
+	// is no disk pressure.
+	PressureLevel int
+}
+
+// UnfreezeStatus reports the progress of re-syncing publishers after the
+// indexer is unfrozen.
+type UnfreezeStatus struct {
+	// Running is true while publishers are being re-synced.
+	Running  bool
+	Started  time.Time
+	Finished *time.Time `json:",omitempty"`
+	// Publishers is the number of publishers to re-sync.
+	Publishers int
+	// Synced is the number of publishers re-synced successfully.
+	Synced int
+	// Errors holds a message for each publisher that failed to re-sync.
+	Errors []string `json:",omitempty"`
+}
+
+// BackupStatus reports the progress of a backup of a running indexer.
+type BackupStatus struct {
+	// Name is the name of the backup.
+	Name string
+	// Running is true while the backup is being written.
+	Running  bool
+	Started  time.Time
+	Finished *time.Time `json:",omitempty"`
+	// Publishers is the number of publishers whose latest advertisement was
+	// recorded in the backup.
+	Publishers int
+	// DatastoreKeys is the number of datastore keys backed up.
+	DatastoreKeys uint64
+	// ValueStoreFiles is the number of value store files backed up.
+	ValueStoreFiles int
+	// Error describes why the backup failed.
+	Error string `json:",omitempty"`
+}
+
+// Sources of index counts used to reconcile the persisted index counts.
+const (
+	// ReconcileSourceValueStore counts indexes by iterating the value store.
+	ReconcileSourceValueStore = "valuestore"
+	// ReconcileSourceMirror counts indexes by reading advertisement chains
+	// from the CAR mirror.
+	ReconcileSourceMirror = "mirror"
+)
+
+// CountDiscrepancy is a difference between a persisted index count and the
+// count from the reconciliation source.
+type CountDiscrepancy struct {
+	ProviderID peer.ID
+	// ContextID is omitted for provider totals.
+	ContextID []byte `json:",omitempty"`
+	Stored    uint64
+	Actual    uint64
+}
+
+// ReconcileStatus reports the progress of reconciling the persisted index
+// counts with counts from an authoritative source.
+type ReconcileStatus struct {
+	// Source is "valuestore" or "mirror".
+	Source string
+	// Rewrite is true if persisted counts that differ are corrected.
+	Rewrite  bool
+	Running  bool
+	Started  time.Time
+	Finished *time.Time `json:",omitempty"`
+	// Providers is the number of providers reconciled.
+	Providers int
+	// Contexts is the number of provider context IDs reconciled.
+	Contexts int
+	// Discrepancies is the number of context IDs with discrepancies.
+	Discrepancies int
+	// ProviderDiscrepancies lists the provider totals that differ.
+	ProviderDiscrepancies []CountDiscrepancy `json:",omitempty"`
+	// ContextDiscrepancies lists some of the context ID counts that differ.
+	ContextDiscrepancies []CountDiscrepancy `json:",omitempty"`
+	// Skipped lists providers not reconciled because the source does not
+	// have complete counts for them.
+	Skipped []peer.ID `json:",omitempty"`
+	// Rewritten is the number of persisted counts corrected.
+	Rewritten int
+	// Changed is the number of counts not corrected because ingestion
+	// changed them during reconciliation.
+	Changed int
+	// Error describes why reconciliation failed.
+	Error string `json:",omitempty"`
+}
+
+// RebuildStatus reports the progress of rebuilding a publisher's index from
+// the advertisement mirror.
+type RebuildStatus struct {
+	Publisher peer.ID
+	Running   bool
+	Started   time.Time
+	Finished  *time.Time `json:",omitempty"`
+	// Ads is the number of advertisements in the mirrored chain.
+	Ads int
+	// Indexed is the number of advertisements whose entries were indexed.
+	Indexed int
+	// Removals is the number of removal advertisements applied.
+	Removals int
+	// Skipped is the number of advertisements not indexed because their
+	// context ID is removed by a later advertisement.
+	Skipped int
+	// NoEntries is the number of advertisements without entries in the
+	// mirror.
+	NoEntries int
+	// Multihashes is the number of multihashes indexed.
+	Multihashes int
+	// Error describes why the rebuild failed.
+	Error string `json:",omitempty"`
+}
+
+// MaintenanceRun describes a run of value store garbage collection or
+// compaction.
+type MaintenanceRun struct {
+	// Operation is "gc" or "compact".
+	Operation string
+	Running   bool
+	Started   time.Time
+	Finished  *time.Time `json:",omitempty"`
+	// TimeLimit is the maximum duration of the run, if limited.
+	TimeLimit config.Duration `json:",omitempty"`
+	// Throttled is true if the run pauses periodically to let ingestion
+	// proceed.
+	Throttled bool
+	// LimitReached is true if the run stopped at its time limit.
+	LimitReached bool `json:",omitempty"`
+	// BytesReclaimed is the reduction in size of the value store directory.
+	BytesReclaimed int64
+	// Error describes why the run failed.
+	Error string `json:",omitempty"`
+}
+
+// MaintenanceStatus reports the value store maintenance operations that are
+// supported, and the state of the current and last runs.
+type MaintenanceStatus struct {
+	GCSupported      bool
+	CompactSupported bool
+	Current          *MaintenanceRun `json:",omitempty"`
+	Last             *MaintenanceRun `json:",omitempty"`
+}
+
+// PollOverride holds polling values that override the indexer's normal
+// polling configuration for a provider. Zero values use the normal values.
+type PollOverride struct {
+	Interval        config.Duration `json:",omitempty"`
+	RetryAfter      config.Duration `json:",omitempty"`
+	StopAfter       config.Duration `json:",omitempty"`
+	DeactivateAfter config.Duration `json:",omitempty"`
+}
+
+// PollStatus is the effective polling configuration of a provider, and when
+// polling takes action if there is no further contact from the provider's
+// publisher.
+type PollStatus struct {
+	ProviderID      peer.ID
+	Override        bool
+	Persisted       bool
+	Interval        config.Duration
+	RetryAfter      config.Duration
+	StopAfter       config.Duration
+	DeactivateAfter config.Duration
+	LastContact     *time.Time `json:",omitempty"`
+	NextPoll        *time.Time `json:",omitempty"`
+	Deactivate      *time.Time `json:",omitempty"`
+	Remove          *time.Time `json:",omitempty"`
+}
+
+// Label is an operator-defined value attached to a provider.
+type Label struct {
+	Key    string
+	Value  string
+	Public bool `json:",omitempty"`
+}
+
+// ProviderLabels holds all the labels of a provider.
+type ProviderLabels struct {
+	ProviderID peer.ID
+	Labels     []Label
 }
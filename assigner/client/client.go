@@ -0,0 +1,244 @@
+// Package client is an HTTP client for the assigner service admin API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ipni/go-libipni/apierror"
+	assignerconfig "github.com/ipni/storetheindex/assigner/config"
+	"github.com/ipni/storetheindex/assigner/core"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	assignPath       = "assign"
+	assignmentsPath  = "assignments"
+	countsPath       = "counts"
+	drainPath        = "drain"
+	eventsPath       = "events"
+	indexersPath     = "indexers"
+	movePath         = "move"
+	pollPath         = "poll"
+	rebalancePath    = "rebalance"
+	reloadConfigPath = "reloadconfig"
+	unassignPath     = "unassign"
+)
+
+// Client is an http client for the assigner admin API.
+type Client struct {
+	c       *http.Client
+	baseURL *url.URL
+}
+
+// New creates a new assigner admin HTTP client.
+func New(baseURL string, options ...Option) (*Client, error) {
+	opts, err := getOpts(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "http://" + baseURL
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = ""
+
+	return &Client{
+		c:       opts.httpClient,
+		baseURL: u,
+	}, nil
+}
+
+// Assignments returns the indexers that each publisher is assigned to.
+func (c *Client) Assignments(ctx context.Context) (map[peer.ID][]int, error) {
+	var assignments map[peer.ID][]int
+	err := c.request(ctx, http.MethodGet, c.baseURL.JoinPath(assignmentsPath), nil, &assignments)
+	if err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+// Assigned returns the indexers that the publisher is assigned to.
+func (c *Client) Assigned(ctx context.Context, pubID peer.ID) ([]int, error) {
+	var indexers []int
+	err := c.request(ctx, http.MethodGet, c.baseURL.JoinPath(assignmentsPath, pubID.String()), nil, &indexers)
+	if err != nil {
+		return nil, err
+	}
+	return indexers, nil
+}
+
+// Assign assigns the publisher to the indexer at the given position in the
+// assigner's indexer pool.
+func (c *Client) Assign(ctx context.Context, pubID peer.ID, indexerNum int) error {
+	u := c.baseURL.JoinPath(assignPath, pubID.String())
+	u.RawQuery = url.Values{"indexer": {strconv.Itoa(indexerNum)}}.Encode()
+	return c.request(ctx, http.MethodPut, u, nil, nil)
+}
+
+// Unassign unassigns the publisher from the indexer at the given position in
+// the assigner's indexer pool.
+func (c *Client) Unassign(ctx context.Context, pubID peer.ID, indexerNum int) error {
+	u := c.baseURL.JoinPath(unassignPath, pubID.String())
+	u.RawQuery = url.Values{"indexer": {strconv.Itoa(indexerNum)}}.Encode()
+	return c.request(ctx, http.MethodPut, u, nil, nil)
+}
+
+// Move moves the publisher from one indexer to another, where each indexer is
+// identified by its position in the assigner's indexer pool.
+func (c *Client) Move(ctx context.Context, pubID peer.ID, from, to int) error {
+	u := c.baseURL.JoinPath(movePath, pubID.String())
+	u.RawQuery = url.Values{
+		"from": {strconv.Itoa(from)},
+		"to":   {strconv.Itoa(to)},
+	}.Encode()
+	return c.request(ctx, http.MethodPost, u, nil, nil)
+}
+
+// Counts returns the number of publishers assigned to each indexer in the
+// assigner's indexer pool.
+func (c *Client) Counts(ctx context.Context) ([]int, error) {
+	var counts []int
+	if err := c.request(ctx, http.MethodGet, c.baseURL.JoinPath(countsPath), nil, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// Indexers returns information about each indexer in the assigner's pool.
+func (c *Client) Indexers(ctx context.Context) ([]core.Indexer, error) {
+	var indexers []core.Indexer
+	if err := c.request(ctx, http.MethodGet, c.baseURL.JoinPath(indexersPath), nil, &indexers); err != nil {
+		return nil, err
+	}
+	return indexers, nil
+}
+
+// Indexer returns information about the indexer at the given position in the
+// assigner's pool, including the publishers assigned to it.
+func (c *Client) Indexer(ctx context.Context, indexerNum int) (*core.Indexer, error) {
+	var indexer core.Indexer
+	u := c.baseURL.JoinPath(indexersPath, strconv.Itoa(indexerNum))
+	if err := c.request(ctx, http.MethodGet, u, nil, &indexer); err != nil {
+		return nil, err
+	}
+	return &indexer, nil
+}
+
+// Drain moves all publishers off of the indexer at the given position in the
+// assigner's pool, and returns the moves that were done or attempted.
+func (c *Client) Drain(ctx context.Context, indexerNum int) ([]core.Move, error) {
+	var moves []core.Move
+	u := c.baseURL.JoinPath(drainPath, strconv.Itoa(indexerNum))
+	if err := c.request(ctx, http.MethodPost, u, nil, &moves); err != nil {
+		return nil, err
+	}
+	return moves, nil
+}
+
+// Events returns the assigner's most recent indexer health and replication
+// events, oldest first.
+func (c *Client) Events(ctx context.Context) ([]core.Event, error) {
+	var events []core.Event
+	if err := c.request(ctx, http.MethodGet, c.baseURL.JoinPath(eventsPath), nil, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// PollNow tells the assigner to poll its indexers immediately.
+func (c *Client) PollNow(ctx context.Context) error {
+	return c.request(ctx, http.MethodPost, c.baseURL.JoinPath(pollPath), nil, nil)
+}
+
+// Rebalance moves publishers from over-loaded to under-loaded indexers. If
+// dryRun is true, then the planned moves are returned without moving any
+// publishers.
+func (c *Client) Rebalance(ctx context.Context, dryRun bool) (*core.Rebalance, error) {
+	u := c.baseURL.JoinPath(rebalancePath)
+	if dryRun {
+		u.RawQuery = url.Values{"dryrun": {"true"}}.Encode()
+	}
+	var rebal core.Rebalance
+	if err := c.request(ctx, http.MethodPost, u, nil, &rebal); err != nil {
+		return nil, err
+	}
+	return &rebal, nil
+}
+
+// AddIndexer adds an indexer to the assigner's indexer pool, and returns the
+// information about the added indexer.
+func (c *Client) AddIndexer(ctx context.Context, cfgIndexer assignerconfig.Indexer) (*core.Indexer, error) {
+	data, err := json.Marshal(&cfgIndexer)
+	if err != nil {
+		return nil, err
+	}
+	var indexer core.Indexer
+	if err = c.request(ctx, http.MethodPost, c.baseURL.JoinPath(indexersPath), data, &indexer); err != nil {
+		return nil, err
+	}
+	return &indexer, nil
+}
+
+// RetireIndexer moves all publishers off of the indexer at the given position
+// in the assigner's pool, and then removes the indexer from the pool.
+func (c *Client) RetireIndexer(ctx context.Context, indexerNum int) ([]core.Move, error) {
+	var moves []core.Move
+	u := c.baseURL.JoinPath(indexersPath, strconv.Itoa(indexerNum))
+	if err := c.request(ctx, http.MethodDelete, u, nil, &moves); err != nil {
+		return nil, err
+	}
+	return moves, nil
+}
+
+// ReloadConfig tells the assigner to reload its configuration file, which
+// adds and retires indexers to match the configured indexer pool.
+func (c *Client) ReloadConfig(ctx context.Context) error {
+	return c.request(ctx, http.MethodPost, c.baseURL.JoinPath(reloadConfigPath), nil, nil)
+}
+
+// request sends a request to the assigner and decodes the JSON response into
+// result, if result is not nil.
+func (c *Client) request(ctx context.Context, method string, u *url.URL, data []byte, result any) error {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return apierror.FromResponse(resp.StatusCode, respData)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(respData, result)
+}
@@ -0,0 +1,532 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ipni/storetheindex/assigner/client"
+	"github.com/ipni/storetheindex/assigner/config"
+	"github.com/ipni/storetheindex/assigner/core"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/urfave/cli/v2"
+)
+
+var AdminCmd = &cli.Command{
+	Name:  "admin",
+	Usage: "Perform admin activities with an assigner service",
+	Subcommands: []*cli.Command{
+		addIndexerCmd,
+		assignCmd,
+		assignmentsCmd,
+		countsCmd,
+		drainCmd,
+		eventsCmd,
+		indexersCmd,
+		moveCmd,
+		pollCmd,
+		rebalanceCmd,
+		reloadConfigCmd,
+		retireIndexerCmd,
+		unassignCmd,
+	},
+}
+
+var assignerHostFlag = &cli.StringFlag{
+	Name:    "assigner",
+	Usage:   "Host or host:port of assigner admin API",
+	EnvVars: []string{"ASSIGNER_ADMIN"},
+	Aliases: []string{"a"},
+	Value:   "localhost:3002",
+}
+
+var publisherFlag = &cli.StringFlag{
+	Name:     "publisher",
+	Usage:    "Publisher peer ID",
+	Aliases:  []string{"p"},
+	Required: true,
+}
+
+var indexerFlag = &cli.IntFlag{
+	Name:     "indexer",
+	Usage:    "Position of indexer in assigner's indexer pool",
+	Aliases:  []string{"i"},
+	Required: true,
+}
+
+var assignmentsCmd = &cli.Command{
+	Name:  "assignments",
+	Usage: "List the indexers that publishers are assigned to",
+	Flags: []cli.Flag{
+		assignerHostFlag,
+		&cli.StringFlag{
+			Name:    "publisher",
+			Usage:   "Only show assignments for this publisher",
+			Aliases: []string{"p"},
+		},
+	},
+	Action: assignmentsAction,
+}
+
+var assignCmd = &cli.Command{
+	Name:   "assign",
+	Usage:  "Assign a publisher to an indexer",
+	Flags:  []cli.Flag{assignerHostFlag, publisherFlag, indexerFlag},
+	Action: assignAction,
+}
+
+var unassignCmd = &cli.Command{
+	Name:  "unassign",
+	Usage: "Unassign a publisher from an indexer",
+	Description: "If this leaves the publisher assigned to fewer indexers than required, then the assigner " +
+		"assigns the publisher to another indexer when it next receives an announce from the publisher.",
+	Flags:  []cli.Flag{assignerHostFlag, publisherFlag, indexerFlag},
+	Action: unassignAction,
+}
+
+var moveCmd = &cli.Command{
+	Name:  "move",
+	Usage: "Move a publisher from one indexer to another",
+	Description: "The publisher is handed off to the indexer it is moved to, which continues indexing from " +
+		"where the indexer it is moved from left off. The publisher is then unassigned from the indexer it " +
+		"is moved from.",
+	Flags: []cli.Flag{
+		assignerHostFlag,
+		publisherFlag,
+		&cli.IntFlag{
+			Name:     "from",
+			Usage:    "Position of indexer to move publisher from",
+			Required: true,
+		},
+		&cli.IntFlag{
+			Name:     "to",
+			Usage:    "Position of indexer to move publisher to",
+			Required: true,
+		},
+	},
+	Action: moveAction,
+}
+
+var countsCmd = &cli.Command{
+	Name:   "counts",
+	Usage:  "Show the number of publishers assigned to each indexer",
+	Flags:  []cli.Flag{assignerHostFlag},
+	Action: countsAction,
+}
+
+var indexersCmd = &cli.Command{
+	Name:  "indexers",
+	Usage: "Show the indexers in the assigner's indexer pool",
+	Flags: []cli.Flag{
+		assignerHostFlag,
+		&cli.IntFlag{
+			Name:    "indexer",
+			Usage:   "Only show this indexer, and the publishers assigned to it",
+			Aliases: []string{"i"},
+		},
+	},
+	Action: indexersAction,
+}
+
+var drainCmd = &cli.Command{
+	Name:  "drain",
+	Usage: "Move all publishers off of an indexer",
+	Description: "Hands off each publisher assigned to the indexer to another indexer, and stops assigning " +
+		"publishers to the drained indexer until the assigner is restarted.",
+	Flags:  []cli.Flag{assignerHostFlag, indexerFlag},
+	Action: drainAction,
+}
+
+var addIndexerCmd = &cli.Command{
+	Name:  "add-indexer",
+	Usage: "Add an indexer to the assigner's indexer pool",
+	Description: "The assigner reads the indexer's existing assignments and starts assigning publishers to " +
+		"the indexer. The new indexer pool is saved to the assigner's config file.",
+	Flags: []cli.Flag{
+		assignerHostFlag,
+		&cli.StringFlag{
+			Name:     "admin-url",
+			Usage:    "URL of the indexer's admin API",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "find-url",
+			Usage:    "URL of the indexer's find API",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "ingest-url",
+			Usage:    "URL of the indexer's ingest API",
+			Required: true,
+		},
+		&cli.StringSliceFlag{
+			Name:  "preset",
+			Usage: "Peer ID of publisher to always assign to the indexer. Can be specified multiple times",
+		},
+	},
+	Action: addIndexerAction,
+}
+
+var retireIndexerCmd = &cli.Command{
+	Name:  "retire-indexer",
+	Usage: "Move all publishers off of an indexer and remove it from the indexer pool",
+	Description: "Hands off each publisher assigned to the indexer to another indexer. When all publishers " +
+		"are moved, the indexer is removed from the pool and the new indexer pool is saved to the " +
+		"assigner's config file. The positions of the other indexers do not change.",
+	Flags:  []cli.Flag{assignerHostFlag, indexerFlag},
+	Action: retireIndexerAction,
+}
+
+var reloadConfigCmd = &cli.Command{
+	Name:  "reload-config",
+	Usage: "Reload the assigner's config file",
+	Description: "Reloads the logging configuration and the indexer pool. Indexers in the config file that " +
+		"are not in the pool are added, and indexers in the pool that are not in the config file are retired.",
+	Flags:  []cli.Flag{assignerHostFlag},
+	Action: reloadConfigAction,
+}
+
+var eventsCmd = &cli.Command{
+	Name:  "events",
+	Usage: "Show recent indexer health and replication events",
+	Description: "Shows when indexers became unreachable, down, or recovered, and the publishers that were " +
+		"assigned to other indexers to restore replication or unassigned from recovered indexers.",
+	Flags: []cli.Flag{
+		assignerHostFlag,
+		&cli.IntFlag{
+			Name:    "indexer",
+			Usage:   "Only show events for this indexer",
+			Aliases: []string{"i"},
+		},
+	},
+	Action: eventsAction,
+}
+
+var pollCmd = &cli.Command{
+	Name:   "poll",
+	Usage:  "Poll the indexers in the pool for their status immediately",
+	Flags:  []cli.Flag{assignerHostFlag},
+	Action: pollAction,
+}
+
+var rebalanceCmd = &cli.Command{
+	Name:  "rebalance",
+	Usage: "Move publishers from over-loaded indexers to under-loaded indexers",
+	Flags: []cli.Flag{
+		assignerHostFlag,
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only show the planned moves",
+		},
+	},
+	Action: rebalanceAction,
+}
+
+func assignmentsAction(cctx *cli.Context) error {
+	cl, err := client.New(cctx.String("assigner"))
+	if err != nil {
+		return err
+	}
+	if cctx.IsSet("publisher") {
+		pubID, err := peer.Decode(cctx.String("publisher"))
+		if err != nil {
+			return fmt.Errorf("bad publisher id: %w", err)
+		}
+		indexers, err := cl.Assigned(cctx.Context, pubID)
+		if err != nil {
+			return err
+		}
+		fmt.Println(pubID, "indexers:", indexers)
+		return nil
+	}
+
+	assignments, err := cl.Assignments(cctx.Context)
+	if err != nil {
+		return err
+	}
+	if len(assignments) == 0 {
+		fmt.Println("No assignments")
+		return nil
+	}
+	pubIDs := make([]peer.ID, 0, len(assignments))
+	for pubID := range assignments {
+		pubIDs = append(pubIDs, pubID)
+	}
+	sort.Slice(pubIDs, func(i, j int) bool { return pubIDs[i] < pubIDs[j] })
+	for _, pubID := range pubIDs {
+		fmt.Println(pubID, "indexers:", assignments[pubID])
+	}
+	return nil
+}
+
+func assignAction(cctx *cli.Context) error {
+	cl, err := client.New(cctx.String("assigner"))
+	if err != nil {
+		return err
+	}
+	pubID, err := peer.Decode(cctx.String("publisher"))
+	if err != nil {
+		return fmt.Errorf("bad publisher id: %w", err)
+	}
+	if err = cl.Assign(cctx.Context, pubID, cctx.Int("indexer")); err != nil {
+		return err
+	}
+	fmt.Println("Assigned", pubID, "to indexer", cctx.Int("indexer"))
+	return nil
+}
+
+func unassignAction(cctx *cli.Context) error {
+	cl, err := client.New(cctx.String("assigner"))
+	if err != nil {
+		return err
+	}
+	pubID, err := peer.Decode(cctx.String("publisher"))
+	if err != nil {
+		return fmt.Errorf("bad publisher id: %w", err)
+	}
+	if err = cl.Unassign(cctx.Context, pubID, cctx.Int("indexer")); err != nil {
+		return err
+	}
+	fmt.Println("Unassigned", pubID, "from indexer", cctx.Int("indexer"))
+	return nil
+}
+
+func moveAction(cctx *cli.Context) error {
+	cl, err := client.New(cctx.String("assigner"))
+	if err != nil {
+		return err
+	}
+	pubID, err := peer.Decode(cctx.String("publisher"))
+	if err != nil {
+		return fmt.Errorf("bad publisher id: %w", err)
+	}
+	if err = cl.Move(cctx.Context, pubID, cctx.Int("from"), cctx.Int("to")); err != nil {
+		return err
+	}
+	fmt.Println("Moved", pubID, "from indexer", cctx.Int("from"), "to indexer", cctx.Int("to"))
+	return nil
+}
+
+func countsAction(cctx *cli.Context) error {
+	cl, err := client.New(cctx.String("assigner"))
+	if err != nil {
+		return err
+	}
+	counts, err := cl.Counts(cctx.Context)
+	if err != nil {
+		return err
+	}
+	for i, count := range counts {
+		fmt.Printf("Indexer %d: %d publishers\n", i, count)
+	}
+	return nil
+}
+
+func indexersAction(cctx *cli.Context) error {
+	cl, err := client.New(cctx.String("assigner"))
+	if err != nil {
+		return err
+	}
+	if cctx.IsSet("indexer") {
+		indexer, err := cl.Indexer(cctx.Context, cctx.Int("indexer"))
+		if err != nil {
+			return err
+		}
+		printIndexer(indexer)
+		if len(indexer.Publishers) != 0 {
+			fmt.Println("  Publishers:")
+			for _, pubID := range indexer.Publishers {
+				fmt.Println("   ", pubID)
+			}
+		}
+		return nil
+	}
+
+	indexers, err := cl.Indexers(cctx.Context)
+	if err != nil {
+		return err
+	}
+	for i := range indexers {
+		printIndexer(&indexers[i])
+	}
+	return nil
+}
+
+func printIndexer(indexer *core.Indexer) {
+	fmt.Printf("Indexer %d:\n", indexer.Num)
+	if indexer.ID.Validate() == nil {
+		fmt.Println("  ID:        ", indexer.ID)
+	}
+	fmt.Println("  AdminURL:  ", indexer.AdminURL)
+	fmt.Println("  Online:    ", indexer.Online)
+	fmt.Println("  Frozen:    ", indexer.Frozen)
+	fmt.Println("  Draining:  ", indexer.Draining)
+	if indexer.Retired {
+		fmt.Println("  Retired:    true")
+	}
+	if indexer.Down {
+		fmt.Println("  Health:     down")
+	} else if indexer.Unreachable {
+		fmt.Println("  Health:     unreachable")
+	}
+	fmt.Println("  Assigned:  ", indexer.Assigned)
+	if indexer.Usage < 0 {
+		fmt.Println("  Usage:      not available")
+	} else {
+		fmt.Printf("  Usage:       %0.2f%%\n", indexer.Usage)
+	}
+	fmt.Println("  IndexCount:", indexer.IndexCount)
+}
+
+func drainAction(cctx *cli.Context) error {
+	cl, err := client.New(cctx.String("assigner"))
+	if err != nil {
+		return err
+	}
+	indexerNum := cctx.Int("indexer")
+	fmt.Println("Draining indexer", indexerNum)
+	moves, err := cl.Drain(cctx.Context, indexerNum)
+	if err != nil {
+		return err
+	}
+	moved := printMoves(moves)
+	fmt.Printf("Moved %d out of %d publishers from indexer %d\n", moved, len(moves), indexerNum)
+	return nil
+}
+
+func addIndexerAction(cctx *cli.Context) error {
+	cl, err := client.New(cctx.String("assigner"))
+	if err != nil {
+		return err
+	}
+	presets := cctx.StringSlice("preset")
+	for _, preset := range presets {
+		if _, err = peer.Decode(preset); err != nil {
+			return fmt.Errorf("bad preset publisher id %s: %w", preset, err)
+		}
+	}
+	indexer, err := cl.AddIndexer(cctx.Context, config.Indexer{
+		AdminURL:    cctx.String("admin-url"),
+		FindURL:     cctx.String("find-url"),
+		IngestURL:   cctx.String("ingest-url"),
+		PresetPeers: presets,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("Added indexer to pool")
+	printIndexer(indexer)
+	return nil
+}
+
+func retireIndexerAction(cctx *cli.Context) error {
+	cl, err := client.New(cctx.String("assigner"))
+	if err != nil {
+		return err
+	}
+	indexerNum := cctx.Int("indexer")
+	fmt.Println("Retiring indexer", indexerNum)
+	moves, err := cl.RetireIndexer(cctx.Context, indexerNum)
+	if err != nil {
+		return err
+	}
+	printMoves(moves)
+	fmt.Println("Retired indexer", indexerNum)
+	return nil
+}
+
+func reloadConfigAction(cctx *cli.Context) error {
+	cl, err := client.New(cctx.String("assigner"))
+	if err != nil {
+		return err
+	}
+	if err = cl.ReloadConfig(cctx.Context); err != nil {
+		return err
+	}
+	fmt.Println("Reloaded assigner config")
+	return nil
+}
+
+func eventsAction(cctx *cli.Context) error {
+	cl, err := client.New(cctx.String("assigner"))
+	if err != nil {
+		return err
+	}
+	events, err := cl.Events(cctx.Context)
+	if err != nil {
+		return err
+	}
+	var count int
+	for _, event := range events {
+		if cctx.IsSet("indexer") && event.Indexer != cctx.Int("indexer") {
+			continue
+		}
+		line := fmt.Sprintf("%s %s indexer=%d", event.Time.Format(time.RFC3339), event.Type, event.Indexer)
+		if event.Publisher.Validate() == nil {
+			line += " publisher=" + event.Publisher.String()
+		}
+		if event.Message != "" {
+			line += " " + event.Message
+		}
+		fmt.Println(line)
+		count++
+	}
+	if count == 0 {
+		fmt.Println("No events")
+	}
+	return nil
+}
+
+func pollAction(cctx *cli.Context) error {
+	cl, err := client.New(cctx.String("assigner"))
+	if err != nil {
+		return err
+	}
+	if err = cl.PollNow(cctx.Context); err != nil {
+		return err
+	}
+	fmt.Println("Polled indexers")
+	return nil
+}
+
+func rebalanceAction(cctx *cli.Context) error {
+	cl, err := client.New(cctx.String("assigner"))
+	if err != nil {
+		return err
+	}
+	dryRun := cctx.Bool("dry-run")
+	rebal, err := cl.Rebalance(cctx.Context, dryRun)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Publishers per indexer before:", rebal.Before)
+	fmt.Println("Publishers per indexer after: ", rebal.After)
+	if len(rebal.Moves) == 0 {
+		fmt.Println("Indexers are balanced")
+		return nil
+	}
+	if dryRun {
+		for _, mv := range rebal.Moves {
+			fmt.Println("Move", mv.Publisher, "from indexer", mv.From, "to indexer", mv.To)
+		}
+		return nil
+	}
+	printMoves(rebal.Moves)
+	fmt.Printf("Moved %d out of %d publishers\n", rebal.Moved, len(rebal.Moves))
+	return nil
+}
+
+// printMoves prints the result of each move, and returns the number of
+// publishers moved.
+func printMoves(moves []core.Move) int {
+	var moved int
+	for _, mv := range moves {
+		if mv.Done {
+			fmt.Println("Moved", mv.Publisher, "from indexer", mv.From, "to indexer", mv.To)
+			moved++
+		} else {
+			fmt.Println("Could not move", mv.Publisher, "from indexer", mv.From, "error:", mv.Error)
+		}
+	}
+	return moved
+}
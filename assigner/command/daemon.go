@@ -1,10 +1,14 @@
 package command
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipfs/kubo/core/bootstrap"
@@ -13,6 +17,7 @@ import (
 	"github.com/ipni/storetheindex/assigner/config"
 	"github.com/ipni/storetheindex/assigner/core"
 	server "github.com/ipni/storetheindex/assigner/server"
+	adminserver "github.com/ipni/storetheindex/assigner/server/admin"
 	sticfg "github.com/ipni/storetheindex/config"
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/host"
@@ -146,6 +151,28 @@ func daemonAction(cctx *cli.Context) error {
 		}
 	}
 
+	reloadErrsChan := make(chan chan error, 1)
+
+	// Create admin HTTP server
+	var adminServer *adminserver.Server
+	adminAddr := cfg.Daemon.AdminAddr
+	if cctx.String("listen-admin") != "" {
+		adminAddr = cctx.String("listen-admin")
+	}
+	if adminAddr != "none" {
+		adminNetAddr, err := mautil.MultiaddrStringToNetAddr(adminAddr)
+		if err != nil {
+			return fmt.Errorf("bad admin address %s: %w", adminAddr, err)
+		}
+
+		adminServer, err = adminserver.New(adminNetAddr.String(), assigner,
+			adminserver.WithReload(reloadErrsChan),
+			adminserver.WithSavePool(saveIndexerPool))
+		if err != nil {
+			return err
+		}
+	}
+
 	svrErrChan := make(chan error, 3)
 
 	log.Info("Starting http servers")
@@ -157,6 +184,23 @@ func daemonAction(cctx *cli.Context) error {
 	} else {
 		fmt.Println("http server:\t disabled")
 	}
+	if adminServer != nil {
+		go func() {
+			svrErrChan <- adminServer.Start()
+		}()
+		fmt.Println("admin server:\t", adminAddr)
+	} else {
+		fmt.Println("admin server:\t disabled")
+	}
+
+	reloadSig := make(chan os.Signal, 1)
+	signal.Notify(reloadSig, syscall.SIGHUP)
+
+	// Reloads run outside of the main loop, since changing the indexer pool
+	// can take a long time, and are canceled when the daemon shuts down.
+	reloadCtx, reloadCancel := context.WithCancel(cctx.Context)
+	var reloadMutex sync.Mutex
+	var reloadWG sync.WaitGroup
 
 	// Output message to user (not to log).
 	fmt.Println("Daemon is ready")
@@ -170,8 +214,30 @@ func daemonAction(cctx *cli.Context) error {
 		case err = <-svrErrChan:
 			finalErr = fmt.Errorf("failed to start server: %w", err)
 			endDaemon = true
+		case <-reloadSig:
+			reloadErrsChan <- nil
+		case errChan := <-reloadErrsChan:
+			// A reload has been triggered by putting either an error channel
+			// or nil on reloadErrsChan. If the reload signaler wants to know
+			// if an error occurred, then the error channel is not nil.
+			reloadWG.Add(1)
+			go func() {
+				defer reloadWG.Done()
+				reloadMutex.Lock()
+				defer reloadMutex.Unlock()
+				err := reloadConfig(reloadCtx, assigner)
+				if err != nil {
+					log.Errorw("Error reloading config", "err", err)
+				}
+				if errChan != nil {
+					errChan <- err
+				}
+			}()
 		}
 	}
+	signal.Stop(reloadSig)
+	reloadCancel()
+	reloadWG.Wait()
 
 	log.Infow("Shutting down daemon")
 
@@ -181,6 +247,12 @@ func daemonAction(cctx *cli.Context) error {
 		}
 	}
 
+	if adminServer != nil {
+		if err = adminServer.Close(); err != nil {
+			finalErr = fmt.Errorf("error shutting down admin server: %w", err)
+		}
+	}
+
 	if err = assigner.Close(); err != nil {
 		finalErr = fmt.Errorf("error closing assigner: %w", err)
 	}
@@ -206,6 +278,34 @@ func setLoggingConfig(cfgLogging config.Logging) error {
 	return nil
 }
 
+// reloadConfig reads the config file and applies the reloadable values. The
+// assigner's indexer pool is changed to match the configured indexer pool.
+func reloadConfig(ctx context.Context, assigner *core.Assigner) error {
+	cfg, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+	if err = setLoggingConfig(cfg.Logging); err != nil {
+		return fmt.Errorf("cannot set logging config: %w", err)
+	}
+	if err = assigner.SetIndexerPool(ctx, cfg.Assignment.IndexerPool); err != nil {
+		return fmt.Errorf("cannot update indexer pool: %w", err)
+	}
+	log.Info("Reloaded reloadable values from configuration")
+	return nil
+}
+
+// saveIndexerPool writes the indexer pool to the config file, so that changes
+// made to the pool using the admin API are kept when the assigner restarts.
+func saveIndexerPool(cfgIndexerPool []config.Indexer) error {
+	cfg, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+	cfg.Assignment.IndexerPool = cfgIndexerPool
+	return cfg.Save("")
+}
+
 func loadConfig(filePath string) (*config.Config, error) {
 	cfg, err := config.Load(filePath)
 	if err != nil {
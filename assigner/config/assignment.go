@@ -13,6 +13,15 @@ type Assignment struct {
 	// FilterIPs, when true, removes any private, loopback, or unspecified IP
 	// addresses from provider and publisher addresses.
 	FilterIPs bool
+	// Health configures checking the health of indexers, and restoring the
+	// replication of publishers assigned to indexers that are down.
+	Health Health
+	// IndexCountWeight is how much an indexer's index count, relative to the
+	// other indexers in the pool, counts towards its free capacity. The rest
+	// of the free capacity is from the indexer's free value store disk space.
+	// Must be between 0 and 1. A value of 0 selects indexers using only disk
+	// usage.
+	IndexCountWeight float64
 	// PoolInterval is how often to poll indexers for status.
 	PollInterval sticfg.Duration
 	// IndexerPool is the set of indexers the pool.
@@ -22,6 +31,9 @@ type Assignment struct {
 	// PubSubTopic sets the topic name to which to subscribe for ingestion
 	// announcements.
 	PubSubTopic string
+	// Rebalance configures moving publishers from over-loaded to under-loaded
+	// indexers.
+	Rebalance Rebalance
 	// PresetReplication is the number of pre-assigned indexers to assign a
 	// publisher to. See Indexer.PresetPeers. Any value < 1 defaults to 1.
 	PresetReplication int
@@ -29,6 +41,10 @@ type Assignment struct {
 	// the publisher does not have a preset assignment. A value <= 0 assigns
 	// each publisher to one indexer.
 	Replication int
+	// UsageThreshold is the value store disk usage percent above which an
+	// indexer is not assigned any more publishers. A value <= 0 disables the
+	// threshold.
+	UsageThreshold float64
 }
 
 type Indexer struct {
@@ -51,11 +67,15 @@ func NewIndexer() Indexer {
 // NewDiscovery returns Discovery with values set to their defaults.
 func NewAssignment() Assignment {
 	return Assignment{
+		Health:            NewHealth(),
+		IndexCountWeight:  0.5,
 		PollInterval:      sticfg.Duration(5 * time.Minute),
 		Policy:            NewPolicy(),
 		PubSubTopic:       "/indexer/ingest/mainnet",
 		PresetReplication: 1,
+		Rebalance:         NewRebalance(),
 		Replication:       1,
+		UsageThreshold:    80.0,
 	}
 }
 
@@ -75,4 +95,6 @@ func (c *Assignment) populateUnset() {
 	if c.Replication <= 0 {
 		c.Replication = def.Replication
 	}
+	c.Health.PopulateUnset()
+	c.Rebalance.PopulateUnset()
 }
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"time"
+
+	sticfg "github.com/ipni/storetheindex/config"
+)
+
+// Health configures checking the health of the indexers in the indexer pool,
+// and restoring the replication of publishers assigned to indexers that are
+// down.
+type Health struct {
+	// CheckInterval is how often to check the health of each indexer. A value
+	// of 0 disables health checking.
+	CheckInterval sticfg.Duration
+	// CheckTimeout is how long to wait for an indexer to respond to a health
+	// check before the indexer is considered unreachable.
+	CheckTimeout sticfg.Duration
+	// GracePeriod is how long an indexer must be unreachable before it is
+	// considered down. When an indexer is down, its publishers are assigned
+	// to other indexers to restore their replication.
+	GracePeriod sticfg.Duration
+}
+
+// NewHealth returns Health with values set to their defaults.
+func NewHealth() Health {
+	return Health{
+		CheckInterval: sticfg.Duration(time.Minute),
+		CheckTimeout:  sticfg.Duration(10 * time.Second),
+		GracePeriod:   sticfg.Duration(10 * time.Minute),
+	}
+}
+
+// PopulateUnset replaces zero-values in the config with default values.
+func (c *Health) PopulateUnset() {
+	def := NewHealth()
+
+	if c.CheckTimeout <= 0 {
+		c.CheckTimeout = def.CheckTimeout
+	}
+	if c.GracePeriod <= 0 {
+		c.GracePeriod = def.GracePeriod
+	}
+}
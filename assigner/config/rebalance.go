@@ -0,0 +1,47 @@
+package config
+
+import (
+	sticfg "github.com/ipni/storetheindex/config"
+)
+
+// Rebalance configures moving publishers from over-loaded indexers to
+// under-loaded indexers in the indexer pool.
+type Rebalance struct {
+	// Interval is how often to rebalance publishers across the indexer pool.
+	// A value of 0 disables scheduled rebalancing, but rebalancing can still
+	// be started manually.
+	Interval sticfg.Duration
+	// MaxConcurrent is the maximum number of publishers that are moved at the
+	// same time.
+	MaxConcurrent int
+	// MaxMoves is the maximum number of publishers that are moved by each
+	// rebalancing.
+	MaxMoves int
+	// Tolerance is how many more publishers than the pool average an indexer
+	// can be assigned before it is over-loaded.
+	Tolerance int
+}
+
+// NewRebalance returns Rebalance with values set to their defaults.
+func NewRebalance() Rebalance {
+	return Rebalance{
+		MaxConcurrent: 4,
+		MaxMoves:      100,
+		Tolerance:     1,
+	}
+}
+
+// PopulateUnset replaces zero-values in the config with default values.
+func (c *Rebalance) PopulateUnset() {
+	def := NewRebalance()
+
+	if c.MaxConcurrent <= 0 {
+		c.MaxConcurrent = def.MaxConcurrent
+	}
+	if c.MaxMoves <= 0 {
+		c.MaxMoves = def.MaxMoves
+	}
+	if c.Tolerance < 0 {
+		c.Tolerance = 0
+	}
+}
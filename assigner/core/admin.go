@@ -0,0 +1,342 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	adminclient "github.com/ipni/storetheindex/admin/client"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+var (
+	// ErrAlreadyAssigned is returned when assigning a publisher to an indexer
+	// that the publisher is already assigned to.
+	ErrAlreadyAssigned = errors.New("publisher already assigned to indexer")
+	// ErrIndexerNotFound is returned when an indexer number does not identify
+	// an indexer in the pool.
+	ErrIndexerNotFound = errors.New("indexer not in pool")
+	// ErrNotAssigned is returned when a publisher is not assigned to the
+	// indexer it is unassigned or moved from.
+	ErrNotAssigned = errors.New("publisher not assigned to indexer")
+)
+
+// Indexer describes an indexer in the indexer pool.
+type Indexer struct {
+	// Num is the position of the indexer in the pool.
+	Num       int
+	AdminURL  string
+	FindURL   string
+	IngestURL string
+	// ID is the peer ID of the indexer, if known.
+	ID peer.ID `json:",omitempty"`
+	// Online is true if the assigner has read the indexer's assignments.
+	Online bool
+	// Frozen is true if the indexer is frozen.
+	Frozen bool
+	// Draining is true if the indexer's publishers are being moved to other
+	// indexers.
+	Draining bool
+	// Retired is true if the indexer was removed from the pool.
+	Retired bool
+	// Unreachable is true if the indexer failed its latest health check.
+	Unreachable bool
+	// Down is true if the indexer has been unreachable for longer than the
+	// health check grace period.
+	Down bool
+	// Assigned is the number of publishers assigned to the indexer.
+	Assigned int
+	// Usage is the percent of the indexer's value store storage used, or -1
+	// if not known.
+	Usage float64
+	// IndexCount is the number of indexes stored by the indexer.
+	IndexCount uint64
+	// Publishers are the publishers assigned to the indexer. This is only
+	// set when getting a single indexer.
+	Publishers []peer.ID `json:",omitempty"`
+}
+
+// Assignments returns the indexers that each publisher is assigned to.
+func (a *Assigner) Assignments() map[peer.ID][]int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	assignments := make(map[peer.ID][]int, len(a.assigned))
+	for pubID, asmt := range a.assigned {
+		if len(asmt.indexers) == 0 {
+			continue
+		}
+		cpy := make([]int, len(asmt.indexers))
+		copy(cpy, asmt.indexers)
+		assignments[pubID] = cpy
+	}
+	return assignments
+}
+
+// Indexers returns information about each indexer in the pool, in pool order.
+func (a *Assigner) Indexers() []Indexer {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	indexers := make([]Indexer, len(a.indexerPool))
+	for i := range a.indexerPool {
+		indexers[i] = a.indexerInfo(i)
+	}
+	return indexers
+}
+
+// Indexer returns information about the indexer at the given position in the
+// pool, including the publishers assigned to it.
+func (a *Assigner) Indexer(indexerNum int) (Indexer, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if !a.inPool(indexerNum) {
+		return Indexer{}, ErrIndexerNotFound
+	}
+
+	indexer := a.indexerInfo(indexerNum)
+	indexer.Publishers = a.indexerPublishers(indexerNum)
+	return indexer, nil
+}
+
+// inPool returns true if the indexer number is a position in the pool. The
+// Assigner mutex or the poolMutex must be held when calling this function.
+func (a *Assigner) inPool(indexerNum int) bool {
+	return indexerNum >= 0 && indexerNum < len(a.indexerPool)
+}
+
+// indexerInfo returns the information about an indexer. The Assigner mutex
+// must be held when calling this function.
+func (a *Assigner) indexerInfo(indexerNum int) Indexer {
+	ii := &a.indexerPool[indexerNum]
+	usage := -1.0
+	if ii.hasUsage {
+		usage = ii.usage
+	}
+	return Indexer{
+		Num:         indexerNum,
+		AdminURL:    ii.adminURL,
+		FindURL:     ii.findURL,
+		IngestURL:   ii.ingestURL,
+		ID:          ii.id,
+		Online:      ii.initDone,
+		Frozen:      ii.frozen,
+		Draining:    ii.draining,
+		Retired:     ii.retired,
+		Unreachable: !ii.unreachableSince.IsZero(),
+		Down:        ii.down,
+		Assigned:    ii.assignedCount(),
+		Usage:       usage,
+		IndexCount:  ii.indexCount,
+	}
+}
+
+// indexerPublishers returns the publishers assigned to an indexer, sorted by
+// peer ID. The Assigner mutex must be held when calling this function.
+func (a *Assigner) indexerPublishers(indexerNum int) []peer.ID {
+	var pubs []peer.ID
+	for pubID, asmt := range a.assigned {
+		if asmt.hasIndexer(indexerNum) {
+			pubs = append(pubs, pubID)
+		}
+	}
+	sort.Slice(pubs, func(i, j int) bool { return pubs[i] < pubs[j] })
+	return pubs
+}
+
+// AssignPublisher assigns a publisher to the indexer at the given position in
+// the pool. The indexer starts indexing the publisher's advertisements when it
+// next receives an announce from the publisher.
+func (a *Assigner) AssignPublisher(ctx context.Context, pubID peer.ID, indexerNum int) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if !a.inPool(indexerNum) || a.indexerPool[indexerNum].retired {
+		return ErrIndexerNotFound
+	}
+
+	asmt, found := a.assigned[pubID]
+	if found && asmt.hasIndexer(indexerNum) {
+		return ErrAlreadyAssigned
+	}
+
+	cl, err := adminclient.New(a.indexerPool[indexerNum].adminURL)
+	if err != nil {
+		return err
+	}
+	if err = cl.Assign(ctx, pubID); err != nil {
+		return fmt.Errorf("cannot assign publisher to indexer %d: %w", indexerNum, err)
+	}
+
+	if !found {
+		asmt = &assignment{
+			indexers: []int{},
+		}
+		a.assigned[pubID] = asmt
+	}
+	asmt.addIndexer(indexerNum)
+	a.indexerPool[indexerNum].addAssignedCount(1)
+	a.notifyAssignment(pubID, indexerNum)
+	recordAssignment(indexerNum)
+
+	log.Infow("Manually assigned publisher to indexer", "publisher", pubID, "indexer", indexerNum)
+	return nil
+}
+
+// UnassignPublisher unassigns a publisher from the indexer at the given
+// position in the pool. If the publisher is then assigned to fewer indexers
+// than required, it is assigned to another indexer when the assigner next
+// receives an announce from the publisher.
+func (a *Assigner) UnassignPublisher(ctx context.Context, pubID peer.ID, indexerNum int) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if !a.inPool(indexerNum) {
+		return ErrIndexerNotFound
+	}
+
+	asmt, found := a.assigned[pubID]
+	if !found || !asmt.hasIndexer(indexerNum) {
+		return ErrNotAssigned
+	}
+
+	cl, err := adminclient.New(a.indexerPool[indexerNum].adminURL)
+	if err != nil {
+		return err
+	}
+	if err = cl.Unassign(ctx, pubID); err != nil {
+		return fmt.Errorf("cannot unassign publisher from indexer %d: %w", indexerNum, err)
+	}
+
+	asmt.removeIndexer(indexerNum)
+	a.indexerPool[indexerNum].addAssignedCount(-1)
+
+	log.Infow("Manually unassigned publisher from indexer", "publisher", pubID, "indexer", indexerNum)
+	return nil
+}
+
+// MovePublisher moves a publisher from one indexer to another, identified by
+// their positions in the pool. The indexer the publisher is moved to continues
+// indexing from the last advertisement processed by the indexer the publisher
+// is moved from. Returns ErrMovesInProgress if rebalancing or draining is in
+// progress.
+func (a *Assigner) MovePublisher(ctx context.Context, pubID peer.ID, from, to int) error {
+	if from == to {
+		return ErrAlreadyAssigned
+	}
+
+	if !a.moveMutex.TryLock() {
+		return ErrMovesInProgress
+	}
+	defer a.moveMutex.Unlock()
+
+	a.poolMutex.RLock()
+	defer a.poolMutex.RUnlock()
+
+	a.mutex.Lock()
+	var err error
+	if !a.inPool(from) || !a.inPool(to) || a.indexerPool[to].retired {
+		err = ErrIndexerNotFound
+	} else if asmt, found := a.assigned[pubID]; !found || !asmt.hasIndexer(from) {
+		err = ErrNotAssigned
+	} else if asmt.hasIndexer(to) {
+		err = ErrAlreadyAssigned
+	}
+	a.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err = a.movePublisher(ctx, pubID, from, to); err != nil {
+		return err
+	}
+	log.Infow("Manually moved publisher", "publisher", pubID, "from", from, "to", to)
+	return nil
+}
+
+// Drain moves all publishers off of the indexer at the given position in the
+// pool, and stops assigning publishers to that indexer until the assigner is
+// restarted. Each publisher is moved to the indexer with the most free
+// capacity that the publisher can be assigned to.
+//
+// The returned moves record which publishers were moved and which could not
+// be moved. Draining again moves any remaining publishers. Returns
+// ErrMovesInProgress if rebalancing or draining is already in progress.
+func (a *Assigner) Drain(ctx context.Context, indexerNum int) ([]Move, error) {
+	if !a.moveMutex.TryLock() {
+		return nil, ErrMovesInProgress
+	}
+	defer a.moveMutex.Unlock()
+	return a.drain(ctx, indexerNum)
+}
+
+// drain moves all publishers off of an indexer. The moveMutex must be held
+// when calling this function.
+func (a *Assigner) drain(ctx context.Context, indexerNum int) ([]Move, error) {
+	a.mutex.Lock()
+	if !a.inPool(indexerNum) || a.indexerPool[indexerNum].retired {
+		a.mutex.Unlock()
+		return nil, ErrIndexerNotFound
+	}
+	a.indexerPool[indexerNum].draining = true
+	moves := a.planDrain(indexerNum)
+	a.mutex.Unlock()
+
+	log := log.With("indexer", indexerNum)
+	log.Infow("Draining indexer", "publishers", len(moves))
+
+	moved := a.runMoves(ctx, moves)
+	if moved != len(moves) {
+		log.Warnw("Could not move all publishers from drained indexer", "moved", moved, "remaining", len(moves)-moved)
+	} else {
+		log.Info("Drained indexer")
+	}
+	return moves, ctx.Err()
+}
+
+// planDrain returns a move for each publisher assigned to the indexer being
+// drained. A move that has no indexer to move the publisher to has an error.
+//
+// The Assigner mutex must be held when calling this function.
+func (a *Assigner) planDrain(indexerNum int) []Move {
+	pubs := a.indexerPublishers(indexerNum)
+	if len(pubs) == 0 {
+		return nil
+	}
+
+	var targets []int
+	counts := make(map[int]int, len(a.indexerPool))
+	for i := range a.indexerPool {
+		if i != indexerNum && a.indexerPool[i].initDone && a.canAssign(i) {
+			targets = append(targets, i)
+			counts[i] = a.indexerPool[i].assignedCount()
+		}
+	}
+
+	moves := make([]Move, len(pubs))
+	candidates := make([]int, 0, len(targets))
+	for i, pubID := range pubs {
+		asmt := a.assigned[pubID]
+		moves[i] = Move{
+			Publisher: pubID,
+			From:      indexerNum,
+			To:        -1,
+		}
+		candidates = candidates[:0]
+		for _, n := range a.rebalanceTargets(pubID, targets) {
+			if !asmt.hasIndexer(n) {
+				candidates = append(candidates, n)
+			}
+		}
+		if len(candidates) == 0 {
+			moves[i].Error = "no indexer to move publisher to"
+			continue
+		}
+		a.orderByCounts(candidates, asmt.preferred, counts)
+		moves[i].To = candidates[0]
+		counts[candidates[0]]++
+	}
+	return moves
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -14,24 +15,40 @@ import (
 	"github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipni/go-libipni/announce"
+	findclient "github.com/ipni/go-libipni/find/client/http"
 	ingestclient "github.com/ipni/go-libipni/ingest/client"
 	adminclient "github.com/ipni/storetheindex/admin/client"
+	"github.com/ipni/storetheindex/admin/model"
 	"github.com/ipni/storetheindex/assigner/config"
+	"github.com/ipni/storetheindex/internal/metrics"
 	"github.com/ipni/storetheindex/peerutil"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 )
 
 var log = logging.Logger("assigner/core")
 
-const pollFrozenTimeout = 2 * time.Minute
+const pollTimeout = 2 * time.Minute
 
 // Assigner is responsible for assigning publishers to indexers.
 type Assigner struct {
 	// assigned maps a publisher to a set of indexers.
 	assigned map[peer.ID]*assignment
+	// events are the most recent events, oldest first.
+	events     []Event
+	eventMutex sync.Mutex
+	// healthCfg configures checking the health of indexers.
+	healthCfg config.Health
+	// indexCountWeight is how much index counts count towards the free
+	// capacity of an indexer.
+	indexCountWeight float64
 	// indexerPool is the set of indexers to assign publishers to.
 	indexerPool []indexerInfo
+	// poolMutex is write-locked while indexers are added to the pool, and
+	// read-locked while the pool is used without holding the mutex.
+	poolMutex sync.RWMutex
 	// initDone is true when assignments have been read from all indexers.
 	initDone bool
 	// mutex protects assigned.
@@ -45,6 +62,11 @@ type Assigner struct {
 	pollDone chan struct{}
 	// pollNow signals the poll goroutine to poll immediately.
 	pollNow chan struct{}
+	// moveMutex is held while publishers are being moved by rebalancing or
+	// draining.
+	moveMutex sync.Mutex
+	// rebalanceCfg configures rebalancing of publishers across the pool.
+	rebalanceCfg config.Rebalance
 	// presets maps publisher ID to pre-assigned indexers.
 	presets map[peer.ID][]int
 	// presetRepl is number of the preset indexers to assign a publisher to.
@@ -53,6 +75,12 @@ type Assigner struct {
 	receiver *announce.Receiver
 	// replication is the number of indexers to assign a publisher to.
 	replication int
+	// cfgReplication is the configured replication, which may be more than
+	// the number of indexers in the pool.
+	cfgReplication int
+	// usageThreshold is the value store usage percent above which indexers
+	// are not assigned publishers.
+	usageThreshold float64
 	// watchDone signals that the watch function exited.
 	watchDone chan struct{}
 	// waitingNotice are channels waiting for a specific peer to be assigned
@@ -80,6 +108,17 @@ func (asmt *assignment) addIndexer(x int) {
 	asmt.indexers[i] = x
 }
 
+// addPreferred adds an indexer, identified by its number in the pool, to the
+// preferred indexers of this assignment, if not already present.
+func (asmt *assignment) addPreferred(x int) {
+	for _, p := range asmt.preferred {
+		if p == x {
+			return
+		}
+	}
+	asmt.preferred = append(asmt.preferred, x)
+}
+
 // removeIndexer removes an indexer, identified by its number in the pool, from
 // this assignment.
 func (asmt *assignment) removeIndexer(x int) bool {
@@ -104,10 +143,36 @@ type indexerInfo struct {
 	ingestURL string
 
 	assigned    int32
+	draining    bool
 	frozen      bool
 	id          peer.ID
 	initDone    bool
 	needHandoff map[peer.ID]struct{}
+	presetPeers []string
+	// retired is true if the indexer was removed from the pool. A retired
+	// indexer keeps its position so that the positions of the other
+	// indexers do not change.
+	retired bool
+
+	// Health information from health checks. This is protected by the
+	// Assigner mutex.
+	//
+	// unreachableSince is when the indexer started failing health checks, or
+	// zero if the indexer is healthy.
+	unreachableSince time.Time
+	// down is true if the indexer has been unreachable for longer than the
+	// grace period, and its publishers were removed from its assignments.
+	down bool
+	// needReconcile is true if the indexer recovered from being down, and
+	// its replicas have not been reconciled yet.
+	needReconcile bool
+
+	// Capacity information from the latest poll of the indexer. This is
+	// protected by the Assigner mutex.
+	hasUsage      bool
+	usage         float64
+	hasIndexCount bool
+	indexCount    uint64
 }
 
 // assignedCount returns the number of publishers assigned to this indexer.
@@ -127,6 +192,9 @@ func NewAssigner(ctx context.Context, cfg config.Assignment, p2pHost host.Host)
 	if cfg.Replication < 0 {
 		return nil, errors.New("bad replication value, must be 0 or positive")
 	}
+	if cfg.IndexCountWeight < 0 || cfg.IndexCountWeight > 1 {
+		return nil, errors.New("bad index count weight, must be between 0 and 1")
+	}
 	if len(cfg.IndexerPool) < 1 {
 		return nil, errors.New("no indexers configured to assign to")
 	}
@@ -164,18 +232,29 @@ func NewAssigner(ctx context.Context, cfg config.Assignment, p2pHost host.Host)
 		replication = len(indexerPool)
 	}
 
+	rebalanceCfg := cfg.Rebalance
+	rebalanceCfg.PopulateUnset()
+
+	healthCfg := cfg.Health
+	healthCfg.PopulateUnset()
+
 	a := &Assigner{
-		assigned:    make(map[peer.ID]*assignment),
-		indexerPool: indexerPool,
-		p2pHost:     p2pHost,
-		policy:      policy,
-		pollDone:    make(chan struct{}),
-		pollNow:     make(chan struct{}),
-		presets:     presets,
-		presetRepl:  presetRepl,
-		receiver:    rcvr,
-		replication: replication,
-		watchDone:   make(chan struct{}),
+		assigned:         make(map[peer.ID]*assignment),
+		healthCfg:        healthCfg,
+		indexCountWeight: cfg.IndexCountWeight,
+		indexerPool:      indexerPool,
+		p2pHost:          p2pHost,
+		policy:           policy,
+		pollDone:         make(chan struct{}),
+		pollNow:          make(chan struct{}),
+		presets:          presets,
+		presetRepl:       presetRepl,
+		rebalanceCfg:     rebalanceCfg,
+		receiver:         rcvr,
+		replication:      replication,
+		cfgReplication:   cfg.Replication,
+		usageThreshold:   cfg.UsageThreshold,
+		watchDone:        make(chan struct{}),
 	}
 
 	// Get the publishers currently assigned to each indexer in the pool. If
@@ -194,7 +273,7 @@ func NewAssigner(ctx context.Context, cfg config.Assignment, p2pHost host.Host)
 	a.pollCancel = pollCancel
 
 	go a.watch()
-	go a.poll(pollCtx, time.Duration(cfg.PollInterval))
+	go a.poll(pollCtx, time.Duration(cfg.PollInterval), time.Duration(rebalanceCfg.Interval), time.Duration(healthCfg.CheckInterval))
 
 	return a, nil
 }
@@ -204,6 +283,9 @@ func NewAssigner(ctx context.Context, cfg config.Assignment, p2pHost host.Host)
 // position of each count corresponds to the position of the indexer in the
 // pool.
 func (a *Assigner) IndexerAssignedCounts() []int {
+	a.poolMutex.RLock()
+	defer a.poolMutex.RUnlock()
+
 	counts := make([]int, len(a.indexerPool))
 	for i := range a.indexerPool {
 		counts[i] = a.indexerPool[i].assignedCount()
@@ -245,17 +327,23 @@ func (a *Assigner) initAssignments(ctx context.Context) int {
 
 	var needInit int
 	for i := range a.indexerPool {
-		if a.indexerPool[i].initDone {
+		if a.indexerPool[i].initDone || a.indexerPool[i].retired || a.indexerPool[i].down {
 			continue
 		}
 
-		id, frozen, assigned, prefPubs, err := a.getAssignments(ctx, i)
+		status, assigned, prefPubs, err := a.getAssignments(ctx, i)
 		if err != nil {
 			needInit++
 			log.Errorw("Could not get assignments from indexer", "err", err, "indexer", i)
 			continue
 		}
+		id, frozen := status.ID, status.Frozen
 		a.indexerPool[i].id = id
+		indexCount, err := a.getIndexCount(ctx, i)
+		if err != nil {
+			log.Errorw("Could not get index count from indexer", "err", err, "indexer", i)
+		}
+		a.updateCapacity(i, status.Usage, indexCount, err == nil)
 
 		// Add this indexer to each publisher's assignments.
 		for pubID := range assigned {
@@ -269,8 +357,12 @@ func (a *Assigner) initAssignments(ctx context.Context) int {
 				}
 				a.assigned[pubID] = asmt
 			}
-			asmt.addIndexer(i)
-			a.indexerPool[i].assigned++
+			// The indexer may already be in the assignment if this is
+			// reinitializing a recovered indexer.
+			if !asmt.hasIndexer(i) {
+				asmt.addIndexer(i)
+				a.indexerPool[i].assigned++
+			}
 		}
 		indexerAssigned[i] = assigned
 		log.Infof("Indexer %d has %d assignments", i, a.indexerPool[i].assigned)
@@ -299,7 +391,7 @@ func (a *Assigner) initAssignments(ctx context.Context) int {
 				log.Errorw("Publisher assigned to indexer cannot be listed as preferred", "indexer", i, "publisher", pubID)
 				continue
 			}
-			asmt.preferred = append(asmt.preferred, i)
+			asmt.addPreferred(i)
 		}
 
 		a.indexerPool[i].initDone = true
@@ -371,35 +463,18 @@ func indexersFromConfig(cfgIndexerPool []config.Indexer) ([]indexerInfo, map[pee
 	var presets map[peer.ID][]int
 
 	for i := range cfgIndexerPool {
-		var iInfo indexerInfo
-		var err error
-
-		iInfo.adminURL, err = configURL(cfgIndexerPool[i].AdminURL, "admin", i, seen)
-		if err != nil {
-			return nil, nil, err
-		}
-		iInfo.findURL, err = configURL(cfgIndexerPool[i].FindURL, "find", i, seen)
-		if err != nil {
-			return nil, nil, err
-		}
-		iInfo.ingestURL, err = configURL(cfgIndexerPool[i].IngestURL, "ingest", i, seen)
+		iInfo, presetPeers, err := indexerFromConfig(cfgIndexerPool[i], i, seen)
 		if err != nil {
 			return nil, nil, err
 		}
-
 		indexers = append(indexers, iInfo)
 
 		// Add indexer to each publisher's preset list.
-		preset := cfgIndexerPool[i].PresetPeers
-		if len(preset) != 0 {
+		if len(presetPeers) != 0 {
 			if presets == nil {
 				presets = make(map[peer.ID][]int)
 			}
-			for _, pubIDStr := range preset {
-				pubID, err := peer.Decode(pubIDStr)
-				if err != nil {
-					return nil, nil, fmt.Errorf("indexer %d has bad preset peer id %s", i, pubIDStr)
-				}
+			for _, pubID := range presetPeers {
 				presets[pubID] = append(presets[pubID], i)
 			}
 		}
@@ -408,6 +483,38 @@ func indexersFromConfig(cfgIndexerPool []config.Indexer) ([]indexerInfo, map[pee
 	return indexers, presets, nil
 }
 
+// indexerFromConfig creates the indexer information for the indexer at the
+// given position in the pool, and returns the indexer's preset publishers.
+func indexerFromConfig(cfgIndexer config.Indexer, indexerNum int, seen map[string]struct{}) (indexerInfo, []peer.ID, error) {
+	var iInfo indexerInfo
+	var err error
+
+	iInfo.adminURL, err = configURL(cfgIndexer.AdminURL, "admin", indexerNum, seen)
+	if err != nil {
+		return indexerInfo{}, nil, err
+	}
+	iInfo.findURL, err = configURL(cfgIndexer.FindURL, "find", indexerNum, seen)
+	if err != nil {
+		return indexerInfo{}, nil, err
+	}
+	iInfo.ingestURL, err = configURL(cfgIndexer.IngestURL, "ingest", indexerNum, seen)
+	if err != nil {
+		return indexerInfo{}, nil, err
+	}
+
+	var presetPeers []peer.ID
+	for _, pubIDStr := range cfgIndexer.PresetPeers {
+		pubID, err := peer.Decode(pubIDStr)
+		if err != nil {
+			return indexerInfo{}, nil, fmt.Errorf("indexer %d has bad preset peer id %s", indexerNum, pubIDStr)
+		}
+		presetPeers = append(presetPeers, pubID)
+	}
+	iInfo.presetPeers = cfgIndexer.PresetPeers
+
+	return iInfo, presetPeers, nil
+}
+
 func configURL(urlStr, name string, indexerNum int, seen map[string]struct{}) (string, error) {
 	if !strings.HasPrefix(urlStr, "http://") && !strings.HasPrefix(urlStr, "https://") {
 		urlStr = "http://" + urlStr
@@ -456,6 +563,8 @@ func (a *Assigner) Assigned(peerID peer.ID) []int {
 
 // Presets returns preset indexer assignments for the given peer.
 func (a *Assigner) Presets(peerID peer.ID) []int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
 	return a.presets[peerID]
 }
 
@@ -494,6 +603,10 @@ func (a *Assigner) Close() error {
 // channel will need to be created to receive notification of future
 // assignments/handoff.
 func (a *Assigner) OnAssignment(pubID peer.ID) (<-chan int, context.CancelFunc) {
+	a.poolMutex.RLock()
+	poolSize := len(a.indexerPool)
+	a.poolMutex.RUnlock()
+
 	a.noticeMutex.Lock()
 	defer a.noticeMutex.Unlock()
 
@@ -506,7 +619,7 @@ func (a *Assigner) OnAssignment(pubID peer.ID) (<-chan int, context.CancelFunc)
 	}
 
 	if !ok {
-		noticeChan = make(chan int, len(a.indexerPool))
+		noticeChan = make(chan int, poolSize)
 		a.waitingNotice[pubID] = noticeChan
 	}
 
@@ -523,8 +636,12 @@ func (a *Assigner) notifyAssignment(pubID peer.ID, indexerNum int) {
 	if !ok {
 		return
 	}
-	// Will never block because channel size is same as pool size.
-	noticeChan <- indexerNum
+	// Does not block because channel size is same as pool size. The pool may
+	// have grown since the channel was created, so do not wait if full.
+	select {
+	case noticeChan <- indexerNum:
+	default:
+	}
 }
 
 func (a *Assigner) closeNotifyAssignment(pubID peer.ID) {
@@ -544,7 +661,7 @@ func (a *Assigner) closeNotifyAssignment(pubID peer.ID) {
 	}
 }
 
-func (a *Assigner) poll(ctx context.Context, interval time.Duration) {
+func (a *Assigner) poll(ctx context.Context, interval, rebalanceInterval, healthInterval time.Duration) {
 	defer close(a.pollDone)
 
 	var timerCh <-chan time.Time
@@ -556,15 +673,41 @@ func (a *Assigner) poll(ctx context.Context, interval time.Duration) {
 		timerCh = timer.C
 	}
 
+	var rebalanceCh <-chan time.Time
+	var rebalanceTimer *time.Timer
+
+	if rebalanceInterval != 0 {
+		rebalanceTimer = time.NewTimer(rebalanceInterval)
+		defer rebalanceTimer.Stop()
+		rebalanceCh = rebalanceTimer.C
+	}
+
+	var healthCh <-chan time.Time
+	var healthTimer *time.Timer
+
+	if healthInterval != 0 {
+		healthTimer = time.NewTimer(healthInterval)
+		defer healthTimer.Stop()
+		healthCh = healthTimer.C
+	}
+
 	for {
 		select {
 		case <-timerCh:
-			a.pollFrozen(ctx)
+			a.pollIndexers(ctx)
 			timer.Reset(interval)
+		case <-rebalanceCh:
+			if _, err := a.Rebalance(ctx, false); err != nil {
+				log.Errorw("Scheduled rebalance failed", "err", err)
+			}
+			rebalanceTimer.Reset(rebalanceInterval)
+		case <-healthCh:
+			a.checkHealth(ctx)
+			healthTimer.Reset(healthInterval)
 		case <-ctx.Done():
 			return
 		case <-a.pollNow:
-			a.pollFrozen(ctx)
+			a.pollIndexers(ctx)
 		}
 	}
 }
@@ -663,17 +806,27 @@ func (a *Assigner) makeAssignments(ctx context.Context, amsg announce.Announce,
 	if usesPresets {
 		candidates = make([]int, 0, len(preset)-len(asmt.indexers))
 		for _, indexerNum := range preset {
-			if !a.indexerPool[indexerNum].frozen && !asmt.hasIndexer(indexerNum) {
-				candidates = append(candidates, indexerNum)
+			if asmt.hasIndexer(indexerNum) {
+				continue
+			}
+			if !a.canAssign(indexerNum) {
+				a.recordSkipped(indexerNum)
+				continue
 			}
+			candidates = append(candidates, indexerNum)
 		}
 		required = a.presetRepl
 	} else {
 		candidates = make([]int, 0, len(a.indexerPool)-len(asmt.indexers))
 		for i := range a.indexerPool {
-			if !a.indexerPool[i].frozen && !asmt.hasIndexer(i) {
-				candidates = append(candidates, i)
+			if asmt.hasIndexer(i) {
+				continue
+			}
+			if !a.canAssign(i) {
+				a.recordSkipped(i)
+				continue
 			}
+			candidates = append(candidates, i)
 		}
 		required = a.replication
 	}
@@ -696,6 +849,7 @@ func (a *Assigner) makeAssignments(ctx context.Context, amsg announce.Announce,
 		asmt.addIndexer(indexerNum)
 		a.indexerPool[indexerNum].addAssignedCount(1)
 		a.notifyAssignment(amsg.PeerID, indexerNum)
+		recordAssignment(indexerNum)
 		need--
 		if need == 0 {
 			// Close the notification channel to signal to reader that
@@ -709,16 +863,33 @@ func (a *Assigner) makeAssignments(ctx context.Context, amsg announce.Announce,
 	log.Warnf("Publisher assigned to %d out of %d required indexers", len(asmt.indexers), required)
 }
 
-func (a *Assigner) pollFrozen(ctx context.Context) {
-	ctx, cancel := context.WithTimeout(ctx, pollFrozenTimeout)
+// indexerStatus is the result of polling an indexer.
+type indexerStatus struct {
+	indexerNum int
+	frozen     bool
+	// status is nil if the indexer was not asked for its status.
+	status        *model.Status
+	indexCount    uint64
+	hasIndexCount bool
+	err           error
+}
+
+// pollIndexers gets the status of each indexer in the pool to update its
+// capacity information, and to handoff the publishers of any indexer that has
+// become frozen.
+func (a *Assigner) pollIndexers(ctx context.Context) {
+	a.poolMutex.RLock()
+	defer a.poolMutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, pollTimeout)
 	defer cancel()
 
-	newFrozen := make(chan int, len(a.indexerPool))
+	results := make(chan indexerStatus, len(a.indexerPool))
 	var reqCount int
 
 	for i := range a.indexerPool {
-		if !a.indexerPool[i].initDone {
-			continue // ignore offline
+		if !a.indexerPool[i].initDone || a.indexerPool[i].retired || a.indexerPool[i].down {
+			continue // ignore offline, retired, and down
 		}
 		if a.indexerPool[i].frozen {
 			continue // ignore already frozen
@@ -729,50 +900,232 @@ func (a *Assigner) pollFrozen(ctx context.Context) {
 		// If incomplete handoff, indexer must be frozen so report it as frozen
 		// without actually requesting status.
 		if len(a.indexerPool[i].needHandoff) != 0 {
-			newFrozen <- i
+			results <- indexerStatus{
+				indexerNum: i,
+				frozen:     true,
+			}
 			continue
 		}
 
 		// Send status requests concurrently.
 		go func(indexerNum int) {
-			frozen, err := a.checkFrozen(ctx, indexerNum)
-			if err != nil {
-				log.Errorw("Cannot get indexer status", "err", err, "indexer", indexerNum)
-				newFrozen <- -1
-				return
-			}
-			if !frozen {
-				newFrozen <- -1
-				return
-			}
-			// Indexer has become frozen since last check.
-			newFrozen <- indexerNum
+			results <- a.pollStatus(ctx, indexerNum)
 		}(i)
 	}
 
+	var polled []int
+	var newFrozen []int
 	for ; reqCount > 0; reqCount-- {
-		i := <-newFrozen
-		if i != -1 {
-			if err := a.handoffFrozen(ctx, i); err != nil {
-				log.Errorw("Handoff incomplete", "err", err, "frozenIndexer", i)
-			}
+		result := <-results
+		if result.err != nil {
+			log.Errorw("Cannot get indexer status", "err", result.err, "indexer", result.indexerNum)
+			continue
+		}
+		if result.status != nil {
+			a.mutex.Lock()
+			a.updateCapacity(result.indexerNum, result.status.Usage, result.indexCount, result.hasIndexCount)
+			a.mutex.Unlock()
+			polled = append(polled, result.indexerNum)
+		}
+		if result.frozen {
+			// Indexer has become frozen since last check.
+			newFrozen = append(newFrozen, result.indexerNum)
+		}
+	}
+	a.reportCapacity(polled)
+
+	for _, i := range newFrozen {
+		if err := a.handoffFrozen(ctx, i); err != nil {
+			log.Errorw("Handoff incomplete", "err", err, "frozenIndexer", i)
 		}
 	}
 }
 
-func (a *Assigner) checkFrozen(ctx context.Context, indexerNum int) (bool, error) {
+// pollStatus gets the status and the total index count of an indexer.
+func (a *Assigner) pollStatus(ctx context.Context, indexerNum int) indexerStatus {
+	result := indexerStatus{
+		indexerNum: indexerNum,
+	}
+
 	adminURL := a.indexerPool[indexerNum].adminURL
 	cl, err := adminclient.New(adminURL)
 	if err != nil {
-		return false, fmt.Errorf("cannot create admin client: %w", err)
+		result.err = fmt.Errorf("cannot create admin client: %w", err)
+		return result
 	}
-
 	status, err := cl.Status(ctx)
 	if err != nil {
-		return false, fmt.Errorf("error requesting status: %w", err)
+		result.err = fmt.Errorf("error requesting status: %w", err)
+		return result
+	}
+	result.status = status
+	result.frozen = status.Frozen
+
+	result.indexCount, err = a.getIndexCount(ctx, indexerNum)
+	if err != nil {
+		log.Errorw("Cannot get index count from indexer", "err", err, "indexer", indexerNum)
+	} else {
+		result.hasIndexCount = true
+	}
+	return result
+}
+
+// getIndexCount returns the total number of indexes that an indexer stores for
+// all providers.
+func (a *Assigner) getIndexCount(ctx context.Context, indexerNum int) (uint64, error) {
+	cl, err := findclient.New(a.indexerPool[indexerNum].findURL)
+	if err != nil {
+		return 0, fmt.Errorf("cannot create find client: %w", err)
+	}
+	providers, err := cl.ListProviders(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("cannot list providers: %w", err)
+	}
+	var total uint64
+	for _, pinfo := range providers {
+		total += pinfo.IndexCount
+	}
+	return total, nil
+}
+
+// updateCapacity records the capacity information of an indexer. A negative
+// usage means that the indexer could not determine its usage.
+func (a *Assigner) updateCapacity(indexerNum int, usage float64, indexCount uint64, hasIndexCount bool) {
+	ii := &a.indexerPool[indexerNum]
+	ii.hasUsage = usage >= 0
+	ii.usage = usage
+	ii.hasIndexCount = hasIndexCount
+	ii.indexCount = indexCount
+
+	indexerTag := tag.Insert(metrics.Indexer, strconv.Itoa(indexerNum))
+	if ii.hasUsage {
+		_ = stats.RecordWithOptions(context.Background(),
+			stats.WithTags(indexerTag),
+			stats.WithMeasurements(metrics.IndexerUsage.M(usage)))
+	}
+	if hasIndexCount {
+		_ = stats.RecordWithOptions(context.Background(),
+			stats.WithTags(indexerTag),
+			stats.WithMeasurements(metrics.IndexerIndexCount.M(int64(indexCount))))
+	}
+}
+
+// reportCapacity logs and records the free capacity of the polled indexers.
+func (a *Assigner) reportCapacity(indexers []int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	caps := a.capacities(indexers)
+	for _, n := range indexers {
+		ii := &a.indexerPool[n]
+		capacity, ok := caps[n]
+		if ok {
+			_ = stats.RecordWithOptions(context.Background(),
+				stats.WithTags(tag.Insert(metrics.Indexer, strconv.Itoa(n))),
+				stats.WithMeasurements(metrics.IndexerCapacity.M(capacity)))
+		}
+		log.Infow("Indexer capacity", "indexer", n, "usage", ii.usage, "indexCount", ii.indexCount,
+			"capacity", capacity, "assigned", ii.assignedCount())
+	}
+}
+
+// capacities returns the weighted free capacity, from 0 to 1, of each of the
+// indexers. Free capacity is computed from the free value store space of each
+// indexer and, if index counts are known for all the indexers, from the index
+// count of each indexer relative to the highest index count. Returns nil if
+// the value store usage of any indexer is not known.
+func (a *Assigner) capacities(indexers []int) map[int]float64 {
+	useCounts := a.indexCountWeight != 0
+	var maxCount uint64
+	for _, n := range indexers {
+		ii := &a.indexerPool[n]
+		if !ii.hasUsage {
+			return nil
+		}
+		if !ii.hasIndexCount {
+			useCounts = false
+		} else if ii.indexCount > maxCount {
+			maxCount = ii.indexCount
+		}
+	}
+	if maxCount == 0 {
+		useCounts = false
 	}
 
-	return status.Frozen, nil
+	caps := make(map[int]float64, len(indexers))
+	for _, n := range indexers {
+		ii := &a.indexerPool[n]
+		free := 1 - ii.usage/100
+		if free < 0 {
+			free = 0
+		}
+		if useCounts {
+			freeCount := 1 - float64(ii.indexCount)/float64(maxCount)
+			free = (1-a.indexCountWeight)*free + a.indexCountWeight*freeCount
+		}
+		caps[n] = free
+	}
+	return caps
+}
+
+// canAssign returns true if the indexer can be assigned more publishers. An
+// indexer cannot be assigned publishers if it is retired, frozen, being
+// drained, unreachable, or above the usage threshold. This only checks the
+// indexer, so it can be called when planning assignments.
+func (a *Assigner) canAssign(indexerNum int) bool {
+	ii := &a.indexerPool[indexerNum]
+	return !ii.retired && !ii.frozen && !ii.draining && a.skipReason(indexerNum) == ""
+}
+
+// skipReason returns why the indexer must not be assigned more publishers
+// because of its health or usage, or "" if there is no such reason.
+func (a *Assigner) skipReason(indexerNum int) string {
+	if a.unreachable(indexerNum) {
+		return "unreachable"
+	}
+	if a.aboveThreshold(indexerNum) {
+		return "usage"
+	}
+	return ""
+}
+
+// recordSkipped records that a publisher was not assigned to the indexer
+// because of the indexer's health or usage. This is only called when a
+// publisher is assigned, and not when planning assignments.
+func (a *Assigner) recordSkipped(indexerNum int) {
+	ii := &a.indexerPool[indexerNum]
+	if ii.retired || ii.frozen || ii.draining {
+		return
+	}
+	reason := a.skipReason(indexerNum)
+	switch reason {
+	case "":
+		return
+	case "usage":
+		log.Infow("Not assigning to indexer above usage threshold", "indexer", indexerNum,
+			"usage", ii.usage, "threshold", a.usageThreshold)
+	}
+	_ = stats.RecordWithOptions(context.Background(),
+		stats.WithTags(tag.Insert(metrics.Indexer, strconv.Itoa(indexerNum)), tag.Insert(metrics.Reason, reason)),
+		stats.WithMeasurements(metrics.IndexerSkippedCount.M(1)))
+}
+
+// unreachable returns true if the indexer failed its latest health check.
+func (a *Assigner) unreachable(indexerNum int) bool {
+	return !a.indexerPool[indexerNum].unreachableSince.IsZero()
+}
+
+// aboveThreshold returns true if the indexer's value store usage is above the
+// usage threshold.
+func (a *Assigner) aboveThreshold(indexerNum int) bool {
+	ii := &a.indexerPool[indexerNum]
+	return a.usageThreshold > 0 && ii.hasUsage && ii.usage >= a.usageThreshold
+}
+
+func recordAssignment(indexerNum int) {
+	_ = stats.RecordWithOptions(context.Background(),
+		stats.WithTags(tag.Insert(metrics.Indexer, strconv.Itoa(indexerNum))),
+		stats.WithMeasurements(metrics.AssignmentCount.M(1)))
 }
 
 // handoffFrozen does a handoff of all the publishers assigned to an indexer.
@@ -821,16 +1174,26 @@ func (a *Assigner) handoffFrozen(ctx context.Context, indexerNum int) error {
 			// Find an indexer, that has this publisher as a preset, that the
 			// publisher is not already assigned to.
 			for _, i := range preset {
-				if i != indexerNum && !a.indexerPool[i].frozen && !asmt.hasIndexer(i) {
-					candidates = append(candidates, i)
+				if i == indexerNum || asmt.hasIndexer(i) {
+					continue
 				}
+				if !a.canAssign(i) {
+					a.recordSkipped(i)
+					continue
+				}
+				candidates = append(candidates, i)
 			}
 		} else {
 			// Find an indexer that the publisher is not already assigned to.
 			for i := range a.indexerPool {
-				if i != indexerNum && !a.indexerPool[i].frozen && !asmt.hasIndexer(i) {
-					candidates = append(candidates, i)
+				if i == indexerNum || asmt.hasIndexer(i) {
+					continue
 				}
+				if !a.canAssign(i) {
+					a.recordSkipped(i)
+					continue
+				}
+				candidates = append(candidates, i)
 			}
 		}
 		// There are no remaining indexers to handoff publisher to.
@@ -867,6 +1230,7 @@ func (a *Assigner) handoffFrozen(ctx context.Context, indexerNum int) error {
 		asmt.removeIndexer(indexerNum)
 		asmt.addIndexer(handoffTo)
 		a.notifyAssignment(pubID, handoffTo)
+		recordAssignment(handoffTo)
 
 		log.Infow("Publisher handoff done", "publisher", pubID, "targetIndexer", handoffTo)
 	}
@@ -879,9 +1243,10 @@ func (a *Assigner) handoffFrozen(ctx context.Context, indexerNum int) error {
 }
 
 type indexerSlice struct {
-	indexers []int
-	counts   map[int]int
-	prefs    map[int]bool
+	indexers   []int
+	capacities map[int]float64
+	counts     map[int]int
+	prefs      map[int]bool
 }
 
 // Len is part of sort.Interface.
@@ -892,32 +1257,46 @@ func (x indexerSlice) Less(i, j int) bool {
 	ni := x.indexers[i]
 	nj := x.indexers[j]
 	pi := x.prefs[ni]
-	if pi == x.prefs[nj] {
-		// Both preferred or both not preferred, sort by assigned count.
-		return x.counts[ni] < x.counts[nj]
+	if pi != x.prefs[nj] {
+		return pi
 	}
-	return pi
+	// Both preferred or both not preferred, sort by most free capacity.
+	if x.capacities != nil {
+		ci, cj := x.capacities[ni], x.capacities[nj]
+		if ci != cj {
+			return ci > cj
+		}
+	}
+	// Same capacity, sort by assigned count.
+	return x.counts[ni] < x.counts[nj]
 }
 
 // Swap is part of sort.Interface.
 func (x indexerSlice) Swap(i, j int) { x.indexers[i], x.indexers[j] = x.indexers[j], x.indexers[i] }
 
 func (a *Assigner) orderCandidates(indexers []int, preferred []int) {
-	// Sort indexer list by preferred, then least-assigned-first.
 	counts := map[int]int{}
 	for _, n := range indexers {
 		counts[n] = a.indexerPool[n].assignedCount()
 	}
+	a.orderByCounts(indexers, preferred, counts)
+}
+
+// orderByCounts sorts the indexers by preferred, then most-free-capacity-first,
+// then least-assigned-first using the given assigned counts.
+func (a *Assigner) orderByCounts(indexers []int, preferred []int, counts map[int]int) {
 	prefs := map[int]bool{}
 	for _, p := range preferred {
 		prefs[p] = true
 	}
 	iSlice := indexerSlice{
-		indexers: indexers,
-		counts:   counts,
-		prefs:    prefs,
+		indexers:   indexers,
+		capacities: a.capacities(indexers),
+		counts:     counts,
+		prefs:      prefs,
 	}
 	sort.Sort(&iSlice)
+	log.Debugw("Ordered candidate indexers", "indexers", indexers, "capacities", iSlice.capacities)
 }
 
 func (a *Assigner) assignIndexer(ctx context.Context, indexerNum int, amsg announce.Announce) error {
@@ -934,7 +1313,9 @@ func (a *Assigner) assignIndexer(ctx context.Context, indexerNum int, amsg annou
 	log.Infow("Assigned publisher to indexer, sending direct announce",
 		"adminURL", indexer.adminURL,
 		"ingestURL", indexer.ingestURL,
-		"publisher", amsg.PeerID)
+		"publisher", amsg.PeerID,
+		"usage", indexer.usage,
+		"indexCount", indexer.indexCount)
 
 	// Send announce instead of sync request in case indexer is already syncing
 	// due to receiving announce after immediately allowing the publisher.
@@ -953,30 +1334,30 @@ func (a *Assigner) assignIndexer(ctx context.Context, indexerNum int, amsg annou
 	return nil
 }
 
-func (a *Assigner) getAssignments(ctx context.Context, indexerNum int) (peer.ID, bool, map[peer.ID]peer.ID, []peer.ID, error) {
+func (a *Assigner) getAssignments(ctx context.Context, indexerNum int) (*model.Status, map[peer.ID]peer.ID, []peer.ID, error) {
 	adminURL := a.indexerPool[indexerNum].adminURL
 
 	cl, err := adminclient.New(adminURL)
 	if err != nil {
-		return "", false, nil, nil, fmt.Errorf("cannot create admin client: %w", err)
+		return nil, nil, nil, fmt.Errorf("cannot create admin client: %w", err)
 	}
 
 	assigned, err := cl.ListAssignedPeers(ctx)
 	if err != nil {
-		return "", false, nil, nil, fmt.Errorf("cannot get assignments: %w", err)
+		return nil, nil, nil, fmt.Errorf("cannot get assignments: %w", err)
 	}
 
 	status, err := cl.Status(ctx)
 	if err != nil {
-		return "", false, nil, nil, fmt.Errorf("cannot get indexer status: %w", err)
+		return nil, nil, nil, fmt.Errorf("cannot get indexer status: %w", err)
 	}
 	if status.Frozen {
-		return status.ID, true, assigned, nil, nil
+		return status, assigned, nil, nil
 	}
 
 	preferred, err := cl.ListPreferredPeers(ctx)
 	if err != nil {
 		log.Errorw("Cannot get preferred assignments from indexer", "err", err, "indexer", indexerNum)
 	}
-	return status.ID, false, assigned, preferred, nil
+	return status, assigned, preferred, nil
 }
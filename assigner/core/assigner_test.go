@@ -9,14 +9,17 @@ import (
 	"path"
 	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/ipfs/go-cid"
+	"github.com/ipni/go-libipni/test"
 	"github.com/ipni/storetheindex/admin/model"
 	"github.com/ipni/storetheindex/assigner/config"
 	"github.com/ipni/storetheindex/assigner/core"
+	sticfg "github.com/ipni/storetheindex/config"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/require"
@@ -591,6 +594,90 @@ func TestPoolIndexerOffline(t *testing.T) {
 	require.NoError(t, assigner.Close())
 }
 
+// Test that publishers are not assigned to an indexer that is above the usage
+// threshold.
+func TestAssignerUsageThreshold(t *testing.T) {
+	usageAdminHandler := func(id peer.ID, usage float64) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "GET" && r.URL.String() == "/status" {
+				data, err := json.Marshal(&model.Status{ID: id, Usage: usage})
+				if err != nil {
+					panic(err.Error())
+				}
+				writeJsonResponse(w, http.StatusOK, data)
+				return
+			}
+			defaultTestAdminHandler(w, r)
+		}
+	}
+
+	fakeIndexer1 := newTestIndexer(usageAdminHandler(serverID, 85.0))
+	defer fakeIndexer1.close()
+
+	fakeIndexer2 := newTestIndexer(usageAdminHandler(server2ID, 20.0))
+	defer fakeIndexer2.close()
+
+	cfgAssignment := config.Assignment{
+		IndexCountWeight: 0.5,
+		IndexerPool: []config.Indexer{
+			{
+				AdminURL:  fakeIndexer1.adminServer.URL,
+				FindURL:   fakeIndexer1.findServer.URL,
+				IngestURL: fakeIndexer1.ingestServer.URL,
+			},
+			{
+				AdminURL:  fakeIndexer2.adminServer.URL,
+				FindURL:   fakeIndexer2.findServer.URL,
+				IngestURL: fakeIndexer2.ingestServer.URL,
+			},
+		},
+		Policy: config.Policy{
+			Allow: true,
+		},
+		PubSubTopic:    "testtopic",
+		Replication:    1,
+		UsageThreshold: 80.0,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assigner, err := core.NewAssigner(ctx, cfgAssignment, nil)
+	require.NoError(t, err)
+
+	adCid1, _ := cid.Decode("bafybeigvgzoolc3drupxhlevdp2ugqcrbcsqfmcek2zxiw5wctk3xjpjwy")
+	adCid2, _ := cid.Decode("QmNiV8rwXeC92hufGNu5qJ6L9AygrvDyi63gEpCQaqsE9B")
+	a, _ := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/9999")
+
+	// Indexer 0 has fewer assignments after the first, but is above the usage
+	// threshold, so both publishers are assigned to indexer 1.
+	for i, pubID := range []peer.ID{peer2ID, peer3ID} {
+		adCid := adCid1
+		if i != 0 {
+			adCid = adCid2
+		}
+		asmtChan, cancel := assigner.OnAssignment(pubID)
+		err = assigner.Announce(ctx, adCid, peer.AddrInfo{
+			ID:    pubID,
+			Addrs: []multiaddr.Multiaddr{a},
+		})
+		require.NoError(t, err)
+
+		select {
+		case assignNum := <-asmtChan:
+			require.Equal(t, 1, assignNum)
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for assignment")
+		}
+		cancel()
+	}
+
+	counts := assigner.IndexerAssignedCounts()
+	require.Equal(t, []int{1, 3}, counts)
+
+	require.NoError(t, assigner.Close())
+}
+
 // Test that assigner detects frozen indexer and handsoff its assigned
 // publishers to another indexer.
 func TestFreezeHandoff(t *testing.T) {
@@ -787,6 +874,438 @@ func TestFreezeHandoff(t *testing.T) {
 	fakeIndexer2.close()
 }
 
+func TestRebalance(t *testing.T) {
+	admin1 := newFakeAdmin(serverID, peer1ID, peer2ID, peer3ID)
+	fakeIndexer1 := newTestIndexer(admin1.handle)
+	defer fakeIndexer1.close()
+
+	admin2 := newFakeAdmin(server2ID)
+	fakeIndexer2 := newTestIndexer(admin2.handle)
+	defer fakeIndexer2.close()
+
+	cfgAssignment := config.Assignment{
+		IndexerPool: []config.Indexer{
+			{
+				AdminURL:  fakeIndexer1.adminServer.URL,
+				FindURL:   fakeIndexer1.findServer.URL,
+				IngestURL: fakeIndexer1.ingestServer.URL,
+			},
+			{
+				AdminURL:  fakeIndexer2.adminServer.URL,
+				FindURL:   fakeIndexer2.findServer.URL,
+				IngestURL: fakeIndexer2.ingestServer.URL,
+			},
+		},
+		Policy: config.Policy{
+			Allow: true,
+		},
+		PubSubTopic: "testtopic",
+		Rebalance: config.Rebalance{
+			MaxConcurrent: 2,
+			MaxMoves:      10,
+		},
+		Replication: 1,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assigner, err := core.NewAssigner(ctx, cfgAssignment, nil)
+	require.NoError(t, err)
+	defer assigner.Close()
+	require.Equal(t, []int{3, 0}, assigner.IndexerAssignedCounts())
+
+	// Dry run does not move publishers.
+	plan, err := assigner.Rebalance(ctx, true)
+	require.NoError(t, err)
+	require.True(t, plan.DryRun)
+	require.Equal(t, []int{3, 0}, plan.Before)
+	require.Equal(t, []int{2, 1}, plan.After)
+	require.Len(t, plan.Moves, 1)
+	require.Zero(t, plan.Moved)
+	require.Equal(t, []int{3, 0}, assigner.IndexerAssignedCounts())
+
+	rebal, err := assigner.Rebalance(ctx, false)
+	require.NoError(t, err)
+	require.Equal(t, 1, rebal.Moved)
+	mv := rebal.Moves[0]
+	require.True(t, mv.Done)
+	require.Equal(t, 0, mv.From)
+	require.Equal(t, 1, mv.To)
+	require.Equal(t, []int{1}, assigner.Assigned(mv.Publisher))
+	require.Equal(t, []int{2, 1}, assigner.IndexerAssignedCounts())
+
+	// Publisher handed off to indexer 1 and unassigned from indexer 0.
+	require.Equal(t, map[peer.ID]peer.ID{mv.Publisher: serverID}, admin2.assignedPeers())
+	require.Len(t, admin1.assignedPeers(), 2)
+	require.NotContains(t, admin1.assignedPeers(), mv.Publisher)
+
+	// Already balanced.
+	rebal, err = assigner.Rebalance(ctx, false)
+	require.NoError(t, err)
+	require.Empty(t, rebal.Moves)
+}
+
+func TestManualAssignment(t *testing.T) {
+	admin1 := newFakeAdmin(serverID, peer1ID)
+	fakeIndexer1 := newTestIndexer(admin1.handle)
+	defer fakeIndexer1.close()
+
+	admin2 := newFakeAdmin(server2ID)
+	fakeIndexer2 := newTestIndexer(admin2.handle)
+	defer fakeIndexer2.close()
+
+	assigner, err := core.NewAssigner(context.Background(), twoIndexerConfig(fakeIndexer1, fakeIndexer2), nil)
+	require.NoError(t, err)
+	defer assigner.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.Equal(t, map[peer.ID][]int{peer1ID: {0}}, assigner.Assignments())
+
+	require.NoError(t, assigner.AssignPublisher(ctx, peer2ID, 1))
+	require.Equal(t, []int{1}, assigner.Assigned(peer2ID))
+	require.Contains(t, admin2.assignedPeers(), peer2ID)
+	require.ErrorIs(t, assigner.AssignPublisher(ctx, peer2ID, 1), core.ErrAlreadyAssigned)
+	require.ErrorIs(t, assigner.AssignPublisher(ctx, peer2ID, 2), core.ErrIndexerNotFound)
+
+	require.NoError(t, assigner.MovePublisher(ctx, peer1ID, 0, 1))
+	require.Equal(t, []int{1}, assigner.Assigned(peer1ID))
+	require.Empty(t, admin1.assignedPeers())
+	require.ErrorIs(t, assigner.MovePublisher(ctx, peer1ID, 0, 1), core.ErrNotAssigned)
+	require.Equal(t, []int{0, 2}, assigner.IndexerAssignedCounts())
+
+	indexer, err := assigner.Indexer(1)
+	require.NoError(t, err)
+	require.Equal(t, 2, indexer.Assigned)
+	require.ElementsMatch(t, []peer.ID{peer1ID, peer2ID}, indexer.Publishers)
+
+	require.NoError(t, assigner.UnassignPublisher(ctx, peer2ID, 1))
+	require.Nil(t, assigner.Assigned(peer2ID))
+	require.NotContains(t, admin2.assignedPeers(), peer2ID)
+	require.ErrorIs(t, assigner.UnassignPublisher(ctx, peer2ID, 1), core.ErrNotAssigned)
+	require.Equal(t, []int{0, 1}, assigner.IndexerAssignedCounts())
+}
+
+func TestDrain(t *testing.T) {
+	admin1 := newFakeAdmin(serverID, peer1ID, peer2ID)
+	fakeIndexer1 := newTestIndexer(admin1.handle)
+	defer fakeIndexer1.close()
+
+	admin2 := newFakeAdmin(server2ID, peer3ID)
+	fakeIndexer2 := newTestIndexer(admin2.handle)
+	defer fakeIndexer2.close()
+
+	assigner, err := core.NewAssigner(context.Background(), twoIndexerConfig(fakeIndexer1, fakeIndexer2), nil)
+	require.NoError(t, err)
+	defer assigner.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	moves, err := assigner.Drain(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, moves, 2)
+	for _, mv := range moves {
+		require.True(t, mv.Done, mv.Error)
+		require.Equal(t, 1, mv.To)
+	}
+	require.Empty(t, admin1.assignedPeers())
+	require.Len(t, admin2.assignedPeers(), 3)
+	require.Equal(t, []int{0, 3}, assigner.IndexerAssignedCounts())
+
+	indexers := assigner.Indexers()
+	require.True(t, indexers[0].Draining)
+	require.False(t, indexers[1].Draining)
+
+	// Publishers cannot be moved off of the only remaining indexer.
+	moves, err = assigner.Drain(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, moves, 3)
+	for _, mv := range moves {
+		require.False(t, mv.Done)
+		require.NotEmpty(t, mv.Error)
+	}
+	require.Equal(t, []int{0, 3}, assigner.IndexerAssignedCounts())
+}
+
+func TestAddRetireIndexer(t *testing.T) {
+	admin1 := newFakeAdmin(serverID, peer1ID, peer2ID)
+	fakeIndexer1 := newTestIndexer(admin1.handle)
+	defer fakeIndexer1.close()
+
+	admin2 := newFakeAdmin(server2ID, peer3ID)
+	fakeIndexer2 := newTestIndexer(admin2.handle)
+	defer fakeIndexer2.close()
+
+	server3ID, _, _ := test.RandomIdentity()
+	admin3 := newFakeAdmin(server3ID)
+	fakeIndexer3 := newTestIndexer(admin3.handle)
+	defer fakeIndexer3.close()
+
+	cfgAssignment := twoIndexerConfig(fakeIndexer1, fakeIndexer2)
+	assigner, err := core.NewAssigner(context.Background(), cfgAssignment, nil)
+	require.NoError(t, err)
+	defer assigner.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cfgIndexer3 := config.Indexer{
+		AdminURL:  fakeIndexer3.adminServer.URL,
+		FindURL:   fakeIndexer3.findServer.URL,
+		IngestURL: fakeIndexer3.ingestServer.URL,
+	}
+	indexerNum, err := assigner.AddIndexer(ctx, cfgIndexer3)
+	require.NoError(t, err)
+	require.Equal(t, 2, indexerNum)
+	require.Equal(t, []int{2, 1, 0}, assigner.IndexerAssignedCounts())
+	indexer, err := assigner.Indexer(2)
+	require.NoError(t, err)
+	require.True(t, indexer.Online)
+
+	_, err = assigner.AddIndexer(ctx, cfgIndexer3)
+	require.ErrorIs(t, err, core.ErrIndexerExists)
+
+	// Retiring an indexer moves its publishers to the other indexers.
+	moves, err := assigner.RetireIndexer(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, moves, 2)
+	for _, mv := range moves {
+		require.True(t, mv.Done, mv.Error)
+	}
+	require.Empty(t, admin1.assignedPeers())
+	require.Len(t, assigner.Assignments(), 3)
+	counts := assigner.IndexerAssignedCounts()
+	require.Zero(t, counts[0])
+	require.Equal(t, 3, counts[1]+counts[2])
+
+	indexer, err = assigner.Indexer(0)
+	require.NoError(t, err)
+	require.True(t, indexer.Retired)
+	require.False(t, indexer.Draining)
+
+	err = assigner.AssignPublisher(ctx, peer1ID, 0)
+	require.ErrorIs(t, err, core.ErrIndexerNotFound)
+	_, err = assigner.RetireIndexer(ctx, 0)
+	require.ErrorIs(t, err, core.ErrIndexerNotFound)
+
+	cfgPool := assigner.IndexerPoolConfig()
+	require.Len(t, cfgPool, 2)
+	require.Equal(t, fakeIndexer2.adminServer.URL, cfgPool[0].AdminURL)
+	require.Equal(t, fakeIndexer3.adminServer.URL, cfgPool[1].AdminURL)
+
+	// Adding a retired indexer returns it to its previous position.
+	indexerNum, err = assigner.AddIndexer(ctx, cfgAssignment.IndexerPool[0])
+	require.NoError(t, err)
+	require.Zero(t, indexerNum)
+	indexer, err = assigner.Indexer(0)
+	require.NoError(t, err)
+	require.False(t, indexer.Retired)
+	require.Len(t, assigner.IndexerPoolConfig(), 3)
+
+	// Setting the pool to the original configuration retires the third
+	// indexer.
+	require.NoError(t, assigner.SetIndexerPool(ctx, cfgAssignment.IndexerPool))
+	require.Empty(t, admin3.assignedPeers())
+	counts = assigner.IndexerAssignedCounts()
+	require.Zero(t, counts[2])
+	require.Equal(t, 3, counts[0]+counts[1])
+	require.Len(t, assigner.IndexerPoolConfig(), 2)
+	require.True(t, assigner.Indexers()[2].Retired)
+}
+
+func TestIndexerDown(t *testing.T) {
+	admin1 := newFakeAdmin(serverID, peer1ID, peer2ID)
+	fakeIndexer1 := newTestIndexer(admin1.handle)
+	defer fakeIndexer1.close()
+
+	admin2 := newFakeAdmin(server2ID, peer1ID, peer2ID)
+	fakeIndexer2 := newTestIndexer(admin2.handle)
+	defer fakeIndexer2.close()
+
+	server3ID, _, _ := test.RandomIdentity()
+	admin3 := newFakeAdmin(server3ID)
+	fakeIndexer3 := newTestIndexer(admin3.handle)
+	defer fakeIndexer3.close()
+
+	cfgAssignment := twoIndexerConfig(fakeIndexer1, fakeIndexer2)
+	cfgAssignment.IndexerPool = append(cfgAssignment.IndexerPool, config.Indexer{
+		AdminURL:  fakeIndexer3.adminServer.URL,
+		FindURL:   fakeIndexer3.findServer.URL,
+		IngestURL: fakeIndexer3.ingestServer.URL,
+	})
+	cfgAssignment.Replication = 2
+	cfgAssignment.Health = config.Health{
+		CheckInterval: sticfg.Duration(20 * time.Millisecond),
+		CheckTimeout:  sticfg.Duration(time.Second),
+		GracePeriod:   sticfg.Duration(100 * time.Millisecond),
+	}
+
+	assigner, err := core.NewAssigner(context.Background(), cfgAssignment, nil)
+	require.NoError(t, err)
+	defer assigner.Close()
+
+	require.Equal(t, []int{2, 2, 0}, assigner.IndexerAssignedCounts())
+
+	// When indexer 1 is down, its publishers are assigned to indexer 2.
+	admin2.setUnavailable(true)
+	require.Eventually(t, func() bool {
+		return len(admin3.assignedPeers()) == 2
+	}, 5*time.Second, 20*time.Millisecond, "publishers not assigned to replace down indexer")
+	require.Eventually(t, func() bool {
+		counts := assigner.IndexerAssignedCounts()
+		return counts[0] == 2 && counts[1] == 0 && counts[2] == 2
+	}, time.Second, 10*time.Millisecond)
+	indexer, err := assigner.Indexer(1)
+	require.NoError(t, err)
+	require.True(t, indexer.Down)
+	require.True(t, indexer.Unreachable)
+	require.Equal(t, []int{0, 2}, assigner.Assigned(peer1ID))
+
+	// When indexer 1 recovers, it is unassigned the publishers that already
+	// have enough replicas.
+	admin2.setUnavailable(false)
+	require.Eventually(t, func() bool {
+		events := assigner.Events()
+		return len(events) != 0 && events[len(events)-1].Type == core.EventIndexerReconciled
+	}, 5*time.Second, 20*time.Millisecond, "recovered indexer not reconciled")
+	require.Empty(t, admin2.assignedPeers())
+	require.Equal(t, []int{2, 0, 2}, assigner.IndexerAssignedCounts())
+	require.Equal(t, []int{0, 2}, assigner.Assigned(peer2ID))
+	indexer, err = assigner.Indexer(1)
+	require.NoError(t, err)
+	require.False(t, indexer.Down)
+	require.False(t, indexer.Unreachable)
+
+	eventCounts := make(map[core.EventType]int)
+	for _, event := range assigner.Events() {
+		eventCounts[event.Type]++
+	}
+	require.Equal(t, map[core.EventType]int{
+		core.EventIndexerUnreachable: 1,
+		core.EventIndexerDown:        1,
+		core.EventReplicaRestored:    2,
+		core.EventIndexerRecovered:   1,
+		core.EventReplicaRemoved:     2,
+		core.EventIndexerReconciled:  1,
+	}, eventCounts)
+}
+
+func twoIndexerConfig(indexer1, indexer2 *testIndexer) config.Assignment {
+	return config.Assignment{
+		IndexerPool: []config.Indexer{
+			{
+				AdminURL:  indexer1.adminServer.URL,
+				FindURL:   indexer1.findServer.URL,
+				IngestURL: indexer1.ingestServer.URL,
+			},
+			{
+				AdminURL:  indexer2.adminServer.URL,
+				FindURL:   indexer2.findServer.URL,
+				IngestURL: indexer2.ingestServer.URL,
+			},
+		},
+		Policy: config.Policy{
+			Allow: true,
+		},
+		PubSubTopic: "testtopic",
+		Replication: 1,
+	}
+}
+
+// fakeAdmin is an indexer admin handler that keeps track of assignments.
+type fakeAdmin struct {
+	id          peer.ID
+	mutex       sync.Mutex
+	assigned    map[peer.ID]peer.ID
+	unavailable bool
+}
+
+func newFakeAdmin(id peer.ID, assigned ...peer.ID) *fakeAdmin {
+	fa := &fakeAdmin{
+		id:       id,
+		assigned: make(map[peer.ID]peer.ID),
+	}
+	for _, pubID := range assigned {
+		fa.assigned[pubID] = ""
+	}
+	return fa
+}
+
+func (fa *fakeAdmin) assignedPeers() map[peer.ID]peer.ID {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+	cpy := make(map[peer.ID]peer.ID, len(fa.assigned))
+	for pubID, from := range fa.assigned {
+		cpy[pubID] = from
+	}
+	return cpy
+}
+
+// setUnavailable makes the fake indexer fail all requests, as if it were down.
+func (fa *fakeAdmin) setUnavailable(unavailable bool) {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+	fa.unavailable = unavailable
+}
+
+func (fa *fakeAdmin) handle(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+
+	if fa.unavailable {
+		http.Error(w, "", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/healthcheck":
+		writeJsonResponse(w, http.StatusOK, []byte(`"OK"`))
+	case r.Method == http.MethodGet && r.URL.Path == "/ingest/assigned":
+		assignedInfos := make([]model.Assigned, 0, len(fa.assigned))
+		for pubID, from := range fa.assigned {
+			assignedInfos = append(assignedInfos, model.Assigned{
+				Publisher: pubID,
+				Continued: from,
+			})
+		}
+		data, err := json.Marshal(assignedInfos)
+		if err != nil {
+			panic(err.Error())
+		}
+		writeJsonResponse(w, http.StatusOK, data)
+	case r.Method == http.MethodGet && r.URL.Path == "/ingest/preferred":
+		writeJsonResponse(w, http.StatusNoContent, nil)
+	case r.Method == http.MethodGet && r.URL.Path == "/status":
+		testStatusHandler(fa.id, false, w, r)
+	case strings.HasPrefix(r.URL.Path, "/ingest/"):
+		pubID, err := peer.Decode(path.Base(r.URL.Path))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch path.Base(path.Dir(r.URL.Path)) {
+		case "assign":
+			fa.assigned[pubID] = ""
+		case "unassign":
+			delete(fa.assigned, pubID)
+		case "handoff":
+			var handoff model.Handoff
+			if err = json.NewDecoder(r.Body).Decode(&handoff); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			fa.assigned[pubID] = handoff.FrozenID
+		}
+		writeJsonResponse(w, http.StatusOK, nil)
+	default:
+		http.Error(w, "", http.StatusNotFound)
+	}
+}
+
 type testIndexer struct {
 	adminServer  *httptest.Server
 	findServer   *httptest.Server
@@ -838,6 +1357,10 @@ func testIngestHandler(w http.ResponseWriter, req *http.Request) {
 
 func testFindHandler(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
+	if req.Method == "GET" && req.URL.String() == "/providers" {
+		writeJsonResponse(w, http.StatusOK, []byte("[]"))
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// maxEvents is the number of most recent events kept by the assigner.
+const maxEvents = 1000
+
+// EventType identifies what happened in an Event.
+type EventType string
+
+const (
+	// EventIndexerUnreachable is when an indexer fails a health check after
+	// being healthy.
+	EventIndexerUnreachable EventType = "IndexerUnreachable"
+	// EventIndexerDown is when an indexer has been unreachable for longer
+	// than the grace period, and its publishers are assigned to other
+	// indexers.
+	EventIndexerDown EventType = "IndexerDown"
+	// EventIndexerRecovered is when an unreachable or down indexer passes a
+	// health check.
+	EventIndexerRecovered EventType = "IndexerRecovered"
+	// EventReplicaRestored is when a publisher of a down indexer is assigned
+	// to another indexer.
+	EventReplicaRestored EventType = "ReplicaRestored"
+	// EventReplicaNotRestored is when a publisher of a down indexer could not
+	// be assigned to another indexer.
+	EventReplicaNotRestored EventType = "ReplicaNotRestored"
+	// EventReplicaRemoved is when a publisher is unassigned from a recovered
+	// indexer because the publisher already has enough replicas.
+	EventReplicaRemoved EventType = "ReplicaRemoved"
+	// EventIndexerReconciled is when the replicas of a recovered indexer have
+	// been reconciled with the assignments made while it was down.
+	EventIndexerReconciled EventType = "IndexerReconciled"
+)
+
+// Event records a change in the health of an indexer, or a change in
+// assignments made because of it.
+type Event struct {
+	Time time.Time
+	Type EventType
+	// Indexer is the position of the indexer in the pool. For replica events
+	// this is the indexer that the publisher was assigned to or unassigned
+	// from.
+	Indexer int
+	// Publisher is the publisher whose assignment changed, for replica
+	// events.
+	Publisher peer.ID `json:",omitempty"`
+	// Message has details about the event, such as an error.
+	Message string `json:",omitempty"`
+}
+
+// Events returns the most recent events, oldest first.
+func (a *Assigner) Events() []Event {
+	a.eventMutex.Lock()
+	defer a.eventMutex.Unlock()
+
+	events := make([]Event, len(a.events))
+	copy(events, a.events)
+	return events
+}
+
+// addEvent records an event, discarding the oldest event if there are more
+// than maxEvents.
+func (a *Assigner) addEvent(eventType EventType, indexerNum int, pubID peer.ID, msg string) {
+	a.eventMutex.Lock()
+	defer a.eventMutex.Unlock()
+
+	if len(a.events) == maxEvents {
+		copy(a.events, a.events[1:])
+		a.events = a.events[:maxEvents-1]
+	}
+	a.events = append(a.events, Event{
+		Time:      time.Now(),
+		Type:      eventType,
+		Indexer:   indexerNum,
+		Publisher: pubID,
+		Message:   msg,
+	})
+}
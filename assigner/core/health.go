@@ -0,0 +1,356 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	adminclient "github.com/ipni/storetheindex/admin/client"
+	"github.com/ipni/storetheindex/internal/metrics"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// healthResult is the result of checking the health of an indexer.
+type healthResult struct {
+	indexerNum int
+	err        error
+}
+
+// checkHealth checks the health of each indexer in the pool. An indexer that
+// fails a health check is not assigned publishers. If an indexer has been
+// unreachable for longer than the grace period, then it is down and its
+// publishers are assigned to other indexers to restore their replication.
+// When a down indexer recovers, its replicas are reconciled with the
+// assignments made while it was down.
+func (a *Assigner) checkHealth(ctx context.Context) {
+	a.poolMutex.RLock()
+	defer a.poolMutex.RUnlock()
+
+	a.mutex.Lock()
+	indexers := make([]int, 0, len(a.indexerPool))
+	for i := range a.indexerPool {
+		if !a.indexerPool[i].retired {
+			indexers = append(indexers, i)
+		}
+	}
+	a.mutex.Unlock()
+
+	results := make(chan healthResult, len(indexers))
+	for _, n := range indexers {
+		go func(indexerNum int) {
+			results <- healthResult{
+				indexerNum: indexerNum,
+				err:        a.healthCheck(ctx, indexerNum),
+			}
+		}(n)
+	}
+
+	var down, recovered []int
+	now := time.Now()
+
+	a.mutex.Lock()
+	for range indexers {
+		result := <-results
+		n := result.indexerNum
+		ii := &a.indexerPool[n]
+		log := log.With("indexer", n, "adminURL", ii.adminURL)
+
+		if result.err != nil {
+			recordIndexerUp(n, false)
+			if ii.unreachableSince.IsZero() {
+				ii.unreachableSince = now
+				log.Warnw("Indexer is unreachable", "err", result.err)
+				a.addEvent(EventIndexerUnreachable, n, "", result.err.Error())
+				recordHealthChange(n, "unreachable")
+			} else if !ii.down && now.Sub(ii.unreachableSince) >= time.Duration(a.healthCfg.GracePeriod) {
+				ii.down = true
+				log.Errorw("Indexer is down, restoring replication of its publishers", "err", result.err,
+					"unreachableSince", ii.unreachableSince)
+				a.addEvent(EventIndexerDown, n, "", result.err.Error())
+				recordHealthChange(n, "down")
+				down = append(down, n)
+			}
+			continue
+		}
+
+		recordIndexerUp(n, true)
+		if ii.unreachableSince.IsZero() {
+			if ii.needReconcile {
+				recovered = append(recovered, n)
+			}
+			continue
+		}
+		log.Infow("Indexer recovered", "unreachableFor", now.Sub(ii.unreachableSince).String(), "wasDown", ii.down)
+		a.addEvent(EventIndexerRecovered, n, "", "")
+		recordHealthChange(n, "recovered")
+		if ii.down {
+			ii.needReconcile = true
+			recovered = append(recovered, n)
+		}
+		ii.unreachableSince = time.Time{}
+		ii.down = false
+	}
+	a.mutex.Unlock()
+
+	for _, n := range down {
+		a.restoreReplicas(ctx, n)
+	}
+	for _, n := range recovered {
+		a.reconcileReplicas(ctx, n)
+	}
+}
+
+// healthCheck checks the health of an indexer using its admin and ingest
+// health endpoints.
+func (a *Assigner) healthCheck(ctx context.Context, indexerNum int) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(a.healthCfg.CheckTimeout))
+	defer cancel()
+
+	ii := &a.indexerPool[indexerNum]
+	cl, err := adminclient.New(ii.adminURL)
+	if err != nil {
+		return fmt.Errorf("cannot create admin client: %w", err)
+	}
+	if err = cl.HealthCheck(ctx); err != nil {
+		return fmt.Errorf("admin health check failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ii.ingestURL+"/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ingest health check failed: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ingest health check failed: %s", http.StatusText(resp.StatusCode))
+	}
+	return nil
+}
+
+// restoreReplicas removes a down indexer from the assignments of its
+// publishers, and assigns each publisher that then has too few replicas to
+// another indexer. A publisher that cannot be assigned to another indexer now
+// is assigned when the assigner next receives an announce from it.
+func (a *Assigner) restoreReplicas(ctx context.Context, indexerNum int) {
+	type restore struct {
+		pubID      peer.ID
+		candidates []int
+	}
+
+	a.mutex.Lock()
+	pubs := a.indexerPublishers(indexerNum)
+	counts := make(map[int]int, len(a.indexerPool))
+	for i := range a.indexerPool {
+		counts[i] = a.indexerPool[i].assignedCount()
+	}
+	restores := make([]restore, 0, len(pubs))
+	for _, pubID := range pubs {
+		asmt := a.assigned[pubID]
+		asmt.removeIndexer(indexerNum)
+		a.indexerPool[indexerNum].addAssignedCount(-1)
+		if len(asmt.indexers) >= a.required(pubID) {
+			continue
+		}
+		candidates := a.replicaCandidates(pubID, asmt)
+		if len(candidates) != 0 {
+			a.orderByCounts(candidates, asmt.preferred, counts)
+			counts[candidates[0]]++
+		}
+		restores = append(restores, restore{
+			pubID:      pubID,
+			candidates: candidates,
+		})
+	}
+	a.mutex.Unlock()
+
+	log := log.With("downIndexer", indexerNum)
+	log.Infow("Restoring replication of publishers on down indexer", "publishers", len(pubs), "needReplica", len(restores))
+
+	var restored int
+	for _, r := range restores {
+		if ctx.Err() != nil {
+			return
+		}
+		to, err := a.assignReplica(ctx, r.pubID, r.candidates)
+		if err != nil {
+			log.Warnw("Could not restore replica of publisher", "publisher", r.pubID, "err", err)
+			a.addEvent(EventReplicaNotRestored, indexerNum, r.pubID, err.Error())
+			recordReplicaRestore(indexerNum, "failed")
+			continue
+		}
+		log.Infow("Restored replica of publisher", "publisher", r.pubID, "indexer", to)
+		a.addEvent(EventReplicaRestored, to, r.pubID, "replaces replica on indexer "+strconv.Itoa(indexerNum))
+		recordReplicaRestore(to, "restored")
+		restored++
+	}
+	log.Infow("Done restoring replication", "restored", restored, "notRestored", len(restores)-restored)
+}
+
+// assignReplica assigns a publisher to the first of the candidate indexers
+// that the publisher can be assigned to, and returns that indexer.
+func (a *Assigner) assignReplica(ctx context.Context, pubID peer.ID, candidates []int) (int, error) {
+	if len(candidates) == 0 {
+		return -1, errors.New("no indexer to assign publisher to")
+	}
+	var err error
+	for _, n := range candidates {
+		var cl *adminclient.Client
+		cl, err = adminclient.New(a.indexerPool[n].adminURL)
+		if err != nil {
+			continue
+		}
+		if err = cl.Assign(ctx, pubID); err != nil {
+			err = fmt.Errorf("cannot assign publisher to indexer %d: %w", n, err)
+			continue
+		}
+
+		a.mutex.Lock()
+		asmt, found := a.assigned[pubID]
+		if !found {
+			asmt = &assignment{
+				indexers: []int{},
+			}
+			a.assigned[pubID] = asmt
+		}
+		if !asmt.hasIndexer(n) {
+			asmt.addIndexer(n)
+			a.indexerPool[n].addAssignedCount(1)
+			a.notifyAssignment(pubID, n)
+			recordAssignment(n)
+		}
+		a.mutex.Unlock()
+		return n, nil
+	}
+	return -1, err
+}
+
+// reconcileReplicas reads the assignments of an indexer that has recovered
+// from being down. Each publisher that the indexer is assigned to is kept if
+// the publisher needs the replica. Otherwise the publisher is unassigned from
+// the recovered indexer, since it was assigned to another indexer while the
+// recovered indexer was down.
+func (a *Assigner) reconcileReplicas(ctx context.Context, indexerNum int) {
+	log := log.With("indexer", indexerNum)
+
+	a.mutex.Lock()
+	ii := &a.indexerPool[indexerNum]
+	if ii.down || ii.retired {
+		a.mutex.Unlock()
+		return
+	}
+	ii.initDone = false
+	a.initDone = false
+	a.initAssignments(ctx)
+	if !ii.initDone {
+		a.mutex.Unlock()
+		log.Warn("Could not read assignments of recovered indexer, will retry")
+		return
+	}
+	ii.needReconcile = false
+
+	var remove []peer.ID
+	pubs := a.indexerPublishers(indexerNum)
+	for _, pubID := range pubs {
+		if len(a.assigned[pubID].indexers) > a.required(pubID) {
+			remove = append(remove, pubID)
+			continue
+		}
+		recordReplicaReconcile(indexerNum, "kept")
+	}
+	adminURL := ii.adminURL
+	a.mutex.Unlock()
+
+	log.Infow("Reconciling replicas of recovered indexer", "publishers", len(pubs), "extraReplicas", len(remove))
+
+	cl, err := adminclient.New(adminURL)
+	if err != nil {
+		log.Errorw("Cannot create admin client", "err", err)
+		return
+	}
+	var removed int
+	for _, pubID := range remove {
+		if err = cl.Unassign(ctx, pubID); err != nil {
+			log.Warnw("Could not unassign extra replica from recovered indexer", "publisher", pubID, "err", err)
+			continue
+		}
+		a.mutex.Lock()
+		if asmt, found := a.assigned[pubID]; found && asmt.removeIndexer(indexerNum) {
+			ii.addAssignedCount(-1)
+		}
+		a.mutex.Unlock()
+		a.addEvent(EventReplicaRemoved, indexerNum, pubID, "publisher has enough replicas on other indexers")
+		recordReplicaReconcile(indexerNum, "removed")
+		removed++
+	}
+	msg := fmt.Sprintf("kept %d publishers, removed %d extra replicas", len(pubs)-len(remove), removed)
+	a.addEvent(EventIndexerReconciled, indexerNum, "", msg)
+	log.Infow("Reconciled replicas of recovered indexer", "kept", len(pubs)-len(remove), "removed", removed)
+}
+
+// required returns the number of indexers that a publisher must be assigned
+// to. The Assigner mutex must be held when calling this function.
+func (a *Assigner) required(pubID peer.ID) int {
+	if _, usesPreset := a.presets[pubID]; usesPreset {
+		return a.presetRepl
+	}
+	return a.replication
+}
+
+// replicaCandidates returns the indexers that a publisher can be assigned to
+// in addition to the indexers it is already assigned to. The Assigner mutex
+// must be held when calling this function.
+func (a *Assigner) replicaCandidates(pubID peer.ID, asmt *assignment) []int {
+	var candidates []int
+	if preset, usesPresets := a.presets[pubID]; usesPresets {
+		for _, n := range preset {
+			if !asmt.hasIndexer(n) && a.canAssign(n) {
+				candidates = append(candidates, n)
+			}
+		}
+		return candidates
+	}
+	for n := range a.indexerPool {
+		if !asmt.hasIndexer(n) && a.canAssign(n) {
+			candidates = append(candidates, n)
+		}
+	}
+	return candidates
+}
+
+func recordIndexerUp(indexerNum int, up bool) {
+	var value int64
+	if up {
+		value = 1
+	}
+	_ = stats.RecordWithOptions(context.Background(),
+		stats.WithTags(tag.Insert(metrics.Indexer, strconv.Itoa(indexerNum))),
+		stats.WithMeasurements(metrics.IndexerUp.M(value)))
+}
+
+func recordHealthChange(indexerNum int, reason string) {
+	_ = stats.RecordWithOptions(context.Background(),
+		stats.WithTags(tag.Insert(metrics.Indexer, strconv.Itoa(indexerNum)), tag.Insert(metrics.Reason, reason)),
+		stats.WithMeasurements(metrics.IndexerHealthChangeCount.M(1)))
+}
+
+func recordReplicaRestore(indexerNum int, reason string) {
+	_ = stats.RecordWithOptions(context.Background(),
+		stats.WithTags(tag.Insert(metrics.Indexer, strconv.Itoa(indexerNum)), tag.Insert(metrics.Reason, reason)),
+		stats.WithMeasurements(metrics.ReplicaRestoreCount.M(1)))
+}
+
+func recordReplicaReconcile(indexerNum int, reason string) {
+	_ = stats.RecordWithOptions(context.Background(),
+		stats.WithTags(tag.Insert(metrics.Indexer, strconv.Itoa(indexerNum)), tag.Insert(metrics.Reason, reason)),
+		stats.WithMeasurements(metrics.ReplicaReconcileCount.M(1)))
+}
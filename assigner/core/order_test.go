@@ -38,3 +38,69 @@ func TestOrdering(t *testing.T) {
 	assigner.orderCandidates(candidates, []int{2, 0, 1})
 	require.Equal(t, []int{2, 1, 0, 5, 9, 8, 7, 6, 4, 3}, candidates)
 }
+
+func TestOrderingByCapacity(t *testing.T) {
+	pool := make([]indexerInfo, 4)
+	for i := range pool {
+		pool[i].assigned = int32(i)
+	}
+
+	assigner := &Assigner{
+		indexCountWeight: 0.5,
+		indexerPool:      pool,
+		usageThreshold:   80,
+	}
+
+	candidates := []int{0, 1, 2, 3}
+
+	// Capacity not known for all indexers, so order by assigned count.
+	pool[3].hasUsage = true
+	pool[3].usage = 10
+	assigner.orderCandidates(candidates, nil)
+	require.Equal(t, []int{0, 1, 2, 3}, candidates)
+
+	// Order by free disk space when index counts are not known.
+	for i, usage := range []float64{70, 50, 50, 10} {
+		pool[i].hasUsage = true
+		pool[i].usage = usage
+	}
+	assigner.orderCandidates(candidates, nil)
+	require.Equal(t, []int{3, 1, 2, 0}, candidates)
+
+	// Index counts change the order when known for all indexers.
+	for i, count := range []uint64{0, 1000, 10, 2000} {
+		pool[i].hasIndexCount = true
+		pool[i].indexCount = count
+	}
+	caps := assigner.capacities(candidates)
+	require.InDelta(t, 0.65, caps[0], 0.0001)
+	require.InDelta(t, 0.5, caps[1], 0.0001)
+	require.InDelta(t, 0.7475, caps[2], 0.0001)
+	require.InDelta(t, 0.45, caps[3], 0.0001)
+	assigner.orderCandidates(candidates, nil)
+	require.Equal(t, []int{2, 0, 1, 3}, candidates)
+
+	// Preferred indexers are still first.
+	assigner.orderCandidates(candidates, []int{3})
+	require.Equal(t, []int{3, 2, 0, 1}, candidates)
+
+	// Disk usage only.
+	assigner.indexCountWeight = 0
+	assigner.orderCandidates(candidates, nil)
+	require.Equal(t, []int{3, 1, 2, 0}, candidates)
+
+	require.False(t, assigner.aboveThreshold(0))
+	pool[0].usage = 80
+	require.True(t, assigner.aboveThreshold(0))
+	assigner.usageThreshold = 0
+	require.False(t, assigner.aboveThreshold(0))
+}
+
+func TestAddPreferred(t *testing.T) {
+	var asmt assignment
+	asmt.addPreferred(2)
+	asmt.addPreferred(1)
+	// Reinitializing a recovered indexer adds its preferred publishers again.
+	asmt.addPreferred(2)
+	require.Equal(t, []int{2, 1}, asmt.preferred)
+}
@@ -0,0 +1,267 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipni/storetheindex/assigner/config"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+var (
+	// ErrIndexerExists is returned when adding an indexer that is already in
+	// the pool.
+	ErrIndexerExists = errors.New("indexer already in pool")
+	// ErrIndexerOffline is returned when retiring an indexer whose
+	// assignments have not been read, since its publishers cannot be handed
+	// off.
+	ErrIndexerOffline = errors.New("indexer is offline")
+)
+
+// AddIndexer adds an indexer to the pool and reads the indexer's existing
+// assignments. The indexer is added at the end of the pool, unless it was
+// previously retired, in which case it is returned to its previous position.
+// Returns the position of the indexer in the pool.
+//
+// If the indexer's assignments cannot be read, the indexer is still added and
+// its assignments are read when next needed.
+func (a *Assigner) AddIndexer(ctx context.Context, cfgIndexer config.Indexer) (int, error) {
+	a.poolMutex.Lock()
+	defer a.poolMutex.Unlock()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// Reuse the position of a retired indexer with the same admin URL, and
+	// check that URLs are unique among the other indexers.
+	indexerNum := len(a.indexerPool)
+	seen := make(map[string]struct{}, 3*len(a.indexerPool))
+	for i := range a.indexerPool {
+		ii := &a.indexerPool[i]
+		if ii.retired {
+			if ii.adminURL == normalizeURL(cfgIndexer.AdminURL) {
+				indexerNum = i
+			}
+			continue
+		}
+		seen[ii.adminURL] = struct{}{}
+		seen[ii.findURL] = struct{}{}
+		seen[ii.ingestURL] = struct{}{}
+	}
+	if _, ok := seen[normalizeURL(cfgIndexer.AdminURL)]; ok {
+		return 0, ErrIndexerExists
+	}
+
+	iInfo, presetPeers, err := indexerFromConfig(cfgIndexer, indexerNum, seen)
+	if err != nil {
+		return 0, err
+	}
+
+	if indexerNum == len(a.indexerPool) {
+		a.indexerPool = append(a.indexerPool, iInfo)
+	} else {
+		a.indexerPool[indexerNum] = iInfo
+	}
+	if len(presetPeers) != 0 {
+		if a.presets == nil {
+			a.presets = make(map[peer.ID][]int)
+		}
+		for _, pubID := range presetPeers {
+			a.presets[pubID] = append(a.presets[pubID], indexerNum)
+		}
+	}
+
+	if a.replication < a.cfgReplication {
+		a.replication = a.cfgReplication
+		if active := a.activeCount(); a.replication > active {
+			a.replication = active
+		}
+	}
+
+	log := log.With("indexer", indexerNum, "adminURL", iInfo.adminURL)
+	log.Info("Added indexer to pool")
+
+	a.initDone = false
+	if a.initAssignments(ctx) != 0 && !a.indexerPool[indexerNum].initDone {
+		log.Warn("Could not get existing assignments for new indexer, will retry later")
+	}
+	return indexerNum, nil
+}
+
+// RetireIndexer removes an indexer from the pool by moving all of its
+// publishers to other indexers, and then no longer using the indexer. The
+// indexer keeps its position in the pool so that the positions of the other
+// indexers do not change.
+//
+// If any publishers cannot be moved, then the indexer is not retired, but
+// remains draining so that no more publishers are assigned to it. The
+// returned moves record which publishers were moved and which could not be
+// moved.
+func (a *Assigner) RetireIndexer(ctx context.Context, indexerNum int) ([]Move, error) {
+	if !a.moveMutex.TryLock() {
+		return nil, ErrMovesInProgress
+	}
+	defer a.moveMutex.Unlock()
+
+	a.mutex.Lock()
+	if a.inPool(indexerNum) && !a.indexerPool[indexerNum].initDone && !a.indexerPool[indexerNum].retired {
+		a.mutex.Unlock()
+		return nil, ErrIndexerOffline
+	}
+	a.mutex.Unlock()
+
+	moves, err := a.drain(ctx, indexerNum)
+	if err != nil {
+		return moves, err
+	}
+	for i := range moves {
+		if !moves[i].Done {
+			return moves, fmt.Errorf("could not move all publishers from indexer %d", indexerNum)
+		}
+	}
+
+	// Pool readers that do not hold the mutex check whether indexers are
+	// retired, so write-lock the pool while retiring the indexer.
+	a.poolMutex.Lock()
+	defer a.poolMutex.Unlock()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// Check that no publishers were assigned while draining.
+	if pubs := a.indexerPublishers(indexerNum); len(pubs) != 0 {
+		return moves, fmt.Errorf("indexer %d still has %d publishers", indexerNum, len(pubs))
+	}
+
+	ii := &a.indexerPool[indexerNum]
+	ii.retired = true
+	ii.draining = false
+	ii.needHandoff = nil
+	ii.presetPeers = nil
+
+	// Remove the indexer from preset and preferred assignments.
+	for pubID, preset := range a.presets {
+		a.presets[pubID] = removeInt(preset, indexerNum)
+		if len(a.presets[pubID]) == 0 {
+			delete(a.presets, pubID)
+		}
+	}
+	for _, asmt := range a.assigned {
+		asmt.preferred = removeInt(asmt.preferred, indexerNum)
+	}
+
+	log.Infow("Retired indexer", "indexer", indexerNum, "adminURL", ii.adminURL)
+	return moves, nil
+}
+
+// SetIndexerPool changes the pool to have the given indexers. Indexers are
+// identified by their admin URLs. Indexers that are not in the pool are
+// added, and indexers that are in the pool but not in the given indexers are
+// retired. The positions of indexers already in the pool do not change.
+func (a *Assigner) SetIndexerPool(ctx context.Context, cfgIndexerPool []config.Indexer) error {
+	if len(cfgIndexerPool) == 0 {
+		return errors.New("no indexers configured to assign to")
+	}
+
+	want := make(map[string]struct{}, len(cfgIndexerPool))
+	for i := range cfgIndexerPool {
+		want[normalizeURL(cfgIndexerPool[i].AdminURL)] = struct{}{}
+	}
+
+	var retire []int
+	have := make(map[string]struct{})
+	a.mutex.Lock()
+	for i := range a.indexerPool {
+		ii := &a.indexerPool[i]
+		if ii.retired {
+			continue
+		}
+		if _, ok := want[ii.adminURL]; ok {
+			have[ii.adminURL] = struct{}{}
+		} else {
+			retire = append(retire, i)
+		}
+	}
+	a.mutex.Unlock()
+
+	var errs []error
+	for i := range cfgIndexerPool {
+		if _, ok := have[normalizeURL(cfgIndexerPool[i].AdminURL)]; ok {
+			continue
+		}
+		if _, err := a.AddIndexer(ctx, cfgIndexerPool[i]); err != nil {
+			errs = append(errs, fmt.Errorf("cannot add indexer %s: %w", cfgIndexerPool[i].AdminURL, err))
+		}
+	}
+	for _, indexerNum := range retire {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+		if _, err := a.RetireIndexer(ctx, indexerNum); err != nil {
+			errs = append(errs, fmt.Errorf("cannot retire indexer %d: %w", indexerNum, err))
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return fmt.Errorf("%w, and %d more errors", errs[0], len(errs)-1)
+}
+
+// IndexerPoolConfig returns the configuration of the indexers in the pool,
+// not including retired indexers.
+func (a *Assigner) IndexerPoolConfig() []config.Indexer {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	cfgIndexerPool := make([]config.Indexer, 0, len(a.indexerPool))
+	for i := range a.indexerPool {
+		ii := &a.indexerPool[i]
+		if ii.retired {
+			continue
+		}
+		cfgIndexerPool = append(cfgIndexerPool, config.Indexer{
+			AdminURL:    ii.adminURL,
+			FindURL:     ii.findURL,
+			IngestURL:   ii.ingestURL,
+			PresetPeers: ii.presetPeers,
+		})
+	}
+	return cfgIndexerPool
+}
+
+// activeCount returns the number of indexers in the pool that are not
+// retired. The Assigner mutex must be held when calling this function.
+func (a *Assigner) activeCount() int {
+	var count int
+	for i := range a.indexerPool {
+		if !a.indexerPool[i].retired {
+			count++
+		}
+	}
+	return count
+}
+
+// normalizeURL returns the URL in the form stored in the pool, or the
+// original string if it cannot be parsed.
+func normalizeURL(urlStr string) string {
+	u, err := configURL(urlStr, "", 0, map[string]struct{}{})
+	if err != nil {
+		return urlStr
+	}
+	return u
+}
+
+func removeInt(ints []int, x int) []int {
+	for i := range ints {
+		if ints[i] == x {
+			return append(ints[:i], ints[i+1:]...)
+		}
+	}
+	return ints
+}
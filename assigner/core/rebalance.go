@@ -0,0 +1,325 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	adminclient "github.com/ipni/storetheindex/admin/client"
+	"github.com/ipni/storetheindex/internal/metrics"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// ErrMovesInProgress is returned when rebalancing or draining is requested
+// while publishers are already being moved by rebalancing or draining.
+var ErrMovesInProgress = errors.New("publisher moves already in progress")
+
+// Move describes moving a publisher from one indexer to another. The indexer
+// values are positions in the indexer pool.
+type Move struct {
+	Publisher peer.ID
+	From      int
+	To        int
+	// Done is true if the publisher was moved.
+	Done bool `json:",omitempty"`
+	// Error is the reason the publisher could not be moved.
+	Error string `json:",omitempty"`
+}
+
+// Rebalance describes a plan to move publishers from over-loaded indexers to
+// under-loaded indexers, and the result of carrying out the plan.
+type Rebalance struct {
+	// DryRun is true if the plan was made but not carried out.
+	DryRun bool
+	// Started is when the rebalancing started.
+	Started time.Time
+	// Finished is when the rebalancing finished.
+	Finished time.Time
+	// Before is the number of publishers assigned to each indexer in the
+	// pool before rebalancing.
+	Before []int
+	// After is the number of publishers assigned to each indexer in the pool
+	// if all moves are done.
+	After []int
+	// Moves are the moves in the plan.
+	Moves []Move
+	// Moved is the number of publishers that were moved.
+	Moved int
+}
+
+// Rebalance moves publishers from over-loaded indexers to under-loaded
+// indexers in the pool. An indexer is over-loaded when it is assigned more
+// publishers than the pool average plus the configured tolerance. A publisher
+// is moved by handing it off to an under-loaded indexer, which continues
+// indexing from the last advertisement the over-loaded indexer processed, and
+// then unassigning it from the over-loaded indexer.
+//
+// If dryRun is true, then only the plan is returned and no publishers are
+// moved. Returns ErrMovesInProgress if rebalancing or draining is already in
+// progress.
+func (a *Assigner) Rebalance(ctx context.Context, dryRun bool) (*Rebalance, error) {
+	if !a.moveMutex.TryLock() {
+		return nil, ErrMovesInProgress
+	}
+	defer a.moveMutex.Unlock()
+
+	rebal := &Rebalance{
+		DryRun:  dryRun,
+		Started: time.Now(),
+	}
+
+	a.mutex.Lock()
+	rebal.Before, rebal.After, rebal.Moves = a.planRebalance()
+	a.mutex.Unlock()
+
+	log.Infow("Planned rebalance", "moves", len(rebal.Moves), "before", rebal.Before, "after", rebal.After, "dryRun", dryRun)
+	if dryRun || len(rebal.Moves) == 0 {
+		rebal.Finished = time.Now()
+		return rebal, nil
+	}
+
+	rebal.Moved = a.runMoves(ctx, rebal.Moves)
+	rebal.Finished = time.Now()
+	log.Infow("Finished rebalance", "moved", rebal.Moved, "planned", len(rebal.Moves),
+		"elapsed", rebal.Finished.Sub(rebal.Started))
+	if ctx.Err() != nil {
+		return rebal, ctx.Err()
+	}
+	return rebal, nil
+}
+
+// planRebalance returns the number of publishers assigned to each indexer,
+// before and after rebalancing, and the moves that rebalance the publishers.
+// Publishers are moved from the indexer with the most publishers to the
+// indexer with the most free capacity that is below the pool average. Only
+// indexers that are online, not frozen, and not being drained are rebalanced.
+//
+// The Assigner mutex must be held when calling this function.
+func (a *Assigner) planRebalance() ([]int, []int, []Move) {
+	before := make([]int, len(a.indexerPool))
+	pubs := make([][]peer.ID, len(a.indexerPool))
+	for pubID, asmt := range a.assigned {
+		for _, n := range asmt.indexers {
+			before[n]++
+			pubs[n] = append(pubs[n], pubID)
+		}
+	}
+	after := make([]int, len(before))
+	copy(after, before)
+
+	var active []int
+	var total int
+	for i := range a.indexerPool {
+		ii := &a.indexerPool[i]
+		if !ii.initDone || ii.retired || ii.frozen || ii.draining || !ii.unreachableSince.IsZero() || len(ii.needHandoff) != 0 {
+			continue
+		}
+		active = append(active, i)
+		total += before[i]
+	}
+	if len(active) < 2 {
+		return before, after, nil
+	}
+
+	avg := int(math.Ceil(float64(total) / float64(len(active))))
+	overLimit := avg + a.rebalanceCfg.Tolerance
+
+	// Move publishers in a consistent order.
+	for _, n := range active {
+		sort.Slice(pubs[n], func(i, j int) bool { return pubs[n][i] < pubs[n][j] })
+	}
+
+	// Indexers above the usage threshold do not get more publishers.
+	eligible := make(map[int]bool, len(active))
+	for _, n := range active {
+		eligible[n] = !a.aboveThreshold(n)
+	}
+
+	var moves []Move
+	moved := make(map[peer.ID]struct{})
+	exhausted := make(map[int]struct{})
+	candidates := make([]int, 0, len(active))
+	counts := make(map[int]int, len(active))
+
+	for len(moves) < a.rebalanceCfg.MaxMoves {
+		// Find the most over-loaded indexer that still has publishers that
+		// can be moved.
+		from := -1
+		for _, n := range active {
+			if _, ok := exhausted[n]; ok || after[n] <= overLimit {
+				continue
+			}
+			if from == -1 || after[n] > after[from] {
+				from = n
+			}
+		}
+		if from == -1 {
+			break
+		}
+
+		var mv *Move
+		for _, pubID := range pubs[from] {
+			if _, ok := moved[pubID]; ok {
+				continue
+			}
+			asmt := a.assigned[pubID]
+			if !asmt.hasIndexer(from) {
+				continue
+			}
+			candidates = candidates[:0]
+			for _, n := range a.rebalanceTargets(pubID, active) {
+				if after[n] < avg && eligible[n] && !asmt.hasIndexer(n) {
+					candidates = append(candidates, n)
+					counts[n] = after[n]
+				}
+			}
+			if len(candidates) == 0 {
+				continue
+			}
+			a.orderByCounts(candidates, asmt.preferred, counts)
+			mv = &Move{
+				Publisher: pubID,
+				From:      from,
+				To:        candidates[0],
+			}
+			break
+		}
+		if mv == nil {
+			exhausted[from] = struct{}{}
+			continue
+		}
+		moves = append(moves, *mv)
+		moved[mv.Publisher] = struct{}{}
+		after[mv.From]--
+		after[mv.To]++
+	}
+	return before, after, moves
+}
+
+// runMoves moves publishers, running up to the configured maximum number of
+// moves concurrently, and returns the number of publishers moved. The result
+// of each move is recorded in the move. Moves that already have an error are
+// skipped.
+func (a *Assigner) runMoves(ctx context.Context, moves []Move) int {
+	a.poolMutex.RLock()
+	defer a.poolMutex.RUnlock()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, a.rebalanceCfg.MaxConcurrent)
+	for i := range moves {
+		if ctx.Err() != nil {
+			break
+		}
+		if moves[i].Error != "" {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(mv *Move) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := a.movePublisher(ctx, mv.Publisher, mv.From, mv.To)
+			result := "moved"
+			if err != nil {
+				mv.Error = err.Error()
+				result = "failed"
+				log.Errorw("Could not move publisher", "err", err, "publisher", mv.Publisher, "from", mv.From, "to", mv.To)
+			} else {
+				mv.Done = true
+				log.Infow("Moved publisher", "publisher", mv.Publisher, "from", mv.From, "to", mv.To)
+			}
+			_ = stats.RecordWithOptions(context.Background(),
+				stats.WithTags(tag.Insert(metrics.Indexer, strconv.Itoa(mv.To)), tag.Insert(metrics.Reason, result)),
+				stats.WithMeasurements(metrics.PublisherMoveCount.M(1)))
+		}(&moves[i])
+	}
+	wg.Wait()
+
+	var moved int
+	for i := range moves {
+		if moves[i].Done {
+			moved++
+		}
+	}
+	return moved
+}
+
+// rebalanceTargets returns the active indexers that a publisher can be moved
+// to. A publisher with preset indexers can only be moved to one of those.
+func (a *Assigner) rebalanceTargets(pubID peer.ID, active []int) []int {
+	preset, usesPreset := a.presets[pubID]
+	if !usesPreset {
+		return active
+	}
+	var targets []int
+	for _, n := range active {
+		for _, p := range preset {
+			if n == p {
+				targets = append(targets, n)
+				break
+			}
+		}
+	}
+	return targets
+}
+
+// movePublisher hands off a publisher to the indexer it is moved to, and then
+// unassigns the publisher from the indexer it was moved from.
+func (a *Assigner) movePublisher(ctx context.Context, pubID peer.ID, from, to int) error {
+	if err := a.handoffPublisher(ctx, pubID, from, to); err != nil {
+		return fmt.Errorf("cannot handoff to indexer %d: %w", to, err)
+	}
+
+	// Handoff does not assign the publisher if the publisher no longer
+	// publishes for any provider on the indexer it is moved from, so check
+	// that the publisher was assigned.
+	toClient, err := adminclient.New(a.indexerPool[to].adminURL)
+	if err != nil {
+		return err
+	}
+	assigned, err := toClient.ListAssignedPeers(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get assignments from indexer %d: %w", to, err)
+	}
+	if _, ok := assigned[pubID]; !ok {
+		return fmt.Errorf("publisher has no providers to handoff on indexer %d", from)
+	}
+
+	a.mutex.Lock()
+	asmt, found := a.assigned[pubID]
+	if !found {
+		asmt = &assignment{
+			indexers: []int{},
+		}
+		a.assigned[pubID] = asmt
+	}
+	asmt.addIndexer(to)
+	a.indexerPool[to].addAssignedCount(1)
+	a.notifyAssignment(pubID, to)
+	a.mutex.Unlock()
+	recordAssignment(to)
+
+	fromClient, err := adminclient.New(a.indexerPool[from].adminURL)
+	if err != nil {
+		return err
+	}
+	if err = fromClient.Unassign(ctx, pubID); err != nil {
+		return fmt.Errorf("handed off, but cannot unassign from indexer %d: %w", from, err)
+	}
+
+	a.mutex.Lock()
+	if asmt.removeIndexer(from) {
+		a.indexerPool[from].addAssignedCount(-1)
+	}
+	a.mutex.Unlock()
+	return nil
+}
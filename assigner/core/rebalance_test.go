@@ -0,0 +1,81 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/ipni/go-libipni/test"
+	"github.com/ipni/storetheindex/assigner/config"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanRebalance(t *testing.T) {
+	pool := make([]indexerInfo, 4)
+	for i := range pool {
+		pool[i].initDone = true
+	}
+	// Indexer 3 is frozen and is not rebalanced.
+	pool[3].frozen = true
+
+	assigner := &Assigner{
+		assigned:     make(map[peer.ID]*assignment),
+		indexerPool:  pool,
+		rebalanceCfg: config.Rebalance{MaxMoves: 100, Tolerance: 1},
+	}
+
+	// Assign 9 publishers to indexer 0, 1 to indexer 1, and 2 to indexer 3.
+	pubs := make([]peer.ID, 12)
+	for i := range pubs {
+		pubs[i], _, _ = test.RandomIdentity()
+		var n int
+		switch {
+		case i < 9:
+			n = 0
+		case i < 10:
+			n = 1
+		default:
+			n = 3
+		}
+		assigner.assigned[pubs[i]] = &assignment{indexers: []int{n}}
+	}
+	// Publisher on indexer 0 is also on indexer 2, so cannot be moved there.
+	assigner.assigned[pubs[0]].addIndexer(2)
+
+	before, after, moves := assigner.planRebalance()
+	require.Equal(t, []int{9, 1, 1, 2}, before)
+	// Average is 4, so indexer 0 is over-loaded above 5.
+	require.Equal(t, 5, after[0])
+	require.Equal(t, 6, after[1]+after[2])
+	require.LessOrEqual(t, after[1], 4)
+	require.LessOrEqual(t, after[2], 4)
+	require.Equal(t, 2, after[3])
+	require.Len(t, moves, 4)
+	for _, mv := range moves {
+		require.Equal(t, 0, mv.From)
+		require.NotEqual(t, 3, mv.To)
+		if mv.Publisher == pubs[0] {
+			require.Equal(t, 1, mv.To)
+		}
+	}
+
+	// Limit the number of moves.
+	assigner.rebalanceCfg.MaxMoves = 1
+	_, after, moves = assigner.planRebalance()
+	require.Equal(t, 8, after[0])
+	require.Equal(t, 3, after[1]+after[2])
+	require.Len(t, moves, 1)
+
+	// Indexer above usage threshold does not get publishers.
+	assigner.rebalanceCfg.MaxMoves = 100
+	assigner.usageThreshold = 80
+	pool[1].hasUsage = true
+	pool[1].usage = 90
+	_, after, _ = assigner.planRebalance()
+	require.Equal(t, []int{6, 1, 4, 2}, after)
+
+	// Nothing to do when balanced within tolerance.
+	assigner.usageThreshold = 0
+	assigner.rebalanceCfg.Tolerance = 10
+	_, _, moves = assigner.planRebalance()
+	require.Empty(t, moves)
+}
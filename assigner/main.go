@@ -38,6 +38,7 @@ func main() {
 		Description: "The assigner service is responsible for assigning content advertisement publishers to indexers.",
 		Version:     revision.Revision,
 		Commands: []*cli.Command{
+			command.AdminCmd,
 			command.DaemonCmd,
 			command.InitCmd,
 		},
@@ -0,0 +1,339 @@
+package adminserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/ipni/storetheindex/assigner/config"
+	"github.com/ipni/storetheindex/assigner/core"
+	"github.com/ipni/storetheindex/internal/httpserver"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+type adminHandler struct {
+	// ctx is used for moving publishers, so that moves are not interrupted
+	// if the client goes away.
+	ctx           context.Context
+	assigner      *core.Assigner
+	reloadErrChan chan<- chan error
+	savePoolFunc  SavePoolFunc
+}
+
+// ----- assignment handlers -----
+
+func (h *adminHandler) listAssignments(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.MethodOK(w, r, http.MethodGet) {
+		return
+	}
+	writeJson(w, h.assigner.Assignments())
+}
+
+func (h *adminHandler) getAssignment(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.MethodOK(w, r, http.MethodGet) {
+		return
+	}
+	pubID, ok := decodePeerID(path.Base(r.URL.Path), w)
+	if !ok {
+		return
+	}
+	indexers := h.assigner.Assigned(pubID)
+	if len(indexers) == 0 {
+		http.Error(w, "publisher not assigned", http.StatusNotFound)
+		return
+	}
+	writeJson(w, indexers)
+}
+
+func (h *adminHandler) assign(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.MethodOK(w, r, http.MethodPut) {
+		return
+	}
+	pubID, ok := decodePeerID(path.Base(r.URL.Path), w)
+	if !ok {
+		return
+	}
+	indexerNum, ok := indexerParam(r, w, "indexer")
+	if !ok {
+		return
+	}
+	if err := h.assigner.AssignPublisher(r.Context(), pubID, indexerNum); err != nil {
+		assignError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *adminHandler) unassign(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.MethodOK(w, r, http.MethodPut) {
+		return
+	}
+	pubID, ok := decodePeerID(path.Base(r.URL.Path), w)
+	if !ok {
+		return
+	}
+	indexerNum, ok := indexerParam(r, w, "indexer")
+	if !ok {
+		return
+	}
+	if err := h.assigner.UnassignPublisher(r.Context(), pubID, indexerNum); err != nil {
+		assignError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *adminHandler) move(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.MethodOK(w, r, http.MethodPost) {
+		return
+	}
+	pubID, ok := decodePeerID(path.Base(r.URL.Path), w)
+	if !ok {
+		return
+	}
+	from, ok := indexerParam(r, w, "from")
+	if !ok {
+		return
+	}
+	to, ok := indexerParam(r, w, "to")
+	if !ok {
+		return
+	}
+	if err := h.assigner.MovePublisher(h.ctx, pubID, from, to); err != nil {
+		assignError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ----- indexer pool handlers -----
+
+func (h *adminHandler) counts(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.MethodOK(w, r, http.MethodGet) {
+		return
+	}
+	writeJson(w, h.assigner.IndexerAssignedCounts())
+}
+
+func (h *adminHandler) listIndexers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJson(w, h.assigner.Indexers())
+	case http.MethodPost:
+		h.addIndexer(w, r)
+	default:
+		w.Header().Set("Allow", http.MethodGet)
+		w.Header().Add("Allow", http.MethodPost)
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *adminHandler) addIndexer(w http.ResponseWriter, r *http.Request) {
+	var cfgIndexer config.Indexer
+	if err := json.NewDecoder(r.Body).Decode(&cfgIndexer); err != nil {
+		http.Error(w, "cannot decode indexer config: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if cfgIndexer.AdminURL == "" || cfgIndexer.FindURL == "" || cfgIndexer.IngestURL == "" {
+		http.Error(w, "indexer admin, find, and ingest urls are required", http.StatusBadRequest)
+		return
+	}
+	indexerNum, err := h.assigner.AddIndexer(h.ctx, cfgIndexer)
+	if err != nil {
+		assignError(w, err)
+		return
+	}
+	h.savePool()
+
+	indexer, err := h.assigner.Indexer(indexerNum)
+	if err != nil {
+		assignError(w, err)
+		return
+	}
+	writeJson(w, indexer)
+}
+
+func (h *adminHandler) getIndexer(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		h.retireIndexer(w, r)
+		return
+	default:
+		w.Header().Set("Allow", http.MethodGet)
+		w.Header().Add("Allow", http.MethodDelete)
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	indexerNum, ok := decodeIndexer(path.Base(r.URL.Path), w)
+	if !ok {
+		return
+	}
+	indexer, err := h.assigner.Indexer(indexerNum)
+	if err != nil {
+		assignError(w, err)
+		return
+	}
+	writeJson(w, indexer)
+}
+
+func (h *adminHandler) retireIndexer(w http.ResponseWriter, r *http.Request) {
+	indexerNum, ok := decodeIndexer(path.Base(r.URL.Path), w)
+	if !ok {
+		return
+	}
+	moves, err := h.assigner.RetireIndexer(h.ctx, indexerNum)
+	if err != nil {
+		assignError(w, err)
+		return
+	}
+	h.savePool()
+
+	if moves == nil {
+		moves = []core.Move{}
+	}
+	writeJson(w, moves)
+}
+
+func (h *adminHandler) drain(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.MethodOK(w, r, http.MethodPost) {
+		return
+	}
+	indexerNum, ok := decodeIndexer(path.Base(r.URL.Path), w)
+	if !ok {
+		return
+	}
+	moves, err := h.assigner.Drain(h.ctx, indexerNum)
+	if err != nil && moves == nil {
+		assignError(w, err)
+		return
+	}
+	if moves == nil {
+		moves = []core.Move{}
+	}
+	writeJson(w, moves)
+}
+
+func (h *adminHandler) events(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.MethodOK(w, r, http.MethodGet) {
+		return
+	}
+	writeJson(w, h.assigner.Events())
+}
+
+func (h *adminHandler) poll(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.MethodOK(w, r, http.MethodPost) {
+		return
+	}
+	h.assigner.PollNow()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *adminHandler) rebalance(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.MethodOK(w, r, http.MethodPost) {
+		return
+	}
+	var dryRun bool
+	if dryRunStr := r.URL.Query().Get("dryrun"); dryRunStr != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(dryRunStr)
+		if err != nil {
+			http.Error(w, "bad dryrun value", http.StatusBadRequest)
+			return
+		}
+	}
+	rebal, err := h.assigner.Rebalance(h.ctx, dryRun)
+	if err != nil && rebal == nil {
+		assignError(w, err)
+		return
+	}
+	writeJson(w, rebal)
+}
+
+// ----- config handlers -----
+
+func (h *adminHandler) reloadConfig(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.MethodOK(w, r, http.MethodPost) {
+		return
+	}
+	if h.reloadErrChan == nil {
+		http.Error(w, "config reload not available", http.StatusNotImplemented)
+		return
+	}
+
+	errChan := make(chan error)
+	h.reloadErrChan <- errChan
+	err := <-errChan
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ----- utility functions -----
+
+// savePool persists the indexer pool after it has changed. The pool change is
+// not undone if it cannot be saved, since the running assigner is already
+// using the new pool.
+func (h *adminHandler) savePool() {
+	if h.savePoolFunc == nil {
+		return
+	}
+	if err := h.savePoolFunc(h.assigner.IndexerPoolConfig()); err != nil {
+		log.Errorw("Cannot save indexer pool configuration", "err", err)
+	}
+}
+
+func assignError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, core.ErrIndexerNotFound), errors.Is(err, core.ErrNotAssigned):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, core.ErrAlreadyAssigned), errors.Is(err, core.ErrMovesInProgress),
+		errors.Is(err, core.ErrIndexerExists), errors.Is(err, core.ErrIndexerOffline):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Errorw("Assigner admin request failed", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func decodePeerID(id string, w http.ResponseWriter) (peer.ID, bool) {
+	peerID, err := peer.Decode(id)
+	if err != nil {
+		http.Error(w, "Cannot decode peer id", http.StatusBadRequest)
+		return peerID, false
+	}
+	return peerID, true
+}
+
+func decodeIndexer(num string, w http.ResponseWriter) (int, bool) {
+	indexerNum, err := strconv.Atoi(num)
+	if err != nil {
+		http.Error(w, "Cannot decode indexer number", http.StatusBadRequest)
+		return 0, false
+	}
+	return indexerNum, true
+}
+
+func indexerParam(r *http.Request, w http.ResponseWriter, name string) (int, bool) {
+	num := r.URL.Query().Get(name)
+	if num == "" {
+		http.Error(w, "missing "+name+" parameter", http.StatusBadRequest)
+		return 0, false
+	}
+	return decodeIndexer(num, w)
+}
+
+func writeJson(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Errorw("Error marshaling response", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	httpserver.WriteJsonResponse(w, http.StatusOK, data)
+}
@@ -0,0 +1,80 @@
+package adminserver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ipni/storetheindex/assigner/config"
+)
+
+const (
+	// Drain and rebalance requests wait for publishers to be moved, so allow
+	// a long time to write the response.
+	defaultWriteTimeout = 10 * time.Minute
+	defaultReadTimeout  = 30 * time.Second
+)
+
+// serverConfig contains all options for the server.
+type serverConfig struct {
+	reloadErrChan chan<- chan error
+	savePoolFunc  SavePoolFunc
+	writeTimeout  time.Duration
+	readTimeout   time.Duration
+}
+
+// SavePoolFunc persists the indexer pool configuration after indexers are
+// added or retired.
+type SavePoolFunc func(cfgIndexerPool []config.Indexer) error
+
+// Option is a function that sets a value in a serverConfig.
+type Option func(*serverConfig) error
+
+// getOpts creates a serverConfig and applies Options to it.
+func getOpts(opts []Option) (serverConfig, error) {
+	cfg := serverConfig{
+		writeTimeout: defaultWriteTimeout,
+		readTimeout:  defaultReadTimeout,
+	}
+
+	for i, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return serverConfig{}, fmt.Errorf("option %d error: %s", i, err)
+		}
+	}
+	return cfg, nil
+}
+
+// WithReload enables reloading the configuration. A reload request sends a
+// channel on reloadErrChan, and the result of the reload is read from that
+// channel.
+func WithReload(reloadErrChan chan<- chan error) Option {
+	return func(c *serverConfig) error {
+		c.reloadErrChan = reloadErrChan
+		return nil
+	}
+}
+
+// WithSavePool sets the function that persists the indexer pool after
+// indexers are added or retired.
+func WithSavePool(savePoolFunc SavePoolFunc) Option {
+	return func(c *serverConfig) error {
+		c.savePoolFunc = savePoolFunc
+		return nil
+	}
+}
+
+// WithWriteTimeout configures server write timeout.
+func WithWriteTimeout(t time.Duration) Option {
+	return func(c *serverConfig) error {
+		c.writeTimeout = t
+		return nil
+	}
+}
+
+// WithReadTimeout configures server read timeout.
+func WithReadTimeout(t time.Duration) Option {
+	return func(c *serverConfig) error {
+		c.readTimeout = t
+		return nil
+	}
+}
@@ -0,0 +1,88 @@
+package adminserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipni/storetheindex/assigner/core"
+)
+
+var log = logging.Logger("assigner/admin")
+
+type Server struct {
+	cancel   context.CancelFunc
+	listener net.Listener
+	server   *http.Server
+}
+
+func New(listen string, assigner *core.Assigner, options ...Option) (*Server, error) {
+	opts, err := getOpts(options)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	server := &http.Server{
+		Handler:      mux,
+		WriteTimeout: opts.writeTimeout,
+		ReadTimeout:  opts.readTimeout,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &adminHandler{
+		ctx:           ctx,
+		assigner:      assigner,
+		reloadErrChan: opts.reloadErrChan,
+		savePoolFunc:  opts.savePoolFunc,
+	}
+
+	s := &Server{
+		cancel:   cancel,
+		listener: l,
+		server:   server,
+	}
+
+	// Assignment routes
+	mux.HandleFunc("/assignments", h.listAssignments)
+	mux.HandleFunc("/assignments/", h.getAssignment)
+	mux.HandleFunc("/assign/", h.assign)
+	mux.HandleFunc("/unassign/", h.unassign)
+	mux.HandleFunc("/move/", h.move)
+
+	// Indexer pool routes
+	mux.HandleFunc("/counts", h.counts)
+	mux.HandleFunc("/drain/", h.drain)
+	mux.HandleFunc("/events", h.events)
+	mux.HandleFunc("/indexers", h.listIndexers)
+	mux.HandleFunc("/indexers/", h.getIndexer)
+	mux.HandleFunc("/poll", h.poll)
+	mux.HandleFunc("/rebalance", h.rebalance)
+
+	// Config routes
+	mux.HandleFunc("/reloadconfig", h.reloadConfig)
+
+	return s, nil
+}
+
+func (s *Server) URL() string {
+	return fmt.Sprint("http://", s.listener.Addr().String())
+}
+
+func (s *Server) Start() error {
+	log.Infow("admin http server listening", "listen_addr", s.listener.Addr())
+	return s.server.Serve(s.listener)
+}
+
+func (s *Server) Close() error {
+	log.Info("admin http server shutdown")
+	s.cancel() // stop any drain or rebalance in progress
+	return s.server.Shutdown(context.Background())
+}
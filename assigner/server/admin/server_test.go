@@ -0,0 +1,325 @@
+package adminserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipni/go-libipni/apierror"
+	"github.com/ipni/go-libipni/test"
+	"github.com/ipni/storetheindex/admin/model"
+	"github.com/ipni/storetheindex/assigner/client"
+	"github.com/ipni/storetheindex/assigner/config"
+	"github.com/ipni/storetheindex/assigner/core"
+	adminserver "github.com/ipni/storetheindex/assigner/server/admin"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminAPI(t *testing.T) {
+	pub1ID, _, _ := test.RandomIdentity()
+	pub2ID, _, _ := test.RandomIdentity()
+	pubIDs := []peer.ID{pub1ID, pub2ID}
+	indexer1 := newFakeIndexer(t, pubIDs[0])
+	indexer2 := newFakeIndexer(t)
+
+	cfgAssignment := config.Assignment{
+		IndexerPool: []config.Indexer{
+			{
+				AdminURL:  indexer1.admin.URL,
+				FindURL:   indexer1.find.URL,
+				IngestURL: indexer1.ingest.URL,
+			},
+			{
+				AdminURL:  indexer2.admin.URL,
+				FindURL:   indexer2.find.URL,
+				IngestURL: indexer2.ingest.URL,
+			},
+		},
+		Policy: config.Policy{
+			Allow: true,
+		},
+		PubSubTopic: "testtopic",
+		Replication: 1,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	assigner, err := core.NewAssigner(ctx, cfgAssignment, nil)
+	require.NoError(t, err)
+	defer assigner.Close()
+
+	s, err := adminserver.New("127.0.0.1:0", assigner)
+	require.NoError(t, err)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.Start()
+	}()
+	defer func() {
+		require.NoError(t, s.Close())
+		require.ErrorIs(t, <-errChan, http.ErrServerClosed)
+	}()
+
+	cl, err := client.New(s.URL())
+	require.NoError(t, err)
+
+	assignments, err := cl.Assignments(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[peer.ID][]int{pubIDs[0]: {0}}, assignments)
+
+	counts, err := cl.Counts(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 0}, counts)
+
+	require.NoError(t, cl.Assign(ctx, pubIDs[1], 1))
+	indexers, err := cl.Assigned(ctx, pubIDs[1])
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, indexers)
+
+	var apierr *apierror.Error
+	err = cl.Assign(ctx, pubIDs[1], 1)
+	require.ErrorAs(t, err, &apierr)
+	require.Equal(t, http.StatusConflict, apierr.Status())
+
+	err = cl.Unassign(ctx, pubIDs[1], 0)
+	require.ErrorAs(t, err, &apierr)
+	require.Equal(t, http.StatusNotFound, apierr.Status())
+
+	require.NoError(t, cl.Unassign(ctx, pubIDs[1], 1))
+	_, err = cl.Assigned(ctx, pubIDs[1])
+	require.ErrorAs(t, err, &apierr)
+	require.Equal(t, http.StatusNotFound, apierr.Status())
+
+	poolInfo, err := cl.Indexers(ctx)
+	require.NoError(t, err)
+	require.Len(t, poolInfo, 2)
+	require.Equal(t, indexer1.admin.URL, poolInfo[0].AdminURL)
+	require.True(t, poolInfo[0].Online)
+	require.Equal(t, 1, poolInfo[0].Assigned)
+
+	indexer, err := cl.Indexer(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, []peer.ID{pubIDs[0]}, indexer.Publishers)
+
+	_, err = cl.Indexer(ctx, 2)
+	require.ErrorAs(t, err, &apierr)
+	require.Equal(t, http.StatusNotFound, apierr.Status())
+
+	require.NoError(t, cl.PollNow(ctx))
+
+	events, err := cl.Events(ctx)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	rebal, err := cl.Rebalance(ctx, true)
+	require.NoError(t, err)
+	require.True(t, rebal.DryRun)
+	require.Equal(t, []int{1, 0}, rebal.Before)
+
+	moves, err := cl.Drain(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, moves, 1)
+	require.True(t, moves[0].Done, moves[0].Error)
+	require.Equal(t, 1, moves[0].To)
+
+	counts, err = cl.Counts(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1}, counts)
+
+	// Reload is not available unless the server is configured with it.
+	err = cl.ReloadConfig(ctx)
+	require.ErrorAs(t, err, &apierr)
+	require.Equal(t, http.StatusNotImplemented, apierr.Status())
+}
+
+func TestAdminAPIIndexerPool(t *testing.T) {
+	pubID, _, _ := test.RandomIdentity()
+	indexer1 := newFakeIndexer(t, pubID)
+	indexer2 := newFakeIndexer(t)
+
+	cfgAssignment := config.Assignment{
+		IndexerPool: []config.Indexer{
+			{
+				AdminURL:  indexer1.admin.URL,
+				FindURL:   indexer1.find.URL,
+				IngestURL: indexer1.ingest.URL,
+			},
+		},
+		Policy: config.Policy{
+			Allow: true,
+		},
+		PubSubTopic: "testtopic",
+		Replication: 1,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	assigner, err := core.NewAssigner(ctx, cfgAssignment, nil)
+	require.NoError(t, err)
+	defer assigner.Close()
+
+	var savedPool []config.Indexer
+	savePool := func(cfgIndexerPool []config.Indexer) error {
+		savedPool = cfgIndexerPool
+		return nil
+	}
+
+	reloadErrChan := make(chan chan error, 1)
+	go func() {
+		for errChan := range reloadErrChan {
+			errChan <- assigner.SetIndexerPool(ctx, cfgAssignment.IndexerPool)
+		}
+	}()
+	defer close(reloadErrChan)
+
+	s, err := adminserver.New("127.0.0.1:0", assigner,
+		adminserver.WithReload(reloadErrChan),
+		adminserver.WithSavePool(savePool))
+	require.NoError(t, err)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.Start()
+	}()
+	defer func() {
+		require.NoError(t, s.Close())
+		require.ErrorIs(t, <-errChan, http.ErrServerClosed)
+	}()
+
+	cl, err := client.New(s.URL())
+	require.NoError(t, err)
+
+	cfgIndexer2 := config.Indexer{
+		AdminURL:  indexer2.admin.URL,
+		FindURL:   indexer2.find.URL,
+		IngestURL: indexer2.ingest.URL,
+	}
+	indexer, err := cl.AddIndexer(ctx, cfgIndexer2)
+	require.NoError(t, err)
+	require.Equal(t, 1, indexer.Num)
+	require.True(t, indexer.Online)
+	require.Len(t, savedPool, 2)
+
+	var apierr *apierror.Error
+	_, err = cl.AddIndexer(ctx, cfgIndexer2)
+	require.ErrorAs(t, err, &apierr)
+	require.Equal(t, http.StatusConflict, apierr.Status())
+
+	moves, err := cl.RetireIndexer(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, moves, 1)
+	require.True(t, moves[0].Done, moves[0].Error)
+	require.Equal(t, []config.Indexer{cfgIndexer2}, savedPool)
+
+	indexer, err = cl.Indexer(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, []peer.ID{pubID}, indexer.Publishers)
+
+	// Reloading the original config puts back the first indexer and retires
+	// the second.
+	require.NoError(t, cl.ReloadConfig(ctx))
+	_, err = cl.RetireIndexer(ctx, 1)
+	require.ErrorAs(t, err, &apierr)
+	require.Equal(t, http.StatusNotFound, apierr.Status())
+	indexer, err = cl.Indexer(ctx, 0)
+	require.NoError(t, err)
+	require.False(t, indexer.Retired)
+	require.Equal(t, []peer.ID{pubID}, indexer.Publishers)
+}
+
+// fakeIndexer serves the parts of the indexer admin, find, and ingest APIs
+// that the assigner uses, and keeps track of assigned publishers.
+type fakeIndexer struct {
+	id       peer.ID
+	admin    *httptest.Server
+	find     *httptest.Server
+	ingest   *httptest.Server
+	mutex    sync.Mutex
+	assigned map[peer.ID]peer.ID
+}
+
+func newFakeIndexer(t *testing.T, assigned ...peer.ID) *fakeIndexer {
+	indexerID, _, _ := test.RandomIdentity()
+	fi := &fakeIndexer{
+		id:       indexerID,
+		assigned: make(map[peer.ID]peer.ID),
+	}
+	for _, pubID := range assigned {
+		fi.assigned[pubID] = ""
+	}
+	fi.admin = httptest.NewServer(http.HandlerFunc(fi.handleAdmin))
+	t.Cleanup(fi.admin.Close)
+	fi.find = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	t.Cleanup(fi.find.Close)
+	fi.ingest = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(fi.ingest.Close)
+	return fi
+}
+
+func (fi *fakeIndexer) handleAdmin(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+
+	var body any
+	switch {
+	case r.URL.Path == "/ingest/assigned":
+		assignedInfos := make([]model.Assigned, 0, len(fi.assigned))
+		for pubID, from := range fi.assigned {
+			assignedInfos = append(assignedInfos, model.Assigned{
+				Publisher: pubID,
+				Continued: from,
+			})
+		}
+		body = assignedInfos
+	case r.URL.Path == "/ingest/preferred":
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case r.URL.Path == "/status":
+		body = model.Status{ID: fi.id, Usage: -1}
+	case strings.HasPrefix(r.URL.Path, "/ingest/"):
+		pubID, err := peer.Decode(path.Base(r.URL.Path))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch path.Base(path.Dir(r.URL.Path)) {
+		case "assign":
+			fi.assigned[pubID] = ""
+		case "unassign":
+			delete(fi.assigned, pubID)
+		case "handoff":
+			var handoff model.Handoff
+			if err = json.NewDecoder(r.Body).Decode(&handoff); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			fi.assigned[pubID] = handoff.FrozenID
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
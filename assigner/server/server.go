@@ -9,6 +9,7 @@ import (
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipni/go-libipni/announce/message"
 	"github.com/ipni/storetheindex/assigner/core"
+	"github.com/ipni/storetheindex/internal/metrics"
 	"github.com/libp2p/go-libp2p/core/peer"
 )
 
@@ -53,6 +54,8 @@ func New(listen string, assigner *core.Assigner, options ...Option) (*Server, er
 	mux.HandleFunc("/announce", s.announce)
 	// Health check.
 	mux.HandleFunc("/health", s.health)
+	// Metrics, including indexer capacity and assignment decisions.
+	mux.Handle("/metrics/", metrics.Start(metrics.AssignerViews))
 
 	// Depricated
 	mux.HandleFunc("/ingest/announce", s.announce)
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 
 	"github.com/ipfs/go-cid"
 	car "github.com/ipld/go-car/v2"
@@ -91,41 +92,20 @@ func (cr CarReader) Compression() string {
 
 // Read reads an advertisement CAR file, identitfied by the advertisement CID
 // and returns the advertisement data and a channel to read blocks of multihash
-// entries. Returns fs.ErrNotExist if file is not found.
+// entries. Returns fs.ErrNotExist if file is not found, and ErrCorrupt if the
+// file does not match its manifest. If the entries read do not have the
+// number of multihashes in the manifest, the last entry block read from the
+// channel has ErrCorrupt.
+//
+// If skipEntries is true, only the start of the CAR file is read, and the file
+// is not checked against its manifest. The advertisement data is still checked
+// against the advertisement CID.
 func (cr CarReader) Read(ctx context.Context, adCid cid.Cid, skipEntries bool) (*AdBlock, error) {
-	carPath := adCid.String() + CarFileSuffix
-	if cr.compAlg == Gzip {
-		carPath += GzipFileSuffix
-	}
-	_, r, err := cr.fileStore.Get(ctx, carPath)
+	cbr, rc, _, m, err := cr.open(ctx, adCid, !skipEntries)
 	if err != nil {
 		return nil, err
 	}
 
-	var rc io.ReadCloser
-	if cr.compAlg == Gzip {
-		gzr, err := gzip.NewReader(r)
-		if err != nil {
-			return nil, err
-		}
-		rc = &gzipReadCloser{
-			r:   r,
-			gzr: gzr,
-		}
-	} else {
-		rc = r
-	}
-
-	cbr, err := car.NewBlockReader(rc)
-	if err != nil {
-		rc.Close()
-		return nil, fmt.Errorf("cannot create car blockstore: %w", err)
-	}
-	if len(cbr.Roots) == 0 || cbr.Roots[0] != adCid {
-		rc.Close()
-		return nil, errors.New("car file has wrong root")
-	}
-
 	blk, err := cbr.Next()
 	if err != nil {
 		rc.Close()
@@ -140,7 +120,7 @@ func (cr CarReader) Read(ctx context.Context, adCid cid.Cid, skipEntries bool) (
 	if !skipEntries && len(cbr.Roots) > 1 {
 		entsCh := make(chan EntryBlock)
 		adBlock.Entries = entsCh
-		go readEntries(ctx, cbr, rc, entsCh)
+		go readEntries(ctx, cbr, rc, entsCh, m)
 	} else {
 		rc.Close()
 	}
@@ -148,6 +128,62 @@ func (cr CarReader) Read(ctx context.Context, adCid cid.Cid, skipEntries bool) (
 	return &adBlock, nil
 }
 
+// open opens the CAR file for the advertisement and checks that the
+// advertisement is its root. The CAR file is looked for with the suffix of
+// each compression method, so that files written with a different
+// compression can still be read. If verify is true and the CAR file has a
+// manifest, the file is checked against it, and the manifest is returned. The
+// caller must close the returned reader.
+func (cr CarReader) open(ctx context.Context, adCid cid.Cid, verify bool) (*car.BlockReader, io.ReadCloser, *filestore.File, *Manifest, error) {
+	var file *filestore.File
+	var r io.ReadCloser
+	var err error
+	for _, carPath := range carPaths(adCid, cr.compAlg) {
+		file, r, err = cr.fileStore.Get(ctx, carPath)
+		if !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	var m *Manifest
+	if verify {
+		m, err = readManifest(ctx, cr.fileStore, file.Path)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				r.Close()
+				return nil, nil, nil, nil, err
+			}
+			// CAR files written before manifests were added are not checked.
+			m = nil
+		} else {
+			r, err = verifiedReader(r, m)
+			if err != nil {
+				return nil, nil, nil, nil, fmt.Errorf("cannot verify %s: %w", file.Path, err)
+			}
+		}
+	}
+
+	rc, err := decompressReader(file.Path, r)
+	if err != nil {
+		r.Close()
+		return nil, nil, nil, nil, err
+	}
+
+	cbr, err := car.NewBlockReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, nil, nil, nil, fmt.Errorf("cannot create car blockstore: %w", err)
+	}
+	if len(cbr.Roots) == 0 || cbr.Roots[0] != adCid {
+		rc.Close()
+		return nil, nil, nil, nil, errors.New("car file has wrong root")
+	}
+	return cbr, rc, file, m, nil
+}
+
 // ReadHead reads the advertisement CID from the publisher's head file. The
 // head file contains the CID of the latest advertisement for an advertisement
 // publisher. Returns fs.ErrNotExist if head file is not found.
@@ -172,7 +208,10 @@ func (cr CarReader) ReadHead(ctx context.Context, publisher peer.ID) (cid.Cid, e
 	return cid.Decode(buf.String())
 }
 
-func readEntries(ctx context.Context, cbr *car.BlockReader, r io.ReadCloser, entsCh chan EntryBlock) {
+// readEntries sends the entries blocks read from the CAR file on entsCh. If
+// the CAR file has a manifest, the number of multihashes read is checked
+// against the manifest.
+func readEntries(ctx context.Context, cbr *car.BlockReader, r io.ReadCloser, entsCh chan EntryBlock, m *Manifest) {
 	defer r.Close()
 	defer close(entsCh)
 
@@ -183,18 +222,33 @@ func readEntries(ctx context.Context, cbr *car.BlockReader, r io.ReadCloser, ent
 		return
 	}
 
-	for {
+	var entryCount int
+	for last := false; !last; {
 		var entBlock EntryBlock
 
 		blk, err := cbr.Next()
 		if err != nil {
-			if errors.Is(err, io.EOF) {
+			if !errors.Is(err, io.EOF) {
+				entBlock.Err = err
+			} else if m != nil && entryCount != m.Entries {
+				entBlock.Err = fmt.Errorf("%w: has %d entries, expected %d", ErrCorrupt, entryCount, m.Entries)
+				last = true
+			} else {
 				return
 			}
-			entBlock.Err = err
 		} else {
 			entBlock.Cid = blk.Cid()
 			entBlock.Data = blk.RawData()
+			if m != nil {
+				chunk, err := decodeEntryChunk(entBlock.Data, entBlock.Cid)
+				if err != nil {
+					// The reader gets the same error when decoding the
+					// chunk, so the count cannot be checked.
+					m = nil
+				} else {
+					entryCount += len(chunk.Entries)
+				}
+			}
 		}
 
 		select {
@@ -2,6 +2,7 @@ package carstore_test
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/ipfs/go-datastore"
@@ -97,3 +98,33 @@ func TestRead(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, adCid, headCid)
 }
+
+func TestVerifyRoot(t *testing.T) {
+	dstore := datastore.NewMapDatastore()
+	fileStore, err := filestore.NewLocal(t.TempDir())
+	require.NoError(t, err)
+	carw, err := carstore.NewWriter(dstore, fileStore, carstore.WithCompress(testCompress))
+	require.NoError(t, err)
+
+	adLink, _, _, _, _ := storeRandomIndexAndAd(t, 2, nil, nil, dstore)
+	adCid := adLink.(cidlink.Link).Cid
+	otherLink, _, _, _, _ := storeRandomIndexAndAd(t, 2, nil, nil, dstore)
+	otherCid := otherLink.(cidlink.Link).Cid
+
+	ctx := context.Background()
+	carInfo, err := carw.Write(ctx, adCid, false, true)
+	require.NoError(t, err)
+	suffix := strings.TrimPrefix(carInfo.Path, adCid.String())
+
+	verify := func(relPath string) error {
+		_, r, err := fileStore.Get(ctx, carInfo.Path)
+		require.NoError(t, err)
+		defer r.Close()
+		return carstore.VerifyRoot(relPath, r)
+	}
+	require.NoError(t, verify(carInfo.Path))
+	require.Error(t, verify(otherCid.String()+suffix))
+	// Files not named by advertisement CID are not checked.
+	require.NoError(t, verify("other"+suffix))
+	require.NoError(t, verify("other.txt"))
+}
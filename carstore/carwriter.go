@@ -3,7 +3,6 @@ package carstore
 import (
 	"bufio"
 	"bytes"
-	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
@@ -84,10 +83,7 @@ func (cw *CarWriter) Write(ctx context.Context, adCid cid.Cid, skipEntries, over
 
 func (cw *CarWriter) write(ctx context.Context, adCid cid.Cid, ad schema.Advertisement, data []byte, skipEntries, overWrite bool) (*filestore.File, error) {
 	fileName := adCid.String() + CarFileSuffix
-	carPath := fileName
-	if cw.compAlg == Gzip {
-		carPath += GzipFileSuffix
-	}
+	carPath := adCid.String() + carSuffix(cw.compAlg)
 	roots := make([]cid.Cid, 1, 2)
 	roots[0] = adCid
 
@@ -108,10 +104,11 @@ func (cw *CarWriter) write(ctx context.Context, adCid cid.Cid, ad schema.Adverti
 		cw.deleteCids(delCids)
 	}()
 
-	// If the destination file already exists, do not rewrite it.
-	fileInfo, err := cw.fileStore.Head(ctx, carPath)
+	// If the destination file already exists, with any compression, do not
+	// rewrite it.
+	fileInfo, err := cw.headCar(ctx, adCid)
 	if err != nil {
-		if err != fs.ErrNotExist {
+		if !errors.Is(err, fs.ErrNotExist) {
 			return nil, err
 		}
 		// OK, car file does not exist.
@@ -142,6 +139,8 @@ func (cw *CarWriter) write(ctx context.Context, adCid cid.Cid, ad schema.Adverti
 	delCids[0] = adCid
 	roots = nil
 
+	var entryCount int
+
 	if entriesCid != cid.Undef {
 		delCids = append(delCids, entriesCid)
 
@@ -164,6 +163,7 @@ func (cw *CarWriter) write(ctx context.Context, adCid cid.Cid, ad schema.Adverti
 				if err != nil {
 					return nil, fmt.Errorf("cannot load entries block: %w", err)
 				}
+				entryCount += len(chunk.Entries)
 				if err = carStore.Put(ctx, entriesCid.KeyString(), data); err != nil {
 					return nil, fmt.Errorf("cannot write entries block to car file: %w", err)
 				}
@@ -185,45 +185,57 @@ func (cw *CarWriter) write(ctx context.Context, adCid cid.Cid, ad schema.Adverti
 		return nil, err
 	}
 
-	if cw.compAlg == Gzip {
-		gzTmpName := carTmpName + GzipFileSuffix
-		gzFile, err := os.Create(gzTmpName)
+	if cw.compAlg != "" {
+		compTmpName := carTmpName + strings.TrimPrefix(carPath, fileName)
+		compFile, err := os.Create(compTmpName)
 		if err != nil {
-			return nil, fmt.Errorf("cannot create gzip file: %w", err)
+			return nil, fmt.Errorf("cannot create compressed file: %w", err)
 		}
-		defer os.Remove(gzTmpName)
-		defer gzFile.Close()
+		defer os.Remove(compTmpName)
+		defer compFile.Close()
 
-		wbuf := bufio.NewWriter(gzFile)
-		gzw := gzip.NewWriter(wbuf)
-		_, err = io.Copy(gzw, carFile)
-		if err != nil {
-			return nil, fmt.Errorf("cannot write gzip file: %w", err)
+		wbuf := bufio.NewWriter(compFile)
+		if err = compress(cw.compAlg, wbuf, carFile); err != nil {
+			return nil, fmt.Errorf("cannot write compressed file: %w", err)
 		}
 		if err = carFile.Close(); err != nil {
 			// Since data in car file has already been written, an error from close
 			// is not critical, so only log warning.
 			log.Warnw("Error closing temporary car file", "err", err, "name", carFile.Name())
 		}
-		// Close gzip writer; finish writing gzip data to buffer.
-		if err = gzw.Close(); err != nil {
-			return nil, fmt.Errorf("cannot close gzip writer: %w", err)
-		}
 		// Flush buffered data to file.
 		if err = wbuf.Flush(); err != nil {
-			return nil, fmt.Errorf("cannot write gzip file: %w", err)
+			return nil, fmt.Errorf("cannot write compressed file: %w", err)
 		}
-		_, err = gzFile.Seek(0, io.SeekStart)
+		_, err = compFile.Seek(0, io.SeekStart)
 		if err != nil {
 			return nil, err
 		}
-		carFile = gzFile
+		carFile = compFile
+	}
+
+	manifest, err := newManifest(carFile, entryCount)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create manifest: %w", err)
+	}
+	if _, err = carFile.Seek(0, io.SeekStart); err != nil {
+		return nil, err
 	}
 
 	carInfo, err := cw.fileStore.Put(ctx, carPath, carFile)
 	if err != nil {
 		return nil, err
 	}
+	if err = writeManifest(ctx, cw.fileStore, carPath, manifest); err != nil {
+		return nil, fmt.Errorf("cannot write manifest: %w", err)
+	}
+
+	// Remove a file replaced by one with different compression.
+	if fileInfo != nil && fileInfo.Path != carPath {
+		if err = cw.deleteCar(ctx, fileInfo.Path); err != nil {
+			log.Errorw("Cannot remove replaced car file", "err", err, "path", fileInfo.Path)
+		}
+	}
 
 	if err = carFile.Close(); err != nil {
 		// Since data in car file has already been written, an error from close
@@ -275,6 +287,32 @@ func (cw *CarWriter) WriteChain(ctx context.Context, adCid cid.Cid, overWrite bo
 	return count, nil
 }
 
+// headCar returns information about the CAR file for the advertisement,
+// written with any compression. Returns fs.ErrNotExist if there is no CAR
+// file.
+func (cw *CarWriter) headCar(ctx context.Context, adCid cid.Cid) (*filestore.File, error) {
+	for _, carPath := range carPaths(adCid, cw.compAlg) {
+		fileInfo, err := cw.fileStore.Head(ctx, carPath)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fileInfo, err
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+// deleteCar deletes a CAR file and its manifest.
+func (cw *CarWriter) deleteCar(ctx context.Context, carPath string) error {
+	err := cw.fileStore.Delete(ctx, carPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	err = cw.fileStore.Delete(ctx, carPath+ManifestFileSuffix)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
 func (cw *CarWriter) WriteHead(ctx context.Context, adCid cid.Cid, publisher peer.ID) (*filestore.File, error) {
 	err := publisher.Validate()
 	if err != nil {
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"io"
 	"io/fs"
+	"strings"
 	"testing"
 
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	car "github.com/ipld/go-car/v2"
 	carblockstore "github.com/ipld/go-car/v2/blockstore"
@@ -18,6 +21,7 @@ import (
 	"github.com/ipni/go-libipni/test"
 	"github.com/ipni/storetheindex/carstore"
 	"github.com/ipni/storetheindex/filestore"
+	"github.com/ipni/storetheindex/test/typehelpers"
 	crypto "github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
 	p2ptest "github.com/libp2p/go-libp2p/core/test"
@@ -218,15 +222,118 @@ func TestWriteChain(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, 2, count)
 
-	// Test that car file is created.
+	// Test that car file and manifest are created.
 	fileCh, errCh := fileStore.List(ctx, "", false)
 	infos := make([]*filestore.File, 0, 2)
+	var manifests int
 	for fileInfo := range fileCh {
+		if strings.HasSuffix(fileInfo.Path, carstore.ManifestFileSuffix) {
+			manifests++
+			continue
+		}
 		infos = append(infos, fileInfo)
 	}
 	err = <-errCh
 	require.NoError(t, err)
 	require.Equal(t, 2, len(infos))
+	require.Equal(t, 2, manifests)
+}
+
+func TestCompression(t *testing.T) {
+	dstore := datastore.NewMapDatastore()
+	fileStore, err := filestore.NewLocal(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	zstdWriter, err := carstore.NewWriter(dstore, fileStore, carstore.WithCompress(carstore.Zstd))
+	require.NoError(t, err)
+	adLink, _, mhs, _, _ := storeRandomIndexAndAd(t, 3, nil, nil, dstore)
+	adCid := adLink.(cidlink.Link).Cid
+	adData, err := dstore.Get(ctx, datastore.NewKey(adCid.String()))
+	require.NoError(t, err)
+	carInfo, err := zstdWriter.Write(ctx, adCid, false, false)
+	require.NoError(t, err)
+	require.Equal(t, adCid.String()+carstore.CarFileSuffix+carstore.ZstdFileSuffix, carInfo.Path)
+
+	// Manifest describes the stored file.
+	_, r, err := fileStore.Get(ctx, carInfo.Path+carstore.ManifestFileSuffix)
+	require.NoError(t, err)
+	var manifest carstore.Manifest
+	require.NoError(t, json.NewDecoder(r).Decode(&manifest))
+	r.Close()
+	require.Equal(t, carInfo.Size, manifest.Size)
+	require.Equal(t, len(mhs), manifest.Entries)
+	require.Len(t, manifest.SHA256, 64)
+
+	// File written with zstd is read by reader configured for gzip.
+	gzipReader, err := carstore.NewReader(fileStore, carstore.WithCompress(carstore.Gzip))
+	require.NoError(t, err)
+	adBlock, err := gzipReader.Read(ctx, adCid, false)
+	require.NoError(t, err)
+	var count int
+	for entBlock := range adBlock.Entries {
+		require.NoError(t, entBlock.Err)
+		count++
+	}
+	require.Equal(t, 3, count)
+
+	// Entries that do not match the manifest entry count are detected.
+	manifest.Entries++
+	data, err := json.Marshal(&manifest)
+	require.NoError(t, err)
+	_, err = fileStore.Put(ctx, carInfo.Path+carstore.ManifestFileSuffix, bytes.NewReader(data))
+	require.NoError(t, err)
+	adBlock, err = gzipReader.Read(ctx, adCid, false)
+	require.NoError(t, err)
+	var entErr error
+	for entBlock := range adBlock.Entries {
+		entErr = entBlock.Err
+	}
+	require.ErrorIs(t, entErr, carstore.ErrCorrupt)
+
+	// Existing file with other compression is not overwritten.
+	gzipWriter, err := carstore.NewWriter(dstore, fileStore, carstore.WithCompress(carstore.Gzip))
+	require.NoError(t, err)
+	require.NoError(t, dstore.Put(ctx, datastore.NewKey(adCid.String()), adData))
+	_, err = gzipWriter.Write(ctx, adCid, true, false)
+	require.ErrorIs(t, err, fs.ErrExist)
+
+	// Overwriting with other compression replaces the file.
+	require.NoError(t, dstore.Put(ctx, datastore.NewKey(adCid.String()), adData))
+	carInfo, err = gzipWriter.Write(ctx, adCid, true, true)
+	require.NoError(t, err)
+	carPath := adCid.String() + carstore.CarFileSuffix + carstore.GzipFileSuffix
+	require.Equal(t, carPath, carInfo.Path)
+	zstdPath := adCid.String() + carstore.CarFileSuffix + carstore.ZstdFileSuffix
+	_, err = fileStore.Head(ctx, zstdPath)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fileStore.Head(ctx, zstdPath+carstore.ManifestFileSuffix)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	// Corrupted file is detected when reading entries.
+	_, r, err = fileStore.Get(ctx, carPath)
+	require.NoError(t, err)
+	data, err = io.ReadAll(r)
+	require.NoError(t, err)
+	r.Close()
+	_, err = fileStore.Put(ctx, carPath, bytes.NewReader(data[:len(data)-1]))
+	require.NoError(t, err)
+	_, err = gzipReader.Read(ctx, adCid, false)
+	require.ErrorIs(t, err, carstore.ErrCorrupt)
+	// Only reading the advertisement does not check the whole file.
+	adBlock, err = gzipReader.Read(ctx, adCid, true)
+	require.NoError(t, err)
+	require.Equal(t, adData, adBlock.Data)
+	data[len(data)/2]++
+	_, err = fileStore.Put(ctx, carPath, bytes.NewReader(data))
+	require.NoError(t, err)
+	_, err = gzipReader.Read(ctx, adCid, false)
+	require.ErrorIs(t, err, carstore.ErrCorrupt)
+
+	// File without manifest is not checked.
+	require.NoError(t, fileStore.Delete(ctx, carPath+carstore.ManifestFileSuffix))
+	_, err = gzipReader.Read(ctx, adCid, false)
+	require.NotErrorIs(t, err, carstore.ErrCorrupt)
 }
 
 func newRandomLinkedList(t *testing.T, lsys ipld.LinkSystem, size int) (ipld.Link, []multihash.Multihash) {
@@ -308,3 +415,111 @@ func storeRandomIndexAndAd(t *testing.T, eChunkCount int, metadata []byte, prevL
 
 	return advLnk, adv, mhs, p, priv
 }
+
+func TestCompact(t *testing.T) {
+	dstore := datastore.NewMapDatastore()
+	lsys := mkProvLinkSystem(dstore)
+	fileStore, err := filestore.NewLocal(t.TempDir())
+	require.NoError(t, err)
+	carw, err := carstore.NewWriter(dstore, fileStore, carstore.WithCompress(testCompress))
+	require.NoError(t, err)
+	carr, err := carstore.NewReader(fileStore, carstore.WithCompress(testCompress))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	priv, _, err := p2ptest.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	headCid := typehelpers.BuildRemovalChain(t, lsys, priv).(cidlink.Link).Cid
+
+	var adCids []cid.Cid
+	for adCid := headCid; adCid != cid.Undef; {
+		adCids = append(adCids, adCid)
+		node, err := lsys.Load(ipld.LinkContext{}, cidlink.Link{Cid: adCid}, schema.AdvertisementPrototype)
+		require.NoError(t, err)
+		ad, err := schema.UnwrapAdvertisement(node)
+		require.NoError(t, err)
+		if ad.PreviousID == nil {
+			break
+		}
+		adCid = ad.PreviousID.(cidlink.Link).Cid
+	}
+	require.Len(t, adCids, 4)
+
+	// Write all ads with entries.
+	for _, adCid := range adCids {
+		_, err = carw.Write(ctx, adCid, false, false)
+		require.NoError(t, err)
+	}
+	publisher, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	_, err = carw.WriteHead(ctx, headCid, publisher)
+	require.NoError(t, err)
+
+	// Write an ad that is not in the chain.
+	orphanLink, _, _, _, _ := storeRandomIndexAndAd(t, 2, nil, nil, dstore)
+	orphanCid := orphanLink.(cidlink.Link).Cid
+	_, err = carw.Write(ctx, orphanCid, false, false)
+	require.NoError(t, err)
+
+	// Write an ad and then remove its CAR file, leaving its manifest.
+	orphanLink, _, _, _, _ = storeRandomIndexAndAd(t, 2, nil, nil, dstore)
+	carInfo, err := carw.Write(ctx, orphanLink.(cidlink.Link).Cid, false, false)
+	require.NoError(t, err)
+	require.NoError(t, fileStore.Delete(ctx, carInfo.Path))
+
+	report, err := carw.Compact(ctx, true, 0)
+	require.NoError(t, err)
+	require.Len(t, report.Publishers, 1)
+	pc := report.Publishers[0]
+	require.Equal(t, publisher, pc.Publisher)
+	require.Equal(t, 4, pc.Ads)
+	require.Equal(t, 1, pc.Rewritten)
+	require.Positive(t, pc.Reclaimed)
+	require.False(t, pc.Incomplete)
+	require.Equal(t, 1, report.Orphans)
+	require.Equal(t, 1, report.OrphanManifests)
+	require.True(t, report.OrphansDeleted)
+	require.Equal(t, pc.Reclaimed+report.OrphanBytes, report.Reclaimed())
+	_, err = fileStore.Head(ctx, carInfo.Path+carstore.ManifestFileSuffix)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	_, err = carr.Read(ctx, orphanCid, true)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	// Removed ad is rewritten without entries and still has valid signature.
+	adBlock, err := carr.Read(ctx, adCids[3], false)
+	require.NoError(t, err)
+	require.Nil(t, adBlock.Entries)
+	ad, err := adBlock.Advertisement()
+	require.NoError(t, err)
+	signer, err := ad.VerifySignature()
+	require.NoError(t, err)
+	require.Equal(t, publisher, signer)
+
+	// Other ads keep their entries.
+	adBlock, err = carr.Read(ctx, adCids[2], false)
+	require.NoError(t, err)
+	require.NotNil(t, adBlock.Entries)
+	for entBlock := range adBlock.Entries {
+		require.NoError(t, entBlock.Err)
+	}
+
+	// Nothing more to compact.
+	report, err = carw.Compact(ctx, true, 0)
+	require.NoError(t, err)
+	require.Zero(t, report.Publishers[0].Rewritten)
+	require.Zero(t, report.Orphans)
+	require.Zero(t, report.OrphanManifests)
+
+	// Orphans are not deleted if a chain is incomplete.
+	require.NoError(t, fileStore.Delete(ctx, adCids[2].String()+carstore.CarFileSuffix+carstore.GzipFileSuffix))
+	report, err = carw.Compact(ctx, true, 0)
+	require.NoError(t, err)
+	require.True(t, report.Publishers[0].Incomplete)
+	require.Equal(t, 2, report.Publishers[0].Ads)
+	require.Equal(t, 1, report.Orphans)
+	require.Equal(t, 1, report.OrphanManifests)
+	require.False(t, report.OrphansDeleted)
+	_, err = carr.Read(ctx, adCids[3], true)
+	require.NoError(t, err)
+}
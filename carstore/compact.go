@@ -0,0 +1,255 @@
+package carstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipni/go-libipni/ingest/schema"
+	"github.com/ipni/storetheindex/filestore"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// PublisherCompaction describes the compaction of one publisher's
+// advertisement chain.
+type PublisherCompaction struct {
+	Publisher peer.ID
+	// Ads is the number of advertisements in the mirrored chain.
+	Ads int
+	// Rewritten is the number of CAR files rewritten without entries.
+	Rewritten int
+	// Reclaimed is the number of bytes freed by rewriting CAR files.
+	Reclaimed int64
+	// Incomplete is true if a CAR file in the chain is missing.
+	Incomplete bool
+}
+
+// CompactReport describes the result of compacting a mirror.
+type CompactReport struct {
+	Publishers []PublisherCompaction
+	// Orphans is the number of CAR files that are not in any publisher's
+	// chain.
+	Orphans int
+	// OrphanManifests is the number of manifest files whose CAR file does not
+	// exist.
+	OrphanManifests int
+	// OrphanBytes is the total size of orphaned CAR files and manifests.
+	OrphanBytes int64
+	// OrphansDeleted is true if orphaned CAR files and manifests were
+	// deleted.
+	OrphansDeleted bool
+}
+
+// Reclaimed returns the total number of bytes freed by compaction.
+func (r *CompactReport) Reclaimed() int64 {
+	var total int64
+	for i := range r.Publishers {
+		total += r.Publishers[i].Reclaimed
+	}
+	if r.OrphansDeleted {
+		total += r.OrphanBytes
+	}
+	return total
+}
+
+// removedKey identifies a context ID of a provider.
+type removedKey struct {
+	provider  string
+	contextID string
+}
+
+// Compact reduces the size of the mirror. The advertisement chain of each
+// publisher that has a head file is read from the mirror, and the CAR files
+// of advertisements whose context ID is removed by a later advertisement are
+// rewritten without entries. The advertisement itself is kept, so that chain
+// links and signatures can still be verified.
+//
+// CAR files that are not in any publisher's chain are orphans, as are
+// manifest files whose CAR file does not exist. These are deleted if
+// deleteOrphans is true, they were last modified more than orphanAge ago, and
+// no publisher's chain is missing a CAR file. A missing CAR file means the
+// earlier part of that chain is unknown, so its files would look orphaned.
+func (cw *CarWriter) Compact(ctx context.Context, deleteOrphans bool, orphanAge time.Duration) (*CompactReport, error) {
+	cr := CarReader{
+		compAlg:   cw.compAlg,
+		fileStore: cw.fileStore,
+	}
+	cutoff := time.Now().Add(-orphanAge)
+
+	var publishers []peer.ID
+	carFiles := make(map[string]*filestore.File)
+	manifests := make(map[string]*filestore.File)
+	files, errs := cw.fileStore.List(ctx, "", false)
+	for file := range files {
+		name := path.Base(file.Path)
+		if strings.HasSuffix(name, HeadFileSuffix) {
+			publisher, err := peer.Decode(strings.TrimSuffix(name, HeadFileSuffix))
+			if err != nil {
+				continue
+			}
+			publishers = append(publishers, publisher)
+		} else if strings.HasSuffix(name, ManifestFileSuffix) {
+			if _, _, ok := splitCarName(strings.TrimSuffix(name, ManifestFileSuffix)); ok {
+				manifests[strings.TrimSuffix(file.Path, ManifestFileSuffix)] = file
+			}
+		} else if _, _, ok := splitCarName(name); ok {
+			// Only CAR files named by advertisement CID are in a chain.
+			carFiles[file.Path] = file
+		}
+	}
+	if err := <-errs; err != nil {
+		return nil, fmt.Errorf("cannot list mirror files: %w", err)
+	}
+	sort.Slice(publishers, func(i, j int) bool { return publishers[i] < publishers[j] })
+
+	report := &CompactReport{
+		Publishers: make([]PublisherCompaction, 0, len(publishers)),
+	}
+	var incomplete bool
+	visited := make(map[string]struct{})
+	for _, publisher := range publishers {
+		pc, err := cw.compactChain(ctx, cr, publisher, visited)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compact chain of publisher %s: %w", publisher, err)
+		}
+		if pc.Incomplete {
+			incomplete = true
+		}
+		report.Publishers = append(report.Publishers, pc)
+	}
+
+	var orphans []*filestore.File
+	for carPath, file := range carFiles {
+		if _, ok := visited[carPath]; ok {
+			continue
+		}
+		if !file.Modified.IsZero() && file.Modified.After(cutoff) {
+			// May belong to an advertisement that is being ingested.
+			continue
+		}
+		orphans = append(orphans, file)
+		report.Orphans++
+		report.OrphanBytes += file.Size
+	}
+	var orphanManifests []*filestore.File
+	for carPath, file := range manifests {
+		if _, ok := carFiles[carPath]; ok {
+			continue
+		}
+		if !file.Modified.IsZero() && file.Modified.After(cutoff) {
+			continue
+		}
+		orphanManifests = append(orphanManifests, file)
+		report.OrphanManifests++
+		report.OrphanBytes += file.Size
+	}
+	if !deleteOrphans || len(orphans)+len(orphanManifests) == 0 {
+		return report, nil
+	}
+	if incomplete {
+		log.Warnw("Not deleting orphaned CAR files because a mirrored chain is incomplete",
+			"orphans", len(orphans), "orphanManifests", len(orphanManifests))
+		return report, nil
+	}
+	for _, file := range orphans {
+		if err := cw.deleteCar(ctx, file.Path); err != nil {
+			return report, fmt.Errorf("cannot delete orphaned car file: %w", err)
+		}
+	}
+	for _, file := range orphanManifests {
+		if err := cw.fileStore.Delete(ctx, file.Path); err != nil {
+			return report, fmt.Errorf("cannot delete orphaned manifest: %w", err)
+		}
+	}
+	report.OrphansDeleted = true
+	return report, nil
+}
+
+// compactChain rewrites the CAR files of the publisher's chain that have
+// entries for a removed context ID. The path of each CAR file in the chain is
+// added to visited.
+func (cw *CarWriter) compactChain(ctx context.Context, cr CarReader, publisher peer.ID, visited map[string]struct{}) (PublisherCompaction, error) {
+	pc := PublisherCompaction{
+		Publisher: publisher,
+	}
+	adCid, err := cr.ReadHead(ctx, publisher)
+	if err != nil {
+		return pc, fmt.Errorf("cannot read head: %w", err)
+	}
+
+	removed := make(map[removedKey]struct{})
+	for adCid != cid.Undef {
+		ad, data, hasEntries, file, err := cw.readCarAd(ctx, cr, adCid)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				pc.Incomplete = true
+				break
+			}
+			return pc, err
+		}
+		if _, ok := visited[file.Path]; ok {
+			// Rest of chain already compacted.
+			break
+		}
+		visited[file.Path] = struct{}{}
+		pc.Ads++
+
+		key := removedKey{
+			provider:  ad.Provider,
+			contextID: string(ad.ContextID),
+		}
+		if ad.IsRm {
+			removed[key] = struct{}{}
+		} else if _, ok := removed[key]; ok && hasEntries {
+			carInfo, err := cw.write(ctx, adCid, ad, data, true, true)
+			if err != nil {
+				return pc, fmt.Errorf("cannot rewrite car file for advertisement %s: %w", adCid, err)
+			}
+			// A rewritten file with different compression has a new path.
+			visited[carInfo.Path] = struct{}{}
+			pc.Rewritten++
+			pc.Reclaimed += file.Size - carInfo.Size
+			log.Infow("Rewrote CAR without entries", "path", carInfo.Path, "size", carInfo.Size, "previousSize", file.Size)
+		}
+
+		if ad.PreviousID == nil {
+			break
+		}
+		adCid = ad.PreviousID.(cidlink.Link).Cid
+	}
+	return pc, nil
+}
+
+// readCarAd reads the advertisement from its CAR file, and whether the CAR
+// file contains any entries.
+func (cw *CarWriter) readCarAd(ctx context.Context, cr CarReader, adCid cid.Cid) (schema.Advertisement, []byte, bool, *filestore.File, error) {
+	cbr, rc, file, _, err := cr.open(ctx, adCid, true)
+	if err != nil {
+		return schema.Advertisement{}, nil, false, nil, err
+	}
+	defer rc.Close()
+
+	blk, err := cbr.Next()
+	if err != nil {
+		return schema.Advertisement{}, nil, false, nil, fmt.Errorf("cannot read advertisement data: %w", err)
+	}
+	data := blk.RawData()
+	ad, err := decodeAd(data, adCid)
+	if err != nil {
+		return schema.Advertisement{}, nil, false, nil, err
+	}
+
+	_, err = cbr.Next()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return schema.Advertisement{}, nil, false, nil, fmt.Errorf("cannot read entries data: %w", err)
+	}
+	return ad, data, err == nil, file, nil
+}
@@ -0,0 +1,123 @@
+package carstore
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/klauspost/compress/zstd"
+)
+
+// carSuffixes are the suffixes of CAR files for each compression method.
+var carSuffixes = []string{
+	CarFileSuffix + GzipFileSuffix,
+	CarFileSuffix + ZstdFileSuffix,
+	CarFileSuffix,
+}
+
+// carSuffix returns the CAR file suffix for the compression method.
+func carSuffix(compAlg string) string {
+	switch compAlg {
+	case Gzip:
+		return CarFileSuffix + GzipFileSuffix
+	case Zstd:
+		return CarFileSuffix + ZstdFileSuffix
+	}
+	return CarFileSuffix
+}
+
+// carPaths returns the possible paths of the CAR file for an advertisement,
+// with the path for the compression method first.
+func carPaths(adCid cid.Cid, compAlg string) []string {
+	first := carSuffix(compAlg)
+	paths := make([]string, 1, len(carSuffixes))
+	paths[0] = adCid.String() + first
+	for _, suffix := range carSuffixes {
+		if suffix != first {
+			paths = append(paths, adCid.String()+suffix)
+		}
+	}
+	return paths
+}
+
+// splitCarName returns the advertisement CID and the suffix from the name of
+// a CAR file. Returns false if the name is not that of an advertisement CAR
+// file.
+func splitCarName(name string) (cid.Cid, string, bool) {
+	for _, suffix := range carSuffixes {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		adCid, err := cid.Decode(strings.TrimSuffix(name, suffix))
+		if err != nil {
+			return cid.Undef, "", false
+		}
+		return adCid, suffix, true
+	}
+	return cid.Undef, "", false
+}
+
+// compress writes the data from r to w using the compression method.
+func compress(compAlg string, w io.Writer, r io.Reader) error {
+	var cw io.WriteCloser
+	var err error
+	switch compAlg {
+	case Gzip:
+		cw = gzip.NewWriter(w)
+	case Zstd:
+		cw, err = zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported compression: %s", compAlg)
+	}
+	if _, err = io.Copy(cw, r); err != nil {
+		cw.Close()
+		return err
+	}
+	return cw.Close()
+}
+
+// decompressReader returns a reader that decompresses the CAR file data from
+// r according to the suffix of the CAR file path. Closing the returned reader
+// also closes r.
+func decompressReader(carPath string, r io.ReadCloser) (io.ReadCloser, error) {
+	switch {
+	case strings.HasSuffix(carPath, GzipFileSuffix):
+		gzr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return &gzipReadCloser{
+			r:   r,
+			gzr: gzr,
+		}, nil
+	case strings.HasSuffix(carPath, ZstdFileSuffix):
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return &zstdReadCloser{
+			r:  r,
+			zr: zr,
+		}, nil
+	}
+	return r, nil
+}
+
+type zstdReadCloser struct {
+	r  io.ReadCloser
+	zr *zstd.Decoder
+}
+
+func (z zstdReadCloser) Read(p []byte) (n int, err error) {
+	return z.zr.Read(p)
+}
+
+func (z zstdReadCloser) Close() error {
+	z.zr.Close()
+	return z.r.Close()
+}
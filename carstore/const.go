@@ -2,12 +2,15 @@ package carstore
 
 // File suffixes.
 const (
-	CarFileSuffix  = ".car"
-	GzipFileSuffix = ".gz"
-	HeadFileSuffix = ".head"
+	CarFileSuffix      = ".car"
+	GzipFileSuffix     = ".gz"
+	ZstdFileSuffix     = ".zst"
+	HeadFileSuffix     = ".head"
+	ManifestFileSuffix = ".manifest"
 )
 
 // Compression methods.
 const (
 	Gzip = "gzip"
+	Zstd = "zstd"
 )
@@ -2,4 +2,8 @@ package carstore
 
 import "errors"
 
-var ErrHAMT = errors.New("hamt entries not supported")
+var (
+	ErrHAMT = errors.New("hamt entries not supported")
+	// ErrCorrupt is returned when a CAR file does not match its manifest.
+	ErrCorrupt = errors.New("car file does not match manifest")
+)
@@ -0,0 +1,108 @@
+package carstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ipni/storetheindex/filestore"
+)
+
+// Manifest describes a CAR file as it is stored, so that truncated or
+// corrupted files can be detected. The manifest of a CAR file is stored in a
+// file with the path of the CAR file followed by ManifestFileSuffix.
+type Manifest struct {
+	// SHA256 is the hex encoded SHA-256 digest of the stored file.
+	SHA256 string
+	// Size is the size of the stored file in bytes.
+	Size int64
+	// Entries is the number of multihashes in the CAR file.
+	Entries int
+}
+
+// newManifest creates a manifest for the data read from r.
+func newManifest(r io.Reader, entries int) (*Manifest, error) {
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+	return &Manifest{
+		SHA256:  hex.EncodeToString(h.Sum(nil)),
+		Size:    size,
+		Entries: entries,
+	}, nil
+}
+
+func writeManifest(ctx context.Context, fileStore filestore.Interface, carPath string, m *Manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = fileStore.Put(ctx, carPath+ManifestFileSuffix, bytes.NewReader(data))
+	return err
+}
+
+// readManifest reads the manifest of the CAR file. Returns fs.ErrNotExist if
+// the CAR file does not have a manifest.
+func readManifest(ctx context.Context, fileStore filestore.Interface, carPath string) (*Manifest, error) {
+	_, r, err := fileStore.Get(ctx, carPath+ManifestFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var m Manifest
+	if err = json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("cannot decode manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// verifiedReader reads the CAR file data from r into a temporary file, and
+// checks it against the manifest. The returned reader reads the verified data
+// and removes the temporary file when closed.
+func verifiedReader(r io.ReadCloser, m *Manifest) (io.ReadCloser, error) {
+	defer r.Close()
+
+	tmp, err := os.CreateTemp("", "car-*")
+	if err != nil {
+		return nil, err
+	}
+	vr := &tempFileReader{tmp}
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		vr.Close()
+		return nil, err
+	}
+	if size != m.Size {
+		vr.Close()
+		return nil, fmt.Errorf("%w: size is %d, expected %d", ErrCorrupt, size, m.Size)
+	}
+	if digest := hex.EncodeToString(h.Sum(nil)); digest != m.SHA256 {
+		vr.Close()
+		return nil, fmt.Errorf("%w: sha256 is %s, expected %s", ErrCorrupt, digest, m.SHA256)
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		vr.Close()
+		return nil, err
+	}
+	return vr, nil
+}
+
+type tempFileReader struct {
+	*os.File
+}
+
+func (t *tempFileReader) Close() error {
+	err := t.File.Close()
+	os.Remove(t.Name())
+	return err
+}
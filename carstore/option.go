@@ -29,6 +29,8 @@ func WithCompress(alg string) Option {
 		switch alg {
 		case Gzip, "gz":
 			c.compAlg = Gzip
+		case Zstd, "zst":
+			c.compAlg = Zstd
 		case "", "none", "nil", "null":
 			c.compAlg = ""
 		default:
@@ -0,0 +1,35 @@
+package carstore
+
+import (
+	"fmt"
+	"io"
+	"path"
+
+	car "github.com/ipld/go-car/v2"
+)
+
+// VerifyRoot checks that a CAR file read from a mirror file store has the
+// advertisement CID, from the file name, as its root. Files that are not CAR
+// files are not checked. This is used as a filestore.VerifyFunc to keep
+// corrupt files out of a file store cache.
+func VerifyRoot(relPath string, r io.Reader) error {
+	adCid, _, ok := splitCarName(path.Base(relPath))
+	if !ok {
+		return nil
+	}
+
+	rc, err := decompressReader(relPath, io.NopCloser(r))
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	cbr, err := car.NewBlockReader(rc)
+	if err != nil {
+		return fmt.Errorf("cannot read car header: %w", err)
+	}
+	if len(cbr.Roots) == 0 || cbr.Roots[0] != adCid {
+		return fmt.Errorf("car file root is not %s", adCid)
+	}
+	return nil
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/ipni/storetheindex/admin/client"
+	"github.com/ipni/storetheindex/admin/model"
+	"github.com/ipni/storetheindex/config"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/urfave/cli/v2"
@@ -17,15 +20,22 @@ var AdminCmd = &cli.Command{
 	Usage: "Perform admin activities with an indexer",
 	Subcommands: []*cli.Command{
 		allowCmd,
+		backupCmd,
 		blockCmd,
 		freezeIndexerCmd,
 		importProvidersCmd,
+		labelsCmd,
 		listAssignedCmd,
 		listPreferredCmd,
+		pollingCmd,
+		rebuildCmd,
+		reconcileCountsCmd,
 		reloadCmd,
 		statusCmd,
 		syncCmd,
 		unassignCmd,
+		unfreezeCmd,
+		valueStoreCmd,
 	},
 }
 
@@ -101,6 +111,141 @@ var freezeIndexerCmd = &cli.Command{
 	Action: freezeAction,
 }
 
+var unfreezeCmd = &cli.Command{
+	Name:  "unfreeze",
+	Usage: "Take indexer out of frozen mode and re-sync frozen publishers",
+	Flags: []cli.Flag{
+		indexerHostFlag,
+		&cli.BoolFlag{
+			Name:  "status",
+			Usage: "Only show the progress of a previous unfreeze",
+		},
+		&cli.BoolFlag{
+			Name:  "wait",
+			Usage: "Wait for re-syncing to finish, showing progress",
+			Value: true,
+		},
+	},
+	Action: unfreezeAction,
+}
+
+var backupCmd = &cli.Command{
+	Name:  "backup",
+	Usage: "Write a backup of the running indexer to its configured backup storage",
+	Description: "Backs up the datastore and the latest advertisement of each publisher. " +
+		"The value store is not backed up, since it is only consistent when the indexer is stopped; " +
+		"use \"storetheindex backup\" to back up the value store of a stopped indexer. " +
+		"Ingestion of advertisements is paused while the backup is written, " +
+		"and advertisements continue to be synced. When the backup is complete, ingestion resumes.",
+	Flags: []cli.Flag{
+		indexerHostFlag,
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "Name of backup. Default is the current UTC time",
+		},
+		&cli.BoolFlag{
+			Name:  "status",
+			Usage: "Only show the progress of a previous backup",
+		},
+		&cli.BoolFlag{
+			Name:  "wait",
+			Usage: "Wait for backup to finish, showing progress",
+			Value: true,
+		},
+	},
+	Action: backupAction,
+}
+
+var rebuildCmd = &cli.Command{
+	Name:  "rebuild",
+	Usage: "Rebuild the index of a publisher's advertisements from the advertisement mirror",
+	Description: "Reads the publisher's advertisement chain from the running indexer's advertisement " +
+		"mirror, from the mirrored head back to the first advertisement, and indexes it again without " +
+		"contacting the publisher. Removal advertisements are applied, and advertisements whose context " +
+		"ID is removed later in the chain are skipped.",
+	Flags: []cli.Flag{
+		indexerHostFlag,
+		&cli.StringFlag{
+			Name:    "pubid",
+			Usage:   "Publisher peer ID",
+			Aliases: []string{"p"},
+		},
+		&cli.BoolFlag{
+			Name:  "status",
+			Usage: "Only show the result of a previous rebuild",
+		},
+		&cli.BoolFlag{
+			Name:  "wait",
+			Usage: "Wait for rebuild to finish, showing progress",
+			Value: true,
+		},
+	},
+	Action: rebuildAction,
+}
+
+var reconcileCountsCmd = &cli.Command{
+	Name:  "reconcile-counts",
+	Usage: "Reconcile the running indexer's index counts with an authoritative source",
+	Description: "Counts indexes for each provider context ID from the value store or the advertisement mirror, " +
+		"and reports where the persisted index counts differ. Ingestion continues during reconciliation.",
+	Flags: []cli.Flag{
+		indexerHostFlag,
+		reconcileSourceFlag,
+		reconcileRewriteFlag,
+		&cli.BoolFlag{
+			Name:  "status",
+			Usage: "Only show the result of a previous reconciliation",
+		},
+		&cli.BoolFlag{
+			Name:  "wait",
+			Usage: "Wait for reconciliation to finish, showing progress",
+			Value: true,
+		},
+	},
+	Action: reconcileCountsAction,
+}
+
+var valueStoreCmd = &cli.Command{
+	Name:  "valuestore",
+	Usage: "Run value store garbage collection or compaction, and show status",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "gc",
+			Usage:  "Start value store garbage collection",
+			Flags:  valueStoreMaintenanceFlags,
+			Action: valueStoreMaintenanceAction,
+		},
+		{
+			Name:   "compact",
+			Usage:  "Start value store compaction",
+			Flags:  valueStoreMaintenanceFlags,
+			Action: valueStoreMaintenanceAction,
+		},
+		{
+			Name:   "status",
+			Usage:  "Show status of current and last value store garbage collection or compaction",
+			Flags:  []cli.Flag{indexerHostFlag},
+			Action: valueStoreMaintenanceAction,
+		},
+	},
+}
+
+var valueStoreMaintenanceFlags = []cli.Flag{
+	indexerHostFlag,
+	&cli.DurationFlag{
+		Name:  "limit",
+		Usage: "Stop after this amount of time. Default is to run until finished",
+	},
+	&cli.BoolFlag{
+		Name:  "no-throttle",
+		Usage: "Run without periodic pauses to let ingestion proceed",
+	},
+	&cli.BoolFlag{
+		Name:  "wait",
+		Usage: "Wait for run to finish, showing progress",
+	},
+}
+
 var importProvidersCmd = &cli.Command{
 	Name:   "import-providers",
 	Usage:  "Import provider information from another indexer",
@@ -136,6 +281,135 @@ var listPreferredCmd = &cli.Command{
 	Action: listPreferredAction,
 }
 
+var labelsCmd = &cli.Command{
+	Name:  "labels",
+	Usage: "Manage operator-defined provider labels",
+	Subcommands: []*cli.Command{
+		labelsGetCmd,
+		labelsSetCmd,
+		labelsDeleteCmd,
+	},
+}
+
+var labelsGetCmd = &cli.Command{
+	Name:  "get",
+	Usage: "Show labels of a provider, or of all labeled providers",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "provider",
+			Usage:   "Provider's peer ID. Lists all labeled providers if not specified.",
+			Aliases: []string{"p"},
+		},
+		&cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "Only list providers with a label matching this \"key=value\" or \"key\" selector. Repeat to match multiple labels.",
+		},
+		indexerHostFlag,
+	},
+	Action: labelsGetAction,
+}
+
+var labelsSetCmd = &cli.Command{
+	Name:  "set",
+	Usage: "Set a provider label, replacing any existing label with the same key",
+	Flags: []cli.Flag{
+		providerFlag,
+		&cli.StringFlag{
+			Name:     "key",
+			Usage:    "Label key",
+			Aliases:  []string{"k"},
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:    "value",
+			Usage:   "Label value",
+			Aliases: []string{"v"},
+		},
+		&cli.BoolFlag{
+			Name:  "public",
+			Usage: "Show the label in public provider information",
+		},
+		indexerHostFlag,
+	},
+	Action: labelsSetAction,
+}
+
+var labelsDeleteCmd = &cli.Command{
+	Name:  "delete",
+	Usage: "Delete a provider label",
+	Flags: []cli.Flag{
+		providerFlag,
+		&cli.StringFlag{
+			Name:     "key",
+			Usage:    "Label key",
+			Aliases:  []string{"k"},
+			Required: true,
+		},
+		indexerHostFlag,
+	},
+	Action: labelsDeleteAction,
+}
+
+var pollingCmd = &cli.Command{
+	Name:  "polling",
+	Usage: "Manage per-provider polling overrides",
+	Subcommands: []*cli.Command{
+		pollingGetCmd,
+		pollingSetCmd,
+		pollingDeleteCmd,
+	},
+}
+
+var pollingGetCmd = &cli.Command{
+	Name:  "get",
+	Usage: "Show polling status of a provider, or of all providers with polling overrides",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "provider",
+			Usage:   "Provider's peer ID. Lists all polling overrides if not specified.",
+			Aliases: []string{"p"},
+		},
+		indexerHostFlag,
+	},
+	Action: pollingGetAction,
+}
+
+var pollingSetCmd = &cli.Command{
+	Name:  "set",
+	Usage: "Set a provider's polling override. Unspecified values use the normal polling configuration.",
+	Flags: []cli.Flag{
+		providerFlag,
+		&cli.DurationFlag{
+			Name:  "interval",
+			Usage: "Time with no contact after which publisher is polled",
+		},
+		&cli.DurationFlag{
+			Name:  "retry-after",
+			Usage: "Time to wait between polling attempts",
+		},
+		&cli.DurationFlag{
+			Name:  "stop-after",
+			Usage: "Time to keep polling before the provider is removed",
+		},
+		&cli.DurationFlag{
+			Name:  "deactivate-after",
+			Usage: "Time to keep polling before the provider is excluded from find results",
+		},
+		indexerHostFlag,
+	},
+	Action: pollingSetAction,
+}
+
+var pollingDeleteCmd = &cli.Command{
+	Name:  "delete",
+	Usage: "Delete a provider's polling override that was previously set",
+	Flags: []cli.Flag{
+		providerFlag,
+		indexerHostFlag,
+	},
+	Action: pollingDeleteAction,
+}
+
 var reloadCmd = &cli.Command{
 	Name:  "reload-config",
 	Usage: "Reload various settings from the configuration file",
@@ -306,6 +580,325 @@ func freezeAction(cctx *cli.Context) error {
 	return nil
 }
 
+func unfreezeAction(cctx *cli.Context) error {
+	cl, err := client.New(cliIndexer(cctx, "admin"))
+	if err != nil {
+		return err
+	}
+
+	var status *model.UnfreezeStatus
+	if cctx.Bool("status") {
+		status, err = cl.UnfreezeStatus(cctx.Context)
+	} else {
+		status, err = cl.Unfreeze(cctx.Context)
+		if err == nil {
+			fmt.Println("Indexer unfrozen")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	printUnfreezeStatus(status)
+
+	if !cctx.Bool("wait") {
+		return nil
+	}
+	const checkInterval = 5 * time.Second
+	for status.Running {
+		select {
+		case <-time.After(checkInterval):
+		case <-cctx.Done():
+			return cctx.Err()
+		}
+		status, err = cl.UnfreezeStatus(cctx.Context)
+		if err != nil {
+			return err
+		}
+		printUnfreezeStatus(status)
+	}
+	return nil
+}
+
+func printUnfreezeStatus(status *model.UnfreezeStatus) {
+	state := "running"
+	if !status.Running {
+		state = "finished"
+	}
+	fmt.Printf("Re-sync %s: %d of %d publishers synced, %d failed\n", state, status.Synced, status.Publishers, len(status.Errors))
+	if !status.Running {
+		for _, msg := range status.Errors {
+			fmt.Println("  Error:", msg)
+		}
+	}
+}
+
+func backupAction(cctx *cli.Context) error {
+	cl, err := client.New(cliIndexer(cctx, "admin"))
+	if err != nil {
+		return err
+	}
+
+	var status *model.BackupStatus
+	if cctx.Bool("status") {
+		status, err = cl.BackupStatus(cctx.Context)
+	} else {
+		status, err = cl.Backup(cctx.Context, cctx.String("name"))
+	}
+	if err != nil {
+		return err
+	}
+	printBackupStatus(status)
+
+	if !cctx.Bool("wait") {
+		return nil
+	}
+	const checkInterval = 5 * time.Second
+	for status.Running {
+		select {
+		case <-time.After(checkInterval):
+		case <-cctx.Done():
+			return cctx.Err()
+		}
+		status, err = cl.BackupStatus(cctx.Context)
+		if err != nil {
+			return err
+		}
+		printBackupStatus(status)
+	}
+	if status.Error != "" {
+		return errors.New("backup failed")
+	}
+	return nil
+}
+
+func printBackupStatus(status *model.BackupStatus) {
+	if status.Running {
+		fmt.Printf("Backup %s running since %s\n", status.Name, status.Started.Format(time.RFC3339))
+		return
+	}
+	if status.Error != "" {
+		fmt.Printf("Backup %s failed: %s\n", status.Name, status.Error)
+		return
+	}
+	fmt.Printf("Backup %s finished in %s: %d publisher heads, %d datastore keys, %d value store files\n",
+		status.Name, status.Finished.Sub(status.Started).Round(time.Second), status.Publishers,
+		status.DatastoreKeys, status.ValueStoreFiles)
+}
+
+func rebuildAction(cctx *cli.Context) error {
+	cl, err := client.New(cliIndexer(cctx, "admin"))
+	if err != nil {
+		return err
+	}
+
+	var status *model.RebuildStatus
+	if cctx.Bool("status") {
+		status, err = cl.RebuildStatus(cctx.Context)
+	} else {
+		if cctx.String("pubid") == "" {
+			return errors.New("must specify --pubid")
+		}
+		var publisherID peer.ID
+		publisherID, err = peer.Decode(cctx.String("pubid"))
+		if err != nil {
+			return fmt.Errorf("bad publisher id: %w", err)
+		}
+		status, err = cl.RebuildFromMirror(cctx.Context, publisherID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if cctx.Bool("wait") {
+		const checkInterval = 5 * time.Second
+		for status.Running {
+			fmt.Printf("Rebuilding index of publisher %s from mirror since %s\n", status.Publisher, status.Started.Format(time.RFC3339))
+			select {
+			case <-time.After(checkInterval):
+			case <-cctx.Done():
+				return cctx.Err()
+			}
+			status, err = cl.RebuildStatus(cctx.Context)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	printRebuildStatus(status)
+	if status.Error != "" {
+		return errors.New("rebuild from mirror failed")
+	}
+	return nil
+}
+
+func printRebuildStatus(status *model.RebuildStatus) {
+	if status.Running {
+		fmt.Printf("Rebuilding index of publisher %s from mirror since %s\n", status.Publisher, status.Started.Format(time.RFC3339))
+		return
+	}
+	if status.Error != "" {
+		fmt.Printf("Rebuild of publisher %s from mirror failed: %s\n", status.Publisher, status.Error)
+	} else {
+		fmt.Printf("Rebuilt index of publisher %s from mirror in %s\n", status.Publisher,
+			status.Finished.Sub(status.Started).Round(time.Second))
+	}
+	fmt.Println("  Advertisements:", status.Ads)
+	fmt.Println("  Indexed:       ", status.Indexed)
+	fmt.Println("  Removals:      ", status.Removals)
+	fmt.Println("  Skipped:       ", status.Skipped)
+	if status.NoEntries != 0 {
+		fmt.Println("  No entries:    ", status.NoEntries)
+	}
+	fmt.Println("  Multihashes:   ", status.Multihashes)
+}
+
+func reconcileCountsAction(cctx *cli.Context) error {
+	cl, err := client.New(cliIndexer(cctx, "admin"))
+	if err != nil {
+		return err
+	}
+
+	var status *model.ReconcileStatus
+	if cctx.Bool("status") {
+		status, err = cl.ReconcileCountsStatus(cctx.Context)
+	} else {
+		status, err = cl.ReconcileCounts(cctx.Context, cctx.String("source"), cctx.Bool("rewrite"))
+	}
+	if err != nil {
+		return err
+	}
+
+	if cctx.Bool("wait") {
+		const checkInterval = 5 * time.Second
+		for status.Running {
+			fmt.Printf("Reconciling index counts with %s since %s\n", status.Source, status.Started.Format(time.RFC3339))
+			select {
+			case <-time.After(checkInterval):
+			case <-cctx.Done():
+				return cctx.Err()
+			}
+			status, err = cl.ReconcileCountsStatus(cctx.Context)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	printReconcileStatus(status)
+	if status.Error != "" {
+		return errors.New("index count reconciliation failed")
+	}
+	return nil
+}
+
+func printReconcileStatus(status *model.ReconcileStatus) {
+	if status.Running {
+		fmt.Printf("Reconciling index counts with %s since %s\n", status.Source, status.Started.Format(time.RFC3339))
+		return
+	}
+	if status.Error != "" {
+		fmt.Printf("Index count reconciliation with %s failed: %s\n", status.Source, status.Error)
+	} else {
+		fmt.Printf("Reconciled index counts with %s in %s\n", status.Source,
+			status.Finished.Sub(status.Started).Round(time.Second))
+	}
+	fmt.Println("  Providers:    ", status.Providers)
+	fmt.Println("  Contexts:     ", status.Contexts)
+	fmt.Println("  Discrepancies:", status.Discrepancies)
+	if status.Rewrite {
+		fmt.Println("  Rewritten:    ", status.Rewritten)
+		if status.Changed != 0 {
+			fmt.Println("  Changed:      ", status.Changed, "(updated by ingestion, not rewritten)")
+		}
+	}
+	for _, pd := range status.ProviderDiscrepancies {
+		fmt.Printf("  Provider %s: stored %d, actual %d\n", pd.ProviderID, pd.Stored, pd.Actual)
+	}
+	for _, providerID := range status.Skipped {
+		fmt.Printf("  Provider %s: skipped, counts incomplete in source\n", providerID)
+	}
+}
+
+func valueStoreMaintenanceAction(cctx *cli.Context) error {
+	cl, err := client.New(cliIndexer(cctx, "admin"))
+	if err != nil {
+		return err
+	}
+
+	var status *model.MaintenanceStatus
+	switch cctx.Command.Name {
+	case "gc":
+		status, err = cl.ValueStoreGC(cctx.Context, cctx.Duration("limit"), !cctx.Bool("no-throttle"))
+	case "compact":
+		status, err = cl.ValueStoreCompact(cctx.Context, cctx.Duration("limit"), !cctx.Bool("no-throttle"))
+	default:
+		status, err = cl.ValueStoreMaintenance(cctx.Context)
+	}
+	if err != nil {
+		return err
+	}
+	printMaintenanceStatus(status)
+
+	if !cctx.Bool("wait") || status.Current == nil {
+		return nil
+	}
+	const checkInterval = 5 * time.Second
+	for status.Current != nil {
+		select {
+		case <-time.After(checkInterval):
+		case <-cctx.Done():
+			return cctx.Err()
+		}
+		status, err = cl.ValueStoreMaintenance(cctx.Context)
+		if err != nil {
+			return err
+		}
+		if status.Current != nil {
+			printMaintenanceRun("Current", status.Current)
+		}
+	}
+	printMaintenanceRun("Last", status.Last)
+	return nil
+}
+
+func printMaintenanceStatus(status *model.MaintenanceStatus) {
+	fmt.Println("GC supported:", status.GCSupported)
+	fmt.Println("Compaction supported:", status.CompactSupported)
+	if status.Current != nil {
+		printMaintenanceRun("Current", status.Current)
+	}
+	if status.Last != nil {
+		printMaintenanceRun("Last", status.Last)
+	}
+}
+
+func printMaintenanceRun(label string, run *model.MaintenanceRun) {
+	if run == nil {
+		return
+	}
+	var limit string
+	if run.TimeLimit != 0 {
+		limit = fmt.Sprint(", limit ", time.Duration(run.TimeLimit))
+	}
+	var throttled string
+	if run.Throttled {
+		throttled = ", throttled"
+	}
+	if run.Running {
+		fmt.Printf("%s %s: running for %s%s%s\n", label, run.Operation,
+			time.Since(run.Started).Round(time.Second), limit, throttled)
+		return
+	}
+	fmt.Printf("%s %s: finished %s, took %s%s%s\n", label, run.Operation, run.Finished.Format(time.RFC3339),
+		run.Finished.Sub(run.Started).Round(time.Second), limit, throttled)
+	if run.LimitReached {
+		fmt.Println("  Stopped at time limit")
+	}
+	fmt.Println("  Bytes reclaimed:", run.BytesReclaimed)
+	if run.Error != "" {
+		fmt.Println("  Error:", run.Error)
+	}
+}
+
 func importProvidersAction(cctx *cli.Context) error {
 	fromHost := cctx.String("from")
 	if !strings.HasPrefix(fromHost, "http://") && !strings.HasPrefix(fromHost, "https://") {
@@ -359,6 +952,7 @@ func statusAction(cctx *cli.Context) error {
 		percent = fmt.Sprintf("%0.2f%%", st.Usage)
 	}
 	fmt.Println("Usage:", percent)
+	fmt.Println("Disk pressure level:", st.PressureLevel)
 	return nil
 }
 
@@ -380,3 +974,185 @@ func unassignAction(cctx *cli.Context) error {
 	fmt.Println("Restart assigner service see this change. To prevent re-assignment to this indexer, first block the peer on this indexer or configure a pre-set assignment.")
 	return nil
 }
+
+func pollingGetAction(cctx *cli.Context) error {
+	cl, err := client.New(cliIndexer(cctx, "admin"))
+	if err != nil {
+		return err
+	}
+
+	if !cctx.IsSet("provider") {
+		statuses, err := cl.ListPollOverrides(cctx.Context)
+		if err != nil {
+			return err
+		}
+		if len(statuses) == 0 {
+			fmt.Println("No polling overrides")
+			return nil
+		}
+		for i := range statuses {
+			printPollStatus(&statuses[i])
+			fmt.Println()
+		}
+		return nil
+	}
+
+	providerID, err := peer.Decode(cctx.String("provider"))
+	if err != nil {
+		return err
+	}
+	status, err := cl.GetPollStatus(cctx.Context, providerID)
+	if err != nil {
+		return err
+	}
+	printPollStatus(status)
+	return nil
+}
+
+func pollingSetAction(cctx *cli.Context) error {
+	cl, err := client.New(cliIndexer(cctx, "admin"))
+	if err != nil {
+		return err
+	}
+	providerID, err := peer.Decode(cctx.String("provider"))
+	if err != nil {
+		return err
+	}
+	override := model.PollOverride{
+		Interval:        config.Duration(cctx.Duration("interval")),
+		RetryAfter:      config.Duration(cctx.Duration("retry-after")),
+		StopAfter:       config.Duration(cctx.Duration("stop-after")),
+		DeactivateAfter: config.Duration(cctx.Duration("deactivate-after")),
+	}
+	if err = cl.SetPollOverride(cctx.Context, providerID, override); err != nil {
+		return err
+	}
+	fmt.Println("Set polling override for provider", providerID)
+	return nil
+}
+
+func pollingDeleteAction(cctx *cli.Context) error {
+	cl, err := client.New(cliIndexer(cctx, "admin"))
+	if err != nil {
+		return err
+	}
+	providerID, err := peer.Decode(cctx.String("provider"))
+	if err != nil {
+		return err
+	}
+	if err = cl.DeletePollOverride(cctx.Context, providerID); err != nil {
+		return err
+	}
+	fmt.Println("Deleted polling override for provider", providerID)
+	return nil
+}
+
+func printPollStatus(status *model.PollStatus) {
+	fmt.Println("Provider:", status.ProviderID)
+	switch {
+	case status.Persisted:
+		fmt.Println("    Override: set at runtime")
+	case status.Override:
+		fmt.Println("    Override: from config file")
+	default:
+		fmt.Println("    Override: none")
+	}
+	fmt.Println("    Interval:", status.Interval)
+	fmt.Println("    RetryAfter:", status.RetryAfter)
+	fmt.Println("    StopAfter:", status.StopAfter)
+	fmt.Println("    DeactivateAfter:", status.DeactivateAfter)
+	if status.LastContact == nil {
+		fmt.Println("    LastContact: none since indexer started")
+		return
+	}
+	fmt.Println("    LastContact:", status.LastContact.Format(time.RFC3339))
+	fmt.Println("    NextPoll:", status.NextPoll.Format(time.RFC3339))
+	fmt.Println("    Deactivate:", status.Deactivate.Format(time.RFC3339))
+	fmt.Println("    Remove:", status.Remove.Format(time.RFC3339))
+}
+
+func labelsGetAction(cctx *cli.Context) error {
+	cl, err := client.New(cliIndexer(cctx, "admin"))
+	if err != nil {
+		return err
+	}
+
+	if !cctx.IsSet("provider") {
+		labeled, err := cl.ListLabeled(cctx.Context, cctx.StringSlice("label")...)
+		if err != nil {
+			return err
+		}
+		if len(labeled) == 0 {
+			fmt.Println("No labeled providers")
+			return nil
+		}
+		for _, pl := range labeled {
+			fmt.Println("Provider:", pl.ProviderID)
+			printLabels(pl.Labels)
+		}
+		return nil
+	}
+
+	providerID, err := peer.Decode(cctx.String("provider"))
+	if err != nil {
+		return err
+	}
+	labels, err := cl.GetLabels(cctx.Context, providerID)
+	if err != nil {
+		return err
+	}
+	if len(labels) == 0 {
+		fmt.Println("Provider has no labels")
+		return nil
+	}
+	printLabels(labels)
+	return nil
+}
+
+func labelsSetAction(cctx *cli.Context) error {
+	cl, err := client.New(cliIndexer(cctx, "admin"))
+	if err != nil {
+		return err
+	}
+	providerID, err := peer.Decode(cctx.String("provider"))
+	if err != nil {
+		return err
+	}
+	label := model.Label{
+		Key:    cctx.String("key"),
+		Value:  cctx.String("value"),
+		Public: cctx.Bool("public"),
+	}
+	if err = cl.SetLabel(cctx.Context, providerID, label); err != nil {
+		return err
+	}
+	fmt.Println("Set label", label.Key, "on provider", providerID)
+	return nil
+}
+
+func labelsDeleteAction(cctx *cli.Context) error {
+	cl, err := client.New(cliIndexer(cctx, "admin"))
+	if err != nil {
+		return err
+	}
+	providerID, err := peer.Decode(cctx.String("provider"))
+	if err != nil {
+		return err
+	}
+	key := cctx.String("key")
+	if err = cl.DeleteLabel(cctx.Context, providerID, key); err != nil {
+		return err
+	}
+	fmt.Println("Deleted label", key, "from provider", providerID)
+	return nil
+}
+
+func printLabels(labels []model.Label) {
+	for _, label := range labels {
+		var public string
+		if label.Public {
+			public = " (public)"
+		}
+		fmt.Printf("    %s=%s%s\n", label.Key, label.Value, public)
+	}
+}
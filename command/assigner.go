@@ -10,6 +10,7 @@ var AssignerCmd = &cli.Command{
 	Usage:       "Start a network indexer assigner service daemon",
 	Description: "The assigner service is responsible for assigning content advertisement publishers to indexers.",
 	Subcommands: []*cli.Command{
+		command.AdminCmd,
 		command.DaemonCmd,
 		command.InitCmd,
 	},
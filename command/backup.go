@@ -0,0 +1,248 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipni/storetheindex/config"
+	"github.com/ipni/storetheindex/filestore"
+	"github.com/ipni/storetheindex/internal/backup"
+	"github.com/ipni/storetheindex/internal/ingest"
+	httpadminserver "github.com/ipni/storetheindex/server/admin/http"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/urfave/cli/v2"
+)
+
+var backupDirFlag = &cli.StringFlag{
+	Name:  "dir",
+	Usage: "Local directory where backups are stored. Overrides Backup.Storage in config",
+}
+
+var BackupCmd = &cli.Command{
+	Name:  "backup",
+	Usage: "Write a backup of a stopped indexer",
+	Description: "Backs up the datastore, value store, and config of a stopped indexer. " +
+		"Use \"storetheindex admin backup\" to back up a running indexer.",
+	Flags: []cli.Flag{
+		backupDirFlag,
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "Name of backup. Default is the current UTC time",
+		},
+	},
+	Action: backupOfflineAction,
+}
+
+var RestoreCmd = &cli.Command{
+	Name:  "restore",
+	Usage: "Restore a backup into a stopped indexer",
+	Description: "Restores the datastore and value store of a backup into the locations given by the indexer config. " +
+		"The datastore must be empty and the value store directory must be empty or not exist. " +
+		"The restored indexer resumes syncing from the advertisements recorded in the backup. " +
+		"If the backup does not contain the value store, then the restored indexer indexes all advertisements again.",
+	Flags: []cli.Flag{
+		backupDirFlag,
+		&cli.StringFlag{
+			Name:     "name",
+			Usage:    "Name of backup to restore",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "config-to",
+			Usage: "Also restore the backed up config to this file, which must not exist",
+		},
+	},
+	Action: restoreAction,
+}
+
+func backupOfflineAction(cctx *cli.Context) error {
+	cfg, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+	fileStore, err := backupFileStore(cfg.Backup.Storage, cctx.String("dir"))
+	if err != nil {
+		return err
+	}
+
+	// Opening the datastore fails if the indexer is running.
+	dstore, _, err := createDatastore(cfg.Datastore)
+	if err != nil {
+		return err
+	}
+	defer dstore.Close()
+
+	heads, err := ingest.LatestSyncs(cctx.Context, dstore)
+	if err != nil {
+		return fmt.Errorf("cannot read latest synced advertisements: %w", err)
+	}
+	cfgFile, err := config.Filename("")
+	if err != nil {
+		return err
+	}
+	peerID, _, err := cfg.Identity.Decode()
+	if err != nil {
+		return err
+	}
+	src := backup.Source{
+		ConfigFile:     cfgFile,
+		Datastore:      dstore,
+		Heads:          heads,
+		PeerID:         peerID,
+		ValueStoreType: cfg.Indexer.ValueStoreType,
+	}
+	if valueStoreHasFiles(cfg.Indexer.ValueStoreType) {
+		src.ValueStoreDir, err = config.Path("", cfg.Indexer.ValueStoreDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	name := cctx.String("name")
+	if name == "" {
+		name = time.Now().UTC().Format("20060102T150405Z")
+	}
+	fmt.Println("Writing backup", name)
+	m, err := backup.Write(cctx.Context, fileStore, name, src)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backup %s complete: %d publisher heads, %d datastore keys, %d value store files\n",
+		m.Name, len(m.Heads), m.DatastoreKeys, len(m.ValueStoreFiles))
+	return nil
+}
+
+func restoreAction(cctx *cli.Context) error {
+	cfg, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+	fileStore, err := backupFileStore(cfg.Backup.Storage, cctx.String("dir"))
+	if err != nil {
+		return err
+	}
+
+	name := cctx.String("name")
+	m, err := backup.ReadManifest(cctx.Context, fileStore, name)
+	if err != nil {
+		return fmt.Errorf("cannot read backup %s: %w", name, err)
+	}
+	if len(m.ValueStoreFiles) != 0 && m.ValueStoreType != cfg.Indexer.ValueStoreType {
+		return fmt.Errorf("backup has %s value store, but indexer is configured for %s", m.ValueStoreType, cfg.Indexer.ValueStoreType)
+	}
+
+	dstore, _, err := createDatastore(cfg.Datastore)
+	if err != nil {
+		return err
+	}
+	defer dstore.Close()
+
+	dst := backup.Target{
+		Datastore: dstore,
+	}
+	if valueStoreHasFiles(m.ValueStoreType) {
+		dst.IndexStatePrefixes = ingest.IndexStatePrefixes()
+	}
+	if cctx.IsSet("config-to") {
+		dst.ConfigFile, err = filepath.Abs(cctx.String("config-to"))
+		if err != nil {
+			return err
+		}
+	}
+	if len(m.ValueStoreFiles) != 0 {
+		dst.ValueStoreDir, err = config.Path("", cfg.Indexer.ValueStoreDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Restoring backup", name, "created", m.Created.Format(time.RFC3339))
+	if _, err = backup.Restore(cctx.Context, fileStore, name, dst); err != nil {
+		return err
+	}
+	fmt.Printf("Restored %d datastore keys and %d value store files\n", m.DatastoreKeys, len(m.ValueStoreFiles))
+	if len(m.ValueStoreFiles) == 0 && valueStoreHasFiles(m.ValueStoreType) {
+		fmt.Println("Backup does not contain the value store, since it was taken of a running indexer")
+		fmt.Println("Indexer will sync and index the advertisement chains of all publishers again from the start")
+	} else {
+		fmt.Printf("Indexer will resume syncing %d publishers from their backed up advertisements\n", len(m.Heads))
+	}
+	if dst.ConfigFile != "" && m.Config {
+		fmt.Println("Restored config to", dst.ConfigFile)
+	}
+	return nil
+}
+
+// newBackupFunc returns a function that writes a backup of the running
+// indexer. The backup contains the datastore and publisher heads, but not the
+// value store files, which are only consistent when the indexer is stopped.
+// Ingestion is paused only while the heads are read and the datastore is
+// copied to a local snapshot, so that the heads match the datastore. The
+// snapshot is written to backup storage after ingestion resumes.
+func newBackupFunc(cfgBackup config.Backup, dstore datastore.Datastore, cfgIndexer config.Indexer, peerID peer.ID, ingester *ingest.Ingester) httpadminserver.BackupFunc {
+	return func(ctx context.Context, name string) (*backup.Manifest, error) {
+		fileStore, err := backupFileStore(cfgBackup.Storage, "")
+		if err != nil {
+			return nil, err
+		}
+		cfgFile, err := config.Filename("")
+		if err != nil {
+			return nil, err
+		}
+		src := backup.Source{
+			ConfigFile:     cfgFile,
+			Online:         true,
+			PeerID:         peerID,
+			ValueStoreType: cfgIndexer.ValueStoreType,
+		}
+
+		if ingester != nil {
+			ingester.PauseIngest()
+		}
+		src.Heads, err = ingest.LatestSyncs(ctx, dstore)
+		if err != nil {
+			err = fmt.Errorf("cannot read latest synced advertisements: %w", err)
+		} else {
+			src.Snapshot, err = backup.SnapshotDatastore(ctx, dstore, "")
+			if err != nil {
+				err = fmt.Errorf("cannot snapshot datastore: %w", err)
+			}
+		}
+		if ingester != nil {
+			ingester.ResumeIngest()
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer src.Snapshot.Close()
+
+		return backup.Write(ctx, fileStore, name, src)
+	}
+}
+
+// backupFileStore returns the file store where backups are kept. If dir is
+// not empty, then it is used as a local file store instead of the configured
+// storage.
+func backupFileStore(cfgStorage config.FileStore, dir string) (filestore.Interface, error) {
+	if dir != "" {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		return filestore.NewLocal(dir)
+	}
+	if cfgStorage.Type == "" || cfgStorage.Type == "none" {
+		return nil, errors.New("backup storage not configured")
+	}
+	return filestore.New(cfgStorage)
+}
+
+// valueStoreHasFiles returns true if the value store type keeps its data in
+// the value store directory.
+func valueStoreHasFiles(vsType string) bool {
+	return vsType == vstoreStorethehash || vsType == vstorePebble
+}
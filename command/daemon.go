@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"reflect"
 	"syscall"
 	"time"
+	"unsafe"
 
 	pbl "github.com/cockroachdb/pebble"
 	"github.com/cockroachdb/pebble/bloom"
@@ -25,10 +27,14 @@ import (
 	"github.com/ipni/go-indexer-core/store/pebble"
 	"github.com/ipni/go-indexer-core/store/storethehash"
 	"github.com/ipni/go-libipni/mautil"
+	"github.com/ipni/storetheindex/carstore"
 	"github.com/ipni/storetheindex/config"
+	"github.com/ipni/storetheindex/filestore"
 	"github.com/ipni/storetheindex/fsutil"
 	"github.com/ipni/storetheindex/internal/counter"
 	"github.com/ipni/storetheindex/internal/ingest"
+	"github.com/ipni/storetheindex/internal/maintenance"
+	"github.com/ipni/storetheindex/internal/pebbleds"
 	"github.com/ipni/storetheindex/internal/registry"
 	httpadminserver "github.com/ipni/storetheindex/server/admin/http"
 	httpfindserver "github.com/ipni/storetheindex/server/find/http"
@@ -41,6 +47,12 @@ import (
 	"github.com/urfave/cli/v2"
 )
 
+// Recognized datastore type names.
+const (
+	dstoreLevelDB = "levelds"
+	dstorePebble  = "pebble"
+)
+
 // Recognized valuestore type names.
 const (
 	vstoreMemory       = "memory"
@@ -100,18 +112,27 @@ func daemonAction(cctx *cli.Context) error {
 	var freezeDirs []string
 
 	// Create a valuestore of the configured type.
-	valueStore, minKeyLen, vsDir, err := createValueStore(cctx.Context, cfg.Indexer)
+	valueStore, vsInfo, err := createValueStore(cctx.Context, cfg.Indexer)
 	if err != nil {
 		return err
 	}
+	var maintainer *maintenance.Maintainer
 	if valueStore != nil {
 		log.Info("Valuestore initialized")
 		// If the value store requires a minimum key length, make sure the
 		// ingester is configured with at least the minimum.
-		if minKeyLen > cfg.Ingest.MinimumKeyLength {
-			cfg.Ingest.MinimumKeyLength = minKeyLen
+		if vsInfo.minKeyLen > cfg.Ingest.MinimumKeyLength {
+			cfg.Ingest.MinimumKeyLength = vsInfo.minKeyLen
 		}
-		freezeDirs = append(freezeDirs, vsDir)
+		freezeDirs = append(freezeDirs, vsInfo.dir)
+
+		maintainer, err = createMaintainer(valueStore, vsInfo)
+		if err != nil {
+			return err
+		}
+	}
+	if err = checkPressureMaintenance(cfg.Indexer.DiskPressure, maintainer); err != nil {
+		return err
 	}
 
 	// Create datastore
@@ -162,9 +183,21 @@ func daemonAction(cctx *cli.Context) error {
 	indexCounts := counter.NewIndexCounts(dstore)
 	indexCounts.SetTotalAddend(cfg.Indexer.IndexCountTotalAddend)
 
+	// Disk pressure level changes are handled by the main daemon loop. Only
+	// the most recent level change needs handling.
+	pressureChan := make(chan int, 1)
+	pressureFunc := func(level int) {
+		select {
+		case <-pressureChan:
+		default:
+		}
+		pressureChan <- level
+	}
+
 	// Create registry
 	reg, err := registry.New(cctx.Context, cfg.Discovery, dstore,
-		registry.WithFreezer(freezeDirs, cfg.Indexer.FreezeAtPercent))
+		registry.WithFreezer(freezeDirs, cfg.Indexer.FreezeAtPercent),
+		registry.WithPressureLevels(cfg.Indexer.DiskPressure.AtPercents(), pressureFunc))
 	if err != nil {
 		return fmt.Errorf("cannot create provider registry: %s", err)
 	}
@@ -280,6 +313,13 @@ func daemonAction(cctx *cli.Context) error {
 		log.Infow("libp2p servers initialized", "host_id", p2pHost.ID(), "multiaddr", p2pmaddr)
 	}
 
+	if cfg.Discovery.ProbeInterval != 0 {
+		if err = reg.StartProbing(p2pHost); err != nil {
+			return fmt.Errorf("cannot start provider reachability probing: %w", err)
+		}
+		log.Infow("Provider reachability probing enabled", "interval", cfg.Discovery.ProbeInterval)
+	}
+
 	// Create ingest HTTP server
 	var ingestSvr *httpingestserver.Server
 	ingestAddr := cfg.Addresses.Ingest
@@ -291,8 +331,18 @@ func daemonAction(cctx *cli.Context) error {
 		if err != nil {
 			return fmt.Errorf("bad ingest address %s: %s", ingestAddr, err)
 		}
-		ingestSvr, err = httpingestserver.New(ingestNetAddr.String(), indexerCore, ingester, reg,
-			httpingestserver.WithVersion(cctx.App.Version))
+		ingestOpts := []httpingestserver.Option{
+			httpingestserver.WithVersion(cctx.App.Version),
+		}
+		if cfg.Ingest.AdvertisementMirror.Serve {
+			carReader, err := newMirrorReader(cfg.Ingest.AdvertisementMirror)
+			if err != nil {
+				return err
+			}
+			ingestOpts = append(ingestOpts, httpingestserver.WithMirror(carReader, privKey))
+			log.Infow("Publishing mirrored advertisement chains", "path", httpingestserver.MirrorPath)
+		}
+		ingestSvr, err = httpingestserver.New(ingestNetAddr.String(), indexerCore, ingester, reg, ingestOpts...)
 		if err != nil {
 			return err
 		}
@@ -311,7 +361,10 @@ func daemonAction(cctx *cli.Context) error {
 		if err != nil {
 			return fmt.Errorf("bad admin address %s: %s", adminAddr, err)
 		}
-		adminSvr, err = httpadminserver.New(adminNetAddr.String(), peerID, indexerCore, ingester, reg, reloadErrsChan)
+		adminSvr, err = httpadminserver.New(adminNetAddr.String(), peerID, indexerCore, ingester, reg, reloadErrsChan,
+			httpadminserver.WithBackup(newBackupFunc(cfg.Backup, dstore, cfg.Indexer, peerID, ingester)),
+			httpadminserver.WithMaintainer(maintainer),
+			httpadminserver.WithReconcile(newReconcileFunc(indexCounts, valueStore, dstore, cfg.Ingest.AdvertisementMirror)))
 		if err != nil {
 			return err
 		}
@@ -401,7 +454,7 @@ func daemonAction(cctx *cli.Context) error {
 				ticker.Reset(time.Duration(cfg.Indexer.ConfigCheckInterval))
 			}
 
-			cfg, err = reloadConfig(cfgPath, ingester, reg, valueStore)
+			cfg, err = reloadConfig(cfgPath, ingester, reg, valueStore, maintainer)
 			if err != nil {
 				log.Errorw("Error reloading conifg", "err", err)
 				if errChan != nil {
@@ -426,9 +479,21 @@ func daemonAction(cctx *cli.Context) error {
 				indexCounts.SetTotalAddend(cfg.Indexer.IndexCountTotalAddend)
 			}
 
+			// Reapply disk pressure settings, since reloading resets the
+			// ingest worker count.
+			applyDiskPressure(cfg.Indexer.DiskPressure, reg.PressureLevel(), cfg.Ingest.IngestWorkerCount, ingester)
+
 			if errChan != nil {
 				errChan <- nil
 			}
+		case level := <-pressureChan:
+			pressure := applyDiskPressure(cfg.Indexer.DiskPressure, level, cfg.Ingest.IngestWorkerCount, ingester)
+			// The config is checked to only have supported operations.
+			for _, op := range pressureMaintenance(pressure) {
+				if _, err = maintainer.Start(op, 0, true); err != nil {
+					log.Warnw("Cannot start value store maintenance for disk pressure", "operation", op, "err", err)
+				}
+			}
 		case <-timeChan:
 			var changed bool
 			modTime, changed, err = fsutil.FileChanged(cfgPath, modTime)
@@ -505,6 +570,10 @@ func daemonAction(cctx *cli.Context) error {
 		}
 	}
 
+	if maintainer != nil {
+		maintainer.Close()
+	}
+
 	if valueStore != nil {
 		if err = valueStore.Close(); err != nil {
 			log.Errorw("Error closing value store", "err", err)
@@ -519,25 +588,39 @@ func daemonAction(cctx *cli.Context) error {
 	return finalErr
 }
 
-func createValueStore(ctx context.Context, cfgIndexer config.Indexer) (indexer.Interface, int, string, error) {
+// valueStoreInfo describes a value store created by createValueStore.
+type valueStoreInfo struct {
+	// dir is the value store directory.
+	dir string
+	// minKeyLen is the minimum multihash length that the value store needs.
+	minKeyLen int
+	// sthStore is the store used by a storethehash value store.
+	sthStore *sth.Store
+	// pebbleDB is the database used by a pebble value store.
+	pebbleDB *pbl.DB
+}
+
+func createValueStore(ctx context.Context, cfgIndexer config.Indexer) (indexer.Interface, valueStoreInfo, error) {
 	const sthMinKeyLen = 4
 
 	if cfgIndexer.ValueStoreType == "" || cfgIndexer.ValueStoreType == "none" {
-		return nil, 0, "", nil
+		return nil, valueStoreInfo{}, nil
 	}
 
 	dir, err := config.Path("", cfgIndexer.ValueStoreDir)
 	if err != nil {
-		return nil, 0, "", err
+		return nil, valueStoreInfo{}, err
 	}
 	log.Infow("Valuestore initializing/opening", "type", cfgIndexer.ValueStoreType, "path", dir)
 
 	if err = fsutil.DirWritable(dir); err != nil {
-		return nil, 0, "", err
+		return nil, valueStoreInfo{}, err
 	}
 
 	var vs indexer.Interface
-	var minKeyLen int
+	info := valueStoreInfo{
+		dir: dir,
+	}
 
 	switch cfgIndexer.ValueStoreType {
 	case vstoreStorethehash:
@@ -545,7 +628,8 @@ func createValueStore(ctx context.Context, cfgIndexer config.Indexer) (indexer.I
 			cfgIndexer.GCInterval = 0
 			cfgIndexer.GCTimeLimit = 0
 		}
-		vs, err = storethehash.New(
+		var sthStorage *storethehash.SthStorage
+		sthStorage, err = storethehash.New(
 			ctx,
 			dir,
 			cfgIndexer.CorePutConcurrency,
@@ -556,7 +640,15 @@ func createValueStore(ctx context.Context, cfgIndexer config.Indexer) (indexer.I
 			sth.IndexBitSize(cfgIndexer.STHBits),
 			sth.FileCacheSize(cfgIndexer.STHFileCacheSize),
 		)
-		minKeyLen = sthMinKeyLen
+		if err == nil {
+			vs = sthStorage
+			// The store only runs GC on demand if it is configured to run
+			// GC periodically.
+			if cfgIndexer.GCInterval != 0 {
+				info.sthStore = fieldOfType[*sth.Store](sthStorage)
+			}
+		}
+		info.minKeyLen = sthMinKeyLen
 	case vstoreMemory:
 		vs, err = memory.New(), nil
 	case vstorePebble:
@@ -599,13 +691,51 @@ func createValueStore(ctx context.Context, cfgIndexer config.Indexer) (indexer.I
 		pebbleOpts.Cache = pbl.NewCache(int64(cfgIndexer.PebbleBlockCacheSize))
 
 		vs, err = pebble.New(dir, pebbleOpts)
+		if err == nil {
+			info.pebbleDB = fieldOfType[*pbl.DB](vs)
+		}
 	default:
 		err = fmt.Errorf("unrecognized store type: %s", cfgIndexer.ValueStoreType)
 	}
 	if err != nil {
-		return nil, 0, "", fmt.Errorf("cannot create %s value store: %w", cfgIndexer.ValueStoreType, err)
+		return nil, valueStoreInfo{}, fmt.Errorf("cannot create %s value store: %w", cfgIndexer.ValueStoreType, err)
+	}
+	return vs, info, nil
+}
+
+// createMaintainer creates a maintainer that runs garbage collection and
+// compaction of the value store, as supported by the value store type.
+func createMaintainer(valueStore indexer.Interface, info valueStoreInfo) (*maintenance.Maintainer, error) {
+	opts := []maintenance.Option{maintenance.WithDir(info.dir)}
+	if info.sthStore != nil {
+		opts = append(opts, maintenance.WithCollector(maintenance.NewSthCollector(info.sthStore)))
+	}
+	if info.pebbleDB != nil {
+		opts = append(opts, maintenance.WithCompactor(maintenance.NewPebbleCompactor(info.pebbleDB)))
 	}
-	return vs, minKeyLen, dir, nil
+	return maintenance.New(valueStore, opts...)
+}
+
+// fieldOfType returns the value of the first field of type T in the struct
+// that v points to, or the zero value of T if there is no such field. The
+// go-indexer-core value stores do not export the storethehash store or pebble
+// database that they use, and these are needed for maintenance.
+func fieldOfType[T any](v any) T {
+	var zero T
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return zero
+	}
+	rv = rv.Elem()
+	want := reflect.TypeOf(zero)
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Field(i)
+		if field.Type() == want {
+			// Unexported fields can only be read through a pointer.
+			return reflect.NewAt(want, unsafe.Pointer(field.UnsafeAddr())).Elem().Interface().(T)
+		}
+	}
+	return zero
 }
 
 func setLoggingConfig(cfgLogging config.Logging) error {
@@ -634,19 +764,67 @@ func loadConfig(filePath string) (*config.Config, error) {
 		log.Warn("Configuration file out-of-date. Upgrade by running: ./storetheindex init --upgrade")
 	}
 
-	if cfg.Datastore.Type != "levelds" {
-		return nil, fmt.Errorf("only levelds datastore type supported, %q not supported", cfg.Datastore.Type)
+	switch cfg.Datastore.Type {
+	case dstoreLevelDB, dstorePebble:
+	default:
+		return nil, fmt.Errorf("datastore type %q not supported", cfg.Datastore.Type)
 	}
 
 	return cfg, nil
 }
 
-func reloadConfig(cfgPath string, ingester *ingest.Ingester, reg *registry.Registry, valueStore indexer.Interface) (*config.Config, error) {
+// applyDiskPressure adjusts ingestion according to the settings of the disk
+// pressure level, and returns those settings. Level 0 restores normal
+// ingestion.
+func applyDiskPressure(cfg config.DiskPressure, level, workerCount int, ingester *ingest.Ingester) config.PressureLevel {
+	pressure, _ := cfg.Level(level)
+	if ingester != nil {
+		if pressure.IngestWorkerCount != 0 && pressure.IngestWorkerCount < workerCount {
+			workerCount = pressure.IngestWorkerCount
+		}
+		ingester.RunWorkers(workerCount)
+		ingester.PauseEntries(pressure.PauseEntries, cfg.PriorityLabels)
+	}
+	log.Infow("Applied disk pressure level", "level", level, "ingestWorkers", workerCount, "pauseEntries", pressure.PauseEntries)
+	return pressure
+}
+
+// pressureMaintenance returns the value store maintenance operations that are
+// started when the disk pressure level is entered.
+func pressureMaintenance(pressure config.PressureLevel) []maintenance.Operation {
+	var ops []maintenance.Operation
+	if pressure.GC {
+		ops = append(ops, maintenance.GC)
+	}
+	if pressure.Compact {
+		ops = append(ops, maintenance.Compact)
+	}
+	return ops
+}
+
+// checkPressureMaintenance returns an error if any disk pressure level starts
+// value store maintenance that is not supported by the value store.
+func checkPressureMaintenance(cfg config.DiskPressure, maintainer *maintenance.Maintainer) error {
+	for _, level := range cfg.Levels {
+		for _, op := range pressureMaintenance(level) {
+			if maintainer == nil || !maintainer.Supported(op) {
+				return fmt.Errorf("disk pressure level at %v percent starts %s, which the value store does not support", level.AtPercent, op)
+			}
+		}
+	}
+	return nil
+}
+
+func reloadConfig(cfgPath string, ingester *ingest.Ingester, reg *registry.Registry, valueStore indexer.Interface, maintainer *maintenance.Maintainer) (*config.Config, error) {
 	cfg, err := loadConfig(cfgPath)
 	if err != nil {
 		return nil, err
 	}
 
+	if err = checkPressureMaintenance(cfg.Indexer.DiskPressure, maintainer); err != nil {
+		return nil, err
+	}
+
 	err = reg.SetPolicy(cfg.Discovery.Policy)
 	if err != nil {
 		return nil, fmt.Errorf("failed to set policy config: %w", err)
@@ -731,9 +909,6 @@ func reloadPeering(cfg config.Peering, peeringService *peering.PeeringService, p
 }
 
 func createDatastore(cfg config.Datastore) (datastore.Batching, string, error) {
-	if cfg.Type != "levelds" {
-		return nil, "", fmt.Errorf("only levelds datastore type supported, %q not supported", cfg.Type)
-	}
 	dataStorePath, err := config.Path("", cfg.Dir)
 	if err != nil {
 		return nil, "", err
@@ -741,9 +916,30 @@ func createDatastore(cfg config.Datastore) (datastore.Batching, string, error) {
 	if err = fsutil.DirWritable(dataStorePath); err != nil {
 		return nil, "", err
 	}
-	ds, err := leveldb.NewDatastore(dataStorePath, nil)
+
+	var ds datastore.Batching
+	switch cfg.Type {
+	case dstoreLevelDB:
+		ds, err = leveldb.NewDatastore(dataStorePath, nil)
+	case dstorePebble:
+		ds, err = pebbleds.New(dataStorePath, nil)
+	default:
+		return nil, "", fmt.Errorf("datastore type %q not supported", cfg.Type)
+	}
 	if err != nil {
-		return nil, "", err
+		return nil, "", fmt.Errorf("cannot open %s datastore: %w", cfg.Type, err)
 	}
 	return ds, dataStorePath, nil
 }
+
+// newMirrorReader creates a CarReader for the advertisement mirror.
+func newMirrorReader(cfgMirror config.Mirror) (*carstore.CarReader, error) {
+	fileStore, err := filestore.New(cfgMirror.Storage, filestore.WithVerify(carstore.VerifyRoot))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create mirror file storage: %w", err)
+	}
+	if fileStore == nil {
+		return nil, errors.New("advertisement mirror storage not configured")
+	}
+	return carstore.NewReader(fileStore, carstore.WithCompress(cfgMirror.Compress))
+}
@@ -0,0 +1,109 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	pbl "github.com/cockroachdb/pebble"
+	"github.com/ipni/go-libipni/test"
+	"github.com/ipni/storetheindex/config"
+	"github.com/ipni/storetheindex/internal/maintenance"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueStoreMaintenance(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("storethehash", func(t *testing.T) {
+		cfgIndexer := config.NewIndexer()
+		cfgIndexer.ValueStoreType = vstoreStorethehash
+		cfgIndexer.ValueStoreDir = t.TempDir()
+		// GC runs on demand only if the store is configured to run GC.
+		cfgIndexer.GCInterval = config.Duration(time.Hour)
+		cfgIndexer.STHBits = 8
+		valueStore, vsInfo, err := createValueStore(ctx, cfgIndexer)
+		require.NoError(t, err)
+		defer valueStore.Close()
+		require.NotNil(t, vsInfo.sthStore)
+
+		mhs := test.RandomMultihashes(100)
+		for _, mh := range mhs {
+			require.NoError(t, vsInfo.sthStore.Put(mh, []byte("value")))
+		}
+		for _, mh := range mhs[:50] {
+			_, err = vsInfo.sthStore.Remove(mh)
+			require.NoError(t, err)
+		}
+		require.NoError(t, vsInfo.sthStore.Flush())
+
+		maintainer, err := createMaintainer(valueStore, vsInfo)
+		require.NoError(t, err)
+		defer maintainer.Close()
+		require.False(t, maintainer.Supported(maintenance.Compact))
+		runMaintenance(t, maintainer, maintenance.GC)
+	})
+
+	t.Run("pebble", func(t *testing.T) {
+		cfgIndexer := config.NewIndexer()
+		cfgIndexer.ValueStoreType = vstorePebble
+		cfgIndexer.ValueStoreDir = t.TempDir()
+		cfgIndexer.PebbleBlockCacheSize = 1 << 20
+		valueStore, vsInfo, err := createValueStore(ctx, cfgIndexer)
+		require.NoError(t, err)
+		defer valueStore.Close()
+		require.NotNil(t, vsInfo.pebbleDB)
+
+		for i := 0; i < 100; i++ {
+			require.NoError(t, vsInfo.pebbleDB.Set([]byte(fmt.Sprint("key-", i)), []byte("value"), pbl.NoSync))
+		}
+		require.NoError(t, vsInfo.pebbleDB.Flush())
+
+		maintainer, err := createMaintainer(valueStore, vsInfo)
+		require.NoError(t, err)
+		defer maintainer.Close()
+		require.False(t, maintainer.Supported(maintenance.GC))
+		runMaintenance(t, maintainer, maintenance.Compact)
+	})
+}
+
+func runMaintenance(t *testing.T, maintainer *maintenance.Maintainer, op maintenance.Operation) {
+	require.True(t, maintainer.Supported(op))
+	_, err := maintainer.Start(op, 0, false)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		current, _ := maintainer.Status()
+		return current == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	_, last := maintainer.Status()
+	require.NotNil(t, last)
+	require.Equal(t, op, last.Operation)
+	require.NoError(t, last.Err)
+	require.Positive(t, last.BytesBefore)
+}
+
+func TestCheckPressureMaintenance(t *testing.T) {
+	cfgIndexer := config.NewIndexer()
+	cfgIndexer.ValueStoreType = vstorePebble
+	cfgIndexer.ValueStoreDir = t.TempDir()
+	cfgIndexer.PebbleBlockCacheSize = 1 << 20
+	valueStore, vsInfo, err := createValueStore(context.Background(), cfgIndexer)
+	require.NoError(t, err)
+	defer valueStore.Close()
+	maintainer, err := createMaintainer(valueStore, vsInfo)
+	require.NoError(t, err)
+	defer maintainer.Close()
+
+	cfg := config.DiskPressure{
+		Levels: []config.PressureLevel{
+			{AtPercent: 75, PauseEntries: true},
+			{AtPercent: 80, Compact: true},
+		},
+	}
+	require.NoError(t, checkPressureMaintenance(cfg, maintainer))
+	require.ErrorContains(t, checkPressureMaintenance(cfg, nil), "compact")
+
+	cfg.Levels[0].GC = true
+	require.ErrorContains(t, checkPressureMaintenance(cfg, maintainer), "gc")
+}
@@ -0,0 +1,178 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipni/storetheindex/config"
+	"github.com/urfave/cli/v2"
+)
+
+const convertBatchSize = 4096
+
+var ConvertDatastoreCmd = &cli.Command{
+	Name:  "convert-datastore",
+	Usage: "Copy the datastore of a stopped indexer into a new datastore of a different type",
+	Description: "Copies all keys from the configured datastore into a new datastore. " +
+		"All sync state, registry records, and index counts are preserved.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "to",
+			Usage:    "Type of datastore to convert to: levelds, pebble",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "to-dir",
+			Usage:    "Directory of new datastore, relative to the config directory if not absolute",
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "update-config",
+			Usage: "Update config to use the new datastore",
+		},
+	},
+	Action: convertDatastoreAction,
+}
+
+func convertDatastoreAction(cctx *cli.Context) error {
+	cfg, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+
+	toCfg := config.Datastore{
+		Dir:  cctx.String("to-dir"),
+		Type: cctx.String("to"),
+	}
+	fromDir, err := config.Path("", cfg.Datastore.Dir)
+	if err != nil {
+		return err
+	}
+	toDir, err := config.Path("", toCfg.Dir)
+	if err != nil {
+		return err
+	}
+	if toDir == fromDir {
+		return errors.New("cannot convert datastore into the same directory")
+	}
+	entries, err := os.ReadDir(toDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(entries) != 0 {
+		return fmt.Errorf("directory for new datastore is not empty: %s", toDir)
+	}
+
+	// Opening the datastore fails if the indexer is running.
+	src, _, err := createDatastore(cfg.Datastore)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, _, err := createDatastore(toCfg)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	fmt.Printf("Converting %s datastore at %s to %s datastore at %s\n", cfg.Datastore.Type, fromDir, toCfg.Type, toDir)
+	count, err := copyDatastore(cctx.Context, src, dst)
+	if err != nil {
+		return fmt.Errorf("cannot convert datastore: %w", err)
+	}
+
+	// Check that all keys are in the new datastore.
+	dstCount, err := countKeys(cctx.Context, dst)
+	if err != nil {
+		return fmt.Errorf("cannot verify new datastore: %w", err)
+	}
+	if dstCount != count {
+		return fmt.Errorf("new datastore has %d keys, expected %d", dstCount, count)
+	}
+	fmt.Println("Converted", count, "datastore keys")
+
+	if !cctx.Bool("update-config") {
+		fmt.Println("Update Datastore in config to use the new datastore")
+		return nil
+	}
+	cfg.Datastore = toCfg
+	cfgFile, err := config.Filename("")
+	if err != nil {
+		return err
+	}
+	if err = cfg.Save(cfgFile); err != nil {
+		return fmt.Errorf("cannot update config: %w", err)
+	}
+	fmt.Println("Updated config to use new datastore")
+	return nil
+}
+
+// copyDatastore copies all keys and values from src to dst, and returns the
+// number of keys copied.
+func copyDatastore(ctx context.Context, src datastore.Datastore, dst datastore.Batching) (uint64, error) {
+	results, err := src.Query(ctx, query.Query{})
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close()
+
+	batch, err := dst.Batch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var count uint64
+	var pending int
+	for r := range results.Next() {
+		if r.Error != nil {
+			return 0, r.Error
+		}
+		if err = batch.Put(ctx, datastore.NewKey(r.Key), r.Value); err != nil {
+			return 0, err
+		}
+		count++
+		pending++
+		if pending == convertBatchSize {
+			if err = batch.Commit(ctx); err != nil {
+				return 0, err
+			}
+			if batch, err = dst.Batch(ctx); err != nil {
+				return 0, err
+			}
+			pending = 0
+			if count%(100*convertBatchSize) == 0 {
+				fmt.Println("Copied", count, "keys")
+			}
+		}
+	}
+	if err = batch.Commit(ctx); err != nil {
+		return 0, err
+	}
+	if err = dst.Sync(ctx, datastore.NewKey("")); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func countKeys(ctx context.Context, ds datastore.Datastore) (uint64, error) {
+	results, err := ds.Query(ctx, query.Query{
+		KeysOnly: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close()
+
+	var count uint64
+	for r := range results.Next() {
+		if r.Error != nil {
+			return 0, r.Error
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,40 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	leveldb "github.com/ipfs/go-ds-leveldb"
+	"github.com/ipni/storetheindex/internal/pebbleds"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyDatastore(t *testing.T) {
+	ctx := context.Background()
+	src, err := leveldb.NewDatastore(t.TempDir(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	dst, err := pebbleds.New(t.TempDir(), nil)
+	require.NoError(t, err)
+	defer dst.Close()
+
+	const keyCount = convertBatchSize + 10
+	for i := 0; i < keyCount; i++ {
+		key := datastore.NewKey(fmt.Sprintf("/sync/%d", i))
+		require.NoError(t, src.Put(ctx, key, []byte(key.String())))
+	}
+
+	count, err := copyDatastore(ctx, src, dst)
+	require.NoError(t, err)
+	require.Equal(t, uint64(keyCount), count)
+
+	count, err = countKeys(ctx, dst)
+	require.NoError(t, err)
+	require.Equal(t, uint64(keyCount), count)
+
+	val, err := dst.Get(ctx, datastore.NewKey("/sync/1234"))
+	require.NoError(t, err)
+	require.Equal(t, "/sync/1234", string(val))
+}
@@ -0,0 +1,186 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ipni/storetheindex/admin/model"
+	"github.com/ipni/storetheindex/internal/counter"
+	"github.com/ipni/storetheindex/internal/export"
+	"github.com/ipni/storetheindex/internal/ingest"
+	"github.com/ipni/storetheindex/internal/registry"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/urfave/cli/v2"
+)
+
+var ExportProviderCmd = &cli.Command{
+	Name:  "export-provider",
+	Usage: "Export a provider's index from a stopped indexer as a new advertisement chain in a CAR file",
+	Description: "Reads the provider's indexes from the value store or the advertisement mirror, and writes a new " +
+		"advertisement chain, with one advertisement per context ID, into a CAR file. The advertisements are " +
+		"signed with the given key, or with the indexer's key if no key is given. Another indexer can ingest " +
+		"the chain by syncing it from a publisher that serves the CAR file. If the signing key is not the " +
+		"provider's key, the ingesting indexer's policy must allow the signer to publish for the provider. " +
+		"Only this publisher policy delegation is supported: the advertisements carry no ExtendedProviders " +
+		"and no signature by the provider, so an indexer that requires the provider's signature rejects them.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "provider",
+			Usage:    "Peer ID of provider to export",
+			Aliases:  []string{"p"},
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "source",
+			Usage: "Where to read indexes: \"valuestore\" or \"mirror\"",
+			Value: model.ReconcileSourceValueStore,
+		},
+		&cli.StringFlag{
+			Name:     "output",
+			Usage:    "Path of CAR file to write",
+			Aliases:  []string{"o"},
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "key-file",
+			Usage: "Path of file containing the marshaled private key that signs the advertisements. Uses the indexer's key if not set.",
+		},
+		&cli.StringSliceFlag{
+			Name:  "addr",
+			Usage: "Provider multiaddr to put in advertisements. Uses the provider's registered or advertised addresses if not set.",
+		},
+		&cli.IntFlag{
+			Name:  "chunk-size",
+			Usage: "Maximum number of multihashes in each entries chunk",
+			Value: export.DefaultChunkSize,
+		},
+	},
+	Action: exportProviderAction,
+}
+
+func exportProviderAction(cctx *cli.Context) error {
+	providerID, err := peer.Decode(cctx.String("provider"))
+	if err != nil {
+		return fmt.Errorf("bad provider id: %w", err)
+	}
+
+	cfg, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+
+	var signKey crypto.PrivKey
+	if cctx.String("key-file") != "" {
+		keyData, err := os.ReadFile(cctx.String("key-file"))
+		if err != nil {
+			return fmt.Errorf("cannot read key file: %w", err)
+		}
+		signKey, err = crypto.UnmarshalPrivateKey(keyData)
+		if err != nil {
+			return fmt.Errorf("cannot decode private key: %w", err)
+		}
+	} else {
+		_, signKey, err = cfg.Identity.Decode()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Opening the datastore fails if the indexer is running.
+	dstore, _, err := createDatastore(cfg.Datastore)
+	if err != nil {
+		return err
+	}
+	defer dstore.Close()
+
+	w, err := export.NewWriter(cctx.String("output"), providerID, cctx.Int("chunk-size"))
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	var advAddrs []string
+	switch cctx.String("source") {
+	case model.ReconcileSourceValueStore:
+		cfgIndexer := cfg.Indexer
+		cfgIndexer.GCInterval = -1
+		valueStore, _, err := createValueStore(cctx.Context, cfgIndexer)
+		if err != nil {
+			return err
+		}
+		if valueStore == nil {
+			return errors.New("no value store configured")
+		}
+		defer valueStore.Close()
+
+		fmt.Println("Exporting indexes of provider", providerID, "from value store")
+		if err = export.FromValueStore(cctx.Context, valueStore, providerID, w); err != nil {
+			return err
+		}
+		counts, err := counter.NewIndexCounts(dstore).ProviderContexts(cctx.Context, providerID)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Cannot read index counts:", err)
+		} else {
+			for contextID, count := range counts {
+				if exported := w.Count([]byte(contextID)); exported != int(count) {
+					fmt.Fprintf(os.Stderr, "Warning: context ID %x has index count %d, but %d indexes in value store\n",
+						[]byte(contextID), count, exported)
+				}
+			}
+		}
+	case model.ReconcileSourceMirror:
+		carReader, err := newMirrorReader(cfg.Ingest.AdvertisementMirror)
+		if err != nil {
+			return err
+		}
+		heads, err := ingest.LatestSyncs(cctx.Context, dstore)
+		if err != nil {
+			return fmt.Errorf("cannot read latest synced advertisements: %w", err)
+		}
+		fmt.Println("Exporting indexes of provider", providerID, "from advertisement mirror")
+		advAddrs, err = export.FromMirror(cctx.Context, carReader, heads, providerID, w)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown export source: %s", cctx.String("source"))
+	}
+
+	addrs := cctx.StringSlice("addr")
+	if len(addrs) == 0 {
+		reg, err := registry.New(cctx.Context, cfg.Discovery, dstore)
+		if err != nil {
+			return fmt.Errorf("cannot create provider registry: %w", err)
+		}
+		pinfo, ok := reg.ProviderInfo(providerID)
+		reg.Close()
+		if ok {
+			for _, maddr := range pinfo.AddrInfo.Addrs {
+				addrs = append(addrs, maddr.String())
+			}
+		}
+		if len(addrs) == 0 {
+			addrs = advAddrs
+		}
+		if len(addrs) == 0 {
+			return errors.New("provider has no known addresses, specify with --addr")
+		}
+	}
+
+	result, err := w.Finish(cctx.Context, addrs, signKey)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Exported provider", providerID, "to", cctx.String("output"))
+	fmt.Println("  Head:        ", result.Head)
+	fmt.Println("  Ads:         ", result.Ads)
+	fmt.Println("  Multihashes: ", result.Multihashes)
+	fmt.Println("  Publisher:   ", result.Publisher)
+	if result.Publisher != providerID {
+		fmt.Println("The ingesting indexer's Discovery.Policy must allow publisher", result.Publisher,
+			"to publish for provider", providerID)
+	}
+	return nil
+}
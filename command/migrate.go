@@ -0,0 +1,228 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ipni/go-indexer-core"
+	"github.com/ipni/go-indexer-core/engine"
+	"github.com/ipni/storetheindex/config"
+	"github.com/ipni/storetheindex/internal/migrate"
+	"github.com/urfave/cli/v2"
+)
+
+const vstoreDHStore = "dhstore"
+
+var MigrateValueStoreCmd = &cli.Command{
+	Name:  "migrate-valuestore",
+	Usage: "Copy all multihashes and values from one value store to another",
+	Description: "Migrates the value store of a stopped indexer to a different type of value store. " +
+		"Progress is checkpointed so that an interrupted migration resumes where it left off when " +
+		"run again with the same arguments. After migration, update the indexer config to use the " +
+		"new value store.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "from",
+			Usage:    "Type of value store to migrate from: sth, pebble",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "from-dir",
+			Usage: "Directory of value store to migrate from. Default is Indexer.ValueStoreDir from config",
+		},
+		&cli.StringFlag{
+			Name:     "to",
+			Usage:    "Type of value store to migrate to: sth, pebble, dhstore",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "to-dir",
+			Usage: "Directory of value store to migrate to. Required unless migrating to dhstore",
+		},
+		&cli.StringFlag{
+			Name:  "dhstore-url",
+			Usage: "URL of dhstore service to migrate to. Default is Indexer.DHStoreURL from config",
+		},
+		&cli.StringFlag{
+			Name:  "checkpoint",
+			Usage: "File to record migration progress in. Default is migrate-valuestore.checkpoint in the config directory",
+		},
+		&cli.BoolFlag{
+			Name:  "restart",
+			Usage: "Ignore any existing checkpoint and migrate from the beginning",
+		},
+		&cli.IntFlag{
+			Name:  "samples",
+			Usage: "Number of migrated multihashes to sample for verification, 0 to disable verification",
+			Value: 1000,
+		},
+	},
+	Action: migrateValueStoreAction,
+}
+
+func migrateValueStoreAction(cctx *cli.Context) error {
+	cfg, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+
+	fromType := cctx.String("from")
+	switch fromType {
+	case vstoreStorethehash, vstorePebble:
+	default:
+		return fmt.Errorf("cannot migrate from value store type %q", fromType)
+	}
+	toType := cctx.String("to")
+	switch toType {
+	case vstoreStorethehash, vstorePebble, vstoreDHStore:
+	default:
+		return fmt.Errorf("cannot migrate to value store type %q", toType)
+	}
+
+	fromDir := cctx.String("from-dir")
+	if fromDir == "" {
+		fromDir = cfg.Indexer.ValueStoreDir
+	}
+	fromDir, err = config.Path("", fromDir)
+	if err != nil {
+		return err
+	}
+
+	var toDir, dhstoreURL string
+	if toType == vstoreDHStore {
+		dhstoreURL = cctx.String("dhstore-url")
+		if dhstoreURL == "" {
+			dhstoreURL = cfg.Indexer.DHStoreURL
+		}
+		if dhstoreURL == "" {
+			return errors.New("dhstore url is required to migrate to dhstore")
+		}
+	} else {
+		if !cctx.IsSet("to-dir") {
+			return fmt.Errorf("to-dir is required to migrate to %s", toType)
+		}
+		toDir, err = config.Path("", cctx.String("to-dir"))
+		if err != nil {
+			return err
+		}
+		if toDir == fromDir {
+			return errors.New("cannot migrate value store to the same directory")
+		}
+	}
+
+	cpPath := cctx.String("checkpoint")
+	if cpPath == "" {
+		cpPath, err = config.Path("", "migrate-valuestore.checkpoint")
+		if err != nil {
+			return err
+		}
+	}
+	if cctx.Bool("restart") {
+		if err = removeIfExists(cpPath); err != nil {
+			return fmt.Errorf("cannot remove checkpoint: %w", err)
+		}
+	}
+
+	fromCfg := cfg.Indexer
+	fromCfg.ValueStoreType = fromType
+	fromCfg.ValueStoreDir = fromDir
+	// Do not run GC while migrating.
+	fromCfg.GCInterval = -1
+	src, _, err := createValueStore(cctx.Context, fromCfg)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var dst indexer.Interface
+	var minKeyLen int
+	if toType == vstoreDHStore {
+		dst = engine.New(nil, nil,
+			engine.WithDHBatchSize(cfg.Indexer.DHBatchSize),
+			engine.WithDHStore(dhstoreURL),
+			engine.WithHttpClientTimeout(time.Duration(cfg.Indexer.DHStoreHttpClientTimeout)),
+		)
+	} else {
+		toCfg := cfg.Indexer
+		toCfg.ValueStoreType = toType
+		toCfg.ValueStoreDir = toDir
+		toCfg.GCInterval = -1
+		var dstInfo valueStoreInfo
+		dst, dstInfo, err = createValueStore(cctx.Context, toCfg)
+		if err != nil {
+			return err
+		}
+		minKeyLen = dstInfo.minKeyLen
+	}
+	defer dst.Close()
+
+	samples := cctx.Int("samples")
+	if toType == vstoreDHStore && samples != 0 {
+		// Values stored in dhstore are encrypted and cannot be compared.
+		fmt.Println("Verification not supported when migrating to dhstore")
+		samples = 0
+	}
+
+	checkpointID := fmt.Sprintf("%s:%s->%s:%s", fromType, fromDir, toType, toDir+dhstoreURL)
+	opts := []migrate.Option{
+		migrate.WithCheckpoint(cpPath, checkpointID),
+		migrate.WithMinKeyLength(minKeyLen),
+		migrate.WithProgress(func(stats migrate.Stats) {
+			fmt.Println("Migrated", stats.Multihashes, "multihashes,", stats.Values, "values")
+		}),
+		migrate.WithSampleSize(samples),
+	}
+	m, err := migrate.New(src, dst, opts...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Migrating %s value store at %s to %s\n", fromType, fromDir, toType)
+	start := time.Now()
+	stats, err := m.Run(cctx.Context)
+	if err != nil {
+		if errors.Is(err, cctx.Context.Err()) {
+			fmt.Println("Migration interrupted, run again to resume from checkpoint", cpPath)
+		}
+		return fmt.Errorf("migration failed: %w", err)
+	}
+	fmt.Println("Migration complete in", time.Since(start).Round(time.Second))
+	fmt.Println("  Multihashes:", stats.Multihashes)
+	fmt.Println("  Values:     ", stats.Values)
+	if stats.Resumed != 0 {
+		fmt.Println("  Resumed:    ", stats.Resumed)
+	}
+	if stats.Skipped != 0 {
+		fmt.Println("  Skipped:    ", stats.Skipped, "(key too short for destination)")
+	}
+
+	if samples == 0 {
+		return nil
+	}
+	v, err := m.Verify(cctx.Context)
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	fmt.Println("Verification:")
+	fmt.Println("  Sampled:   ", v.Sampled)
+	fmt.Println("  Matched:   ", v.Matched)
+	fmt.Println("  Missing:   ", v.Missing)
+	fmt.Println("  Mismatched:", v.Mismatched)
+	for _, failure := range v.Failures {
+		fmt.Println("   ", failure)
+	}
+	if v.Matched != v.Sampled {
+		return errors.New("migrated value store does not match source")
+	}
+	return nil
+}
+
+func removeIfExists(path string) error {
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	client "github.com/ipni/go-libipni/find/client/http"
+	"github.com/ipni/storetheindex/carstore"
+	"github.com/ipni/storetheindex/filestore"
+	"github.com/ipni/storetheindex/internal/ingest"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/urfave/cli/v2"
+)
+
+var MirrorCmd = &cli.Command{
+	Name:  "mirror",
+	Usage: "Commands to manage the advertisement mirror",
+	Subcommands: []*cli.Command{
+		mirrorBackfillCmd,
+		mirrorCompactCmd,
+	},
+}
+
+var mirrorBackfillCmd = &cli.Command{
+	Name:  "backfill",
+	Usage: "Write mirror CAR files for advertisements ingested before the mirror was enabled",
+	Description: "Gets the latest advertisement of each provider from the indexer, then fetches " +
+		"each advertisement chain from its publisher and writes the advertisements that are " +
+		"missing from the mirror configured in Ingest.AdvertisementMirror. Advertisements " +
+		"already in the mirror are not fetched, so an interrupted backfill resumes when run again.",
+	Flags: []cli.Flag{
+		indexerHostFlag,
+		&cli.StringSliceFlag{
+			Name:  "publisher",
+			Usage: "Peer ID of publisher to backfill. Can be specified multiple times",
+		},
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "Backfill all publishers known to the indexer",
+		},
+		&cli.Float64Flag{
+			Name:  "rate",
+			Usage: "Maximum number of advertisements to fetch per second, 0 for no limit",
+			Value: 10,
+		},
+	},
+	Action: mirrorBackfillAction,
+}
+
+var mirrorCompactCmd = &cli.Command{
+	Name:  "compact",
+	Usage: "Remove entries of removed contexts and orphaned files from the mirror",
+	Description: "Reads the advertisement chain of each publisher in the mirror configured in " +
+		"Ingest.AdvertisementMirror, and rewrites the CAR files of advertisements whose context ID " +
+		"is removed by a later advertisement without their entries. CAR files that are not in any " +
+		"publisher's chain are reported as orphans, and deleted if --delete-orphans is given.",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "delete-orphans",
+			Usage: "Delete CAR files that are not in any publisher's advertisement chain",
+		},
+		&cli.DurationFlag{
+			Name:  "orphan-age",
+			Usage: "Only treat CAR files as orphans if not modified for this long",
+			Value: 24 * time.Hour,
+		},
+	},
+	Action: mirrorCompactAction,
+}
+
+type backfillHead struct {
+	pubInfo peer.AddrInfo
+	adCid   cid.Cid
+	adTime  time.Time
+	// writeHead is true if this is the newest head of the publisher.
+	writeHead bool
+}
+
+func mirrorBackfillAction(cctx *cli.Context) error {
+	pubIDs := cctx.StringSlice("publisher")
+	if len(pubIDs) == 0 && !cctx.Bool("all") {
+		return errors.New("must specify --publisher or --all")
+	}
+	if len(pubIDs) != 0 && cctx.Bool("all") {
+		return errors.New("cannot specify both --publisher and --all")
+	}
+	publishers := make(map[peer.ID]struct{}, len(pubIDs))
+	for _, pubID := range pubIDs {
+		peerID, err := peer.Decode(pubID)
+		if err != nil {
+			return fmt.Errorf("bad publisher id %s: %w", pubID, err)
+		}
+		publishers[peerID] = struct{}{}
+	}
+
+	cfg, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+
+	cl, err := client.New(cliIndexer(cctx, "finder"))
+	if err != nil {
+		return err
+	}
+	provs, err := cl.ListProviders(cctx.Context)
+	if err != nil {
+		return fmt.Errorf("cannot list providers: %w", err)
+	}
+
+	// Providers that share a publisher may have different latest
+	// advertisements, so backfill from each.
+	var heads []backfillHead
+	seen := make(map[cid.Cid]struct{})
+	for _, prov := range provs {
+		if prov.Publisher == nil || prov.LastAdvertisement == cid.Undef {
+			continue
+		}
+		if len(publishers) != 0 {
+			if _, ok := publishers[prov.Publisher.ID]; !ok {
+				continue
+			}
+		}
+		if _, ok := seen[prov.LastAdvertisement]; ok {
+			continue
+		}
+		seen[prov.LastAdvertisement] = struct{}{}
+		// Time is zero if unknown.
+		adTime, _ := time.Parse(time.RFC3339, prov.LastAdvertisementTime)
+		heads = append(heads, backfillHead{
+			pubInfo: *prov.Publisher,
+			adCid:   prov.LastAdvertisement,
+			adTime:  adTime,
+		})
+	}
+	// Only the newest head of each publisher is written as the publisher's
+	// head in the mirror.
+	newest := make(map[peer.ID]int)
+	for i := range heads {
+		n, ok := newest[heads[i].pubInfo.ID]
+		if !ok || heads[i].adTime.After(heads[n].adTime) {
+			newest[heads[i].pubInfo.ID] = i
+		}
+	}
+	for _, i := range newest {
+		heads[i].writeHead = true
+	}
+	if len(heads) == 0 {
+		fmt.Println("No advertisements to backfill")
+		return nil
+	}
+
+	p2pHost, err := libp2p.New()
+	if err != nil {
+		return fmt.Errorf("cannot create libp2p host: %w", err)
+	}
+	defer p2pHost.Close()
+
+	backfiller, err := ingest.NewBackfiller(p2pHost, cfg.Ingest, cctx.Float64("rate"))
+	if err != nil {
+		return err
+	}
+	defer backfiller.Close()
+
+	var failed int
+	for _, head := range heads {
+		fmt.Println("Backfilling publisher", head.pubInfo.ID, "from advertisement", head.adCid)
+		stats, err := backfiller.Backfill(cctx.Context, head.pubInfo, head.adCid, head.writeHead)
+		fmt.Println("  Written: ", stats.Written)
+		fmt.Println("  Existing:", stats.Existing)
+		if stats.HAMT != 0 {
+			fmt.Println("  HAMT:    ", stats.HAMT)
+		}
+		if stats.HeadWritten {
+			fmt.Println("  Wrote publisher head")
+		}
+		if err != nil {
+			if cctx.Context.Err() != nil {
+				return cctx.Context.Err()
+			}
+			fmt.Println("  Error:   ", err)
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("backfill failed for %d of %d advertisement chains, run again to resume", failed, len(heads))
+	}
+	return nil
+}
+
+func mirrorCompactAction(cctx *cli.Context) error {
+	cfg, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+	cfgMirror := cfg.Ingest.AdvertisementMirror
+	fileStore, err := filestore.New(cfgMirror.Storage)
+	if err != nil {
+		return fmt.Errorf("cannot create mirror file storage: %w", err)
+	}
+	if fileStore == nil {
+		return errors.New("advertisement mirror storage not configured")
+	}
+	if fileStore.Type() == "http" {
+		return errors.New("cannot compact read-only http mirror storage")
+	}
+	// Compaction only reads advertisement data from the mirror, so use an
+	// empty datastore.
+	carWriter, err := carstore.NewWriter(datastore.NewMapDatastore(), fileStore, carstore.WithCompress(cfgMirror.Compress))
+	if err != nil {
+		return fmt.Errorf("cannot create car file writer: %w", err)
+	}
+
+	fmt.Println("Compacting advertisement mirror")
+	start := time.Now()
+	report, err := carWriter.Compact(cctx.Context, cctx.Bool("delete-orphans"), cctx.Duration("orphan-age"))
+	if err != nil {
+		return err
+	}
+	fmt.Println("Compacted mirror in", time.Since(start).Round(time.Second))
+	for _, pc := range report.Publishers {
+		fmt.Printf("  Publisher %s: %d ads, %d rewritten, %d bytes reclaimed", pc.Publisher, pc.Ads, pc.Rewritten, pc.Reclaimed)
+		if pc.Incomplete {
+			fmt.Print(", chain incomplete")
+		}
+		fmt.Println()
+	}
+	fmt.Printf("  Orphans: %d files, %d manifests, %d bytes", report.Orphans, report.OrphanManifests, report.OrphanBytes)
+	if report.OrphansDeleted {
+		fmt.Print(", deleted")
+	}
+	fmt.Println()
+	fmt.Println("  Reclaimed:", report.Reclaimed(), "bytes")
+	return nil
+}
@@ -0,0 +1,142 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipni/go-indexer-core"
+	"github.com/ipni/storetheindex/admin/model"
+	"github.com/ipni/storetheindex/carstore"
+	"github.com/ipni/storetheindex/config"
+	"github.com/ipni/storetheindex/filestore"
+	"github.com/ipni/storetheindex/internal/counter"
+	"github.com/ipni/storetheindex/internal/ingest"
+	httpadminserver "github.com/ipni/storetheindex/server/admin/http"
+	"github.com/urfave/cli/v2"
+)
+
+var reconcileSourceFlag = &cli.StringFlag{
+	Name:  "source",
+	Usage: "Where to count indexes: \"valuestore\" or \"mirror\"",
+	Value: model.ReconcileSourceValueStore,
+}
+
+var reconcileRewriteFlag = &cli.BoolFlag{
+	Name:  "rewrite",
+	Usage: "Replace persisted index counts that differ with the counts from the source",
+}
+
+var ReconcileCountsCmd = &cli.Command{
+	Name:  "reconcile-counts",
+	Usage: "Reconcile the index counts of a stopped indexer with an authoritative source",
+	Description: "Counts indexes for each provider context ID from the value store or the advertisement mirror, " +
+		"and reports where the persisted index counts differ. Use \"storetheindex admin reconcile-counts\" " +
+		"to reconcile the index counts of a running indexer.",
+	Flags: []cli.Flag{
+		reconcileSourceFlag,
+		reconcileRewriteFlag,
+	},
+	Action: reconcileCountsOfflineAction,
+}
+
+func reconcileCountsOfflineAction(cctx *cli.Context) error {
+	cfg, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+
+	// Opening the datastore fails if the indexer is running.
+	dstore, _, err := createDatastore(cfg.Datastore)
+	if err != nil {
+		return err
+	}
+	defer dstore.Close()
+
+	source := cctx.String("source")
+	var valueStore indexer.Interface
+	if source == model.ReconcileSourceValueStore {
+		cfgIndexer := cfg.Indexer
+		cfgIndexer.GCInterval = -1
+		valueStore, _, err = createValueStore(cctx.Context, cfgIndexer)
+		if err != nil {
+			return err
+		}
+		if valueStore != nil {
+			defer valueStore.Close()
+		}
+	}
+
+	src, err := reconcileSource(cctx.Context, source, valueStore, dstore, cfg.Ingest.AdvertisementMirror)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Reconciling index counts with", source)
+	start := time.Now()
+	indexCounts := counter.NewIndexCounts(dstore)
+	report, err := indexCounts.Reconcile(cctx.Context, src, cctx.Bool("rewrite"))
+	if err != nil {
+		return fmt.Errorf("cannot reconcile index counts: %w", err)
+	}
+	fmt.Println("Reconciled index counts in", time.Since(start).Round(time.Second))
+	fmt.Println("  Providers:    ", report.Providers)
+	fmt.Println("  Contexts:     ", report.Contexts)
+	fmt.Println("  Discrepancies:", report.Discrepancies)
+	if cctx.Bool("rewrite") {
+		fmt.Println("  Rewritten:    ", report.Rewritten)
+	}
+	for _, pd := range report.ProviderDiscrepancies {
+		fmt.Printf("  Provider %s: stored %d, actual %d\n", pd.ProviderID, pd.Stored, pd.Actual)
+	}
+	for _, providerID := range report.Skipped {
+		fmt.Printf("  Provider %s: skipped, counts incomplete in source\n", providerID)
+	}
+	return nil
+}
+
+// newReconcileFunc returns a function that reconciles the index counts of the
+// running indexer.
+func newReconcileFunc(indexCounts *counter.IndexCounts, valueStore indexer.Interface, dstore datastore.Datastore, cfgMirror config.Mirror) httpadminserver.ReconcileFunc {
+	return func(ctx context.Context, source string, rewrite bool) (*counter.Report, error) {
+		src, err := reconcileSource(ctx, source, valueStore, dstore, cfgMirror)
+		if err != nil {
+			return nil, err
+		}
+		return indexCounts.Reconcile(ctx, src, rewrite)
+	}
+}
+
+// reconcileSource returns the named source of index counts. The mirror source
+// reads the advertisement chain of each publisher starting at the latest
+// advertisement that the indexer processed.
+func reconcileSource(ctx context.Context, source string, valueStore indexer.Interface, dstore datastore.Datastore, cfgMirror config.Mirror) (counter.Source, error) {
+	switch source {
+	case model.ReconcileSourceValueStore:
+		if valueStore == nil {
+			return nil, errors.New("no value store configured")
+		}
+		return counter.ValueStoreSource(valueStore), nil
+	case model.ReconcileSourceMirror:
+		if cfgMirror.Storage.Type == "" || cfgMirror.Storage.Type == "none" {
+			return nil, errors.New("advertisement mirror storage not configured")
+		}
+		fileStore, err := filestore.New(cfgMirror.Storage, filestore.WithVerify(carstore.VerifyRoot))
+		if err != nil {
+			return nil, fmt.Errorf("cannot create mirror file storage: %w", err)
+		}
+		carReader, err := carstore.NewReader(fileStore, carstore.WithCompress(cfgMirror.Compress))
+		if err != nil {
+			return nil, fmt.Errorf("cannot create car file reader: %w", err)
+		}
+		heads, err := ingest.LatestSyncs(ctx, dstore)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read latest synced advertisements: %w", err)
+		}
+		return counter.MirrorSource(carReader, heads), nil
+	default:
+		return nil, fmt.Errorf("unknown index count source: %s", source)
+	}
+}
@@ -0,0 +1,122 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ipni/storetheindex/internal/registry"
+	"github.com/urfave/cli/v2"
+)
+
+var RegistryCmd = &cli.Command{
+	Name:  "registry",
+	Usage: "Export or import the registry of a stopped indexer",
+	Subcommands: []*cli.Command{
+		registryExportCmd,
+		registryImportCmd,
+	},
+}
+
+var registryExportCmd = &cli.Command{
+	Name:  "export",
+	Usage: "Write a snapshot of all provider information, assignments, and frozen state to a file",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "file",
+			Usage:   "File to write snapshot to, or \"-\" for stdout",
+			Aliases: []string{"f"},
+			Value:   "-",
+		},
+	},
+	Action: registryExportAction,
+}
+
+var registryImportCmd = &cli.Command{
+	Name:  "import",
+	Usage: "Read a registry snapshot into the indexer datastore",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "file",
+			Usage:    "Snapshot file to import, or \"-\" for stdin",
+			Aliases:  []string{"f"},
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "overwrite",
+			Usage: "Replace information about providers that are already registered",
+		},
+	},
+	Action: registryImportAction,
+}
+
+func registryExportAction(cctx *cli.Context) error {
+	cfg, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+	dstore, _, err := createDatastore(cfg.Datastore)
+	if err != nil {
+		return err
+	}
+	defer dstore.Close()
+
+	var w io.Writer
+	fileName := cctx.String("file")
+	if fileName == "-" {
+		w = os.Stdout
+	} else {
+		f, err := os.Create(fileName)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	stats, err := registry.ExportSnapshot(cctx.Context, dstore, w)
+	if err != nil {
+		return fmt.Errorf("cannot export registry: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d providers, %d assignments, %d preferred peers, frozen: %t\n",
+		stats.Providers, stats.Assigned, stats.Preferred, stats.Frozen)
+	return nil
+}
+
+func registryImportAction(cctx *cli.Context) error {
+	cfg, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader
+	fileName := cctx.String("file")
+	if fileName == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	dstore, _, err := createDatastore(cfg.Datastore)
+	if err != nil {
+		return err
+	}
+	defer dstore.Close()
+
+	stats, err := registry.ImportSnapshot(cctx.Context, dstore, r, cctx.Bool("overwrite"))
+	if err != nil {
+		return fmt.Errorf("cannot import registry: %w", err)
+	}
+
+	fmt.Printf("Imported %d providers, %d assignments, frozen: %t\n", stats.Providers, stats.Assigned, stats.Frozen)
+	if stats.Skipped != 0 {
+		fmt.Printf("Skipped %d providers that are already registered\n", stats.Skipped)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package config
+
+// Backup configures where indexer backups are written to and restored from.
+type Backup struct {
+	// Storage configures the file store that holds backups. Each backup is
+	// stored under a directory named for the backup.
+	Storage FileStore
+}
+
+// NewBackup returns Backup with values set to their defaults.
+func NewBackup() Backup {
+	return Backup{}
+}
@@ -15,6 +15,7 @@ type Config struct {
 	Version   int       // config version
 	Identity  Identity  // peer identity
 	Addresses Addresses // addresses to listen on
+	Backup    Backup    // backup storage configuration
 	Bootstrap Bootstrap // Peers to connect to for gossip
 	Datastore Datastore // datastore config
 	Discovery Discovery // provider pubsub peers
@@ -103,6 +104,7 @@ func Load(filePath string) (*Config, error) {
 	// Populate with initial values in case they are not present in config.
 	cfg := Config{
 		Addresses: NewAddresses(),
+		Backup:    NewBackup(),
 		Bootstrap: NewBootstrap(),
 		Datastore: NewDatastore(),
 		Discovery: NewDiscovery(),
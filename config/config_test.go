@@ -34,3 +34,24 @@ func TestPath(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, filepath.Clean(absdir), path)
 }
+
+func TestDiskPressureLevel(t *testing.T) {
+	cfg := DiskPressure{
+		Levels: []PressureLevel{
+			{AtPercent: 85, PauseEntries: true},
+			{AtPercent: 75, IngestWorkerCount: 2},
+		},
+	}
+	require.Equal(t, []float64{85, 75}, cfg.AtPercents())
+
+	_, ok := cfg.Level(0)
+	require.False(t, ok)
+	level, ok := cfg.Level(1)
+	require.True(t, ok)
+	require.Equal(t, 2, level.IngestWorkerCount)
+	level, ok = cfg.Level(2)
+	require.True(t, ok)
+	require.True(t, level.PauseEntries)
+	_, ok = cfg.Level(3)
+	require.False(t, ok)
+}
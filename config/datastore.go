@@ -6,7 +6,8 @@ type Datastore struct {
 	// absolute path then the location is relative to the indexer repo
 	// directory.
 	Dir string
-	// Type is the type of datastore.
+	// Type is the type of datastore: "levelds" or "pebble". To change the
+	// type of an existing datastore, use the convert-datastore command.
 	Type string
 }
 
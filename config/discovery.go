@@ -39,6 +39,27 @@ type Discovery struct {
 	DeactivateAfter Duration
 	// PollOverrides configures polling for specific providers.
 	PollOverrides []Polling
+	// ProbeInterval is the time between reachability probes of registered
+	// providers. Each probe dials a provider's libp2p addresses and sends a
+	// request to its HTTP addresses. A zero value disables probing.
+	ProbeInterval Duration
+	// ProbeTimeout is the maximum amount of time to wait for a provider to
+	// respond to a reachability probe.
+	ProbeTimeout Duration
+	// DemoteUnreachable, when true, places results from providers that failed
+	// their most recent reachability probe after results from all other
+	// providers in find responses. Only applies if ProbeInterval is non-zero.
+	DemoteUnreachable bool
+	// ReplayWindow is how long the sequence number of a signed register or
+	// ingest request is remembered to protect against replay. Requests with a
+	// sequence number older than this are rejected. Remembered sequence
+	// numbers are persisted so that protection continues across restarts.
+	ReplayWindow Duration
+	// ReplayNonces, when true, treats each request's sequence number as a
+	// nonce. A sequence number is then accepted if it has not been seen within
+	// the ReplayWindow, instead of requiring that it be greater than the last
+	// one seen. This allows a provider to send concurrent requests.
+	ReplayNonces bool
 	// RemoveOldAssignments, if true, removes persisted assignments of previous
 	// versions. When false, previous versions of persisted assignments are
 	// migrated. Only applies if UseAssigner is true.
@@ -57,6 +78,12 @@ type Discovery struct {
 type Polling struct {
 	// ProviderID identifies the provider that this override applies to.
 	ProviderID string
+	// Label is a provider label selector, either "key=value" or "key", that
+	// identifies the providers this override applies to. Only used if
+	// ProviderID is empty. An override with a ProviderID takes precedence
+	// over one with a Label, and label overrides are applied in the order
+	// that they are listed.
+	Label string `json:",omitempty"`
 	// Interval overrides Discovery.PollInterval.
 	Interval Duration
 	// RetryAfter overrides Discovery.PollRetryAfter.
@@ -76,6 +103,8 @@ func NewDiscovery() Discovery {
 		PollRetryAfter:  Duration(5 * time.Hour),
 		PollStopAfter:   defaultStopAfter,
 		DeactivateAfter: defaultStopAfter,
+		ProbeTimeout:    Duration(30 * time.Second),
+		ReplayWindow:    Duration(48 * time.Hour),
 	}
 }
 
@@ -97,4 +126,10 @@ func (c *Discovery) populateUnset() {
 		// This means no inactive grace period for providers by default.
 		c.DeactivateAfter = def.PollStopAfter
 	}
+	if c.ProbeTimeout == 0 {
+		c.ProbeTimeout = def.ProbeTimeout
+	}
+	if c.ReplayWindow == 0 {
+		c.ReplayWindow = def.ReplayWindow
+	}
 }
@@ -0,0 +1,72 @@
+package config
+
+import "sort"
+
+// DiskPressure configures levels of disk usage, below Indexer.FreezeAtPercent,
+// at which the indexer reduces ingestion activity so that there is time to
+// react before the indexer freezes. Levels cannot be configured when freezing
+// is disabled.
+type DiskPressure struct {
+	// Levels is a list of pressure levels. Each level applies when disk usage
+	// reaches the level's AtPercent, and remains in effect until usage drops
+	// below that percent. If multiple levels apply, the settings of the level
+	// with the highest AtPercent are used. Changes to AtPercent values are
+	// not reloadable, but other level settings are.
+	Levels []PressureLevel
+	// PriorityLabels is a list of provider label selectors, either
+	// "key=value" or "key". A provider that has a label matching any selector
+	// continues to have its advertisement entries synced when a pressure level
+	// pauses entries sync.
+	PriorityLabels []string
+}
+
+// PressureLevel configures what the indexer does when disk usage reaches a
+// disk pressure level.
+type PressureLevel struct {
+	// AtPercent is the percent used, of the file systems monitored for
+	// freezing, at which this level applies. This must be less than
+	// Indexer.FreezeAtPercent.
+	AtPercent float64
+	// IngestWorkerCount, if non-zero, reduces the number of ingest workers to
+	// this value while this level applies.
+	IngestWorkerCount int
+	// PauseEntries pauses syncing advertisement entries for providers that do
+	// not have a label matching DiskPressure.PriorityLabels. Advertisements
+	// from these providers remain unprocessed, and are processed when entries
+	// sync is no longer paused.
+	PauseEntries bool
+	// GC triggers value store garbage collection when this level is entered.
+	// Only the storethehash value store supports garbage collection, and
+	// only when Indexer.GCInterval is not zero.
+	GC bool
+	// Compact triggers value store compaction when this level is entered.
+	// Only the pebble value store supports compaction.
+	Compact bool
+}
+
+// AtPercents returns the AtPercent values of all levels.
+func (c DiskPressure) AtPercents() []float64 {
+	if len(c.Levels) == 0 {
+		return nil
+	}
+	percents := make([]float64, len(c.Levels))
+	for i := range c.Levels {
+		percents[i] = c.Levels[i].AtPercent
+	}
+	return percents
+}
+
+// Level returns the settings for the pressure level number, where levels are
+// numbered starting at 1 in order of increasing AtPercent. Returns false if
+// there is no such level.
+func (c DiskPressure) Level(number int) (PressureLevel, bool) {
+	if number < 1 || number > len(c.Levels) {
+		return PressureLevel{}, false
+	}
+	levels := make([]PressureLevel, len(c.Levels))
+	copy(levels, c.Levels)
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].AtPercent < levels[j].AtPercent
+	})
+	return levels[number-1], true
+}
@@ -36,12 +36,16 @@ type Indexer struct {
 	DHStoreClusterURLs []string
 	// DHStoreHttpClientTimeout is a timeout for the DHStore http client
 	DHStoreHttpClientTimeout Duration
+	// DiskPressure configures disk usage levels, below FreezeAtPercent, at
+	// which the indexer reduces ingestion activity.
+	DiskPressure DiskPressure
 	// FreezeAtPercent is the percent used, of the file system that
 	// ValueStoreDir is on, at which to trigger the indexer to enter frozen
 	// mode. A zero value uses the default. A negative value disables freezing.
 	FreezeAtPercent float64
 	// GCInterval configures the garbage collection interval for valuestores
-	// that support it.
+	// that support it. Garbage collection can also be started on demand using
+	// "storetheindex admin valuestore gc".
 	GCInterval Duration
 	// GCTimeLimit configures the maximum amount of time a garbage collection
 	// cycle may run.
@@ -81,7 +85,8 @@ type Indexer struct {
 	// UnfreezeOnStart tells that indexer to unfreeze itself on startup if it
 	// is frozen. This reverts the indexer to the state it was in before it was
 	// frozen. It only retains the most recent provider and publisher
-	// addresses.
+	// addresses. A running indexer can also be unfrozen using the admin
+	// unfreeze command.
 	UnfreezeOnStart bool
 	// VSNoNewMH, when true, prevents storing new multihashes in the
 	// valuestore. Existing data is still retrievable and metadata can be
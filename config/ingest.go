@@ -84,7 +84,14 @@ type Mirror struct {
 	Read bool
 	// Write specified to write advertisement content to the mirrir.
 	Write bool
-	// Compress specifies how to compress files. One of: "gzip", "none".
+	// Serve specifies to publish the mirrored advertisement chains from the
+	// ingest HTTP server, using the dagsync HTTP publisher protocol. The chain
+	// of a publisher is at /mirror/<publisher-id>/ and its head is signed by
+	// the indexer.
+	Serve bool
+	// Compress specifies how to compress files. One of: "gzip", "zstd",
+	// "none". Files already written with a different compression can still
+	// be read.
 	// Defaults to "gzip" if unspecified.
 	Compress string
 	// Storage configures the backing file store for the mirror.
@@ -93,12 +100,30 @@ type Mirror struct {
 
 // FileStore configures a particular file store implementation.
 type FileStore struct {
-	// Type of file store to use: "", "local", "s3"
+	// Type of file store to use: "", "local", "s3", "http"
 	Type string
 	// Configuration for storing files in local filesystem.
 	Local LocalFileStore
 	// Configuration for storing files in S3.
 	S3 S3FileStore
+	// Configuration for reading files from an HTTP server. This file store is
+	// read-only.
+	HTTP HTTPFileStore
+	// Cache configures a local cache of files read from the file store.
+	Cache FileStoreCache
+}
+
+// FileStoreCache configures a read-through cache, on the local file system,
+// of files read from a file store. This avoids repeatedly downloading the
+// same files from a remote file store.
+type FileStoreCache struct {
+	// Dir is the absolute path of the local cache directory. The cache is
+	// disabled if this is not set.
+	Dir string
+	// MaxSize is the maximum total size of cached files. The least recently
+	// used files are removed when the cache exceeds this size. Defaults to
+	// 1Gi if not set.
+	MaxSize ByteSize
 }
 
 type LocalFileStore struct {
@@ -106,6 +131,23 @@ type LocalFileStore struct {
 	BasePath string
 }
 
+// HTTPFileStore configures a read-only file store that retrieves files from
+// an HTTP server, such as a CDN or static file server publishing another
+// indexer's advertisement mirror.
+type HTTPFileStore struct {
+	// BaseURL is the URL that file paths are relative to.
+	BaseURL string
+	// IndexPath is the path, relative to BaseURL, of an index file listing
+	// the available files. Each line of the index file is a file path,
+	// optionally followed by a tab and the file size, and optionally followed
+	// by another tab and the RFC 3339 modification time. Files cannot be
+	// listed if this is not set.
+	IndexPath string `json:",omitempty"`
+	// Timeout is the timeout for each HTTP request. Defaults to 1m if not
+	// set.
+	Timeout Duration `json:",omitempty"`
+}
+
 type S3FileStore struct {
 	BucketName string
 
@@ -23,6 +23,7 @@ func InitWithIdentity(identity Identity) (*Config, error) {
 	conf := &Config{
 		Version:   Version,
 		Addresses: NewAddresses(),
+		Backup:    NewBackup(),
 		Bootstrap: NewBootstrap(),
 		Datastore: NewDatastore(),
 		Discovery: NewDiscovery(),
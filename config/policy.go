@@ -21,6 +21,10 @@ type Policy struct {
 	// in Except. in other words, Allow=true means that Except is a deny-list
 	// and Allow=false means that Except is an allow-list.
 	Except []string
+	// ExceptLabels is a list of provider label selectors, either "key=value"
+	// or "key". A provider having a label that matches any selector, and that
+	// is not listed in Except, is treated as if it were listed in Except.
+	ExceptLabels []string
 
 	// Publish determines whether or not peers are allowed to publish
 	// advertisements for a provider with a differen peer ID.
@@ -9,6 +9,11 @@ type RateLimit struct {
 	// Except list. If Apply is true, then only the peers listed in Except are
 	// not rate-limited.
 	Except []string
+	// ExceptLabels is a list of provider label selectors, either "key=value"
+	// or "key". A publisher that is a provider having a label that matches
+	// any selector, and that is not listed in Except, is treated as if it
+	// were listed in Except.
+	ExceptLabels []string
 	// BlocksPerSecond is the number of blocks allowed to be transferred per
 	// second. An advertisement and a block of multihashes are both represented
 	// as a block, so this limit applies to both. Setting a value of 0 disables
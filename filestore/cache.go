@@ -0,0 +1,328 @@
+package filestore
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("filestore")
+
+// fillPrefix is the file name prefix of files being written into the cache.
+const fillPrefix = ".fill-"
+
+// VerifyFunc checks the content of a file that is being added to a Cache. The
+// file is not cached if VerifyFunc returns an error.
+type VerifyFunc func(relPath string, r io.Reader) error
+
+// Cache is a read-through cache, on the local file system, in front of
+// another file store. Files retrieved with Get are kept in the cache until
+// the total size of cached files exceeds the maximum size, at which point the
+// least recently used files are removed.
+//
+// Writes and deletes go to the backing file store and remove the file from
+// the cache. Listing is always done by the backing file store.
+type Cache struct {
+	backing Interface
+	dir     string
+	maxSize int64
+	verify  VerifyFunc
+
+	mutex sync.Mutex
+	// entries maps file path to element in lru.
+	entries map[string]*list.Element
+	// lru holds *File, most recently used first.
+	lru  *list.List
+	size int64
+}
+
+var _ Interface = (*Cache)(nil)
+
+// NewCache creates a Cache that keeps up to maxSize bytes of files from the
+// backing file store in the local directory dir. Files already in dir are
+// kept in the cache, with the least recently modified evicted first.
+func NewCache(backing Interface, dir string, maxSize int64, options ...CacheOption) (*Cache, error) {
+	if !filepath.IsAbs(dir) {
+		return nil, errors.New("cache directory must be absolute")
+	}
+	if maxSize <= 0 {
+		return nil, errors.New("cache size must be greater than zero")
+	}
+	opts, err := getCacheOpts(options)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		backing: backing,
+		dir:     dir,
+		maxSize: maxSize,
+		verify:  opts.verify,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	if err = c.load(); err != nil {
+		return nil, fmt.Errorf("cannot load cache directory: %w", err)
+	}
+	return c, nil
+}
+
+func (c *Cache) Delete(ctx context.Context, relPath string) error {
+	if err := c.backing.Delete(ctx, relPath); err != nil {
+		return err
+	}
+	c.remove(relPath)
+	return nil
+}
+
+func (c *Cache) Get(ctx context.Context, relPath string) (*File, io.ReadCloser, error) {
+	localPath, ok := c.localPath(relPath)
+	if !ok {
+		// Path cannot be cached.
+		return c.backing.Get(ctx, relPath)
+	}
+
+	if file, f := c.open(relPath, localPath); f != nil {
+		return file, f, nil
+	}
+
+	file, r, err := c.backing.Get(ctx, relPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if file.Size > c.maxSize {
+		// Too large to cache.
+		return file, r, nil
+	}
+	defer r.Close()
+
+	f, err := c.fill(relPath, localPath, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, f, nil
+}
+
+func (c *Cache) Head(ctx context.Context, relPath string) (*File, error) {
+	c.mutex.Lock()
+	elem, ok := c.entries[relPath]
+	if ok {
+		file := *elem.Value.(*File)
+		c.mutex.Unlock()
+		return &file, nil
+	}
+	c.mutex.Unlock()
+	return c.backing.Head(ctx, relPath)
+}
+
+func (c *Cache) List(ctx context.Context, relPath string, recursive bool) (<-chan *File, <-chan error) {
+	return c.backing.List(ctx, relPath, recursive)
+}
+
+func (c *Cache) Put(ctx context.Context, relPath string, reader io.Reader) (*File, error) {
+	file, err := c.backing.Put(ctx, relPath, reader)
+	if err != nil {
+		return nil, err
+	}
+	c.remove(relPath)
+	return file, nil
+}
+
+// Type returns the type of the backing file store.
+func (c *Cache) Type() string {
+	return c.backing.Type()
+}
+
+// Size returns the total size of all cached files.
+func (c *Cache) Size() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.size
+}
+
+// open opens the cached file and marks it as most recently used. Returns a
+// nil reader if the file is not cached.
+func (c *Cache) open(relPath, localPath string) (*File, io.ReadCloser) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.entries[relPath]
+	if !ok {
+		return nil, nil
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		log.Errorw("Cannot open cached file", "err", err, "path", relPath)
+		c.removeElem(elem)
+		return nil, nil
+	}
+	c.lru.MoveToFront(elem)
+	file := *elem.Value.(*File)
+	return &file, f
+}
+
+// fill writes the data from r into the cache, and returns the cached file
+// opened for reading.
+func (c *Cache) fill(relPath, localPath string, r io.Reader) (*os.File, error) {
+	tmp, err := os.CreateTemp(c.dir, fillPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return nil, err
+	}
+	if c.verify != nil {
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err = c.verify(relPath, tmp); err != nil {
+			return nil, fmt.Errorf("cannot verify %s: %w", relPath, err)
+		}
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Replace any copy of the file cached by a concurrent Get.
+	if elem, ok := c.entries[relPath]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, relPath)
+		c.size -= elem.Value.(*File).Size
+	}
+	if err = os.Rename(tmp.Name(), localPath); err != nil {
+		return nil, err
+	}
+	f := tmp
+	tmp = nil
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	c.add(&File{
+		Modified: fi.ModTime(),
+		Path:     relPath,
+		Size:     size,
+	})
+	c.evict()
+	return f, nil
+}
+
+func (c *Cache) remove(relPath string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, ok := c.entries[relPath]; ok {
+		c.removeElem(elem)
+	}
+}
+
+// add adds the file as the most recently used file. The cache mutex must be
+// held.
+func (c *Cache) add(file *File) {
+	c.entries[file.Path] = c.lru.PushFront(file)
+	c.size += file.Size
+}
+
+// evict removes least recently used files until the cache is within its
+// maximum size. The cache mutex must be held.
+func (c *Cache) evict() {
+	for c.size > c.maxSize {
+		elem := c.lru.Back()
+		if elem == nil {
+			return
+		}
+		c.removeElem(elem)
+	}
+}
+
+// removeElem removes the cached file. The cache mutex must be held.
+func (c *Cache) removeElem(elem *list.Element) {
+	file := c.lru.Remove(elem).(*File)
+	delete(c.entries, file.Path)
+	c.size -= file.Size
+	if err := os.Remove(filepath.Join(c.dir, filepath.FromSlash(file.Path))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Errorw("Cannot remove cached file", "err", err, "path", file.Path)
+	}
+}
+
+// localPath returns the path of the file in the cache directory. Returns
+// false if the file cannot be cached at that path.
+func (c *Cache) localPath(relPath string) (string, bool) {
+	clean := path.Clean("/" + relPath)[1:]
+	if clean == "" || clean != relPath || strings.HasPrefix(path.Base(clean), fillPrefix) {
+		return "", false
+	}
+	return filepath.Join(c.dir, filepath.FromSlash(clean)), true
+}
+
+// load adds files already in the cache directory to the cache, and removes
+// any partially written files.
+func (c *Cache) load() error {
+	var files []*File
+	err := filepath.WalkDir(c.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), fillPrefix) {
+			return os.Remove(p)
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(c.dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, &File{
+			Modified: fi.ModTime(),
+			Path:     filepath.ToSlash(relPath),
+			Size:     fi.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Add least recently modified first so that it is evicted first.
+	sort.Slice(files, func(i, j int) bool { return files[i].Modified.Before(files[j].Modified) })
+	for _, file := range files {
+		c.add(file)
+	}
+	c.evict()
+	return nil
+}
@@ -3,8 +3,12 @@ package filestore
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"time"
+
+	"github.com/ipni/storetheindex/config"
 )
 
 // File contains information about a stored file.
@@ -41,3 +45,46 @@ type Interface interface {
 	// Type returns the file store type.
 	Type() string
 }
+
+// defaultCacheSize is the maximum size of a file store cache if not
+// configured.
+const defaultCacheSize = 1 << 30
+
+// New creates a new file store of the configured type. Returns nil if the
+// type is "none". If a cache directory is configured, then the file store is
+// wrapped in a Cache, and the cache options are applied to it.
+func New(cfg config.FileStore, cacheOpts ...CacheOption) (Interface, error) {
+	fileStore, err := newBacking(cfg)
+	if err != nil || fileStore == nil || cfg.Cache.Dir == "" {
+		return fileStore, err
+	}
+	maxSize := int64(cfg.Cache.MaxSize)
+	if maxSize == 0 {
+		maxSize = defaultCacheSize
+	}
+	return NewCache(fileStore, cfg.Cache.Dir, maxSize, cacheOpts...)
+}
+
+func newBacking(cfg config.FileStore) (Interface, error) {
+	switch cfg.Type {
+	case "local":
+		return NewLocal(cfg.Local.BasePath)
+	case "s3":
+		return NewS3(cfg.S3.BucketName,
+			WithEndpoint(cfg.S3.Endpoint),
+			WithRegion(cfg.S3.Region),
+			WithKeys(cfg.S3.AccessKey, cfg.S3.SecretKey),
+		)
+	case "http":
+		opts := []HTTPOption{WithIndexPath(cfg.HTTP.IndexPath)}
+		if cfg.HTTP.Timeout != 0 {
+			opts = append(opts, WithTimeout(time.Duration(cfg.HTTP.Timeout)))
+		}
+		return NewHTTP(cfg.HTTP.BaseURL, opts...)
+	case "":
+		return nil, errors.New("storage type not defined")
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported file storage type: %s", cfg.Type)
+}
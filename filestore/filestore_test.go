@@ -2,9 +2,12 @@ package filestore_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -108,6 +111,160 @@ func TestLocal(t *testing.T) {
 	})
 }
 
+func TestHTTP(t *testing.T) {
+	ctx := context.Background()
+
+	// Serve files from a local file store.
+	dir := t.TempDir()
+	local, err := filestore.NewLocal(dir)
+	require.NoError(t, err)
+	for name, content := range map[string]string{fileName1: data1, fileName2: data2, fileName3: data3} {
+		_, err = local.Put(ctx, name, strings.NewReader(content))
+		require.NoError(t, err)
+	}
+	index := fmt.Sprintf("%s\t%d\n%s\t%d\t2023-01-02T15:04:05Z\n%s\n",
+		fileName3, len(data3), fileName1, len(data1), fileName2)
+	_, err = local.Put(ctx, "index.txt", strings.NewReader(index))
+	require.NoError(t, err)
+	ts := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer ts.Close()
+
+	_, err = filestore.NewHTTP("ftp://example.com")
+	require.Error(t, err)
+
+	fileStore, err := filestore.NewHTTP(ts.URL+"/", filestore.WithIndexPath("index.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "http", fileStore.Type())
+
+	fileInfo, err := fileStore.Head(ctx, "not-here")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.Nil(t, fileInfo)
+
+	fileInfo, err = fileStore.Head(ctx, fileName3)
+	require.NoError(t, err)
+	require.Equal(t, fileName3, fileInfo.Path)
+	require.Equal(t, int64(len(data3)), fileInfo.Size)
+	require.False(t, fileInfo.Modified.IsZero())
+
+	_, _, err = fileStore.Get(ctx, "not-here")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	fileInfo, r, err := fileStore.Get(ctx, fileName1)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data1)), fileInfo.Size)
+	require.Equal(t, ts.URL+"/"+fileName1, fileInfo.URL)
+	content, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, data1, string(content))
+
+	listPaths := func(relPath string, recursive bool) []string {
+		fileCh, errCh := fileStore.List(ctx, relPath, recursive)
+		var paths []string
+		for fileInfo := range fileCh {
+			paths = append(paths, fileInfo.Path)
+		}
+		require.NoError(t, <-errCh)
+		return paths
+	}
+	require.Equal(t, []string{fileName1, fileName2}, listPaths("", false))
+	require.Equal(t, []string{fileName3, fileName1, fileName2}, listPaths("", true))
+	require.Equal(t, []string{fileName3}, listPaths(subdir, false))
+	require.Equal(t, []string{fileName1}, listPaths(fileName1, false))
+	require.Empty(t, listPaths("not-here/", false))
+
+	_, err = fileStore.Put(ctx, fileName, strings.NewReader(data))
+	require.ErrorIs(t, err, filestore.ErrReadOnly)
+	require.ErrorIs(t, fileStore.Delete(ctx, fileName1), filestore.ErrReadOnly)
+
+	// Cannot list without index file.
+	fileStore, err = filestore.NewHTTP(ts.URL)
+	require.NoError(t, err)
+	fileCh, errCh := fileStore.List(ctx, "", true)
+	for range fileCh {
+	}
+	require.Error(t, <-errCh)
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+
+	backing, err := filestore.NewLocal(t.TempDir())
+	require.NoError(t, err)
+	cacheDir := t.TempDir()
+	cache, err := filestore.NewCache(backing, cacheDir, 8)
+	require.NoError(t, err)
+	require.Equal(t, "local", cache.Type())
+
+	// Writes go to backing file store.
+	_, err = cache.Put(ctx, fileName1, strings.NewReader(data1))
+	require.NoError(t, err)
+	_, err = cache.Put(ctx, fileName3, strings.NewReader(data3))
+	require.NoError(t, err)
+	_, err = backing.Put(ctx, fileName, strings.NewReader(data))
+	require.NoError(t, err)
+	require.Zero(t, cache.Size())
+
+	readAll := func(relPath string) string {
+		_, r, err := cache.Get(ctx, relPath)
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		return string(content)
+	}
+
+	require.Equal(t, data1, readAll(fileName1))
+	require.Equal(t, int64(len(data1)), cache.Size())
+	require.True(t, fsutil.FileExists(filepath.Join(cacheDir, fileName1)))
+
+	// Read from cache after removing from backing.
+	require.NoError(t, backing.Delete(ctx, fileName1))
+	require.Equal(t, data1, readAll(fileName1))
+	fileInfo, err := cache.Head(ctx, fileName1)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data1)), fileInfo.Size)
+
+	// Adding another file evicts the least recently used file.
+	require.Equal(t, data3, readAll(fileName3))
+	require.Equal(t, int64(len(data1)+len(data3)), cache.Size())
+	require.Equal(t, data3, readAll(fileName3))
+	require.NoError(t, backing.Delete(ctx, fileName3))
+	_, err = backing.Put(ctx, fileName2, strings.NewReader(data2))
+	require.NoError(t, err)
+	require.Equal(t, data2, readAll(fileName2))
+	_, _, err = cache.Get(ctx, fileName1)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.Equal(t, data3, readAll(fileName3))
+
+	// File too large for cache is read from backing.
+	require.Equal(t, data, readAll(fileName))
+	require.False(t, fsutil.FileExists(filepath.Join(cacheDir, fileName)))
+
+	// Deleting removes file from cache.
+	require.NoError(t, cache.Delete(ctx, fileName2))
+	_, _, err = cache.Get(ctx, fileName2)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	// Cached files are kept when cache is reopened.
+	cache, err = filestore.NewCache(backing, cacheDir, 8)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data3)), cache.Size())
+	require.Equal(t, data3, readAll(fileName3))
+
+	// File that fails verification is not cached.
+	verifyErr := errors.New("bad file")
+	cache, err = filestore.NewCache(backing, t.TempDir(), 8, filestore.WithVerify(func(string, io.Reader) error {
+		return verifyErr
+	}))
+	require.NoError(t, err)
+	_, err = backing.Put(ctx, fileName2, strings.NewReader(data2))
+	require.NoError(t, err)
+	_, _, err = cache.Get(ctx, fileName2)
+	require.ErrorIs(t, err, verifyErr)
+	require.Zero(t, cache.Size())
+}
+
 func testPut(t *testing.T, fileStore filestore.Interface) {
 	fileInfo, err := fileStore.Put(context.Background(), fileName, strings.NewReader(data))
 	require.NoError(t, err)
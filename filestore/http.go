@@ -0,0 +1,217 @@
+package filestore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrReadOnly is returned when writing to or deleting from a read-only file
+// store.
+var ErrReadOnly = errors.New("file store is read-only")
+
+// HTTP is a read-only file store that retrieves files from an HTTP server,
+// such as a CDN or static file server publishing another indexer's mirror.
+//
+// Files are listed by reading an index file from the server. Each line of the
+// index file is the path of a file relative to the base URL, optionally
+// followed by a tab and the size of the file in bytes, and optionally followed
+// by another tab and the RFC 3339 modification time of the file. Listing is
+// not available if no index file is configured.
+type HTTP struct {
+	baseURL   *url.URL
+	client    *http.Client
+	indexPath string
+}
+
+// NewHTTP creates a read-only file store that retrieves files relative to the
+// base URL.
+func NewHTTP(baseURL string, options ...HTTPOption) (*HTTP, error) {
+	if baseURL == "" {
+		return nil, errors.New("http filestore requires base url")
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("base url scheme must be http or https: %s", baseURL)
+	}
+
+	opts, err := getHTTPOpts(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HTTP{
+		baseURL: u,
+		client: &http.Client{
+			Timeout: opts.timeout,
+		},
+		indexPath: opts.indexPath,
+	}, nil
+}
+
+func (h *HTTP) Delete(ctx context.Context, relPath string) error {
+	return ErrReadOnly
+}
+
+func (h *HTTP) Get(ctx context.Context, relPath string) (*File, io.ReadCloser, error) {
+	rsp, err := h.request(ctx, http.MethodGet, relPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h.fileFromResponse(rsp, relPath), rsp.Body, nil
+}
+
+func (h *HTTP) Head(ctx context.Context, relPath string) (*File, error) {
+	rsp, err := h.request(ctx, http.MethodHead, relPath)
+	if err != nil {
+		return nil, err
+	}
+	rsp.Body.Close()
+	return h.fileFromResponse(rsp, relPath), nil
+}
+
+func (h *HTTP) List(ctx context.Context, relPath string, recursive bool) (<-chan *File, <-chan error) {
+	fc := make(chan *File)
+	ec := make(chan error, 1)
+
+	go func() {
+		defer close(fc)
+		defer close(ec)
+
+		if h.indexPath == "" {
+			ec <- errors.New("http filestore cannot list files without index file")
+			return
+		}
+		files, err := h.readIndex(ctx)
+		if err != nil {
+			ec <- fmt.Errorf("cannot read index file: %w", err)
+			return
+		}
+
+		dir := strings.TrimSuffix(relPath, "/")
+		if dir != "" {
+			dir += "/"
+		}
+		for _, file := range files {
+			if file.Path != relPath {
+				if !strings.HasPrefix(file.Path, dir) {
+					continue
+				}
+				// If not resursive then skip subdirectories of relPath.
+				if !recursive && strings.Contains(file.Path[len(dir):], "/") {
+					continue
+				}
+			}
+			select {
+			case fc <- file:
+			case <-ctx.Done():
+				ec <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return fc, ec
+}
+
+func (h *HTTP) Put(ctx context.Context, relPath string, reader io.Reader) (*File, error) {
+	return nil, ErrReadOnly
+}
+
+func (h *HTTP) Type() string {
+	return "http"
+}
+
+// request sends a request for the file at relPath. Returns fs.ErrNotExist if
+// the server does not have the file. The caller must close the response body.
+func (h *HTTP) request(ctx context.Context, method, relPath string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, h.baseURL.JoinPath(relPath).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch rsp.StatusCode {
+	case http.StatusOK:
+		return rsp, nil
+	case http.StatusNotFound, http.StatusForbidden:
+		// Static file servers and CDNs often respond with forbidden for files
+		// that do not exist.
+		rsp.Body.Close()
+		return nil, fs.ErrNotExist
+	default:
+		rsp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", method, req.URL, rsp.Status)
+	}
+}
+
+func (h *HTTP) fileFromResponse(rsp *http.Response, relPath string) *File {
+	file := &File{
+		Path: relPath,
+		Size: rsp.ContentLength,
+		URL:  rsp.Request.URL.String(),
+	}
+	if lastMod := rsp.Header.Get("Last-Modified"); lastMod != "" {
+		if modified, err := http.ParseTime(lastMod); err == nil {
+			file.Modified = modified
+		}
+	}
+	return file
+}
+
+// readIndex reads the index file and returns the files it lists, sorted by
+// path.
+func (h *HTTP) readIndex(ctx context.Context) ([]*File, error) {
+	rsp, err := h.request(ctx, http.MethodGet, h.indexPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	var files []*File
+	scanner := bufio.NewScanner(rsp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		file := &File{
+			Path: strings.TrimPrefix(fields[0], "/"),
+			Size: -1,
+		}
+		if len(fields) > 1 {
+			file.Size, err = strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid size for %s: %w", file.Path, err)
+			}
+		}
+		if len(fields) > 2 {
+			file.Modified, err = time.Parse(time.RFC3339, fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid modification time for %s: %w", file.Path, err)
+			}
+		}
+		file.URL = h.baseURL.JoinPath(file.Path).String()
+		files = append(files, file)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
@@ -1,7 +1,9 @@
 package filestore
 
 import (
+	"errors"
 	"fmt"
+	"time"
 )
 
 type s3Config struct {
@@ -44,3 +46,70 @@ func WithKeys(accessKey, secretKey string) S3Option {
 		return nil
 	}
 }
+
+const defaultHTTPTimeout = time.Minute
+
+type httpConfig struct {
+	indexPath string
+	timeout   time.Duration
+}
+
+type HTTPOption func(*httpConfig) error
+
+func getHTTPOpts(opts []HTTPOption) (httpConfig, error) {
+	cfg := httpConfig{
+		timeout: defaultHTTPTimeout,
+	}
+	for i, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return httpConfig{}, fmt.Errorf("option %d error: %s", i, err)
+		}
+	}
+	return cfg, nil
+}
+
+// WithIndexPath sets the path, relative to the base URL, of the index file
+// that lists the files available from an HTTP file store.
+func WithIndexPath(indexPath string) HTTPOption {
+	return func(c *httpConfig) error {
+		c.indexPath = indexPath
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout for HTTP requests, including reading the
+// response body. A value of 0 means no timeout.
+func WithTimeout(timeout time.Duration) HTTPOption {
+	return func(c *httpConfig) error {
+		if timeout < 0 {
+			return errors.New("timeout cannot be negative")
+		}
+		c.timeout = timeout
+		return nil
+	}
+}
+
+type cacheConfig struct {
+	verify VerifyFunc
+}
+
+type CacheOption func(*cacheConfig) error
+
+func getCacheOpts(opts []CacheOption) (cacheConfig, error) {
+	var cfg cacheConfig
+	for i, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return cacheConfig{}, fmt.Errorf("option %d error: %s", i, err)
+		}
+	}
+	return cfg, nil
+}
+
+// WithVerify sets a function that checks each file before it is added to the
+// cache.
+func WithVerify(verify VerifyFunc) CacheOption {
+	return func(c *cacheConfig) error {
+		c.verify = verify
+		return nil
+	}
+}
@@ -0,0 +1,598 @@
+// Package backup writes and restores snapshots of indexer state. A backup
+// contains the contents of the datastore, the files of the value store, and
+// the indexer config. All of these are written to a file store under a
+// directory named for the backup. The value store files can only be backed up
+// from a stopped indexer, since they are not consistent while the value store
+// is open.
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipni/storetheindex/filestore"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+var log = logging.Logger("indexer/backup")
+
+const (
+	// Version is the version of the backup format.
+	Version = 1
+
+	configName     = "config"
+	datastoreName  = "datastore.gz"
+	manifestName   = "manifest.json"
+	valueStoreName = "valuestore"
+
+	restoreBatchSize = 1024
+)
+
+// ErrExists is returned when writing a backup that already exists.
+var ErrExists = errors.New("backup already exists")
+
+// File describes a file in a backup.
+type File struct {
+	// Path is the slash-separated path of the file, relative to the
+	// directory it was backed up from.
+	Path string
+	// Size is the number of bytes in the file.
+	Size int64
+}
+
+// Head is the latest advertisement processed from a publisher.
+type Head struct {
+	Publisher peer.ID
+	AdCid     cid.Cid
+}
+
+// Manifest describes the contents of a backup. A backup is complete only if
+// its manifest exists, since the manifest is written last.
+type Manifest struct {
+	// Version is the version of the backup format.
+	Version int
+	// Name is the name of the backup.
+	Name string
+	// Created is the time the backup was started.
+	Created time.Time
+	// Online is true if the backup was taken of a running indexer.
+	Online bool
+	// PeerID is the identity of the indexer that was backed up.
+	PeerID peer.ID `json:",omitempty"`
+	// Heads is the latest advertisement processed from each publisher, as of
+	// when the backup was taken.
+	Heads []Head `json:",omitempty"`
+	// DatastoreKeys is the number of datastore keys backed up.
+	DatastoreKeys uint64
+	// ValueStoreType is the type of value store backed up.
+	ValueStoreType string
+	// ValueStoreFiles lists the files backed up from the value store
+	// directory.
+	ValueStoreFiles []File `json:",omitempty"`
+	// Config is true if the backup contains the indexer config file.
+	Config bool
+}
+
+// Source is the indexer state to back up.
+type Source struct {
+	// ConfigFile is the path to the config file. If empty, the config is not
+	// backed up.
+	ConfigFile string
+	// Datastore is the datastore to back up. Not used if Snapshot is set.
+	Datastore datastore.Datastore
+	// Snapshot is a copy of the datastore to back up instead of Datastore.
+	Snapshot *Snapshot
+	// Heads maps each publisher to the latest advertisement processed.
+	Heads map[peer.ID]cid.Cid
+	// Online is true if the indexer is running. An online backup cannot
+	// include value store files.
+	Online bool
+	// PeerID is the identity of the indexer.
+	PeerID peer.ID
+	// ValueStoreDir is the directory containing the value store. If empty,
+	// no value store files are backed up. Must be empty if Online is true.
+	ValueStoreDir string
+	// ValueStoreType is the type of value store.
+	ValueStoreType string
+}
+
+// Target is where backed up indexer state is restored to.
+type Target struct {
+	// ConfigFile is the path to write the config file to. If empty, the
+	// config is not restored. This file must not already exist.
+	ConfigFile string
+	// Datastore is the datastore to restore into. This must be empty.
+	Datastore datastore.Batching
+	// IndexStatePrefixes are the prefixes of datastore keys that record
+	// what has been indexed into the value store. If the backup does not
+	// contain value store files, then keys with these prefixes are not
+	// restored, so that the restored indexer indexes everything again.
+	IndexStatePrefixes []string
+	// ValueStoreDir is the directory to restore value store files into. This
+	// must not exist or be empty.
+	ValueStoreDir string
+}
+
+// Write writes a backup of the source indexer state to the file store. The
+// source must not be modified while the backup is written, except for a
+// datastore that has been copied into a Snapshot. Returns ErrExists if a
+// backup with the same name already exists.
+func Write(ctx context.Context, fileStore filestore.Interface, name string, src Source) (*Manifest, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	if src.Online && src.ValueStoreDir != "" {
+		return nil, errors.New("value store files can only be backed up from a stopped indexer")
+	}
+	_, err := fileStore.Head(ctx, path.Join(name, manifestName))
+	if err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrExists, name)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("cannot check for existing backup: %w", err)
+	}
+
+	m := &Manifest{
+		Version:        Version,
+		Name:           name,
+		Created:        time.Now().UTC(),
+		Online:         src.Online,
+		PeerID:         src.PeerID,
+		ValueStoreType: src.ValueStoreType,
+	}
+	for pubID, adCid := range src.Heads {
+		m.Heads = append(m.Heads, Head{
+			Publisher: pubID,
+			AdCid:     adCid,
+		})
+	}
+	sort.Slice(m.Heads, func(i, j int) bool {
+		return m.Heads[i].Publisher < m.Heads[j].Publisher
+	})
+
+	log := log.With("name", name)
+	log.Info("Writing backup")
+
+	if src.ConfigFile != "" {
+		if err = putFile(ctx, fileStore, path.Join(name, configName), src.ConfigFile); err != nil {
+			return nil, fmt.Errorf("cannot back up config: %w", err)
+		}
+		m.Config = true
+	}
+
+	if src.Snapshot != nil {
+		err = putFile(ctx, fileStore, path.Join(name, datastoreName), src.Snapshot.path)
+		m.DatastoreKeys = src.Snapshot.keys
+	} else {
+		m.DatastoreKeys, err = writeDatastore(ctx, fileStore, path.Join(name, datastoreName), src.Datastore)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot back up datastore: %w", err)
+	}
+	log.Infow("Backed up datastore", "keys", m.DatastoreKeys)
+
+	if src.ValueStoreDir != "" {
+		m.ValueStoreFiles, err = writeDir(ctx, fileStore, path.Join(name, valueStoreName), src.ValueStoreDir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot back up value store: %w", err)
+		}
+		log.Infow("Backed up value store", "files", len(m.ValueStoreFiles))
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = fileStore.Put(ctx, path.Join(name, manifestName), bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("cannot write backup manifest: %w", err)
+	}
+	log.Info("Finished writing backup")
+	return m, nil
+}
+
+// ReadManifest reads the manifest of the named backup. Returns fs.ErrNotExist
+// if there is no complete backup with that name.
+func ReadManifest(ctx context.Context, fileStore filestore.Interface, name string) (*Manifest, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	_, r, err := fileStore.Get(ctx, path.Join(name, manifestName))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var m Manifest
+	if err = json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("cannot decode backup manifest: %w", err)
+	}
+	if m.Version != Version {
+		return nil, fmt.Errorf("unsupported backup version %d", m.Version)
+	}
+	return &m, nil
+}
+
+// Restore restores the named backup from the file store to the target. If the
+// backup does not contain value store files, then the datastore keys with the
+// target's IndexStatePrefixes are not restored.
+func Restore(ctx context.Context, fileStore filestore.Interface, name string, dst Target) (*Manifest, error) {
+	m, err := ReadManifest(ctx, fileStore, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("backup %s not found", name)
+		}
+		return nil, err
+	}
+
+	// Check all targets before restoring anything.
+	empty, err := datastoreEmpty(ctx, dst.Datastore)
+	if err != nil {
+		return nil, err
+	}
+	if !empty {
+		return nil, errors.New("cannot restore into datastore that is not empty")
+	}
+	if len(m.ValueStoreFiles) != 0 {
+		if dst.ValueStoreDir == "" {
+			return nil, errors.New("value store directory required to restore value store")
+		}
+		entries, err := os.ReadDir(dst.ValueStoreDir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if len(entries) != 0 {
+			return nil, fmt.Errorf("cannot restore into value store directory that is not empty: %s", dst.ValueStoreDir)
+		}
+	}
+	if m.Config && dst.ConfigFile != "" {
+		if _, err = os.Stat(dst.ConfigFile); err == nil {
+			return nil, fmt.Errorf("config file already exists: %s", dst.ConfigFile)
+		}
+	}
+
+	log := log.With("name", name)
+	log.Info("Restoring backup")
+
+	var skipPrefixes []string
+	if len(m.ValueStoreFiles) == 0 {
+		skipPrefixes = dst.IndexStatePrefixes
+	}
+	if err = restoreDatastore(ctx, fileStore, path.Join(name, datastoreName), dst.Datastore, m.DatastoreKeys, skipPrefixes); err != nil {
+		return nil, fmt.Errorf("cannot restore datastore: %w", err)
+	}
+	log.Infow("Restored datastore", "keys", m.DatastoreKeys)
+
+	if len(m.ValueStoreFiles) != 0 {
+		if err = restoreDir(ctx, fileStore, path.Join(name, valueStoreName), dst.ValueStoreDir, m.ValueStoreFiles); err != nil {
+			return nil, fmt.Errorf("cannot restore value store: %w", err)
+		}
+		log.Infow("Restored value store", "files", len(m.ValueStoreFiles))
+	}
+
+	if m.Config && dst.ConfigFile != "" {
+		if err = getFile(ctx, fileStore, path.Join(name, configName), dst.ConfigFile, -1); err != nil {
+			return nil, fmt.Errorf("cannot restore config: %w", err)
+		}
+	}
+	log.Info("Finished restoring backup")
+	return m, nil
+}
+
+// Snapshot is a local copy of the datastore, in the same format that it is
+// backed up in. Taking a snapshot is much faster than writing the datastore
+// to remote storage, so a running indexer only needs to stop modifying the
+// datastore while the snapshot is taken.
+type Snapshot struct {
+	keys uint64
+	path string
+}
+
+// SnapshotDatastore copies all datastore keys and values into a new file in
+// dir, or in the default directory for temporary files if dir is empty. The
+// datastore must not be modified until SnapshotDatastore returns. The
+// returned Snapshot must be closed to remove the file.
+func SnapshotDatastore(ctx context.Context, ds datastore.Datastore, dir string) (*Snapshot, error) {
+	f, err := os.CreateTemp(dir, "datastore-snapshot-*.gz")
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{
+		path: f.Name(),
+	}
+	snap.keys, err = encodeDatastore(ctx, ds, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(snap.path)
+		return nil, err
+	}
+	return snap, nil
+}
+
+// Keys returns the number of datastore keys in the snapshot.
+func (s *Snapshot) Keys() uint64 {
+	return s.keys
+}
+
+// Close removes the snapshot file.
+func (s *Snapshot) Close() error {
+	return os.Remove(s.path)
+}
+
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid backup name: %q", name)
+	}
+	return nil
+}
+
+// writeDatastore writes all datastore keys and values to a file in the file
+// store.
+func writeDatastore(ctx context.Context, fileStore filestore.Interface, filePath string, ds datastore.Datastore) (uint64, error) {
+	pr, pw := io.Pipe()
+	var count uint64
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		count, err = encodeDatastore(ctx, ds, pw)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	_, err := fileStore.Put(ctx, filePath, pr)
+	// Unblock the writer if Put returned early.
+	pr.CloseWithError(errors.New("backup write stopped"))
+	writeErr := <-done
+	if err != nil {
+		return 0, err
+	}
+	if writeErr != nil {
+		return 0, writeErr
+	}
+	return count, nil
+}
+
+// encodeDatastore writes all datastore keys and values to w, gzip-compressed,
+// as a series of varint-length-prefixed keys and values.
+func encodeDatastore(ctx context.Context, ds datastore.Datastore, w io.Writer) (uint64, error) {
+	results, err := ds.Query(ctx, query.Query{})
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close()
+
+	gz := gzip.NewWriter(w)
+	bw := bufio.NewWriter(gz)
+	var buf []byte
+	var count uint64
+	for r := range results.Next() {
+		if r.Error != nil {
+			return 0, r.Error
+		}
+		buf = binary.AppendUvarint(buf[:0], uint64(len(r.Key)))
+		buf = append(buf, r.Key...)
+		buf = binary.AppendUvarint(buf, uint64(len(r.Value)))
+		buf = append(buf, r.Value...)
+		if _, err = bw.Write(buf); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	if err = bw.Flush(); err != nil {
+		return 0, err
+	}
+	if err = gz.Close(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// restoreDatastore restores the datastore file into the datastore, except for
+// keys that have any of the skip prefixes.
+func restoreDatastore(ctx context.Context, fileStore filestore.Interface, filePath string, ds datastore.Batching, expect uint64, skipPrefixes []string) error {
+	_, r, err := fileStore.Get(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(gz)
+
+	batch, err := ds.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	var count, pending uint64
+	for {
+		key, err := readField(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		value, err := readField(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		count++
+		if hasAnyPrefix(string(key), skipPrefixes) {
+			continue
+		}
+		if err = batch.Put(ctx, datastore.NewKey(string(key)), value); err != nil {
+			return err
+		}
+		pending++
+		if pending == restoreBatchSize {
+			if err = batch.Commit(ctx); err != nil {
+				return err
+			}
+			if batch, err = ds.Batch(ctx); err != nil {
+				return err
+			}
+			pending = 0
+		}
+	}
+	if err = batch.Commit(ctx); err != nil {
+		return err
+	}
+	if count != expect {
+		return fmt.Errorf("restored %d datastore keys, expected %d", count, expect)
+	}
+	return ds.Sync(ctx, datastore.NewKey(""))
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func readField(br *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	if _, err = io.ReadFull(br, buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+func datastoreEmpty(ctx context.Context, ds datastore.Datastore) (bool, error) {
+	results, err := ds.Query(ctx, query.Query{
+		KeysOnly: true,
+		Limit:    1,
+	})
+	if err != nil {
+		return false, err
+	}
+	ents, err := results.Rest()
+	if err != nil {
+		return false, err
+	}
+	return len(ents) == 0, nil
+}
+
+// writeDir writes all regular files in the directory to the file store.
+func writeDir(ctx context.Context, fileStore filestore.Interface, dstPath, dir string) ([]File, error) {
+	var files []File
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if err = putFile(ctx, fileStore, path.Join(dstPath, rel), name); err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, File{
+			Path: rel,
+			Size: fi.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func restoreDir(ctx context.Context, fileStore filestore.Interface, srcPath, dir string, files []File) error {
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		name := filepath.Join(dir, filepath.FromSlash(file.Path))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			return err
+		}
+		if err := getFile(ctx, fileStore, path.Join(srcPath, file.Path), name, file.Size); err != nil {
+			return fmt.Errorf("cannot restore %s: %w", file.Path, err)
+		}
+	}
+	return nil
+}
+
+func putFile(ctx context.Context, fileStore filestore.Interface, dstPath, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fileStore.Put(ctx, dstPath, f)
+	return err
+}
+
+// getFile reads a file from the file store and writes it to the named local
+// file. If size is not negative, then the file must be that size.
+func getFile(ctx context.Context, fileStore filestore.Interface, srcPath, name string, size int64) error {
+	_, r, err := fileStore.Get(ctx, srcPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if size >= 0 && n != size {
+		return fmt.Errorf("restored %d bytes, expected %d", n, size)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package backup_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipni/go-libipni/test"
+	"github.com/ipni/storetheindex/filestore"
+	"github.com/ipni/storetheindex/internal/backup"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRestore(t *testing.T) {
+	ctx := context.Background()
+	fileStore, err := filestore.NewLocal(t.TempDir())
+	require.NoError(t, err)
+
+	// Create indexer state to back up.
+	srcDir := t.TempDir()
+	configFile := filepath.Join(srcDir, "config")
+	require.NoError(t, os.WriteFile(configFile, []byte(`{"Version": 2}`), 0o644))
+	vsDir := filepath.Join(srcDir, "valuestore")
+	require.NoError(t, os.MkdirAll(filepath.Join(vsDir, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(vsDir, "index"), []byte("index data"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(vsDir, "sub", "data"), []byte("more data"), 0o644))
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	for i := 0; i < 2500; i++ {
+		key := datastore.NewKey("/key/" + test.RandomCids(1)[0].String())
+		require.NoError(t, ds.Put(ctx, key, key.Bytes()))
+	}
+	pubID, err := peer.Decode("12D3KooWKRyzVWW6ChFjQjK4miCty85Niy48tpPV95XdKu1BcvMA")
+	require.NoError(t, err)
+	heads := map[peer.ID]cid.Cid{
+		pubID: test.RandomCids(1)[0],
+	}
+
+	src := backup.Source{
+		ConfigFile:     configFile,
+		Datastore:      ds,
+		Heads:          heads,
+		ValueStoreDir:  vsDir,
+		ValueStoreType: "sth",
+	}
+	// Value store files cannot be backed up from a running indexer.
+	onlineSrc := src
+	onlineSrc.Online = true
+	_, err = backup.Write(ctx, fileStore, "test", onlineSrc)
+	require.ErrorContains(t, err, "stopped indexer")
+
+	m, err := backup.Write(ctx, fileStore, "test", src)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2500), m.DatastoreKeys)
+	require.Len(t, m.ValueStoreFiles, 2)
+	require.True(t, m.Config)
+	require.Equal(t, []backup.Head{{Publisher: pubID, AdCid: heads[pubID]}}, m.Heads)
+
+	_, err = backup.Write(ctx, fileStore, "test", src)
+	require.ErrorIs(t, err, backup.ErrExists)
+	_, err = backup.Write(ctx, fileStore, "../test", src)
+	require.ErrorContains(t, err, "invalid backup name")
+
+	m2, err := backup.ReadManifest(ctx, fileStore, "test")
+	require.NoError(t, err)
+	require.Equal(t, m.Heads, m2.Heads)
+	require.Equal(t, m.ValueStoreFiles, m2.ValueStoreFiles)
+
+	// Restore into new location.
+	dstDir := t.TempDir()
+	dst := backup.Target{
+		ConfigFile:    filepath.Join(dstDir, "config"),
+		Datastore:     dssync.MutexWrap(datastore.NewMapDatastore()),
+		ValueStoreDir: filepath.Join(dstDir, "valuestore"),
+		// Index state is restored along with the value store.
+		IndexStatePrefixes: []string{"/key/"},
+	}
+	_, err = backup.Restore(ctx, fileStore, "other", dst)
+	require.ErrorContains(t, err, "not found")
+
+	_, err = backup.Restore(ctx, fileStore, "test", dst)
+	require.NoError(t, err)
+
+	results, err := ds.Query(ctx, query.Query{})
+	require.NoError(t, err)
+	ents, err := results.Rest()
+	require.NoError(t, err)
+	for _, ent := range ents {
+		value, err := dst.Datastore.Get(ctx, datastore.NewKey(ent.Key))
+		require.NoError(t, err)
+		require.Equal(t, ent.Value, value)
+	}
+
+	data, err := os.ReadFile(dst.ConfigFile)
+	require.NoError(t, err)
+	require.Equal(t, `{"Version": 2}`, string(data))
+	data, err = os.ReadFile(filepath.Join(dst.ValueStoreDir, "sub", "data"))
+	require.NoError(t, err)
+	require.Equal(t, "more data", string(data))
+
+	// Cannot restore over existing state.
+	_, err = backup.Restore(ctx, fileStore, "test", dst)
+	require.ErrorContains(t, err, "not empty")
+	dst.Datastore = dssync.MutexWrap(datastore.NewMapDatastore())
+	_, err = backup.Restore(ctx, fileStore, "test", dst)
+	require.ErrorContains(t, err, "not empty")
+}
+
+func TestWriteSnapshot(t *testing.T) {
+	ctx := context.Background()
+	fileStore, err := filestore.NewLocal(t.TempDir())
+	require.NoError(t, err)
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	keys := make([]datastore.Key, 100)
+	for i := range keys {
+		keys[i] = datastore.NewKey("/key/" + test.RandomCids(1)[0].String())
+		require.NoError(t, ds.Put(ctx, keys[i], keys[i].Bytes()))
+	}
+
+	snapDir := t.TempDir()
+	snap, err := backup.SnapshotDatastore(ctx, ds, snapDir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(keys)), snap.Keys())
+
+	// Changes after the snapshot are not backed up.
+	require.NoError(t, ds.Delete(ctx, keys[0]))
+	newKey := datastore.NewKey("/key/new")
+	require.NoError(t, ds.Put(ctx, newKey, []byte("new")))
+
+	m, err := backup.Write(ctx, fileStore, "test", backup.Source{
+		Online:   true,
+		Snapshot: snap,
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(keys)), m.DatastoreKeys)
+
+	require.NoError(t, snap.Close())
+	ents, err := os.ReadDir(snapDir)
+	require.NoError(t, err)
+	require.Empty(t, ents)
+
+	dst := backup.Target{
+		Datastore: dssync.MutexWrap(datastore.NewMapDatastore()),
+	}
+	_, err = backup.Restore(ctx, fileStore, "test", dst)
+	require.NoError(t, err)
+	for _, key := range keys {
+		value, err := dst.Datastore.Get(ctx, key)
+		require.NoError(t, err)
+		require.Equal(t, key.Bytes(), value)
+	}
+	_, err = dst.Datastore.Get(ctx, newKey)
+	require.ErrorIs(t, err, datastore.ErrNotFound)
+}
+
+func TestRestoreWithoutValueStore(t *testing.T) {
+	ctx := context.Background()
+	fileStore, err := filestore.NewLocal(t.TempDir())
+	require.NoError(t, err)
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	stateKeys := []datastore.Key{
+		datastore.NewKey("/sync/publisher"),
+		datastore.NewKey("/adProcessed/ad"),
+		datastore.NewKey("/indexCounts/provider/context"),
+	}
+	otherKey := datastore.NewKey("/registry/provider")
+	for _, key := range append(stateKeys, otherKey) {
+		require.NoError(t, ds.Put(ctx, key, key.Bytes()))
+	}
+
+	_, err = backup.Write(ctx, fileStore, "test", backup.Source{
+		Datastore:      ds,
+		Online:         true,
+		ValueStoreType: "sth",
+	})
+	require.NoError(t, err)
+
+	// Index state is not restored without the value store, so that the
+	// restored indexer indexes everything again.
+	dst := backup.Target{
+		Datastore:          dssync.MutexWrap(datastore.NewMapDatastore()),
+		IndexStatePrefixes: []string{"/sync/", "/adProcessed/", "/indexCounts/"},
+	}
+	m, err := backup.Restore(ctx, fileStore, "test", dst)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), m.DatastoreKeys)
+	for _, key := range stateKeys {
+		_, err = dst.Datastore.Get(ctx, key)
+		require.ErrorIs(t, err, datastore.ErrNotFound)
+	}
+	value, err := dst.Datastore.Get(ctx, otherKey)
+	require.NoError(t, err)
+	require.Equal(t, otherKey.Bytes(), value)
+}
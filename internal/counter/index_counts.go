@@ -45,6 +45,11 @@ func NewIndexCounts(ds datastore.Datastore) *IndexCounts {
 	}
 }
 
+// KeyPrefix returns the prefix of the datastore keys that store index counts.
+func KeyPrefix() string {
+	return indexCountPrefix
+}
+
 // SetTotalAddent sets a value that is added to the index count returned by
 // Total. Its purpose is to account for uncounted indexes that have existed
 // since before provider index counts were tracked. This only affects Total,
@@ -177,6 +182,41 @@ func (c *IndexCounts) Provider(providerID peer.ID) (uint64, error) {
 	return total, nil
 }
 
+// ProviderContexts returns the persisted index count of each of the
+// provider's context IDs, keyed by context ID.
+func (c *IndexCounts) ProviderContexts(ctx context.Context, providerID peer.ID) (map[string]uint64, error) {
+	q := query.Query{
+		Prefix: indexCountPrefix + providerID.String(),
+	}
+	results, err := c.ds.Query(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query index counts: %w", err)
+	}
+	defer results.Close()
+
+	counts := make(map[string]uint64)
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, fmt.Errorf("cannot read index count: %w", r.Error)
+		}
+		keyProvider, contextID, err := parseIndexCountKey(r.Entry.Key)
+		if err != nil || contextID == nil {
+			log.Errorw("Cannot decode index count key", "key", r.Entry.Key)
+			continue
+		}
+		if keyProvider != providerID {
+			continue
+		}
+		count, _, err := varint.FromUvarint(r.Entry.Value)
+		if err != nil {
+			log.Errorw("Cannot decode index count", "err", err, "key", r.Entry.Key)
+			continue
+		}
+		counts[string(contextID)] = count
+	}
+	return counts, nil
+}
+
 // Total returns the total of all index counts for all providers.
 func (c *IndexCounts) Total() (uint64, error) {
 	// Return in-mem value if available.
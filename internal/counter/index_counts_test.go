@@ -1,6 +1,7 @@
 package counter_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/ipfs/go-datastore"
@@ -150,4 +151,12 @@ func TestAddCount(t *testing.T) {
 	total, err = c.Total()
 	require.NoError(t, err)
 	require.Equal(t, 17, int(total))
+
+	counts, err := c.ProviderContexts(context.Background(), providerID)
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint64{
+		string(ctxid1): 8,
+		string(ctxid2): 4,
+		string(ctxid3): 5,
+	}, counts)
 }
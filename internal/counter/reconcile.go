@@ -0,0 +1,279 @@
+package counter
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-varint"
+)
+
+// maxReportedContexts is the maximum number of context discrepancies listed
+// in a Report.
+const maxReportedContexts = 100
+
+// Counts holds multihash counts for provider context IDs, counted from a
+// source other than the persisted index counts.
+type Counts struct {
+	counts     map[string]*ContextDiscrepancy
+	incomplete map[peer.ID]struct{}
+	// onlyCounted, if true, means that providers with no counts are unknown
+	// to the source, and their persisted counts are not reconciled.
+	onlyCounted bool
+	providers   map[peer.ID]struct{}
+}
+
+// Source counts multihashes for provider context IDs.
+type Source func(context.Context) (*Counts, error)
+
+// NewCounts creates an empty Counts. If onlyCounted is true, then the source
+// cannot tell whether a provider has no indexes, so only providers that have
+// counts are reconciled.
+func NewCounts(onlyCounted bool) *Counts {
+	return &Counts{
+		counts:      make(map[string]*ContextDiscrepancy),
+		incomplete:  make(map[peer.ID]struct{}),
+		onlyCounted: onlyCounted,
+		providers:   make(map[peer.ID]struct{}),
+	}
+}
+
+// Add adds n to the count for the provider's context ID.
+func (c *Counts) Add(providerID peer.ID, contextID []byte, n uint64) {
+	key := makeIndexCountKey(providerID, contextID).String()
+	cc, ok := c.counts[key]
+	if !ok {
+		cc = &ContextDiscrepancy{
+			ProviderID: providerID,
+			ContextID:  contextID,
+		}
+		c.counts[key] = cc
+		c.providers[providerID] = struct{}{}
+	}
+	cc.Actual += n
+}
+
+// SetIncomplete marks the counts of a provider as incomplete. The persisted
+// counts of a provider with incomplete counts are not reconciled.
+func (c *Counts) SetIncomplete(providerID peer.ID) {
+	c.incomplete[providerID] = struct{}{}
+}
+
+// Len returns the number of provider context IDs counted.
+func (c *Counts) Len() int {
+	return len(c.counts)
+}
+
+// ContextDiscrepancy is a difference between the persisted and actual count
+// for a provider's context ID.
+type ContextDiscrepancy struct {
+	ProviderID peer.ID
+	// ContextID is nil if it cannot be decoded from the persisted count key.
+	ContextID []byte
+	Stored    uint64
+	Actual    uint64
+}
+
+// ProviderDiscrepancy is a difference between the persisted and actual total
+// count for a provider.
+type ProviderDiscrepancy struct {
+	ProviderID peer.ID
+	Stored     uint64
+	Actual     uint64
+	// Contexts is the number of the provider's context IDs that have
+	// discrepancies.
+	Contexts int
+}
+
+// Report is the result of reconciling index counts.
+type Report struct {
+	// Providers is the number of providers reconciled.
+	Providers int
+	// Contexts is the number of provider context IDs reconciled.
+	Contexts int
+	// Discrepancies is the number of context IDs with discrepancies.
+	Discrepancies int
+	// ProviderDiscrepancies lists the providers that have discrepancies.
+	ProviderDiscrepancies []ProviderDiscrepancy
+	// ContextDiscrepancies lists up to 100 context IDs that have
+	// discrepancies.
+	ContextDiscrepancies []ContextDiscrepancy
+	// Skipped lists providers that were not reconciled because their counts
+	// are incomplete.
+	Skipped []peer.ID
+	// Rewritten is the number of persisted counts that were corrected.
+	Rewritten int
+	// Changed is the number of counts not corrected because they changed
+	// during reconciliation.
+	Changed int
+}
+
+// Reconcile compares the persisted index counts with the counts from the
+// source, and reports the differences. If rewrite is true, then persisted
+// counts that differ are replaced by the counts from the source.
+//
+// Persisted counts are read before the source is counted. A count that
+// changes while the source is counted, because of ongoing ingestion, is not
+// rewritten and is reported as changed.
+func (c *IndexCounts) Reconcile(ctx context.Context, source Source, rewrite bool) (*Report, error) {
+	stored, err := c.loadAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := source(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Combine persisted and actual counts.
+	for key, count := range stored {
+		cc, ok := actual.counts[key]
+		if !ok {
+			providerID, contextID, err := parseIndexCountKey(key)
+			if err != nil {
+				log.Errorw("Cannot parse index count key", "err", err, "key", key)
+				continue
+			}
+			if _, counted := actual.providers[providerID]; !counted && actual.onlyCounted {
+				continue
+			}
+			cc = &ContextDiscrepancy{
+				ProviderID: providerID,
+				ContextID:  contextID,
+			}
+			actual.counts[key] = cc
+		}
+		cc.Stored = count
+	}
+
+	report := &Report{}
+	for providerID := range actual.incomplete {
+		report.Skipped = append(report.Skipped, providerID)
+	}
+	sort.Slice(report.Skipped, func(i, j int) bool { return report.Skipped[i] < report.Skipped[j] })
+
+	keys := make([]string, 0, len(actual.counts))
+	for key := range actual.counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	providers := make(map[peer.ID]*ProviderDiscrepancy)
+	var discrepancies []string
+	for _, key := range keys {
+		cc := actual.counts[key]
+		if _, ok := actual.incomplete[cc.ProviderID]; ok {
+			continue
+		}
+		report.Contexts++
+		pd, ok := providers[cc.ProviderID]
+		if !ok {
+			pd = &ProviderDiscrepancy{
+				ProviderID: cc.ProviderID,
+			}
+			providers[cc.ProviderID] = pd
+		}
+		pd.Stored += cc.Stored
+		pd.Actual += cc.Actual
+		if cc.Stored == cc.Actual {
+			continue
+		}
+		pd.Contexts++
+		discrepancies = append(discrepancies, key)
+		if len(report.ContextDiscrepancies) < maxReportedContexts {
+			report.ContextDiscrepancies = append(report.ContextDiscrepancies, *cc)
+		}
+	}
+	report.Providers = len(providers)
+	report.Discrepancies = len(discrepancies)
+	for _, pd := range providers {
+		if pd.Contexts != 0 {
+			report.ProviderDiscrepancies = append(report.ProviderDiscrepancies, *pd)
+		}
+	}
+	sort.Slice(report.ProviderDiscrepancies, func(i, j int) bool {
+		return report.ProviderDiscrepancies[i].ProviderID < report.ProviderDiscrepancies[j].ProviderID
+	})
+
+	if !rewrite || len(discrepancies) == 0 {
+		return report, nil
+	}
+
+	// Clear in-mem values so that they are reloaded from the rewritten
+	// counts, even if rewriting fails part way.
+	defer func() {
+		c.mutex.Lock()
+		c.counts = make(map[peer.ID]uint64)
+		c.total = 0
+		c.mutex.Unlock()
+	}()
+
+	for _, key := range discrepancies {
+		cc := actual.counts[key]
+		dsKey := datastore.NewKey(key)
+		current, err := c.loadContextCount(ctx, dsKey)
+		if err != nil {
+			return report, err
+		}
+		if current != cc.Stored {
+			report.Changed++
+			continue
+		}
+		if cc.Actual == 0 {
+			err = c.ds.Delete(ctx, dsKey)
+		} else {
+			err = c.ds.Put(ctx, dsKey, varint.ToUvarint(cc.Actual))
+		}
+		if err != nil {
+			return report, fmt.Errorf("cannot rewrite index count: %w", err)
+		}
+		report.Rewritten++
+	}
+	return report, nil
+}
+
+// loadAll reads all persisted index counts, keyed by index count key.
+func (c *IndexCounts) loadAll(ctx context.Context) (map[string]uint64, error) {
+	q := query.Query{
+		Prefix: indexCountPrefix,
+	}
+	results, err := c.ds.Query(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query index counts: %w", err)
+	}
+	defer results.Close()
+
+	counts := make(map[string]uint64)
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, fmt.Errorf("cannot read index count: %w", r.Error)
+		}
+		count, _, err := varint.FromUvarint(r.Entry.Value)
+		if err != nil {
+			log.Errorw("Cannot decode index count", "err", err, "key", r.Entry.Key)
+			continue
+		}
+		counts[r.Entry.Key] = count
+	}
+	return counts, nil
+}
+
+// parseIndexCountKey returns the provider ID and context ID from an index
+// count key. The context ID is nil if it cannot be decoded.
+func parseIndexCountKey(key string) (peer.ID, []byte, error) {
+	provStr, ctxStr, _ := strings.Cut(strings.TrimPrefix(key, indexCountPrefix), "/")
+	providerID, err := peer.Decode(provStr)
+	if err != nil {
+		return "", nil, err
+	}
+	contextID, err := base64.StdEncoding.DecodeString(ctxStr)
+	if err != nil {
+		return providerID, nil, nil
+	}
+	return providerID, contextID, nil
+}
@@ -0,0 +1,213 @@
+package counter_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipni/go-indexer-core"
+	"github.com/ipni/go-indexer-core/store/memory"
+	"github.com/ipni/go-libipni/test"
+	"github.com/ipni/storetheindex/carstore"
+	"github.com/ipni/storetheindex/filestore"
+	"github.com/ipni/storetheindex/internal/counter"
+	"github.com/ipni/storetheindex/test/typehelpers"
+	crypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	p2ptest "github.com/libp2p/go-libp2p/core/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileValueStore(t *testing.T) {
+	ctx := context.Background()
+	providerID1, providerID2 := randPeerID(t), randPeerID(t)
+	ctxid1 := []byte("ctxid1")
+	ctxid2 := []byte("ctxid2")
+
+	valueStore := memory.New()
+	value1 := indexer.Value{ProviderID: providerID1, ContextID: ctxid1, MetadataBytes: []byte("md")}
+	value2 := indexer.Value{ProviderID: providerID1, ContextID: ctxid2, MetadataBytes: []byte("md")}
+	require.NoError(t, valueStore.Put(value1, test.RandomMultihashes(5)...))
+	require.NoError(t, valueStore.Put(value2, test.RandomMultihashes(3)...))
+
+	c := counter.NewIndexCounts(datastore.NewMapDatastore())
+	c.AddCount(providerID1, ctxid1, 5)
+	c.AddCount(providerID1, ctxid2, 4)
+	c.AddCount(providerID2, ctxid1, 7)
+
+	total, err := c.Total()
+	require.NoError(t, err)
+	require.Equal(t, 16, int(total))
+
+	source := counter.ValueStoreSource(valueStore)
+
+	// Report without rewriting.
+	report, err := c.Reconcile(ctx, source, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Providers)
+	require.Equal(t, 3, report.Contexts)
+	require.Equal(t, 2, report.Discrepancies)
+	require.Len(t, report.ProviderDiscrepancies, 2)
+	require.Zero(t, report.Rewritten)
+
+	count, err := c.Provider(providerID1)
+	require.NoError(t, err)
+	require.Equal(t, 9, int(count))
+
+	// Rewrite counts.
+	report, err = c.Reconcile(ctx, source, true)
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Discrepancies)
+	require.Equal(t, 2, report.Rewritten)
+	require.Zero(t, report.Changed)
+
+	count, err = c.Provider(providerID1)
+	require.NoError(t, err)
+	require.Equal(t, 8, int(count))
+	count, err = c.Provider(providerID2)
+	require.NoError(t, err)
+	require.Zero(t, count)
+	total, err = c.Total()
+	require.NoError(t, err)
+	require.Equal(t, 8, int(total))
+
+	// Counts now agree.
+	report, err = c.Reconcile(ctx, source, true)
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Providers)
+	require.Zero(t, report.Discrepancies)
+	require.Zero(t, report.Rewritten)
+}
+
+func TestReconcileChanged(t *testing.T) {
+	ctx := context.Background()
+	providerID := randPeerID(t)
+	ctxid := []byte("ctxid")
+
+	c := counter.NewIndexCounts(datastore.NewMapDatastore())
+	c.AddCount(providerID, ctxid, 5)
+
+	// Simulate ingestion while the source is counted.
+	source := func(context.Context) (*counter.Counts, error) {
+		c.AddCount(providerID, ctxid, 2)
+		counts := counter.NewCounts(false)
+		counts.Add(providerID, ctxid, 3)
+		return counts, nil
+	}
+	report, err := c.Reconcile(ctx, source, true)
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Discrepancies)
+	require.Zero(t, report.Rewritten)
+	require.Equal(t, 1, report.Changed)
+
+	count, err := c.Provider(providerID)
+	require.NoError(t, err)
+	require.Equal(t, 7, int(count))
+}
+
+func TestReconcileMirror(t *testing.T) {
+	ctx := context.Background()
+	dstore := datastore.NewMapDatastore()
+	lsys := mkLinkSystem(dstore)
+
+	providerPriv, _, err := p2ptest.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	providerID, err := peer.IDFromPrivateKey(providerPriv)
+	require.NoError(t, err)
+
+	// Chain of three ads, each with 20 multihashes, followed by an ad that
+	// removes the first context ID.
+	adBuilder := typehelpers.RandomAdBuilder{
+		EntryBuilders: []typehelpers.EntryBuilder{
+			typehelpers.RandomEntryChunkBuilder{ChunkCount: 2, EntriesPerChunk: 10},
+			typehelpers.RandomEntryChunkBuilder{ChunkCount: 2, EntriesPerChunk: 10},
+			typehelpers.RandomEntryChunkBuilder{ChunkCount: 2, EntriesPerChunk: 10},
+		},
+		AddRmWithNoEntries: true,
+	}
+	headCid := adBuilder.Build(t, lsys, providerPriv).(cidlink.Link).Cid
+
+	fileStore, err := filestore.NewLocal(t.TempDir())
+	require.NoError(t, err)
+	carw, err := carstore.NewWriter(dstore, fileStore)
+	require.NoError(t, err)
+	_, err = carw.WriteChain(ctx, headCid, false)
+	require.NoError(t, err)
+	carr, err := carstore.NewReader(fileStore)
+	require.NoError(t, err)
+
+	c := counter.NewIndexCounts(datastore.NewMapDatastore())
+	c.AddCount(providerID, []byte("test-context-id-0"), 20)
+	c.AddCount(providerID, []byte("test-context-id-1"), 20)
+	c.AddCount(providerID, []byte("test-context-id-2"), 15)
+	// Provider that is not in the mirror is not reconciled.
+	otherID := randPeerID(t)
+	c.AddCount(otherID, []byte("ctxid"), 9)
+
+	publisherID := randPeerID(t)
+	source := counter.MirrorSource(carr, map[peer.ID]cid.Cid{publisherID: headCid})
+	report, err := c.Reconcile(ctx, source, true)
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Providers)
+	require.Equal(t, 3, report.Contexts)
+	require.Equal(t, 2, report.Discrepancies)
+	require.Equal(t, 2, report.Rewritten)
+	require.Equal(t, []counter.ProviderDiscrepancy{{
+		ProviderID: providerID,
+		Stored:     55,
+		Actual:     40,
+		Contexts:   2,
+	}}, report.ProviderDiscrepancies)
+
+	count, err := c.Provider(providerID)
+	require.NoError(t, err)
+	require.Equal(t, 40, int(count))
+	count, err = c.Provider(otherID)
+	require.NoError(t, err)
+	require.Equal(t, 9, int(count))
+
+	// Counts for a provider with missing advertisements are incomplete.
+	adBlock, err := carr.Read(ctx, headCid, true)
+	require.NoError(t, err)
+	ad, err := adBlock.Advertisement()
+	require.NoError(t, err)
+	prevCid := ad.PreviousID.(cidlink.Link).Cid
+	require.NoError(t, fileStore.Delete(ctx, prevCid.String()+carstore.CarFileSuffix))
+	report, err = c.Reconcile(ctx, source, true)
+	require.NoError(t, err)
+	require.Zero(t, report.Providers)
+	require.Equal(t, []peer.ID{providerID}, report.Skipped)
+}
+
+func randPeerID(t *testing.T) peer.ID {
+	priv, _, err := p2ptest.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	peerID, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	return peerID
+}
+
+func mkLinkSystem(ds datastore.Datastore) ipld.LinkSystem {
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = func(lctx ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
+		c := lnk.(cidlink.Link).Cid
+		val, err := ds.Get(lctx.Ctx, datastore.NewKey(c.String()))
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewBuffer(val), nil
+	}
+	lsys.StorageWriteOpener = func(lctx ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+		buf := bytes.NewBuffer(nil)
+		return buf, func(lnk ipld.Link) error {
+			c := lnk.(cidlink.Link).Cid
+			return ds.Put(lctx.Ctx, datastore.NewKey(c.String()), buf.Bytes())
+		}, nil
+	}
+	return lsys
+}
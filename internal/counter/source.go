@@ -0,0 +1,156 @@
+package counter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipni/go-indexer-core"
+	"github.com/ipni/go-libipni/ingest/schema"
+	"github.com/ipni/storetheindex/carstore"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ValueStoreSource returns a Source that counts multihashes by iterating all
+// indexes in the value store. This counts each multihash once for each
+// provider context ID that it is indexed by.
+func ValueStoreSource(valueStore indexer.Interface) Source {
+	return func(ctx context.Context) (*Counts, error) {
+		iter, err := valueStore.Iter()
+		if err != nil {
+			return nil, fmt.Errorf("cannot iterate value store: %w", err)
+		}
+		defer iter.Close()
+
+		counts := NewCounts(false)
+		for {
+			_, values, err := iter.Next()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, fmt.Errorf("cannot read from value store: %w", err)
+			}
+			for _, value := range values {
+				counts.Add(value.ProviderID, value.ContextID, 1)
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		}
+		return counts, nil
+	}
+}
+
+// MirrorSource returns a Source that counts multihashes by reading
+// advertisement chains from the CAR mirror, starting at the head
+// advertisement of each publisher. Entries of advertisements for context IDs
+// that are later removed are not counted.
+//
+// The counts of a provider are incomplete if any of its advertisements, or
+// their entries, are not in the mirror or cannot be read. Providers that do
+// not appear in any mirrored advertisement are not reconciled.
+func MirrorSource(carReader *carstore.CarReader, heads map[peer.ID]cid.Cid) Source {
+	return func(ctx context.Context) (*Counts, error) {
+		counts := NewCounts(true)
+		for publisher, head := range heads {
+			if err := countMirrorChain(ctx, carReader, head, counts); err != nil {
+				return nil, fmt.Errorf("cannot count advertisements from publisher %s: %w", publisher, err)
+			}
+		}
+		return counts, nil
+	}
+}
+
+func countMirrorChain(ctx context.Context, carReader *carstore.CarReader, adCid cid.Cid, counts *Counts) error {
+	// Context IDs removed by advertisements later in the chain, keyed by
+	// index count key.
+	removed := make(map[string]struct{})
+	// Providers seen so far, which are incomplete if the chain is broken.
+	seen := make(map[peer.ID]struct{})
+
+	for adCid != cid.Undef {
+		adBlock, err := carReader.Read(ctx, adCid, false)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warnw("Cannot read advertisement from mirror, counts incomplete", "err", err, "adCid", adCid)
+			for providerID := range seen {
+				counts.SetIncomplete(providerID)
+			}
+			return nil
+		}
+		ad, err := adBlock.Advertisement()
+		if err != nil {
+			drainEntries(adBlock.Entries)
+			return fmt.Errorf("cannot decode advertisement %s: %w", adCid, err)
+		}
+		adCid = cid.Undef
+		if ad.PreviousID != nil {
+			if prev, ok := ad.PreviousID.(cidlink.Link); ok {
+				adCid = prev.Cid
+			}
+		}
+
+		providerID, err := peer.Decode(ad.Provider)
+		if err != nil {
+			drainEntries(adBlock.Entries)
+			log.Warnw("Skipping advertisement with bad provider ID", "err", err, "adCid", adBlock.Cid)
+			continue
+		}
+		seen[providerID] = struct{}{}
+
+		key := makeIndexCountKey(providerID, ad.ContextID).String()
+		if ad.IsRm {
+			removed[key] = struct{}{}
+			drainEntries(adBlock.Entries)
+			continue
+		}
+		if _, ok := removed[key]; ok || ad.Entries == schema.NoEntries {
+			drainEntries(adBlock.Entries)
+			continue
+		}
+		if adBlock.Entries == nil {
+			// Mirror does not have the entries.
+			counts.SetIncomplete(providerID)
+			continue
+		}
+
+		var mhCount uint64
+		for entBlock := range adBlock.Entries {
+			if entBlock.Err != nil {
+				err = entBlock.Err
+				break
+			}
+			var chunk *schema.EntryChunk
+			chunk, err = entBlock.EntryChunk()
+			if err != nil {
+				break
+			}
+			mhCount += uint64(len(chunk.Entries))
+		}
+		if err != nil {
+			drainEntries(adBlock.Entries)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warnw("Cannot read advertisement entries from mirror, counts incomplete", "err", err, "adCid", adBlock.Cid)
+			counts.SetIncomplete(providerID)
+			continue
+		}
+		counts.Add(providerID, ad.ContextID, mhCount)
+	}
+	return nil
+}
+
+func drainEntries(entries <-chan carstore.EntryBlock) {
+	if entries == nil {
+		return
+	}
+	for range entries {
+	}
+}
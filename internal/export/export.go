@@ -0,0 +1,233 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	car "github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/storage"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipni/go-libipni/ingest/schema"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+)
+
+var log = logging.Logger("indexer/export")
+
+// DefaultChunkSize is the default maximum number of multihashes in each
+// exported entries chunk.
+const DefaultChunkSize = 16384
+
+// Result describes an exported advertisement chain.
+type Result struct {
+	// Head is the CID of the latest advertisement in the chain, and the root
+	// of the CAR file.
+	Head cid.Cid
+	// Ads is the number of advertisements in the chain.
+	Ads int
+	// Multihashes is the number of multihashes in all entries chunks.
+	Multihashes int
+	// Publisher is the peer ID of the key that signed the advertisements.
+	Publisher peer.ID
+}
+
+// contextEntries holds the entries of a context ID that are not yet written
+// in a chunk.
+type contextEntries struct {
+	metadata []byte
+	mhs      []multihash.Multihash
+	next     ipld.Link
+	count    int
+}
+
+// Writer writes a new advertisement chain for a provider into a CAR file. The
+// multihashes of each context ID are written into a chain of entries chunks as
+// they are added, so that only a partial chunk per context ID is held in
+// memory. When finished, one advertisement is written for each context ID that
+// has multihashes, and the CAR file root is set to the head of the chain.
+type Writer struct {
+	carFile    *os.File
+	carStore   storage.WritableCar
+	chunkSize  int
+	contexts   map[string]*contextEntries
+	lsys       ipld.LinkSystem
+	providerID peer.ID
+}
+
+// NewWriter creates a Writer that writes the advertisement chain for the
+// provider into a new CAR file at carPath.
+func NewWriter(carPath string, providerID peer.ID, chunkSize int) (*Writer, error) {
+	if chunkSize < 1 {
+		return nil, errors.New("entries chunk size must be at least 1")
+	}
+	carFile, err := os.Create(carPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create car file: %w", err)
+	}
+
+	// The head advertisement is not known until all entries are written, so
+	// use a placeholder root of the same size that is replaced when finished.
+	placeholder, err := schema.Linkproto.Prefix.Sum(nil)
+	if err != nil {
+		carFile.Close()
+		return nil, err
+	}
+	carStore, err := storage.NewWritable(carFile, []cid.Cid{placeholder}, car.WriteAsCarV1(true))
+	if err != nil {
+		carFile.Close()
+		return nil, fmt.Errorf("cannot open writable car storage: %w", err)
+	}
+
+	w := &Writer{
+		carFile:    carFile,
+		carStore:   carStore,
+		chunkSize:  chunkSize,
+		contexts:   make(map[string]*contextEntries),
+		providerID: providerID,
+	}
+	w.lsys = cidlink.DefaultLinkSystem()
+	w.lsys.StorageWriteOpener = func(lctx ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+		buf := bytes.NewBuffer(nil)
+		return buf, func(lnk ipld.Link) error {
+			return w.carStore.Put(lctx.Ctx, lnk.(cidlink.Link).Cid.KeyString(), buf.Bytes())
+		}, nil
+	}
+	return w, nil
+}
+
+// Add adds multihashes to the entries of the context ID. The metadata of a
+// context ID is set by the first call to Add for that context ID.
+func (w *Writer) Add(ctx context.Context, contextID, metadata []byte, mhs ...multihash.Multihash) error {
+	ce, ok := w.contexts[string(contextID)]
+	if !ok {
+		ce = &contextEntries{
+			metadata: metadata,
+		}
+		w.contexts[string(contextID)] = ce
+	}
+	for _, mh := range mhs {
+		ce.mhs = append(ce.mhs, mh)
+		ce.count++
+		if len(ce.mhs) == w.chunkSize {
+			if err := w.storeChunk(ctx, ce); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Count returns the number of multihashes added for the context ID.
+func (w *Writer) Count(contextID []byte) int {
+	ce, ok := w.contexts[string(contextID)]
+	if !ok {
+		return 0
+	}
+	return ce.count
+}
+
+// Finish writes an advertisement for each context ID that has multihashes,
+// signed with key, and sets the root of the CAR file to the head
+// advertisement. The Writer must be closed after calling Finish.
+//
+// The advertisements do not have ExtendedProviders, so if key is not the
+// provider's key then the signer must be allowed by policy to publish for the
+// provider.
+func (w *Writer) Finish(ctx context.Context, addrs []string, key crypto.PrivKey) (*Result, error) {
+	publisher, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get peer id from private key: %w", err)
+	}
+	result := &Result{
+		Publisher: publisher,
+	}
+
+	contextIDs := make([]string, 0, len(w.contexts))
+	for contextID, ce := range w.contexts {
+		if ce.count == 0 {
+			log.Warnw("Not exporting context ID without multihashes", "contextID", []byte(contextID))
+			continue
+		}
+		contextIDs = append(contextIDs, contextID)
+	}
+	sort.Strings(contextIDs)
+
+	var prev ipld.Link
+	for _, contextID := range contextIDs {
+		ce := w.contexts[contextID]
+		if len(ce.mhs) != 0 {
+			if err = w.storeChunk(ctx, ce); err != nil {
+				return nil, err
+			}
+		}
+		ad := schema.Advertisement{
+			PreviousID: prev,
+			Provider:   w.providerID.String(),
+			Addresses:  addrs,
+			Entries:    ce.next,
+			ContextID:  []byte(contextID),
+			Metadata:   ce.metadata,
+		}
+		if err = ad.Sign(key); err != nil {
+			return nil, fmt.Errorf("cannot sign advertisement: %w", err)
+		}
+		if err = ad.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid advertisement: %w", err)
+		}
+		node, err := ad.ToNode()
+		if err != nil {
+			return nil, err
+		}
+		prev, err = w.lsys.Store(ipld.LinkContext{Ctx: ctx}, schema.Linkproto, node)
+		if err != nil {
+			return nil, fmt.Errorf("cannot store advertisement: %w", err)
+		}
+		result.Ads++
+		result.Multihashes += ce.count
+	}
+	if prev == nil {
+		return nil, errors.New("no multihashes to export")
+	}
+
+	if err = w.carStore.Finalize(); err != nil {
+		return nil, fmt.Errorf("cannot finalize car file: %w", err)
+	}
+	result.Head = prev.(cidlink.Link).Cid
+	if err = car.ReplaceRootsInFile(w.carFile.Name(), []cid.Cid{result.Head}); err != nil {
+		return nil, fmt.Errorf("cannot set car file root: %w", err)
+	}
+	return result, nil
+}
+
+// Close closes the CAR file.
+func (w *Writer) Close() error {
+	return w.carFile.Close()
+}
+
+// storeChunk writes the pending multihashes of the context ID as an entries
+// chunk linked to the previously written chunk.
+func (w *Writer) storeChunk(ctx context.Context, ce *contextEntries) error {
+	chunk := schema.EntryChunk{
+		Entries: ce.mhs,
+		Next:    ce.next,
+	}
+	node, err := chunk.ToNode()
+	if err != nil {
+		return err
+	}
+	ce.next, err = w.lsys.Store(ipld.LinkContext{Ctx: ctx}, schema.Linkproto, node)
+	if err != nil {
+		return fmt.Errorf("cannot store entries chunk: %w", err)
+	}
+	ce.mhs = nil
+	return nil
+}
@@ -0,0 +1,189 @@
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-car/v2/storage"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipni/go-libipni/ingest/schema"
+	"github.com/ipni/go-libipni/test"
+	"github.com/ipni/storetheindex/carstore"
+	"github.com/ipni/storetheindex/filestore"
+	"github.com/ipni/storetheindex/internal/export"
+	"github.com/ipni/storetheindex/test/typehelpers"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter(t *testing.T) {
+	ctx := context.Background()
+	providerID, _, _ := test.RandomIdentity()
+	publisherID, publisherPriv, _ := test.RandomIdentity()
+	carPath := filepath.Join(t.TempDir(), "export.car")
+
+	w, err := export.NewWriter(carPath, providerID, 3)
+	require.NoError(t, err)
+	defer w.Close()
+
+	mhs1 := test.RandomMultihashes(7)
+	mhs2 := test.RandomMultihashes(2)
+	require.NoError(t, w.Add(ctx, []byte("ctx1"), []byte("meta1"), mhs1[:4]...))
+	require.NoError(t, w.Add(ctx, []byte("ctx2"), []byte("meta2"), mhs2...))
+	// Metadata is set by the first call for a context ID.
+	require.NoError(t, w.Add(ctx, []byte("ctx1"), []byte("other"), mhs1[4:]...))
+	// Context ID without multihashes is not exported.
+	require.NoError(t, w.Add(ctx, []byte("ctx3"), []byte("meta3")))
+
+	addrs := []string{"/ip4/127.0.0.1/tcp/9999"}
+	result, err := w.Finish(ctx, addrs, publisherPriv)
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Ads)
+	require.Equal(t, 9, result.Multihashes)
+	require.Equal(t, publisherID, result.Publisher)
+	require.NoError(t, w.Close())
+
+	ads := readExport(t, carPath, result.Head)
+	require.Len(t, ads, 2)
+	for _, ad := range ads {
+		require.Equal(t, providerID.String(), ad.ad.Provider)
+		require.Equal(t, addrs, ad.ad.Addresses)
+		signerID, err := ad.ad.VerifySignature()
+		require.NoError(t, err)
+		require.Equal(t, publisherID, signerID)
+	}
+	// Newest first.
+	require.Equal(t, []byte("ctx2"), ads[0].ad.ContextID)
+	require.Equal(t, []byte("meta2"), ads[0].ad.Metadata)
+	require.ElementsMatch(t, mhs2, ads[0].mhs)
+	require.Equal(t, []byte("ctx1"), ads[1].ad.ContextID)
+	require.Equal(t, []byte("meta1"), ads[1].ad.Metadata)
+	require.ElementsMatch(t, mhs1, ads[1].mhs)
+}
+
+func TestWriterNoMultihashes(t *testing.T) {
+	providerID, providerPriv, _ := test.RandomIdentity()
+	w, err := export.NewWriter(filepath.Join(t.TempDir(), "export.car"), providerID, 3)
+	require.NoError(t, err)
+	defer w.Close()
+
+	_, err = w.Finish(context.Background(), nil, providerPriv)
+	require.ErrorContains(t, err, "no multihashes to export")
+}
+
+func TestFromMirror(t *testing.T) {
+	ctx := context.Background()
+	providerID, providerPriv, _ := test.RandomIdentity()
+
+	srcStore := datastore.NewMapDatastore()
+	headCid := typehelpers.BuildRemovalChain(t, mkLinkSystem(srcStore), providerPriv).(cidlink.Link).Cid
+
+	fileStore, err := filestore.NewLocal(t.TempDir())
+	require.NoError(t, err)
+	carWriter, err := carstore.NewWriter(srcStore, fileStore)
+	require.NoError(t, err)
+	_, err = carWriter.WriteChain(ctx, headCid, false)
+	require.NoError(t, err)
+	carReader, err := carstore.NewReader(fileStore)
+	require.NoError(t, err)
+
+	carPath := filepath.Join(t.TempDir(), "export.car")
+	w, err := export.NewWriter(carPath, providerID, 8)
+	require.NoError(t, err)
+	defer w.Close()
+
+	heads := map[peer.ID]cid.Cid{providerID: headCid}
+	addrs, err := export.FromMirror(ctx, carReader, heads, providerID, w)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/ip4/127.0.0.1/tcp/9999"}, addrs)
+
+	result, err := w.Finish(ctx, addrs, providerPriv)
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Ads)
+	require.Equal(t, 40, result.Multihashes)
+
+	ads := readExport(t, carPath, result.Head)
+	require.Len(t, ads, 2)
+	require.Equal(t, []byte("test-context-id-2"), ads[0].ad.ContextID)
+	require.Len(t, ads[0].mhs, 20)
+	require.Equal(t, []byte("test-context-id-1"), ads[1].ad.ContextID)
+	require.Len(t, ads[1].mhs, 20)
+
+	// Missing advertisement is an error.
+	heads[providerID] = test.RandomCids(1)[0]
+	_, err = export.FromMirror(ctx, carReader, heads, providerID, w)
+	require.Error(t, err)
+}
+
+type exportedAd struct {
+	ad  schema.Advertisement
+	mhs []multihash.Multihash
+}
+
+// readExport reads the advertisement chain and entries from the exported CAR
+// file, newest first.
+func readExport(t *testing.T, carPath string, head cid.Cid) []exportedAd {
+	f, err := os.Open(carPath)
+	require.NoError(t, err)
+	defer f.Close()
+	carStore, err := storage.OpenReadable(f)
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{head}, carStore.Roots())
+
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = func(lctx ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
+		data, err := carStore.Get(lctx.Ctx, lnk.(cidlink.Link).Cid.KeyString())
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	}
+
+	var ads []exportedAd
+	var next ipld.Link = cidlink.Link{Cid: head}
+	for next != nil {
+		node, err := lsys.Load(ipld.LinkContext{}, next, schema.AdvertisementPrototype)
+		require.NoError(t, err)
+		ad, err := schema.UnwrapAdvertisement(node)
+		require.NoError(t, err)
+		exported := exportedAd{ad: *ad}
+		for entLink := ad.Entries; entLink != nil; {
+			node, err = lsys.Load(ipld.LinkContext{}, entLink, schema.EntryChunkPrototype)
+			require.NoError(t, err)
+			chunk, err := schema.UnwrapEntryChunk(node)
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(chunk.Entries), 8)
+			exported.mhs = append(exported.mhs, chunk.Entries...)
+			entLink = chunk.Next
+		}
+		ads = append(ads, exported)
+		next = ad.PreviousID
+	}
+	return ads
+}
+
+func mkLinkSystem(ds datastore.Datastore) ipld.LinkSystem {
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = func(lctx ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
+		val, err := ds.Get(lctx.Ctx, datastore.NewKey(lnk.(cidlink.Link).Cid.String()))
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewBuffer(val), nil
+	}
+	lsys.StorageWriteOpener = func(lctx ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+		buf := bytes.NewBuffer(nil)
+		return buf, func(lnk ipld.Link) error {
+			return ds.Put(lctx.Ctx, datastore.NewKey(lnk.(cidlink.Link).Cid.String()), buf.Bytes())
+		}, nil
+	}
+	return lsys
+}
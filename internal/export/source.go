@@ -0,0 +1,147 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipni/go-indexer-core"
+	"github.com/ipni/go-libipni/ingest/schema"
+	"github.com/ipni/storetheindex/carstore"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// FromValueStore adds the provider's indexes to the Writer by iterating all
+// indexes in the value store.
+func FromValueStore(ctx context.Context, valueStore indexer.Interface, providerID peer.ID, w *Writer) error {
+	iter, err := valueStore.Iter()
+	if err != nil {
+		return fmt.Errorf("cannot iterate value store: %w", err)
+	}
+	defer iter.Close()
+
+	for {
+		mh, values, err := iter.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("cannot read from value store: %w", err)
+		}
+		for _, value := range values {
+			if value.ProviderID != providerID {
+				continue
+			}
+			if err = w.Add(ctx, value.ContextID, value.MetadataBytes, mh); err != nil {
+				return err
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// FromMirror adds the provider's indexes to the Writer by reading the
+// advertisement chains from the CAR mirror, starting at the head
+// advertisement of each publisher. Entries of advertisements for context IDs
+// that are later removed are not added. The metadata of each context ID is
+// that of its latest advertisement.
+//
+// Returns the addresses from the provider's latest advertisement in the
+// mirror. Returns an error if any advertisement in a chain, or the entries of
+// any of the provider's advertisements, cannot be read from the mirror.
+func FromMirror(ctx context.Context, carReader *carstore.CarReader, heads map[peer.ID]cid.Cid, providerID peer.ID, w *Writer) ([]string, error) {
+	var addrs []string
+	for publisher, head := range heads {
+		pubAddrs, err := addMirrorChain(ctx, carReader, head, providerID, w)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read advertisements from publisher %s: %w", publisher, err)
+		}
+		if addrs == nil {
+			addrs = pubAddrs
+		}
+	}
+	return addrs, nil
+}
+
+func addMirrorChain(ctx context.Context, carReader *carstore.CarReader, adCid cid.Cid, providerID peer.ID, w *Writer) ([]string, error) {
+	// Context IDs removed by advertisements later in the chain.
+	removed := make(map[string]struct{})
+	var addrs []string
+
+	for adCid != cid.Undef {
+		adBlock, err := carReader.Read(ctx, adCid, false)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read advertisement %s from mirror: %w", adCid, err)
+		}
+		ad, err := adBlock.Advertisement()
+		if err != nil {
+			drainEntries(adBlock.Entries)
+			return nil, fmt.Errorf("cannot decode advertisement %s: %w", adCid, err)
+		}
+		adCid = cid.Undef
+		if ad.PreviousID != nil {
+			adCid = ad.PreviousID.(cidlink.Link).Cid
+		}
+
+		if ad.Provider != providerID.String() {
+			drainEntries(adBlock.Entries)
+			continue
+		}
+		if addrs == nil {
+			addrs = ad.Addresses
+		}
+		if ad.IsRm {
+			removed[string(ad.ContextID)] = struct{}{}
+			drainEntries(adBlock.Entries)
+			continue
+		}
+		if _, ok := removed[string(ad.ContextID)]; ok || len(ad.Metadata) == 0 {
+			drainEntries(adBlock.Entries)
+			continue
+		}
+		if ad.Entries == schema.NoEntries {
+			// Metadata update only.
+			if err = w.Add(ctx, ad.ContextID, ad.Metadata); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if adBlock.Entries == nil {
+			return nil, fmt.Errorf("mirror does not have entries for advertisement %s", adBlock.Cid)
+		}
+
+		for entBlock := range adBlock.Entries {
+			if entBlock.Err != nil {
+				err = entBlock.Err
+				break
+			}
+			var chunk *schema.EntryChunk
+			chunk, err = entBlock.EntryChunk()
+			if err != nil {
+				break
+			}
+			if err = w.Add(ctx, ad.ContextID, ad.Metadata, chunk.Entries...); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			drainEntries(adBlock.Entries)
+			return nil, fmt.Errorf("cannot read entries of advertisement %s: %w", adBlock.Cid, err)
+		}
+	}
+	return addrs, nil
+}
+
+func drainEntries(entries <-chan carstore.EntryBlock) {
+	if entries == nil {
+		return
+	}
+	for range entries {
+	}
+}
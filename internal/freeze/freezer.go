@@ -2,17 +2,25 @@ package freeze
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ipfs/go-datastore"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipni/storetheindex/fsutil/disk"
+	"go.uber.org/zap"
 )
 
 var log = logging.Logger("indexer/freezer")
 
+// ErrUsageTooHigh is returned when trying to unfreeze while disk usage is at
+// or above the freeze-at point.
+var ErrUsageTooHigh = errors.New("disk usage at or above freeze-at point")
+
 const (
 	frozenKey = "/freeze/frozen"
 
@@ -40,21 +48,41 @@ type Freezer struct {
 	trigger     chan struct{}
 	triggerErr  chan error
 	paths       []string
+
+	// mutex protects the channels that are replaced when unfreezing.
+	mutex sync.RWMutex
+
+	// level is the current disk pressure level.
+	level          atomic.Int32
+	pressureFunc   func(int)
+	pressureLevels []float64
 }
 
 // New creates a new Freezer that checks the usage of the file system at dirPath.
-func New(dirPaths []string, freezeAtPercent float64, dstore datastore.Datastore, freezeFunc func() error) (*Freezer, error) {
-	dirPaths, err := uniqFsDirs(dirPaths)
+func New(dirPaths []string, freezeAtPercent float64, dstore datastore.Datastore, freezeFunc func() error, options ...Option) (*Freezer, error) {
+	opts, err := getOpts(options)
+	if err != nil {
+		return nil, err
+	}
+	for _, pct := range opts.pressureLevels {
+		if pct >= freezeAtPercent {
+			return nil, fmt.Errorf("disk pressure level %f%% is not below freeze-at point %f%%", pct, freezeAtPercent)
+		}
+	}
+
+	dirPaths, err = uniqFsDirs(dirPaths)
 	if err != nil {
 		return nil, err
 	}
 	f := &Freezer{
-		dstore:      dstore,
-		freezeAt:    freezeAtPercent,
-		freezeAtStr: fmt.Sprintf("%s%%", strconv.FormatFloat(freezeAtPercent, 'f', -1, 64)),
-		freezeFunc:  freezeFunc,
-		frozen:      make(chan struct{}),
-		paths:       dirPaths,
+		dstore:         dstore,
+		freezeAt:       freezeAtPercent,
+		freezeAtStr:    fmt.Sprintf("%s%%", strconv.FormatFloat(freezeAtPercent, 'f', -1, 64)),
+		freezeFunc:     freezeFunc,
+		frozen:         make(chan struct{}),
+		paths:          dirPaths,
+		pressureFunc:   opts.pressureFunc,
+		pressureLevels: opts.pressureLevels,
 	}
 	frozen, err := f.loadFrozenState()
 	if err != nil {
@@ -72,12 +100,7 @@ func New(dirPaths []string, freezeAtPercent float64, dstore datastore.Datastore,
 		return nil, err
 	}
 	if !frozen {
-		// Start disk usage monitor.
-		f.checkNow = make(chan chan struct{})
-		f.done = make(chan struct{})
-		f.trigger = make(chan struct{})
-		f.triggerErr = make(chan error)
-		go f.run(nextCheck)
+		f.startMonitor(nextCheck)
 	}
 
 	return f, nil
@@ -85,18 +108,26 @@ func New(dirPaths []string, freezeAtPercent float64, dstore datastore.Datastore,
 
 // Freeze manually triggers the indexer to enter frozen mode.
 func (f *Freezer) Freeze() error {
+	f.mutex.RLock()
+	trigger, triggerErr, frozen := f.trigger, f.triggerErr, f.frozen
+	f.mutex.RUnlock()
+
 	select {
-	case f.trigger <- struct{}{}:
-		return <-f.triggerErr
-	case <-f.frozen:
+	case trigger <- struct{}{}:
+		return <-triggerErr
+	case <-frozen:
 	}
 	return nil
 }
 
 // Frozen returns true if indexer is frozen.
 func (f *Freezer) Frozen() bool {
+	f.mutex.RLock()
+	frozen := f.frozen
+	f.mutex.RUnlock()
+
 	select {
-	case <-f.frozen:
+	case <-frozen:
 		return true
 	default:
 	}
@@ -105,22 +136,79 @@ func (f *Freezer) Frozen() bool {
 
 // CheckNow triggers an immediate disk usage check.
 func (f *Freezer) CheckNow() bool {
-	if f.Frozen() {
+	f.mutex.RLock()
+	checkNow, frozen := f.checkNow, f.frozen
+	f.mutex.RUnlock()
+
+	select {
+	case <-frozen:
 		return true
+	default:
 	}
 	checkDone := make(chan struct{})
 	select {
-	case f.checkNow <- checkDone:
+	case checkNow <- checkDone:
 		<-checkDone
 		return false
-	case <-f.frozen:
+	case <-frozen:
 	}
 	return true
 }
 
+// Unfreeze takes the Freezer out of frozen mode and restarts disk usage
+// monitoring. This fails if disk usage is still at or above the freeze-at
+// point. Nothing is done if the Freezer is not frozen.
+func (f *Freezer) Unfreeze(ctx context.Context) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	select {
+	case <-f.frozen:
+	default:
+		return nil
+	}
+
+	if err := checkUnfreezeUsage(f.paths, f.freezeAt); err != nil {
+		return err
+	}
+
+	// Wait for the previous monitor to exit, if it was running when frozen.
+	if f.done != nil {
+		<-f.done
+	}
+
+	if f.dstore != nil {
+		dsKey := datastore.NewKey(frozenKey)
+		if err := f.dstore.Delete(ctx, dsKey); err != nil {
+			return err
+		}
+		if err := f.dstore.Sync(ctx, dsKey); err != nil {
+			return err
+		}
+	}
+
+	f.frozen = make(chan struct{})
+	// Check disk usage immediately to update the pressure level.
+	f.startMonitor(0)
+	log.Warn("Indexer unfrozen")
+	return nil
+}
+
+// Level returns the current disk pressure level. Level 0 means that disk
+// usage is below all configured pressure levels.
+func (f *Freezer) Level() int {
+	return int(f.level.Load())
+}
+
 // Close stops the goroutine that checks disk usage.
 func (f *Freezer) Close() {
-	if f == nil || f.checkNow == nil {
+	if f == nil {
+		return
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.checkNow == nil {
 		return
 	}
 	close(f.checkNow)
@@ -165,21 +253,68 @@ func Unfreeze(ctx context.Context, dirPaths []string, freezeAtPercent float64, d
 		return nil
 	}
 
+	if err = checkUnfreezeUsage(dirPaths, freezeAtPercent); err != nil {
+		return err
+	}
+
+	dsKey := datastore.NewKey(frozenKey)
+	if err = dstore.Delete(ctx, dsKey); err != nil {
+		return err
+	}
+	return dstore.Sync(ctx, dsKey)
+}
+
+// FrozenTime returns the time that the indexer became frozen, as recorded in
+// the datastore. Returns false if the indexer is not frozen.
+func FrozenTime(ctx context.Context, dstore datastore.Datastore) (time.Time, bool, error) {
+	value, err := dstore.Get(ctx, datastore.NewKey(frozenKey))
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, err
+	}
+	frozenAt, err := time.Parse(time.RFC3339, string(value))
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("cannot parse frozen time: %w", err)
+	}
+	return frozenAt, true, nil
+}
+
+// SetFrozenTime records in the datastore that the indexer became frozen at
+// the specified time. This must only be called when there is no Freezer
+// running.
+func SetFrozenTime(ctx context.Context, dstore datastore.Datastore, frozenAt time.Time) error {
+	dsKey := datastore.NewKey(frozenKey)
+	if err := dstore.Put(ctx, dsKey, []byte(frozenAt.Format(time.RFC3339))); err != nil {
+		return err
+	}
+	return dstore.Sync(ctx, dsKey)
+}
+
+// checkUnfreezeUsage returns an error if the usage of any of the directories
+// is at or above the freeze-at point.
+func checkUnfreezeUsage(dirPaths []string, freezeAtPercent float64) error {
 	for _, dirPath := range dirPaths {
 		du, err := disk.Usage(dirPath)
 		if err != nil {
 			return fmt.Errorf("cannot get disk usage for freeze check at path %q: %w", dirPath, err)
 		}
 		if du.Percent >= freezeAtPercent {
-			return fmt.Errorf("cannot unfreeze: disk usage above %f", freezeAtPercent)
+			return fmt.Errorf("cannot unfreeze: %w %s%%", ErrUsageTooHigh, strconv.FormatFloat(freezeAtPercent, 'f', -1, 64))
 		}
 	}
+	return nil
+}
 
-	dsKey := datastore.NewKey(frozenKey)
-	if err = dstore.Delete(ctx, dsKey); err != nil {
-		return err
-	}
-	return dstore.Sync(ctx, dsKey)
+// startMonitor starts the goroutine that monitors disk usage. The first check
+// is done after nextCheck.
+func (f *Freezer) startMonitor(nextCheck time.Duration) {
+	f.checkNow = make(chan chan struct{})
+	f.done = make(chan struct{})
+	f.trigger = make(chan struct{})
+	f.triggerErr = make(chan error)
+	go f.run(nextCheck)
 }
 
 // run periodically check file system usage and sets the frozen state if the
@@ -252,6 +387,8 @@ func (f *Freezer) check() (time.Duration, bool, error) {
 	}
 
 	log := log.With("usage", fmt.Sprintf("%.2f%%", mostUsed), "freezeAt", f.freezeAtStr)
+	f.setLevel(mostUsed, log)
+
 	if mostUsed >= f.freezeAt-logAlertRemaining {
 		if mostUsed >= f.freezeAt-logCriticalRemaining {
 			log.Warnw("Disk usage CRITICAL")
@@ -271,6 +408,27 @@ func (f *Freezer) check() (time.Duration, bool, error) {
 	return nextCheck, false, nil
 }
 
+// setLevel updates the disk pressure level for the disk usage percent, and
+// calls the pressure function if the level changed.
+func (f *Freezer) setLevel(usage float64, log *zap.SugaredLogger) {
+	var level int
+	for level < len(f.pressureLevels) && usage >= f.pressureLevels[level] {
+		level++
+	}
+	prevLevel := int(f.level.Swap(int32(level)))
+	if level == prevLevel {
+		return
+	}
+	if level > prevLevel {
+		log.Warnw("Disk pressure level increased", "level", level)
+	} else {
+		log.Infow("Disk pressure level decreased", "level", level)
+	}
+	if f.pressureFunc != nil {
+		f.pressureFunc(level)
+	}
+}
+
 func (f *Freezer) freeze() error {
 	if f.freezeFunc != nil {
 		if err := f.freezeFunc(); err != nil {
@@ -123,3 +123,69 @@ func TestManualFreeze(t *testing.T) {
 
 	require.Equal(t, 1, freezeCount)
 }
+
+func TestPressureLevels(t *testing.T) {
+	tempDir := t.TempDir()
+
+	du, err := disk.Usage(tempDir)
+	require.NoError(t, err)
+
+	var levels []int
+	pressureFunc := func(level int) {
+		levels = append(levels, level)
+	}
+
+	dirs := []string{tempDir}
+	_, err = freeze.New(dirs, du.Percent/2.0, nil, nil,
+		freeze.WithPressureLevels([]float64{du.Percent / 4.0, du.Percent / 2.0}, pressureFunc))
+	require.ErrorContains(t, err, "not below freeze-at point")
+
+	_, err = freeze.New(dirs, 101.0, nil, nil,
+		freeze.WithPressureLevels([]float64{50.0, 50.0}, pressureFunc))
+	require.ErrorContains(t, err, "duplicate")
+
+	f, err := freeze.New(dirs, 101.0, nil, nil,
+		freeze.WithPressureLevels([]float64{(du.Percent + 100.0) / 2.0, du.Percent / 2.0}, pressureFunc))
+	require.NoError(t, err)
+	require.False(t, f.Frozen())
+	require.Equal(t, 1, f.Level())
+	require.Equal(t, []int{1}, levels)
+
+	// Level does not change, so pressureFunc is not called again.
+	require.False(t, f.CheckNow())
+	require.Equal(t, []int{1}, levels)
+	f.Close()
+}
+
+func TestUnfreezeRunning(t *testing.T) {
+	tempDir := t.TempDir()
+
+	du, err := disk.Usage(tempDir)
+	require.NoError(t, err)
+
+	dstore := datastore.NewMapDatastore()
+	dirs := []string{tempDir}
+	f, err := freeze.New(dirs, du.Percent*2.0, dstore, nil)
+	require.NoError(t, err)
+	t.Cleanup(f.Close)
+
+	// Unfreeze when not frozen does nothing.
+	require.NoError(t, f.Unfreeze(context.Background()))
+
+	require.NoError(t, f.Freeze())
+	require.True(t, f.Frozen())
+	_, frozen, err := freeze.FrozenTime(context.Background(), dstore)
+	require.NoError(t, err)
+	require.True(t, frozen)
+
+	require.NoError(t, f.Unfreeze(context.Background()))
+	require.False(t, f.Frozen())
+	_, frozen, err = freeze.FrozenTime(context.Background(), dstore)
+	require.NoError(t, err)
+	require.False(t, frozen)
+
+	// Check that disk usage monitor is running again.
+	require.False(t, f.CheckNow())
+	require.NoError(t, f.Freeze())
+	require.True(t, f.Frozen())
+}
@@ -0,0 +1,50 @@
+package freeze
+
+import (
+	"fmt"
+	"sort"
+)
+
+// config contains all options for the Freezer.
+type config struct {
+	pressureFunc   func(int)
+	pressureLevels []float64
+}
+
+// Option is a function that sets a value in a config.
+type Option func(*config) error
+
+// getOpts creates a config and applies Options to it.
+func getOpts(opts []Option) (config, error) {
+	var cfg config
+	for i, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return config{}, fmt.Errorf("option %d error: %s", i, err)
+		}
+	}
+	return cfg, nil
+}
+
+// WithPressureLevels configures disk usage percentages, below the freeze-at
+// point, that are disk pressure levels. When disk usage reaches one of these
+// levels, the Freezer calls pressureFunc with the level number. Level numbers
+// start at 1 for the lowest percentage, and level 0 means there is no disk
+// pressure. The pressureFunc is also called when the level decreases.
+func WithPressureLevels(percents []float64, pressureFunc func(level int)) Option {
+	return func(c *config) error {
+		levels := make([]float64, len(percents))
+		copy(levels, percents)
+		sort.Float64s(levels)
+		for i, pct := range levels {
+			if pct <= 0 || pct > 100 {
+				return fmt.Errorf("invalid disk pressure level percent: %f", pct)
+			}
+			if i != 0 && pct == levels[i-1] {
+				return fmt.Errorf("duplicate disk pressure level percent: %f", pct)
+			}
+		}
+		c.pressureLevels = levels
+		c.pressureFunc = pressureFunc
+		return nil
+	}
+}
@@ -0,0 +1,298 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipni/go-libipni/dagsync"
+	"github.com/ipni/go-libipni/ingest/schema"
+	"github.com/ipni/storetheindex/carstore"
+	"github.com/ipni/storetheindex/config"
+	"github.com/ipni/storetheindex/filestore"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/time/rate"
+)
+
+// Backfiller writes advertisement mirror CAR files for advertisements that
+// were ingested before writing to the mirror was enabled. Advertisements and
+// entries are fetched again from the publisher, and written to the mirror
+// without being indexed.
+//
+// Advertisements that are already in the mirror are not fetched, so an
+// interrupted backfill is resumed by running it again.
+type Backfiller struct {
+	carReader  *carstore.CarReader
+	carWriter  *carstore.CarWriter
+	dstore     datastore.Batching
+	entriesSel ipld.Node
+	limiter    *rate.Limiter
+	lsys       ipld.LinkSystem
+	sub        *dagsync.Subscriber
+
+	// fetched is the keys of blocks fetched for the advertisement being
+	// backfilled.
+	fetched      []datastore.Key
+	fetchedMutex sync.Mutex
+}
+
+// BackfillStats describes the result of backfilling an advertisement chain.
+type BackfillStats struct {
+	// Written is the number of advertisement CAR files written.
+	Written int
+	// Existing is the number of advertisements already in the mirror.
+	Existing int
+	// HAMT is the number of advertisements not written because their entries
+	// are a HAMT.
+	HAMT int
+	// HeadWritten is true if the publisher's head file was written.
+	HeadWritten bool
+}
+
+type backfillResult int
+
+const (
+	backfillWritten backfillResult = iota + 1
+	backfillExisting
+	backfillHAMT
+)
+
+// NewBackfiller creates a Backfiller that writes to the advertisement mirror
+// configured in cfg. Advertisements are fetched using the host h, at no more
+// than adsPerSecond. A rate of zero means no limit.
+func NewBackfiller(h host.Host, cfg config.Ingest, adsPerSecond float64) (*Backfiller, error) {
+	cfgMirror := cfg.AdvertisementMirror
+	fileStore, err := filestore.New(cfgMirror.Storage, filestore.WithVerify(carstore.VerifyRoot))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create car file storage for mirror: %w", err)
+	}
+	if fileStore == nil {
+		return nil, errors.New("advertisement mirror storage not configured")
+	}
+	if fileStore.Type() == "http" {
+		return nil, errors.New("cannot write to read-only http mirror storage")
+	}
+
+	// Fetched data is only kept until it is written to a CAR file.
+	dstore := dssync.MutexWrap(datastore.NewMapDatastore())
+	carWriter, err := carstore.NewWriter(dstore, fileStore, carstore.WithCompress(cfgMirror.Compress))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create car file writer: %w", err)
+	}
+	carReader, err := carstore.NewReader(fileStore, carstore.WithCompress(cfgMirror.Compress))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create car file reader: %w", err)
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if adsPerSecond > 0 {
+		limiter = rate.NewLimiter(rate.Limit(adsPerSecond), 1)
+	}
+
+	b := &Backfiller{
+		carReader:  carReader,
+		carWriter:  carWriter,
+		dstore:     dstore,
+		entriesSel: Selectors.EntriesWithLimit(recursionLimit(cfg.EntriesDepthLimit)),
+		limiter:    limiter,
+	}
+	b.lsys = mkBackfillLinkSystem(dstore, b.addFetched)
+	b.sub, err = dagsync.NewSubscriber(h, dstore, b.lsys, cfg.PubSubTopic, nil,
+		// Only sync explicitly requested advertisements.
+		dagsync.AllowPeer(func(peer.ID) bool { return false }),
+		dagsync.WithMaxGraphsyncRequests(cfg.GsMaxInRequests, cfg.GsMaxOutRequests))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create subscriber: %w", err)
+	}
+	return b, nil
+}
+
+// Close stops the Backfiller from fetching advertisements.
+func (b *Backfiller) Close() error {
+	err := b.sub.Close()
+	if dsErr := b.dstore.Close(); err == nil {
+		err = dsErr
+	}
+	return err
+}
+
+// Backfill writes CAR files for each advertisement in the publisher's chain,
+// starting at headCid, that is not already in the mirror. If writeHead is
+// true, the head file for the publisher is written, after the chain is
+// backfilled, if the mirror does not have one. When backfilling several
+// chains of the same publisher, only the chain with the newest head should
+// write the head file.
+//
+// The returned stats describe the work done even if an error is returned.
+func (b *Backfiller) Backfill(ctx context.Context, pubInfo peer.AddrInfo, headCid cid.Cid, writeHead bool) (BackfillStats, error) {
+	log := log.With("publisher", pubInfo.ID)
+	var stats BackfillStats
+
+	// Context IDs removed by later advertisements. Entries are not needed for
+	// earlier advertisements with these context IDs.
+	rmCtxID := make(map[string]struct{})
+
+	for adCid := headCid; adCid != cid.Undef; {
+		ad, result, err := b.backfillAd(ctx, pubInfo, adCid, rmCtxID)
+		if err != nil {
+			return stats, fmt.Errorf("cannot backfill advertisement %s: %w", adCid, err)
+		}
+		switch result {
+		case backfillWritten:
+			stats.Written++
+		case backfillExisting:
+			stats.Existing++
+		case backfillHAMT:
+			stats.HAMT++
+		}
+
+		if ad.IsRm {
+			rmCtxID[string(ad.ContextID)] = struct{}{}
+		}
+		if ad.PreviousID == nil {
+			break
+		}
+		adCid = ad.PreviousID.(cidlink.Link).Cid
+	}
+
+	if !writeHead {
+		return stats, nil
+	}
+	_, err := b.carReader.ReadHead(ctx, pubInfo.ID)
+	if err == nil {
+		return stats, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return stats, fmt.Errorf("cannot read publisher head: %w", err)
+	}
+	if _, err = b.carWriter.WriteHead(ctx, headCid, pubInfo.ID); err != nil {
+		return stats, fmt.Errorf("cannot write publisher head: %w", err)
+	}
+	stats.HeadWritten = true
+	log.Infow("Wrote publisher head", "adCid", headCid)
+	return stats, nil
+}
+
+// backfillAd writes the CAR file for one advertisement, unless it is already
+// in the mirror, and returns the advertisement.
+func (b *Backfiller) backfillAd(ctx context.Context, pubInfo peer.AddrInfo, adCid cid.Cid, rmCtxID map[string]struct{}) (*schema.Advertisement, backfillResult, error) {
+	adBlock, err := b.carReader.Read(ctx, adCid, true)
+	if err == nil {
+		ad, err := adBlock.Advertisement()
+		if err != nil {
+			return nil, 0, fmt.Errorf("cannot decode mirrored advertisement: %w", err)
+		}
+		return &ad, backfillExisting, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, fmt.Errorf("cannot read mirror: %w", err)
+	}
+
+	// The CAR writer removes the blocks it writes to the CAR file. Remove
+	// any other fetched blocks, such as partially fetched entries or HAMTs.
+	defer b.deleteFetched(ctx)
+
+	ad, err := b.fetchAd(ctx, pubInfo, adCid)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	_, skipEntries := rmCtxID[string(ad.ContextID)]
+	if !skipEntries && ad.Entries != nil && ad.Entries != schema.NoEntries {
+		entriesCid := ad.Entries.(cidlink.Link).Cid
+		if _, err = b.sub.Sync(ctx, pubInfo, entriesCid, b.entriesSel); err != nil {
+			return nil, 0, fmt.Errorf("cannot fetch entries: %w", err)
+		}
+	}
+
+	carInfo, err := b.carWriter.Write(ctx, adCid, skipEntries, false)
+	if err != nil {
+		switch {
+		case errors.Is(err, fs.ErrExist):
+			// Written to mirror by the indexer since it was checked.
+			return ad, backfillExisting, nil
+		case errors.Is(err, carstore.ErrHAMT):
+			log.Warnw("Cannot backfill advertisement with HAMT entries", "adCid", adCid)
+			return ad, backfillHAMT, nil
+		}
+		return nil, 0, fmt.Errorf("cannot write car file: %w", err)
+	}
+	log.Infow("Wrote CAR for advertisement", "path", carInfo.Path, "size", carInfo.Size)
+	return ad, backfillWritten, nil
+}
+
+// fetchAd fetches a single advertisement from the publisher.
+func (b *Backfiller) fetchAd(ctx context.Context, pubInfo peer.AddrInfo, adCid cid.Cid) (*schema.Advertisement, error) {
+	if err := b.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := b.sub.Sync(ctx, pubInfo, adCid, Selectors.One); err != nil {
+		return nil, err
+	}
+	node, err := b.lsys.Load(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: adCid}, schema.AdvertisementPrototype)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load advertisement: %w", err)
+	}
+	return schema.UnwrapAdvertisement(node)
+}
+
+// deleteFetched removes all blocks fetched since the last call to
+// deleteFetched from the datastore of fetched data.
+func (b *Backfiller) deleteFetched(ctx context.Context) {
+	b.fetchedMutex.Lock()
+	fetched := b.fetched
+	b.fetched = nil
+	b.fetchedMutex.Unlock()
+
+	for _, key := range fetched {
+		if err := b.dstore.Delete(ctx, key); err != nil {
+			log.Errorw("Cannot remove fetched block from datastore", "err", err, "key", key)
+		}
+	}
+}
+
+// addFetched records the key of a block written to the datastore of fetched
+// data.
+func (b *Backfiller) addFetched(key datastore.Key) {
+	b.fetchedMutex.Lock()
+	b.fetched = append(b.fetched, key)
+	b.fetchedMutex.Unlock()
+}
+
+// mkBackfillLinkSystem creates a link system that stores blocks without
+// verifying them. The blocks are addressed by CID, so they are the same as
+// the blocks that were verified when first ingested. The key of each stored
+// block is passed to onPut.
+func mkBackfillLinkSystem(ds datastore.Batching, onPut func(datastore.Key)) ipld.LinkSystem {
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = func(lctx ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
+		c := lnk.(cidlink.Link).Cid
+		val, err := ds.Get(lctx.Ctx, datastore.NewKey(c.String()))
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewBuffer(val), nil
+	}
+	lsys.StorageWriteOpener = func(lctx ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+		buf := bytes.NewBuffer(nil)
+		return buf, func(lnk ipld.Link) error {
+			key := datastore.NewKey(lnk.(cidlink.Link).Cid.String())
+			if err := ds.Put(lctx.Ctx, key, buf.Bytes()); err != nil {
+				return err
+			}
+			onPut(key)
+			return nil
+		}, nil
+	}
+	return lsys
+}
@@ -0,0 +1,175 @@
+package ingest
+
+import (
+	"context"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipni/go-libipni/ingest/schema"
+	"github.com/ipni/storetheindex/carstore"
+	"github.com/ipni/storetheindex/filestore"
+	"github.com/ipni/storetheindex/test/typehelpers"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackfill(t *testing.T) {
+	te := setupTestEnv(t, true)
+	ctx := context.Background()
+
+	headCid := typehelpers.BuildRemovalChain(t, te.publisherLinkSys, te.publisherPriv).(cidlink.Link).Cid
+	require.NoError(t, te.publisher.SetRoot(ctx, headCid))
+
+	backfillHost := mkTestHost()
+	t.Cleanup(func() { backfillHost.Close() })
+	connectHosts(t, backfillHost, te.pubHost)
+
+	mirrorDir := t.TempDir()
+	cfg := defaultTestIngestConfig
+	cfg.AdvertisementMirror.Write = true
+	cfg.AdvertisementMirror.Storage.Type = "local"
+	cfg.AdvertisementMirror.Storage.Local.BasePath = mirrorDir
+
+	backfiller, err := NewBackfiller(backfillHost, cfg, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { backfiller.Close() })
+
+	pubInfo := peer.AddrInfo{
+		ID:    te.pubHost.ID(),
+		Addrs: te.pubHost.Addrs(),
+	}
+	stats, err := backfiller.Backfill(ctx, pubInfo, headCid, true)
+	require.NoError(t, err)
+	require.Equal(t, BackfillStats{Written: 4, HeadWritten: true}, stats)
+	requireNoFetched(t, backfiller)
+
+	fileStore, err := filestore.NewLocal(mirrorDir)
+	require.NoError(t, err)
+	carReader, err := carstore.NewReader(fileStore)
+	require.NoError(t, err)
+	mirrorHead, err := carReader.ReadHead(ctx, pubInfo.ID)
+	require.NoError(t, err)
+	require.Equal(t, headCid, mirrorHead)
+
+	// Check that entries are written, except for removed context ID.
+	var adCids []cid.Cid
+	var entryCounts []int
+	for adCid := headCid; adCid != cid.Undef; {
+		adBlock, err := carReader.Read(ctx, adCid, false)
+		require.NoError(t, err)
+		var count int
+		if adBlock.Entries != nil {
+			for entBlock := range adBlock.Entries {
+				require.NoError(t, entBlock.Err)
+				count++
+			}
+		}
+		adCids = append(adCids, adCid)
+		entryCounts = append(entryCounts, count)
+
+		ad, err := adBlock.Advertisement()
+		require.NoError(t, err)
+		if ad.PreviousID == nil {
+			break
+		}
+		adCid = ad.PreviousID.(cidlink.Link).Cid
+	}
+	require.Equal(t, []int{0, 2, 2, 0}, entryCounts)
+
+	// Backfill resumes by writing only missing CAR files.
+	require.NoError(t, fileStore.Delete(ctx, adCids[2].String()+carstore.CarFileSuffix))
+	stats, err = backfiller.Backfill(ctx, pubInfo, headCid, true)
+	require.NoError(t, err)
+	require.Equal(t, BackfillStats{Written: 1, Existing: 3}, stats)
+
+	_, err = carReader.Read(ctx, adCids[2], true)
+	require.NoError(t, err)
+}
+
+func TestBackfillCleanup(t *testing.T) {
+	te := setupTestEnv(t, true)
+	ctx := context.Background()
+
+	headCid := typehelpers.RandomAdBuilder{
+		EntryBuilders: []typehelpers.EntryBuilder{
+			typehelpers.RandomHamtEntryBuilder{BucketSize: 3, BitWidth: 5, MultihashCount: 100, Seed: 1},
+			typehelpers.RandomEntryChunkBuilder{ChunkCount: 3, EntriesPerChunk: 10, Seed: 2},
+		},
+	}.Build(t, te.publisherLinkSys, te.publisherPriv).(cidlink.Link).Cid
+	require.NoError(t, te.publisher.SetRoot(ctx, headCid))
+
+	backfillHost := mkTestHost()
+	t.Cleanup(func() { backfillHost.Close() })
+	connectHosts(t, backfillHost, te.pubHost)
+
+	mirrorDir := t.TempDir()
+	cfg := defaultTestIngestConfig
+	cfg.AdvertisementMirror.Write = true
+	cfg.AdvertisementMirror.Storage.Type = "local"
+	cfg.AdvertisementMirror.Storage.Local.BasePath = mirrorDir
+
+	backfiller, err := NewBackfiller(backfillHost, cfg, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { backfiller.Close() })
+
+	pubInfo := peer.AddrInfo{
+		ID:    te.pubHost.ID(),
+		Addrs: te.pubHost.Addrs(),
+	}
+
+	// Remove the last entries chunk of the head advertisement from the
+	// publisher, so that its entries are only partially fetched.
+	node, err := te.publisherLinkSys.Load(ipld.LinkContext{}, cidlink.Link{Cid: headCid}, schema.AdvertisementPrototype)
+	require.NoError(t, err)
+	ad, err := schema.UnwrapAdvertisement(node)
+	require.NoError(t, err)
+	chunkCid := ad.Entries.(cidlink.Link).Cid
+	for i := 0; i < 2; i++ {
+		node, err = te.publisherLinkSys.Load(ipld.LinkContext{}, cidlink.Link{Cid: chunkCid}, schema.EntryChunkPrototype)
+		require.NoError(t, err)
+		chunk, err := schema.UnwrapEntryChunk(node)
+		require.NoError(t, err)
+		chunkCid = chunk.Next.(cidlink.Link).Cid
+	}
+	chunkKey := datastore.NewKey(chunkCid.String())
+	chunkData, err := te.pubStore.Get(ctx, chunkKey)
+	require.NoError(t, err)
+	require.NoError(t, te.pubStore.Delete(ctx, chunkKey))
+
+	_, err = backfiller.Backfill(ctx, pubInfo, headCid, true)
+	require.Error(t, err)
+	requireNoFetched(t, backfiller)
+
+	// Head is not written for a chain that is not the publisher's newest.
+	require.NoError(t, te.pubStore.Put(ctx, chunkKey, chunkData))
+	stats, err := backfiller.Backfill(ctx, pubInfo, headCid, false)
+	require.NoError(t, err)
+	require.Equal(t, BackfillStats{Written: 1, HAMT: 1}, stats)
+	requireNoFetched(t, backfiller)
+
+	fileStore, err := filestore.NewLocal(mirrorDir)
+	require.NoError(t, err)
+	carReader, err := carstore.NewReader(fileStore)
+	require.NoError(t, err)
+	_, err = carReader.ReadHead(ctx, pubInfo.ID)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+// requireNoFetched checks that the backfiller datastore has no blocks. Other
+// data, such as data-transfer state, may remain.
+func requireNoFetched(t *testing.T, b *Backfiller) {
+	results, err := b.dstore.Query(context.Background(), query.Query{KeysOnly: true})
+	require.NoError(t, err)
+	ents, err := results.Rest()
+	require.NoError(t, err)
+	for _, ent := range ents {
+		_, err = cid.Decode(strings.TrimPrefix(ent.Key, "/"))
+		require.Error(t, err, "fetched block not removed")
+	}
+}
@@ -1,9 +1,14 @@
 package ingest
 
 import (
+	"errors"
 	"fmt"
 )
 
+// errEntriesPaused is the error for an advertisement that is not processed
+// because entries sync is paused.
+var errEntriesPaused = errors.New("entries sync paused by disk pressure")
+
 type adIngestState string
 
 type adIngestError struct {
@@ -160,8 +160,9 @@ type Ingester struct {
 	workerPoolSize int
 
 	// RateLimiting
-	rateApply peerutil.Policy
-	rateBurst int
+	rateApply        peerutil.Policy
+	rateBurst        int
+	rateExceptLabels []string
 
 	// providersPendingAnnounce maps the provider ID to the latest announcement
 	// received from the provider that is waiting to be processed.
@@ -170,6 +171,15 @@ type Ingester struct {
 	rateLimit rate.Limit
 	rateMutex sync.Mutex
 
+	// Entries sync paused by disk pressure.
+	pauseEntries        bool
+	pausePriorityLabels []string
+	pauseMutex          sync.Mutex
+
+	// Held for reading while an advertisement is ingested, and for writing
+	// while ingestion is paused.
+	ingestPause sync.RWMutex
+
 	// Multihash minimum length
 	minKeyLen int
 
@@ -229,6 +239,7 @@ func NewIngester(cfg config.Ingest, h host.Host, idxr indexer.Interface, reg *re
 	if err != nil {
 		log.Error(err.Error())
 	}
+	ing.rateExceptLabels = cfg.RateLimit.ExceptLabels
 
 	// Instantiate retryable HTTP client used by dagsync httpsync.
 	rclient := &retryablehttp.Client{
@@ -309,9 +320,16 @@ func (ing *Ingester) getRateLimiter(publisher peer.ID) *rate.Limiter {
 	ing.rateMutex.Lock()
 	defer ing.rateMutex.Unlock()
 
+	apply := ing.rateApply.Eval(publisher)
+	// A publisher with a label in ExceptLabels is treated as an exception,
+	// unless it is already an exception.
+	if apply == ing.rateApply.Default() && ing.reg.HasLabel(publisher, ing.rateExceptLabels) {
+		apply = !apply
+	}
+
 	// If rateLimiting disabled or publisher is not rate-limited, then return
 	// infinite rate limiter.
-	if ing.rateLimit == 0 || !ing.rateApply.Eval(publisher) {
+	if ing.rateLimit == 0 || !apply {
 		return rate.NewLimiter(rate.Inf, 0)
 	}
 	// Return rate limiter with rate setting from config.
@@ -386,6 +404,88 @@ func Unfreeze(unfrozen map[peer.ID]cid.Cid, dstore datastore.Datastore) error {
 	return nil
 }
 
+// IndexStatePrefixes returns the prefixes of the datastore keys that record
+// which advertisements have been indexed, and how many indexes each provider
+// has. Without these keys, the ingester indexes each advertisement chain again
+// from the start.
+func IndexStatePrefixes() []string {
+	return []string{syncPrefix, adProcessedPrefix, adProcessedFrozenPrefix, counter.KeyPrefix()}
+}
+
+// LatestSyncs reads the latest advertisement processed for each publisher
+// from the datastore.
+func LatestSyncs(ctx context.Context, dstore datastore.Datastore) (map[peer.ID]cid.Cid, error) {
+	results, err := dstore.Query(ctx, query.Query{
+		Prefix: syncPrefix,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ents, err := results.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[peer.ID]cid.Cid, len(ents))
+	for i := range ents {
+		pubID, err := peer.Decode(path.Base(ents[i].Key))
+		if err != nil {
+			log.Errorw("Cannot decode publisher ID of latest sync", "key", ents[i].Key, "err", err)
+			continue
+		}
+		_, adCid, err := cid.CidFromBytes(ents[i].Value)
+		if err != nil {
+			log.Errorw("Cannot decode latest synced advertisement", "publisher", pubID, "err", err)
+			continue
+		}
+		latest[pubID] = adCid
+	}
+	return latest, nil
+}
+
+// UnfreezeRunning reverts the ingestion state of a running ingester back to
+// its unfrozen state, and then re-syncs the advertisements of each unfrozen
+// publisher so that advertisements processed while frozen are ingested
+// normally. The progress function, if not nil, is called after each publisher
+// is re-synced, with any error from the sync. This must be called after the
+// registry is unfrozen.
+func (ing *Ingester) UnfreezeRunning(ctx context.Context, unfrozen map[peer.ID]cid.Cid, progress func(peer.ID, error)) error {
+	if err := Unfreeze(unfrozen, ing.ds); err != nil {
+		return err
+	}
+
+	pubAddrs := make(map[peer.ID]multiaddr.Multiaddr, len(unfrozen))
+	for _, info := range ing.reg.AllProviderInfo() {
+		if info.PublisherAddr != nil {
+			pubAddrs[info.Publisher] = info.PublisherAddr
+		}
+	}
+
+	for pubID := range unfrozen {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var err error
+		pubAddr, ok := pubAddrs[pubID]
+		if ok {
+			pubInfo := peer.AddrInfo{
+				ID:    pubID,
+				Addrs: []multiaddr.Multiaddr{pubAddr},
+			}
+			_, err = ing.Sync(ctx, pubInfo, 0, false)
+		} else {
+			err = errors.New("unknown publisher address")
+		}
+		if err != nil {
+			log.Errorw("Cannot re-sync unfrozen publisher", "err", err, "publisher", pubID)
+		}
+		if progress != nil {
+			progress(pubID, err)
+		}
+	}
+	return nil
+}
+
 func removeProcessedFrozen(ctx context.Context, dstore datastore.Datastore) error {
 	q := query.Query{
 		Prefix:   adProcessedFrozenPrefix,
@@ -935,11 +1035,47 @@ func (ing *Ingester) SetRateLimit(cfgRateLimit config.RateLimit) error {
 	ing.rateApply = apply
 	ing.rateBurst = burst
 	ing.rateLimit = limit
+	ing.rateExceptLabels = cfgRateLimit.ExceptLabels
 
 	ing.rateMutex.Unlock()
 	return nil
 }
 
+// PauseEntries pauses or resumes processing advertisements from providers
+// that do not have a label matching any of priorityLabels. Paused
+// advertisements remain unprocessed, and are processed after processing is
+// resumed, when the provider's advertisement chain is next synced.
+func (ing *Ingester) PauseEntries(pause bool, priorityLabels []string) {
+	ing.pauseMutex.Lock()
+	defer ing.pauseMutex.Unlock()
+
+	ing.pauseEntries = pause
+	ing.pausePriorityLabels = priorityLabels
+}
+
+func (ing *Ingester) entriesPaused(provider peer.ID) bool {
+	ing.pauseMutex.Lock()
+	defer ing.pauseMutex.Unlock()
+
+	return ing.pauseEntries && !ing.reg.HasLabel(provider, ing.pausePriorityLabels)
+}
+
+// PauseIngest waits for any advertisements currently being ingested to
+// finish, and then stops ingesting advertisements until ResumeIngest is
+// called. Advertisements continue to be synced while ingestion is paused.
+// This allows a consistent snapshot of indexer state to be taken while the
+// indexer is running.
+func (ing *Ingester) PauseIngest() {
+	ing.ingestPause.Lock()
+	log.Info("Ingestion paused")
+}
+
+// ResumeIngest resumes ingesting advertisements after PauseIngest.
+func (ing *Ingester) ResumeIngest() {
+	ing.ingestPause.Unlock()
+	log.Info("Ingestion resumed")
+}
+
 func (ing *Ingester) RunWorkers(n int) {
 	for n > ing.workerPoolSize {
 		// Start worker.
@@ -1219,9 +1355,11 @@ func (ing *Ingester) ingestWorkerLogic(ctx context.Context, provider peer.ID, as
 				"progress", fmt.Sprintf("%d of %d", count, total))
 
 			keep := ing.mirror.canWrite()
+			ing.ingestPause.RLock()
 			if markErr := ing.markAdProcessed(assignment.publisher, ai.cid, frozen, keep); markErr != nil {
 				log.Errorw("Failed to mark ad as processed", "err", markErr)
 			}
+			ing.ingestPause.RUnlock()
 			if !frozen && keep {
 				// Write the advertisement to a CAR file, but omit the entries.
 				carInfo, err := ing.mirror.write(ctx, ai.cid, true, ai.resync)
@@ -1250,12 +1388,26 @@ func (ing *Ingester) ingestWorkerLogic(ctx context.Context, provider peer.ID, as
 			continue
 		}
 
+		if ing.entriesPaused(provider) {
+			log.Infow("Entries sync paused by disk pressure, not ingesting later ads", "adCid", ai.cid, "adsLeftToProcess", i+1)
+			ing.inEvents <- adProcessedEvent{
+				publisher: assignment.publisher,
+				headAdCid: headAdCid,
+				adCid:     ai.cid,
+				err:       errEntriesPaused,
+			}
+			return
+		}
+
 		lag := total - count
 		log.Infow("Processing advertisement",
 			"adCid", ai.cid,
 			"progress", fmt.Sprintf("%d of %d", count, total),
 			"lag", lag)
 
+		// Ingesting the ad and marking it processed is not interrupted by
+		// pausing ingestion.
+		ing.ingestPause.RLock()
 		err := ing.ingestAd(ctx, assignment.publisher, ai.cid, ai.resync, frozen, lag, headProvider)
 		if err == nil {
 			// No error at all, this ad was processed successfully.
@@ -1282,6 +1434,7 @@ func (ing *Ingester) ingestWorkerLogic(ctx context.Context, provider peer.ID, as
 		}
 
 		if err != nil {
+			ing.ingestPause.RUnlock()
 			log.Errorw("Error while ingesting ad. Bailing early, not ingesting later ads.", "adCid", ai.cid, "err", err, "adsLeftToProcess", i+1)
 			// Tell anyone waiting that the sync finished for this head because
 			// of error.  TODO(mm) would be better to propagate the error.
@@ -1298,6 +1451,7 @@ func (ing *Ingester) ingestWorkerLogic(ctx context.Context, provider peer.ID, as
 		if markErr := ing.markAdProcessed(assignment.publisher, ai.cid, frozen, keep); markErr != nil {
 			log.Errorw("Failed to mark ad as processed", "err", markErr)
 		}
+		ing.ingestPause.RUnlock()
 
 		if !frozen && keep {
 			carInfo, err := ing.mirror.write(ctx, ai.cid, false, ai.resync)
@@ -0,0 +1,267 @@
+package ingest
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipni/go-indexer-core"
+	"github.com/ipni/go-libipni/ingest/schema"
+	"github.com/ipni/storetheindex/carstore"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// RebuildStats describes the result of rebuilding a publisher's index from
+// the advertisement mirror.
+type RebuildStats struct {
+	// Ads is the number of advertisements in the mirrored chain.
+	Ads int
+	// Indexed is the number of advertisements whose entries were indexed.
+	Indexed int
+	// Removals is the number of removal advertisements applied.
+	Removals int
+	// Skipped is the number of advertisements not indexed because their
+	// context ID is removed by a later advertisement.
+	Skipped int
+	// NoEntries is the number of advertisements that should have entries,
+	// but do not have them in the mirror.
+	NoEntries int
+	// Multihashes is the number of multihashes indexed.
+	Multihashes int
+}
+
+// providerContext identifies a context ID of a provider.
+type providerContext struct {
+	provider  string
+	contextID string
+}
+
+// rebuildAd is an advertisement read from the mirror while walking a chain.
+type rebuildAd struct {
+	cid      cid.Cid
+	ad       schema.Advertisement
+	provider peer.ID
+	skip     bool
+}
+
+// RebuildFromMirror re-indexes a publisher's advertisement chain entirely from
+// the advertisement mirror, without contacting the publisher. The chain is
+// read from the mirrored head of the publisher back to its first
+// advertisement, and is then replayed oldest to newest. Removal
+// advertisements are applied, and advertisements whose context ID is removed
+// by a later advertisement are skipped.
+//
+// While rebuilding, the providers of the chain are held the same way that
+// ingest workers hold them, so that the rebuild waits for any ingest of those
+// providers to finish, and ingest of those providers waits for the rebuild.
+//
+// The registry and the latest synced advertisement of the publisher are not
+// changed. Returns an error wrapping fs.ErrNotExist if the publisher has no
+// head in the mirror, or if any advertisement in the chain is missing from the
+// mirror.
+func (ing *Ingester) RebuildFromMirror(ctx context.Context, publisherID peer.ID) (RebuildStats, error) {
+	var stats RebuildStats
+	if !ing.mirror.canRead() {
+		return stats, errors.New("advertisement mirror is not readable")
+	}
+
+	ads, err := ing.readMirrorChain(ctx, publisherID)
+	if err != nil {
+		return stats, err
+	}
+	stats.Ads = len(ads)
+
+	release, err := ing.holdProviders(ctx, ads)
+	if err != nil {
+		return stats, err
+	}
+	defer release()
+
+	log := log.With("publisher", publisherID)
+	log.Infow("Rebuilding index from mirror", "ads", len(ads))
+
+	for i := len(ads) - 1; i >= 0; i-- {
+		if ctx.Err() != nil {
+			return stats, ctx.Err()
+		}
+		rad := ads[i]
+		if rad.skip {
+			stats.Skipped++
+			continue
+		}
+		mhCount, err := ing.rebuildAd(ctx, rad)
+		if err != nil {
+			if errors.Is(err, carstore.ErrHAMT) || errors.Is(err, fs.ErrNotExist) {
+				log.Warnw("Advertisement entries not in mirror", "adCid", rad.cid, "err", err)
+				stats.NoEntries++
+				continue
+			}
+			var adIngestErr adIngestError
+			if errors.As(err, &adIngestErr) && adIngestErr.state == adIngestContentNotFound {
+				log.Warnw("Advertisement entries not in mirror", "adCid", rad.cid, "err", err)
+				stats.NoEntries++
+				continue
+			}
+			return stats, fmt.Errorf("cannot index advertisement %s: %w", rad.cid, err)
+		}
+		if rad.ad.IsRm {
+			stats.Removals++
+		} else if mhCount != 0 {
+			stats.Indexed++
+			stats.Multihashes += mhCount
+		}
+	}
+
+	log.Infow("Finished rebuilding index from mirror", "indexed", stats.Indexed, "removals", stats.Removals,
+		"skipped", stats.Skipped, "noEntries", stats.NoEntries, "multihashes", stats.Multihashes)
+	return stats, nil
+}
+
+// holdProviders takes the processing token of each provider in ads, waiting
+// for any worker that is ingesting advertisements of those providers. The
+// returned function releases the tokens. Tokens are taken in sorted order so
+// that concurrent rebuilds cannot deadlock.
+func (ing *Ingester) holdProviders(ctx context.Context, ads []rebuildAd) (func(), error) {
+	idSet := make(map[peer.ID]struct{})
+	for _, rad := range ads {
+		idSet[rad.provider] = struct{}{}
+	}
+	ids := make([]peer.ID, 0, len(idSet))
+	for id := range idSet {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	held := make([]chan struct{}, 0, len(ids))
+	release := func() {
+		for _, provBusy := range held {
+			<-provBusy
+		}
+	}
+	for _, id := range ids {
+		ing.providersBeingProcessedMu.Lock()
+		provBusy, ok := ing.providersBeingProcessed[id]
+		if !ok {
+			provBusy = make(chan struct{}, 1)
+			ing.providersBeingProcessed[id] = provBusy
+		}
+		ing.providersBeingProcessedMu.Unlock()
+
+		select {
+		case provBusy <- struct{}{}:
+			held = append(held, provBusy)
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+// readMirrorChain reads the publisher's advertisement chain from the mirror,
+// newest first. Advertisements whose context ID is removed by a later
+// advertisement are marked to be skipped.
+func (ing *Ingester) readMirrorChain(ctx context.Context, publisherID peer.ID) ([]rebuildAd, error) {
+	adCid, err := ing.mirror.carReader.ReadHead(ctx, publisherID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read mirrored head: %w", err)
+	}
+
+	var ads []rebuildAd
+	removed := make(map[providerContext]struct{})
+	for adCid != cid.Undef {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		adBlock, err := ing.mirror.read(ctx, adCid, true)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read advertisement %s from mirror: %w", adCid, err)
+		}
+		ad, err := adBlock.Advertisement()
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode advertisement %s: %w", adCid, err)
+		}
+		node, err := ad.ToNode()
+		if err != nil {
+			return nil, err
+		}
+		providerID, err := verifyAdvertisement(node, ing.reg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid advertisement %s: %w", adCid, err)
+		}
+
+		key := providerContext{
+			provider:  ad.Provider,
+			contextID: string(ad.ContextID),
+		}
+		var skip bool
+		if ad.IsRm {
+			removed[key] = struct{}{}
+		} else if _, ok := removed[key]; ok {
+			skip = true
+		}
+		ads = append(ads, rebuildAd{
+			cid:      adCid,
+			ad:       ad,
+			provider: providerID,
+			skip:     skip,
+		})
+
+		if ad.PreviousID == nil {
+			break
+		}
+		adCid = ad.PreviousID.(cidlink.Link).Cid
+	}
+	return ads, nil
+}
+
+// rebuildAd applies a single advertisement read from the mirror, and returns
+// the number of multihashes indexed.
+func (ing *Ingester) rebuildAd(ctx context.Context, rad rebuildAd) (int, error) {
+	ad := rad.ad
+	log := log.With("adCid", rad.cid, "provider", rad.provider,
+		"contextID", base64.StdEncoding.EncodeToString(ad.ContextID))
+
+	if ad.IsRm {
+		if err := ing.indexer.RemoveProviderContext(rad.provider, ad.ContextID); err != nil {
+			return 0, fmt.Errorf("failed to remove provider context: %w", err)
+		}
+		if ing.indexCounts != nil {
+			if _, err := ing.indexCounts.RemoveCtx(rad.provider, ad.ContextID); err != nil {
+				log.Errorw("Error removing index count", "err", err)
+			}
+		}
+		return 0, nil
+	}
+
+	if len(ad.Metadata) == 0 {
+		// Only updates provider addresses.
+		return 0, nil
+	}
+
+	if ad.Entries == schema.NoEntries {
+		value := indexer.Value{
+			ContextID:     ad.ContextID,
+			MetadataBytes: ad.Metadata,
+			ProviderID:    rad.provider,
+		}
+		if err := ing.indexer.Put(value); err != nil {
+			return 0, fmt.Errorf("failed to update metadata: %w", err)
+		}
+		return 0, nil
+	}
+
+	entriesCid := ad.Entries.(cidlink.Link).Cid
+	mhCount, err := ing.ingestEntriesFromCar(ctx, ad, rad.provider, rad.cid, entriesCid, log)
+	if err != nil {
+		return 0, err
+	}
+	ing.updateIndexCounts(mhCount, rad.provider, ad.ContextID, true)
+	ing.mhsFromMirror.Add(uint64(mhCount))
+	return mhCount, nil
+}
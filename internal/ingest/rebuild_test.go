@@ -0,0 +1,149 @@
+package ingest
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipni/go-libipni/ingest/schema"
+	"github.com/ipni/storetheindex/carstore"
+	"github.com/ipni/storetheindex/filestore"
+	"github.com/ipni/storetheindex/test/typehelpers"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebuildFromMirror(t *testing.T) {
+	mirrorDir := t.TempDir()
+	cfg := defaultTestIngestConfig
+	cfg.AdvertisementMirror.Read = true
+	cfg.AdvertisementMirror.Storage.Type = "local"
+	cfg.AdvertisementMirror.Storage.Local.BasePath = mirrorDir
+
+	te := setupTestEnv(t, true, func(optCfg *testEnvOpts) {
+		optCfg.ingestConfig = &cfg
+	})
+	ctx := context.Background()
+
+	// Publisher has no head in mirror.
+	_, err := te.ingester.RebuildFromMirror(ctx, te.pubHost.ID())
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	headCid := typehelpers.BuildRemovalChain(t, te.publisherLinkSys, te.publisherPriv).(cidlink.Link).Cid
+
+	// Write the chain to the mirror without the publisher serving it.
+	fileStore, err := filestore.NewLocal(mirrorDir)
+	require.NoError(t, err)
+	carWriter, err := carstore.NewWriter(te.pubStore, fileStore)
+	require.NoError(t, err)
+	// Write all ads with entries, as a mirror written before the removal was
+	// ingested would have them.
+	for adCid := headCid; adCid != cid.Undef; {
+		node, err := te.publisherLinkSys.Load(ipld.LinkContext{}, cidlink.Link{Cid: adCid}, schema.AdvertisementPrototype)
+		require.NoError(t, err)
+		ad, err := schema.UnwrapAdvertisement(node)
+		require.NoError(t, err)
+		_, err = carWriter.Write(ctx, adCid, false, false)
+		require.NoError(t, err)
+		if ad.PreviousID == nil {
+			break
+		}
+		adCid = ad.PreviousID.(cidlink.Link).Cid
+	}
+	_, err = carWriter.WriteHead(ctx, headCid, te.pubHost.ID())
+	require.NoError(t, err)
+
+	stats, err := te.ingester.RebuildFromMirror(ctx, te.pubHost.ID())
+	require.NoError(t, err)
+	require.Equal(t, RebuildStats{
+		Ads:         4,
+		Indexed:     2,
+		Removals:    1,
+		Skipped:     1,
+		Multihashes: 40,
+	}, stats)
+
+	// Check that the entries of the removed context ID are not indexed.
+	carReader, err := carstore.NewReader(fileStore)
+	require.NoError(t, err)
+	var indexed []bool
+	for adCid := headCid; adCid != cid.Undef; {
+		adBlock, err := carReader.Read(ctx, adCid, false)
+		require.NoError(t, err)
+		var mhs []multihash.Multihash
+		if adBlock.Entries != nil {
+			for entBlock := range adBlock.Entries {
+				require.NoError(t, entBlock.Err)
+				chunk, err := entBlock.EntryChunk()
+				require.NoError(t, err)
+				mhs = append(mhs, chunk.Entries...)
+			}
+		}
+		if len(mhs) != 0 {
+			_, found, err := te.core.Get(mhs[0])
+			require.NoError(t, err)
+			indexed = append(indexed, found)
+		}
+
+		ad, err := adBlock.Advertisement()
+		require.NoError(t, err)
+		if ad.PreviousID == nil {
+			break
+		}
+		adCid = ad.PreviousID.(cidlink.Link).Cid
+	}
+	// The CAR file of the removed ad still has its entries.
+	require.Equal(t, []bool{true, true, false}, indexed)
+
+	// Rebuilding again does not change index counts.
+	count, err := te.indexCounts.Provider(te.pubHost.ID())
+	require.NoError(t, err)
+	require.Equal(t, uint64(40), count)
+	_, err = te.ingester.RebuildFromMirror(ctx, te.pubHost.ID())
+	require.NoError(t, err)
+	count, err = te.indexCounts.Provider(te.pubHost.ID())
+	require.NoError(t, err)
+	require.Equal(t, uint64(40), count)
+
+	// Rebuilding waits while an ingest worker is processing the provider.
+	te.ingester.providersBeingProcessedMu.Lock()
+	provBusy := te.ingester.providersBeingProcessed[te.pubHost.ID()]
+	te.ingester.providersBeingProcessedMu.Unlock()
+	require.NotNil(t, provBusy)
+	provBusy <- struct{}{}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	_, err = te.ingester.RebuildFromMirror(timeoutCtx, te.pubHost.ID())
+	cancel()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := te.ingester.RebuildFromMirror(ctx, te.pubHost.ID())
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("rebuild did not wait for provider")
+	case <-time.After(100 * time.Millisecond):
+	}
+	<-provBusy
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("rebuild did not finish")
+	}
+
+	// Rebuild released the provider.
+	select {
+	case provBusy <- struct{}{}:
+		<-provBusy
+	default:
+		t.Fatal("rebuild did not release provider")
+	}
+}
@@ -0,0 +1,288 @@
+// Package maintenance runs value store garbage collection and compaction on
+// demand, one run at a time, and records the status of each run.
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipni/go-indexer-core"
+)
+
+var log = logging.Logger("indexer/maintenance")
+
+// Operation is a type of value store maintenance.
+type Operation string
+
+const (
+	// GC is value store garbage collection.
+	GC Operation = "gc"
+	// Compact is value store compaction.
+	Compact Operation = "compact"
+)
+
+var (
+	// ErrRunning is returned when starting maintenance while a previous run
+	// has not finished.
+	ErrRunning = errors.New("value store maintenance already running")
+	// ErrNotSupported is returned when starting an operation that the value
+	// store does not support.
+	ErrNotSupported = errors.New("operation not supported by value store")
+)
+
+// Collector runs garbage collection of a value store on demand. GC must
+// return when its context is canceled, and must keep the work done so far, so
+// that the next call to GC continues from where the canceled call stopped.
+type Collector interface {
+	GC(context.Context) error
+}
+
+// Compactor runs compaction of a value store on demand. Compact must return
+// when its context is canceled, and must keep the work done so far, so that
+// the next call to Compact continues from where the canceled call stopped.
+type Compactor interface {
+	Compact(context.Context) error
+}
+
+// Run describes a maintenance run.
+type Run struct {
+	Operation Operation
+	Started   time.Time
+	// Finished is zero while the run is in progress.
+	Finished time.Time
+	// TimeLimit is the maximum duration of the run, or 0 if unlimited.
+	TimeLimit time.Duration
+	// Throttled is true if the run pauses periodically.
+	Throttled bool
+	// LimitReached is true if the run stopped because it reached its time
+	// limit.
+	LimitReached bool
+	// BytesBefore and BytesAfter are the size of the value store directory
+	// before and after the run. These are -1 if the size is unknown.
+	BytesBefore int64
+	BytesAfter  int64
+	// Err is the error that stopped the run.
+	Err error
+}
+
+// BytesReclaimed returns the reduction in the size of the value store
+// directory, which is negative if the directory grew.
+func (r Run) BytesReclaimed() int64 {
+	if r.BytesBefore < 0 || r.BytesAfter < 0 {
+		return 0
+	}
+	return r.BytesBefore - r.BytesAfter
+}
+
+// Maintainer runs value store maintenance.
+type Maintainer struct {
+	cancel     context.CancelFunc
+	ctx        context.Context
+	current    *Run
+	last       *Run
+	mutex      sync.Mutex
+	opts       config
+	valueStore indexer.Interface
+	wg         sync.WaitGroup
+}
+
+// New creates a new Maintainer for the value store.
+func New(valueStore indexer.Interface, options ...Option) (*Maintainer, error) {
+	opts, err := getOpts(options)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Maintainer{
+		cancel:     cancel,
+		ctx:        ctx,
+		opts:       opts,
+		valueStore: valueStore,
+	}, nil
+}
+
+// Close cancels any maintenance run in progress and waits for it to stop.
+func (m *Maintainer) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Supported returns true if the value store supports the operation.
+func (m *Maintainer) Supported(op Operation) bool {
+	return m.operationFunc(op) != nil
+}
+
+// Start starts running the maintenance operation in the background. If
+// timeLimit is not zero, the run stops after that amount of time. If throttle
+// is true, the run periodically pauses so that ingestion can proceed.
+func (m *Maintainer) Start(op Operation, timeLimit time.Duration, throttle bool) (Run, error) {
+	opFunc := m.operationFunc(op)
+	if opFunc == nil {
+		return Run{}, ErrNotSupported
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.current != nil {
+		return Run{}, ErrRunning
+	}
+	if m.ctx.Err() != nil {
+		return Run{}, m.ctx.Err()
+	}
+	run := &Run{
+		Operation:   op,
+		Started:     time.Now(),
+		TimeLimit:   timeLimit,
+		Throttled:   throttle,
+		BytesBefore: -1,
+		BytesAfter:  -1,
+	}
+	m.current = run
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.run(*run, opFunc)
+	}()
+	return *run, nil
+}
+
+// Status returns the run in progress and the last finished run. Either is
+// nil if there is no such run.
+func (m *Maintainer) Status() (current, last *Run) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.current != nil {
+		run := *m.current
+		current = &run
+	}
+	if m.last != nil {
+		run := *m.last
+		last = &run
+	}
+	return current, last
+}
+
+func (m *Maintainer) operationFunc(op Operation) func(context.Context) error {
+	switch op {
+	case GC:
+		if m.opts.collector != nil {
+			return m.opts.collector.GC
+		}
+	case Compact:
+		if m.opts.compactor != nil {
+			return m.opts.compactor.Compact
+		}
+	}
+	return nil
+}
+
+func (m *Maintainer) run(run Run, opFunc func(context.Context) error) {
+	log := log.With("operation", run.Operation)
+	log.Infow("Starting value store maintenance", "timeLimit", run.TimeLimit, "throttled", run.Throttled)
+
+	ctx := m.ctx
+	if run.TimeLimit != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, run.TimeLimit)
+		defer cancel()
+	}
+
+	run.Err = m.valueStore.Flush()
+	if run.Err == nil {
+		run.BytesBefore = m.dirSize()
+		if run.Throttled {
+			run.Err = m.runThrottled(ctx, opFunc)
+		} else {
+			run.Err = opFunc(ctx)
+		}
+		// Reaching the time limit is not an error.
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			run.LimitReached = true
+			run.Err = nil
+		}
+		run.BytesAfter = m.dirSize()
+	}
+	run.Finished = time.Now()
+
+	if run.Err != nil {
+		log.Errorw("Value store maintenance failed", "err", run.Err)
+	} else {
+		log.Infow("Finished value store maintenance", "elapsed", run.Finished.Sub(run.Started),
+			"bytesReclaimed", run.BytesReclaimed(), "limitReached", run.LimitReached)
+	}
+
+	m.mutex.Lock()
+	m.current = nil
+	m.last = &run
+	m.mutex.Unlock()
+}
+
+// runThrottled alternates between running the operation for the throttle run
+// duration and pausing for the throttle pause duration. Each time the
+// operation is run again it continues from where it stopped. The operation is
+// finished when it returns without being stopped by the run duration.
+func (m *Maintainer) runThrottled(ctx context.Context, opFunc func(context.Context) error) error {
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, m.opts.throttleRun)
+		err := opFunc(runCtx)
+		cancel()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+
+		timer := time.NewTimer(m.opts.throttlePause)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// dirSize returns the total size of all files in the value store directory,
+// or -1 if the size is unknown.
+func (m *Maintainer) dirSize() int64 {
+	if m.opts.dir == "" {
+		return -1
+	}
+	var size int64
+	err := filepath.WalkDir(m.opts.dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files may be removed while walking.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		size += fi.Size()
+		return nil
+	})
+	if err != nil {
+		log.Errorw("Cannot get size of value store directory", "err", err)
+		return -1
+	}
+	return size
+}
@@ -0,0 +1,212 @@
+package maintenance_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	sth "github.com/ipld/go-storethehash/store"
+	"github.com/ipni/go-indexer-core"
+	"github.com/ipni/go-indexer-core/store/memory"
+	"github.com/ipni/go-libipni/test"
+	"github.com/ipni/storetheindex/internal/maintenance"
+	"github.com/stretchr/testify/require"
+)
+
+// gcStore is a value store that needs a number of GC calls, each lasting
+// longer than the throttle run duration, to finish garbage collection.
+type gcStore struct {
+	indexer.Interface
+	calls     atomic.Int32
+	callsLeft atomic.Int32
+	garbage   string
+}
+
+func (s *gcStore) GC(ctx context.Context) error {
+	s.calls.Add(1)
+	if s.callsLeft.Add(-1) > 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return os.Remove(s.garbage)
+}
+
+func TestMaintenance(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage")
+	require.NoError(t, os.WriteFile(garbage, make([]byte, 1024), 0o644))
+
+	vs := &gcStore{
+		Interface: memory.New(),
+		garbage:   garbage,
+	}
+	vs.callsLeft.Store(3)
+
+	m, err := maintenance.New(vs,
+		maintenance.WithCollector(vs),
+		maintenance.WithDir(dir),
+		maintenance.WithThrottle(10*time.Millisecond, 10*time.Millisecond))
+	require.NoError(t, err)
+	defer m.Close()
+
+	require.True(t, m.Supported(maintenance.GC))
+	require.False(t, m.Supported(maintenance.Compact))
+	_, err = m.Start(maintenance.Compact, 0, true)
+	require.ErrorIs(t, err, maintenance.ErrNotSupported)
+
+	run, err := m.Start(maintenance.GC, 0, true)
+	require.NoError(t, err)
+	require.Equal(t, maintenance.GC, run.Operation)
+	_, err = m.Start(maintenance.GC, 0, true)
+	require.ErrorIs(t, err, maintenance.ErrRunning)
+
+	var last *maintenance.Run
+	require.Eventually(t, func() bool {
+		var current *maintenance.Run
+		current, last = m.Status()
+		return current == nil && last != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, last.Err)
+	require.False(t, last.LimitReached)
+	require.Equal(t, int32(3), vs.calls.Load())
+	require.Equal(t, int64(1024), last.BytesReclaimed())
+	require.NoFileExists(t, garbage)
+
+	// Time limit stops a run that does not finish.
+	vs.callsLeft.Store(1000)
+	_, err = m.Start(maintenance.GC, 50*time.Millisecond, true)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		var current *maintenance.Run
+		current, last = m.Status()
+		return current == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, last.Err)
+	require.True(t, last.LimitReached)
+	require.Zero(t, last.BytesReclaimed())
+}
+
+// countingCompactor counts the calls to a Compactor.
+type countingCompactor struct {
+	maintenance.Compactor
+	calls atomic.Int32
+}
+
+func (c *countingCompactor) Compact(ctx context.Context) error {
+	c.calls.Add(1)
+	return c.Compactor.Compact(ctx)
+}
+
+func TestPebbleCompact(t *testing.T) {
+	dir := t.TempDir()
+	// Only manual compaction, so that the database has many tables, and so
+	// many key ranges to compact.
+	opts := &pebble.Options{
+		DisableAutomaticCompactions: true,
+	}
+	db, err := pebble.Open(dir, opts)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Write keys in separate tables, then delete most of them.
+	value := make([]byte, 256)
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key-%06d", i)) }
+	for table := 0; table < 8; table++ {
+		for i := table * 1000; i < (table+1)*1000; i++ {
+			require.NoError(t, db.Set(key(i), value, pebble.NoSync))
+		}
+		require.NoError(t, db.Flush())
+	}
+	for i := 0; i < 8000; i++ {
+		if i%10 != 0 {
+			require.NoError(t, db.Delete(key(i), pebble.NoSync))
+		}
+	}
+	require.NoError(t, db.Flush())
+
+	compactor := &countingCompactor{
+		Compactor: maintenance.NewPebbleCompactor(db),
+	}
+	// Each throttled run period is too short to compact more than one key
+	// range, so compaction only finishes if it continues where it stopped.
+	m, err := maintenance.New(memory.New(),
+		maintenance.WithCompactor(compactor),
+		maintenance.WithDir(dir),
+		maintenance.WithThrottle(time.Nanosecond, 0))
+	require.NoError(t, err)
+	defer m.Close()
+
+	_, err = m.Start(maintenance.Compact, 0, true)
+	require.NoError(t, err)
+	var last *maintenance.Run
+	require.Eventually(t, func() bool {
+		var current *maintenance.Run
+		current, last = m.Status()
+		return current == nil && last != nil
+	}, 10*time.Second, 10*time.Millisecond)
+	require.NoError(t, last.Err)
+	require.Greater(t, compactor.calls.Load(), int32(1))
+	require.Positive(t, last.BytesReclaimed())
+
+	for i := 0; i < 8000; i++ {
+		_, closer, err := db.Get(key(i))
+		if i%10 != 0 {
+			require.ErrorIs(t, err, pebble.ErrNotFound)
+			continue
+		}
+		require.NoError(t, err)
+		closer.Close()
+	}
+}
+
+func TestStorethehashGC(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := sth.OpenStore(ctx, sth.MultihashPrimary,
+		filepath.Join(dir, "storethehash.data"), filepath.Join(dir, "storethehash.index"), false,
+		sth.PrimaryFileSize(16*1024), sth.GCInterval(time.Hour))
+	require.NoError(t, err)
+	defer store.Close()
+
+	mhs := test.RandomMultihashes(2000)
+	value := make([]byte, 64)
+	for _, mh := range mhs {
+		require.NoError(t, store.Put(mh, value))
+	}
+	require.NoError(t, store.Flush())
+	for _, mh := range mhs[:1900] {
+		_, err = store.Remove(mh)
+		require.NoError(t, err)
+	}
+	require.NoError(t, store.Flush())
+
+	m, err := maintenance.New(memory.New(),
+		maintenance.WithCollector(maintenance.NewSthCollector(store)),
+		maintenance.WithDir(dir))
+	require.NoError(t, err)
+	defer m.Close()
+
+	require.True(t, m.Supported(maintenance.GC))
+	require.False(t, m.Supported(maintenance.Compact))
+	_, err = m.Start(maintenance.GC, 0, false)
+	require.NoError(t, err)
+	var last *maintenance.Run
+	require.Eventually(t, func() bool {
+		var current *maintenance.Run
+		current, last = m.Status()
+		return current == nil && last != nil
+	}, 10*time.Second, 10*time.Millisecond)
+	require.NoError(t, last.Err)
+	require.Positive(t, last.BytesReclaimed())
+
+	for _, mh := range mhs[1900:] {
+		_, found, err := store.Get(mh)
+		require.NoError(t, err)
+		require.True(t, found)
+	}
+}
@@ -0,0 +1,84 @@
+package maintenance
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultThrottleRun   = time.Minute
+	defaultThrottlePause = time.Minute
+)
+
+// config contains all options for the Maintainer.
+type config struct {
+	collector     Collector
+	compactor     Compactor
+	dir           string
+	throttlePause time.Duration
+	throttleRun   time.Duration
+}
+
+// Option is a function that sets a value in a config.
+type Option func(*config) error
+
+// getOpts creates a config and applies Options to it.
+func getOpts(opts []Option) (config, error) {
+	cfg := config{
+		throttlePause: defaultThrottlePause,
+		throttleRun:   defaultThrottleRun,
+	}
+
+	for i, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return config{}, fmt.Errorf("option %d error: %s", i, err)
+		}
+	}
+	return cfg, nil
+}
+
+// WithDir sets the value store directory. The size of this directory is
+// measured before and after each run, to determine the number of bytes
+// reclaimed.
+func WithDir(dir string) Option {
+	return func(c *config) error {
+		c.dir = dir
+		return nil
+	}
+}
+
+// WithThrottle configures how a throttled run is divided into periods of
+// running and pausing, so that ingestion is not starved of disk I/O. A
+// throttled run alternates between running for the run duration and pausing
+// for the pause duration.
+func WithThrottle(run, pause time.Duration) Option {
+	return func(c *config) error {
+		if run <= 0 {
+			return fmt.Errorf("throttle run duration must be greater than 0")
+		}
+		if pause < 0 {
+			return fmt.Errorf("throttle pause duration cannot be negative")
+		}
+		c.throttleRun = run
+		c.throttlePause = pause
+		return nil
+	}
+}
+
+// WithCollector sets the Collector that runs garbage collection of the value
+// store. If not set, garbage collection is not supported.
+func WithCollector(collector Collector) Option {
+	return func(c *config) error {
+		c.collector = collector
+		return nil
+	}
+}
+
+// WithCompactor sets the Compactor that runs compaction of the value store.
+// If not set, compaction is not supported.
+func WithCompactor(compactor Compactor) Option {
+	return func(c *config) error {
+		c.compactor = compactor
+		return nil
+	}
+}
@@ -0,0 +1,108 @@
+package maintenance
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// compactRanges is the maximum number of key ranges that a pebble database is
+// divided into for compaction. Compaction can only stop between ranges.
+const compactRanges = 64
+
+// pebbleCompactor compacts a pebble database one key range at a time, so that
+// compaction can stop and later continue with the next range.
+type pebbleCompactor struct {
+	db *pebble.DB
+	// bounds are the boundaries of the key ranges being compacted, and next
+	// is the index of the start of the next range to compact. Bounds is nil
+	// when no compaction is in progress.
+	bounds [][]byte
+	next   int
+	mutex  sync.Mutex
+}
+
+// NewPebbleCompactor returns a Compactor that compacts the pebble database.
+func NewPebbleCompactor(db *pebble.DB) Compactor {
+	return &pebbleCompactor{
+		db: db,
+	}
+}
+
+// Compact compacts the database. At least one key range is compacted by each
+// call. If ctx is canceled, then compaction stops after the key range being
+// compacted, and the next call to Compact continues from the following range.
+func (c *pebbleCompactor) Compact(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.bounds == nil {
+		bounds, err := c.rangeBounds()
+		if err != nil {
+			return err
+		}
+		c.bounds = bounds
+		c.next = 0
+	}
+
+	for c.next < len(c.bounds)-1 {
+		if err := c.db.Compact(c.bounds[c.next], c.bounds[c.next+1], true); err != nil {
+			return err
+		}
+		c.next++
+		if c.next < len(c.bounds)-1 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	c.bounds = nil
+	return nil
+}
+
+// rangeBounds divides the keys in the database into at most compactRanges
+// ranges at the boundaries of the database tables. The last bound is after
+// the last key in the database.
+func (c *pebbleCompactor) rangeBounds() ([][]byte, error) {
+	iter := c.db.NewIter(nil)
+	var first, last []byte
+	if iter.First() {
+		first = append([]byte{}, iter.Key()...)
+		iter.Last()
+		last = append([]byte{}, iter.Key()...)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	if first == nil {
+		return nil, nil
+	}
+	end := append(last, 0)
+
+	tables, err := c.db.SSTables()
+	if err != nil {
+		return nil, err
+	}
+	var inner [][]byte
+	for _, level := range tables {
+		for _, table := range level {
+			key := table.Smallest.UserKey
+			if bytes.Compare(key, first) > 0 && bytes.Compare(key, end) < 0 {
+				inner = append(inner, key)
+			}
+		}
+	}
+	sort.Slice(inner, func(i, j int) bool {
+		return bytes.Compare(inner[i], inner[j]) < 0
+	})
+
+	bounds := [][]byte{first}
+	step := len(inner)/compactRanges + 1
+	for i := step - 1; i < len(inner); i += step {
+		if !bytes.Equal(inner[i], bounds[len(bounds)-1]) {
+			bounds = append(bounds, inner[i])
+		}
+	}
+	return append(bounds, end), nil
+}
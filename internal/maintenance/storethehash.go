@@ -0,0 +1,40 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+
+	sth "github.com/ipld/go-storethehash/store"
+	mhprimary "github.com/ipld/go-storethehash/store/primary/multihash"
+)
+
+// lowUsePercent is the percentage of a storethehash primary file that must
+// be deleted records for the file to be compacted by GC.
+const lowUsePercent = 85
+
+// sthCollector runs garbage collection of a storethehash store.
+type sthCollector struct {
+	store *sth.Store
+}
+
+// NewSthCollector returns a Collector that runs garbage collection of the
+// storethehash store. The store must have been opened with a GC interval,
+// since GC is otherwise disabled.
+func NewSthCollector(store *sth.Store) Collector {
+	return &sthCollector{
+		store: store,
+	}
+}
+
+// GC removes deleted records from the store's primary files. The primary
+// files already collected are remembered by the store, so if ctx is canceled
+// the next call to GC continues with the files not yet collected. The store's
+// free list is applied again by each call, and is not resumable.
+func (c *sthCollector) GC(ctx context.Context) error {
+	primary, ok := c.store.Primary().(*mhprimary.MultihashPrimary)
+	if !ok {
+		return errors.New("storethehash primary does not support gc")
+	}
+	_, err := primary.GC(ctx, lowUsePercent)
+	return err
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// Assigner tags
+var (
+	Indexer, _ = tag.NewKey("indexer")
+	Reason, _  = tag.NewKey("reason")
+)
+
+// Assigner measures
+var (
+	IndexerUsage             = stats.Float64("assigner/indexerUsage", "Percent usage of storage available in indexer value store", stats.UnitDimensionless)
+	IndexerIndexCount        = stats.Int64("assigner/indexerIndexCount", "Number of indexes stored by indexer for all providers", stats.UnitDimensionless)
+	IndexerCapacity          = stats.Float64("assigner/indexerCapacity", "Weighted free capacity of indexer, from 0 to 1", stats.UnitDimensionless)
+	AssignmentCount          = stats.Int64("assigner/assignmentCount", "Number of publishers assigned to indexer", stats.UnitDimensionless)
+	IndexerSkippedCount      = stats.Int64("assigner/indexerSkipped", "Number of times an indexer was not considered for assignment", stats.UnitDimensionless)
+	PublisherMoveCount       = stats.Int64("assigner/publisherMoves", "Number of publishers moved to indexer by rebalancing or draining", stats.UnitDimensionless)
+	IndexerUp                = stats.Int64("assigner/indexerUp", "Whether indexer passed its last health check, 1 if healthy or 0 if not", stats.UnitDimensionless)
+	IndexerHealthChangeCount = stats.Int64("assigner/indexerHealthChanges", "Number of times indexer became unreachable, down, or recovered", stats.UnitDimensionless)
+	ReplicaRestoreCount      = stats.Int64("assigner/replicaRestores", "Number of publishers assigned to indexer to restore replication, or that could not be", stats.UnitDimensionless)
+	ReplicaReconcileCount    = stats.Int64("assigner/replicaReconciles", "Number of publishers kept or unassigned when recovered indexer was reconciled", stats.UnitDimensionless)
+)
+
+// AssignerViews are the views of the assigner service measures.
+var AssignerViews = []*view.View{
+	{
+		Measure:     IndexerUsage,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{Indexer},
+	},
+	{
+		Measure:     IndexerIndexCount,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{Indexer},
+	},
+	{
+		Measure:     IndexerCapacity,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{Indexer},
+	},
+	{
+		Measure:     AssignmentCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{Indexer},
+	},
+	{
+		Measure:     IndexerSkippedCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{Indexer, Reason},
+	},
+	{
+		Measure:     PublisherMoveCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{Indexer, Reason},
+	},
+	{
+		Measure:     IndexerUp,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{Indexer},
+	},
+	{
+		Measure:     IndexerHealthChangeCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{Indexer, Reason},
+	},
+	{
+		Measure:     ReplicaRestoreCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{Indexer, Reason},
+	},
+	{
+		Measure:     ReplicaReconcileCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{Indexer, Reason},
+	},
+}
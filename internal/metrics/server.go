@@ -22,22 +22,25 @@ var (
 
 // Measures
 var (
-	FindLatency          = stats.Float64("find/latency", "Time to respond to a find request", stats.UnitMilliseconds)
-	IngestChange         = stats.Int64("ingest/change", "Number of syncAdEntries started", stats.UnitDimensionless)
-	AdIngestLatency      = stats.Float64("ingest/adsynclatency", "latency of syncAdEntries completed successfully", stats.UnitDimensionless)
-	AdIngestErrorCount   = stats.Int64("ingest/adingestError", "Number of errors encountered while processing an ad", stats.UnitDimensionless)
-	AdIngestQueued       = stats.Int64("ingest/adingestqueued", "Number of queued advertisements", stats.UnitDimensionless)
-	AdIngestBacklog      = stats.Int64("ingest/adbacklog", "Queued backlog of adverts", stats.UnitDimensionless)
-	AdIngestActive       = stats.Int64("ingest/adactive", "Active ingest workers", stats.UnitDimensionless)
-	AdIngestSuccessCount = stats.Int64("ingest/adingestSuccess", "Number of successful ad ingest", stats.UnitDimensionless)
-	AdIngestSkippedCount = stats.Int64("ingest/adingestSkipped", "Number of ads skipped during ingest", stats.UnitDimensionless)
-	AdLoadError          = stats.Int64("ingest/adLoadError", "Number of times an ad failed to load", stats.UnitDimensionless)
-	ProviderCount        = stats.Int64("provider/count", "Number of known (registered) providers", stats.UnitDimensionless)
-	EntriesSyncLatency   = stats.Float64("ingest/entriessynclatency", "How long it took to sync an Ad's entries", stats.UnitMilliseconds)
-	IndexCount           = stats.Int64("provider/indexCount", "Number of indexes stored for all providers", stats.UnitDimensionless)
-	PercentUsage         = stats.Float64("ingest/percentusage", "Percent usage of storage available in value store", stats.UnitDimensionless)
-	NonRemoveAdCount     = stats.Int64("ingest/nonremoveadcount", "Number of non-removal advertisements", stats.UnitDimensionless)
-	RemoveAdCount        = stats.Int64("ingest/removeadcount", "Number of removal advertisements", stats.UnitDimensionless)
+	FindLatency              = stats.Float64("find/latency", "Time to respond to a find request", stats.UnitMilliseconds)
+	IngestChange             = stats.Int64("ingest/change", "Number of syncAdEntries started", stats.UnitDimensionless)
+	AdIngestLatency          = stats.Float64("ingest/adsynclatency", "latency of syncAdEntries completed successfully", stats.UnitDimensionless)
+	AdIngestErrorCount       = stats.Int64("ingest/adingestError", "Number of errors encountered while processing an ad", stats.UnitDimensionless)
+	AdIngestQueued           = stats.Int64("ingest/adingestqueued", "Number of queued advertisements", stats.UnitDimensionless)
+	AdIngestBacklog          = stats.Int64("ingest/adbacklog", "Queued backlog of adverts", stats.UnitDimensionless)
+	AdIngestActive           = stats.Int64("ingest/adactive", "Active ingest workers", stats.UnitDimensionless)
+	AdIngestSuccessCount     = stats.Int64("ingest/adingestSuccess", "Number of successful ad ingest", stats.UnitDimensionless)
+	AdIngestSkippedCount     = stats.Int64("ingest/adingestSkipped", "Number of ads skipped during ingest", stats.UnitDimensionless)
+	AdLoadError              = stats.Int64("ingest/adLoadError", "Number of times an ad failed to load", stats.UnitDimensionless)
+	ProviderCount            = stats.Int64("provider/count", "Number of known (registered) providers", stats.UnitDimensionless)
+	EntriesSyncLatency       = stats.Float64("ingest/entriessynclatency", "How long it took to sync an Ad's entries", stats.UnitMilliseconds)
+	IndexCount               = stats.Int64("provider/indexCount", "Number of indexes stored for all providers", stats.UnitDimensionless)
+	PercentUsage             = stats.Float64("ingest/percentusage", "Percent usage of storage available in value store", stats.UnitDimensionless)
+	NonRemoveAdCount         = stats.Int64("ingest/nonremoveadcount", "Number of non-removal advertisements", stats.UnitDimensionless)
+	RemoveAdCount            = stats.Int64("ingest/removeadcount", "Number of removal advertisements", stats.UnitDimensionless)
+	UnreachableProviderCount = stats.Int64("provider/unreachableCount", "Number of providers that failed the most recent reachability probe", stats.UnitDimensionless)
+	ReplayRejectCount        = stats.Int64("ingest/replayRejectCount", "Number of signed requests rejected as replays", stats.UnitDimensionless)
+	DiskPressureLevel        = stats.Int64("ingest/diskPressureLevel", "Current disk pressure level, where 0 means no pressure", stats.UnitDimensionless)
 )
 
 // Views
@@ -109,6 +112,19 @@ var (
 		Measure:     RemoveAdCount,
 		Aggregation: view.LastValue(),
 	}
+	unreachableProviderCountView = &view.View{
+		Measure:     UnreachableProviderCount,
+		Aggregation: view.LastValue(),
+	}
+	replayRejectCountView = &view.View{
+		Measure:     ReplayRejectCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{ErrKind},
+	}
+	diskPressureLevelView = &view.View{
+		Measure:     DiskPressureLevel,
+		Aggregation: view.LastValue(),
+	}
 )
 
 var log = logging.Logger("indexer/metrics")
@@ -133,6 +149,9 @@ func Start(views []*view.View) http.Handler {
 		percentUsageView,
 		nonRemoveAdCountView,
 		removeAdCountView,
+		unreachableProviderCountView,
+		replayRejectCountView,
+		diskPressureLevelView,
 	)
 	if err != nil {
 		log.Errorf("cannot register metrics default views: %s", err)
@@ -0,0 +1,351 @@
+// Package migrate copies all multihashes and values from one value store to
+// another, such as when changing the type of value store an indexer uses.
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipni/go-indexer-core"
+	"github.com/multiformats/go-multihash"
+)
+
+var log = logging.Logger("indexer/migrate")
+
+// maxFailures is the maximum number of verification failures that are
+// described in a Verification.
+const maxFailures = 10
+
+// Stats are the counts of items migrated.
+type Stats struct {
+	// Multihashes is the number of multihashes read from the source,
+	// including any migrated by a previous run that was resumed.
+	Multihashes uint64
+	// Values is the number of values written to the destination.
+	Values uint64
+	// Skipped is the number of multihashes not migrated because their digest
+	// length is less than the minimum key length.
+	Skipped uint64
+	// Resumed is the number of multihashes that were migrated by a previous
+	// run, and were not migrated again.
+	Resumed uint64
+}
+
+// Verification is the result of comparing sampled multihashes in the source
+// and destination value stores.
+type Verification struct {
+	// Sampled is the number of multihashes compared.
+	Sampled int
+	// Matched is the number of multihashes for which the destination has all
+	// of the source values.
+	Matched int
+	// Missing is the number of multihashes not found in the destination.
+	Missing int
+	// Mismatched is the number of multihashes for which the destination is
+	// missing one or more source values.
+	Mismatched int
+	// Failures describes some of the missing and mismatched multihashes.
+	Failures []string
+}
+
+// checkpoint records the progress of a migration.
+type checkpoint struct {
+	ID            string
+	Stats         Stats
+	LastMultihash multihash.Multihash
+	Updated       time.Time
+}
+
+// Migrator copies all multihashes and values from a source to a destination
+// value store.
+type Migrator struct {
+	dst     indexer.Interface
+	opts    config
+	samples []multihash.Multihash
+	src     indexer.Interface
+}
+
+// New creates a new Migrator that migrates from src to dst.
+func New(src, dst indexer.Interface, options ...Option) (*Migrator, error) {
+	opts, err := getOpts(options)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		dst:  dst,
+		opts: opts,
+		src:  src,
+	}, nil
+}
+
+type pendingPut struct {
+	value indexer.Value
+	mhs   []multihash.Multihash
+}
+
+// Run migrates all multihashes and values from the source to the destination.
+// If a checkpoint from a previous run exists, then migration resumes after the
+// last checkpointed multihash. When migration completes, the checkpoint file is
+// removed. If Run is canceled, a checkpoint is written so that migration can
+// be resumed.
+func (m *Migrator) Run(ctx context.Context) (Stats, error) {
+	cp, err := m.loadCheckpoint()
+	if err != nil {
+		return Stats{}, err
+	}
+	var stats Stats
+	var resumeAt uint64
+	if cp != nil {
+		resumeAt = cp.Stats.Multihashes
+		stats = cp.Stats
+		stats.Multihashes = 0
+		stats.Resumed = resumeAt
+		log.Infow("Resuming migration from checkpoint", "multihashes", resumeAt, "updated", cp.Updated)
+	}
+
+	iter, err := m.src.Iter()
+	if err != nil {
+		return Stats{}, fmt.Errorf("cannot iterate source value store: %w", err)
+	}
+	defer iter.Close()
+
+	pending := make(map[string]*pendingPut)
+	var pendingCount int
+	flushPending := func() error {
+		for _, put := range pending {
+			if err := m.dst.Put(put.value, put.mhs...); err != nil {
+				return fmt.Errorf("cannot write to destination value store: %w", err)
+			}
+		}
+		pending = make(map[string]*pendingPut)
+		pendingCount = 0
+		return nil
+	}
+	writeCheckpoint := func(lastMH multihash.Multihash) error {
+		if err := flushPending(); err != nil {
+			return err
+		}
+		if err := m.dst.Flush(); err != nil {
+			return fmt.Errorf("cannot flush destination value store: %w", err)
+		}
+		if err := m.saveCheckpoint(stats, lastMH); err != nil {
+			return err
+		}
+		if m.opts.progress != nil {
+			m.opts.progress(stats)
+		}
+		return nil
+	}
+
+	var lastMH multihash.Multihash
+	var seen int
+	for {
+		mh, values, err := iter.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return stats, fmt.Errorf("cannot read from source value store: %w", err)
+		}
+		stats.Multihashes++
+
+		if stats.Multihashes <= resumeAt {
+			if stats.Multihashes == resumeAt && !bytes.Equal(mh, cp.LastMultihash) {
+				return stats, errors.New("source value store changed since checkpoint, cannot resume")
+			}
+			if m.migratable(mh) {
+				m.sample(mh, &seen)
+			}
+			continue
+		}
+
+		if !m.migratable(mh) {
+			stats.Skipped++
+			continue
+		}
+		for _, value := range values {
+			key := string(value.ProviderID) + string(value.ContextID) + string(value.MetadataBytes)
+			put, ok := pending[key]
+			if !ok {
+				put = &pendingPut{value: value}
+				pending[key] = put
+			}
+			put.mhs = append(put.mhs, mh)
+			pendingCount++
+		}
+		stats.Values += uint64(len(values))
+		m.sample(mh, &seen)
+		lastMH = mh
+
+		if pendingCount >= m.opts.batchSize {
+			if err = flushPending(); err != nil {
+				return stats, err
+			}
+		}
+		if stats.Multihashes%m.opts.checkpointInterval == 0 || ctx.Err() != nil {
+			if err = writeCheckpoint(mh); err != nil {
+				return stats, err
+			}
+			if ctx.Err() != nil {
+				return stats, ctx.Err()
+			}
+		}
+	}
+	if stats.Multihashes < resumeAt {
+		return stats, errors.New("source value store changed since checkpoint, cannot resume")
+	}
+
+	if err = flushPending(); err != nil {
+		return stats, err
+	}
+	if err = m.dst.Flush(); err != nil {
+		return stats, fmt.Errorf("cannot flush destination value store: %w", err)
+	}
+	if m.opts.checkpointPath != "" {
+		if err = os.Remove(m.opts.checkpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return stats, fmt.Errorf("cannot remove checkpoint: %w", err)
+		}
+	}
+	log.Infow("Migration complete", "multihashes", stats.Multihashes, "values", stats.Values, "lastMultihash", lastMH)
+	return stats, nil
+}
+
+// Verify compares the source and destination values of the multihashes
+// sampled during Run.
+func (m *Migrator) Verify(ctx context.Context) (Verification, error) {
+	var v Verification
+	for _, mh := range m.samples {
+		if ctx.Err() != nil {
+			return v, ctx.Err()
+		}
+		srcValues, _, err := m.src.Get(mh)
+		if err != nil {
+			return v, fmt.Errorf("cannot read from source value store: %w", err)
+		}
+		dstValues, found, err := m.dst.Get(mh)
+		if err != nil {
+			return v, fmt.Errorf("cannot read from destination value store: %w", err)
+		}
+		v.Sampled++
+		if !found {
+			v.Missing++
+			v.addFailure(fmt.Sprintf("%s: not found", mh.B58String()))
+			continue
+		}
+		var missing int
+		for _, srcValue := range srcValues {
+			if !containsValue(dstValues, srcValue) {
+				missing++
+			}
+		}
+		if missing != 0 {
+			v.Mismatched++
+			v.addFailure(fmt.Sprintf("%s: %d of %d values missing", mh.B58String(), missing, len(srcValues)))
+			continue
+		}
+		v.Matched++
+	}
+	return v, nil
+}
+
+func (v *Verification) addFailure(msg string) {
+	if len(v.Failures) < maxFailures {
+		v.Failures = append(v.Failures, msg)
+	}
+}
+
+func containsValue(values []indexer.Value, value indexer.Value) bool {
+	for i := range values {
+		if values[i].Equal(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// migratable returns true if the multihash meets the minimum key length.
+func (m *Migrator) migratable(mh multihash.Multihash) bool {
+	if m.opts.minKeyLen == 0 {
+		return true
+	}
+	dm, err := multihash.Decode(mh)
+	if err != nil {
+		return false
+	}
+	return dm.Length >= m.opts.minKeyLen
+}
+
+// sample uses reservoir sampling to select multihashes for verification. The
+// seen count is the number of multihashes considered for sampling.
+func (m *Migrator) sample(mh multihash.Multihash, seen *int) {
+	if m.opts.sampleSize == 0 {
+		return
+	}
+	*seen++
+	if len(m.samples) < m.opts.sampleSize {
+		m.samples = append(m.samples, mh)
+		return
+	}
+	if i := rand.Intn(*seen); i < m.opts.sampleSize {
+		m.samples[i] = mh
+	}
+}
+
+func (m *Migrator) loadCheckpoint() (*checkpoint, error) {
+	if m.opts.checkpointPath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(m.opts.checkpointPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read checkpoint: %w", err)
+	}
+	var cp checkpoint
+	if err = json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("cannot decode checkpoint: %w", err)
+	}
+	if cp.ID != m.opts.checkpointID {
+		return nil, fmt.Errorf("checkpoint %s is for a different migration: %s", m.opts.checkpointPath, cp.ID)
+	}
+	return &cp, nil
+}
+
+func (m *Migrator) saveCheckpoint(stats Stats, lastMH multihash.Multihash) error {
+	if m.opts.checkpointPath == "" {
+		return nil
+	}
+	// Record the total number of multihashes read from the source, since
+	// that is where a resumed migration continues from.
+	cp := checkpoint{
+		ID:            m.opts.checkpointID,
+		Stats:         stats,
+		LastMultihash: lastMH,
+		Updated:       time.Now(),
+	}
+	cp.Stats.Resumed = 0
+	data, err := json.Marshal(&cp)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file and rename, so that a checkpoint is never
+	// partially written.
+	tmpName := filepath.Join(filepath.Dir(m.opts.checkpointPath), "."+filepath.Base(m.opts.checkpointPath)+".tmp")
+	if err = os.WriteFile(tmpName, data, 0o644); err != nil {
+		return fmt.Errorf("cannot write checkpoint: %w", err)
+	}
+	if err = os.Rename(tmpName, m.opts.checkpointPath); err != nil {
+		return fmt.Errorf("cannot write checkpoint: %w", err)
+	}
+	return nil
+}
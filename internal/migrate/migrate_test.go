@@ -0,0 +1,121 @@
+package migrate_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipni/go-indexer-core"
+	"github.com/ipni/go-indexer-core/store/memory"
+	"github.com/ipni/go-libipni/test"
+	"github.com/ipni/storetheindex/internal/migrate"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+// orderedStore is a value store that iterates in the order multihashes were
+// put, so that an interrupted migration can be resumed.
+type orderedStore struct {
+	indexer.Interface
+	mhs []multihash.Multihash
+}
+
+type orderedIter struct {
+	store *orderedStore
+	i     int
+}
+
+func (s *orderedStore) Put(value indexer.Value, mhs ...multihash.Multihash) error {
+	s.mhs = append(s.mhs, mhs...)
+	return s.Interface.Put(value, mhs...)
+}
+
+func (s *orderedStore) Iter() (indexer.Iterator, error) {
+	return &orderedIter{store: s}, nil
+}
+
+func (it *orderedIter) Next() (multihash.Multihash, []indexer.Value, error) {
+	if it.i == len(it.store.mhs) {
+		return nil, nil, io.EOF
+	}
+	mh := it.store.mhs[it.i]
+	it.i++
+	values, _, err := it.store.Get(mh)
+	return mh, values, err
+}
+
+func (it *orderedIter) Close() error { return nil }
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	provID, err := peer.Decode("12D3KooWKRyzVWW6ChFjQjK4miCty85Niy48tpPV95XdKu1BcvMA")
+	require.NoError(t, err)
+
+	src := &orderedStore{Interface: memory.New()}
+	value1 := indexer.Value{ProviderID: provID, ContextID: []byte("ctx1"), MetadataBytes: []byte("md1")}
+	value2 := indexer.Value{ProviderID: provID, ContextID: []byte("ctx2"), MetadataBytes: []byte("md2")}
+	mhs := test.RandomMultihashes(50)
+	require.NoError(t, src.Put(value1, mhs[:30]...))
+	require.NoError(t, src.Put(value2, mhs[30:]...))
+	require.NoError(t, src.Interface.Put(value1, mhs[40:]...))
+
+	cpPath := filepath.Join(t.TempDir(), "checkpoint")
+	dst := memory.New()
+
+	// Cancel migration after the first checkpoint.
+	cctx, cancel := context.WithCancel(ctx)
+	var progress []migrate.Stats
+	m, err := migrate.New(src, dst,
+		migrate.WithCheckpoint(cpPath, "test"),
+		migrate.WithCheckpointInterval(20),
+		migrate.WithProgress(func(stats migrate.Stats) {
+			progress = append(progress, stats)
+			cancel()
+		}))
+	require.NoError(t, err)
+	_, err = m.Run(cctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, progress, 1)
+	require.Equal(t, uint64(20), progress[0].Multihashes)
+	require.FileExists(t, cpPath)
+
+	// Checkpoint for a different migration cannot be resumed.
+	m, err = migrate.New(src, dst, migrate.WithCheckpoint(cpPath, "other"))
+	require.NoError(t, err)
+	_, err = m.Run(ctx)
+	require.ErrorContains(t, err, "different migration")
+
+	m, err = migrate.New(src, dst, migrate.WithCheckpoint(cpPath, "test"), migrate.WithSampleSize(10))
+	require.NoError(t, err)
+	stats, err := m.Run(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(50), stats.Multihashes)
+	require.Equal(t, uint64(20), stats.Resumed)
+	require.Equal(t, uint64(60), stats.Values)
+	require.NoFileExists(t, cpPath)
+
+	for _, mh := range mhs {
+		srcValues, _, err := src.Get(mh)
+		require.NoError(t, err)
+		dstValues, found, err := dst.Get(mh)
+		require.NoError(t, err)
+		require.True(t, found)
+		require.ElementsMatch(t, srcValues, dstValues)
+	}
+
+	v, err := m.Verify(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 10, v.Sampled)
+	require.Equal(t, 10, v.Matched)
+
+	// Verification detects multihashes missing from the destination.
+	require.NoError(t, dst.RemoveProvider(ctx, provID))
+	v, err = m.Verify(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 10, v.Sampled)
+	require.Zero(t, v.Matched)
+	require.Equal(t, 10, v.Missing)
+	require.Len(t, v.Failures, 10)
+}
@@ -0,0 +1,106 @@
+package migrate
+
+import (
+	"fmt"
+)
+
+const (
+	defaultBatchSize          = 1024
+	defaultCheckpointInterval = 100000
+	defaultSampleSize         = 1000
+)
+
+// config contains all options for the Migrator.
+type config struct {
+	batchSize          int
+	checkpointID       string
+	checkpointInterval uint64
+	checkpointPath     string
+	minKeyLen          int
+	progress           func(Stats)
+	sampleSize         int
+}
+
+// Option is a function that sets a value in a config.
+type Option func(*config) error
+
+// getOpts creates a config and applies Options to it.
+func getOpts(opts []Option) (config, error) {
+	cfg := config{
+		batchSize:          defaultBatchSize,
+		checkpointInterval: defaultCheckpointInterval,
+		sampleSize:         defaultSampleSize,
+	}
+	for i, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return config{}, fmt.Errorf("option %d error: %s", i, err)
+		}
+	}
+	return cfg, nil
+}
+
+// WithBatchSize sets the maximum number of multihashes that are written to
+// the destination value store in a single put.
+func WithBatchSize(n int) Option {
+	return func(c *config) error {
+		if n < 1 {
+			return fmt.Errorf("batch size must be at least 1")
+		}
+		c.batchSize = n
+		return nil
+	}
+}
+
+// WithCheckpoint configures the file where migration progress is recorded,
+// so that an interrupted migration can be resumed. The id identifies the
+// source and destination of the migration. An existing checkpoint with a
+// different id is not resumed.
+func WithCheckpoint(path, id string) Option {
+	return func(c *config) error {
+		c.checkpointPath = path
+		c.checkpointID = id
+		return nil
+	}
+}
+
+// WithCheckpointInterval sets the number of multihashes to migrate between
+// writing checkpoints.
+func WithCheckpointInterval(n uint64) Option {
+	return func(c *config) error {
+		if n == 0 {
+			return fmt.Errorf("checkpoint interval must be at least 1")
+		}
+		c.checkpointInterval = n
+		return nil
+	}
+}
+
+// WithMinKeyLength causes multihashes with a digest length less than n to be
+// skipped, for destination value stores that require a minimum key length.
+func WithMinKeyLength(n int) Option {
+	return func(c *config) error {
+		c.minKeyLen = n
+		return nil
+	}
+}
+
+// WithProgress sets a function that is called with the current statistics
+// each time a checkpoint is written.
+func WithProgress(progress func(Stats)) Option {
+	return func(c *config) error {
+		c.progress = progress
+		return nil
+	}
+}
+
+// WithSampleSize sets the number of multihashes that are randomly sampled,
+// during migration, for verification. A value of 0 disables sampling.
+func WithSampleSize(n int) Option {
+	return func(c *config) error {
+		if n < 0 {
+			return fmt.Errorf("sample size cannot be negative")
+		}
+		c.sampleSize = n
+		return nil
+	}
+}
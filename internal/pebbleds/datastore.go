@@ -0,0 +1,341 @@
+// Package pebbleds implements a go-datastore backed by pebble.
+package pebbleds
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/bloom"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+)
+
+// ErrClosed is returned when using a datastore that is closed.
+var ErrClosed = errors.New("datastore closed")
+
+// Datastore is a go-datastore backed by pebble.
+//
+// Individual writes are not synced to disk, so that frequent small writes do
+// not each wait for disk I/O. The write-ahead log is synced when Sync is
+// called and when the datastore is closed.
+type Datastore struct {
+	closed  bool
+	closeLk sync.RWMutex
+	db      *pebble.DB
+	// iters are the iterators of queries that are not yet closed. These are
+	// closed when the datastore is closed.
+	iters   map[*pebble.Iterator]struct{}
+	itersLk sync.Mutex
+}
+
+var _ ds.Batching = (*Datastore)(nil)
+
+// DefaultOptions returns pebble options tuned for the indexer datastore. The
+// indexer writes and deletes many small keys, such as processed advertisement
+// markers, and frequently checks for the existence of keys. The options favor
+// absorbing writes in large memtables and compacting L0 early, and use bloom
+// filters to speed up lookups of keys that do not exist. The options hold a
+// reference to a new block cache.
+func DefaultOptions() *pebble.Options {
+	opts := &pebble.Options{
+		BytesPerSync:                1 << 20, // 1 MiB
+		Cache:                       pebble.NewCache(64 << 20),
+		L0CompactionThreshold:       2,
+		L0StopWritesThreshold:       1000,
+		LBaseMaxBytes:               64 << 20, // 64 MiB
+		MaxConcurrentCompactions:    4,
+		MemTableSize:                64 << 20, // 64 MiB
+		MemTableStopWritesThreshold: 4,
+	}
+	const numLevels = 7
+	opts.Levels = make([]pebble.LevelOptions, numLevels)
+	for i := 0; i < numLevels; i++ {
+		l := &opts.Levels[i]
+		l.BlockSize = 32 << 10 // 32 KiB
+		l.FilterPolicy = bloom.FilterPolicy(10)
+		l.FilterType = pebble.TableFilter
+		if i > 0 {
+			l.TargetFileSize = opts.Levels[i-1].TargetFileSize * 2
+		}
+		l.EnsureDefaults()
+	}
+	return opts
+}
+
+// New opens the pebble datastore in the directory at path, creating it if it
+// does not exist. If opts is nil, then DefaultOptions are used. If opts has a
+// Cache, the caller keeps its reference to the cache and must Unref it when
+// no longer used.
+func New(path string, opts *pebble.Options) (*Datastore, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+		// The opened DB holds its own reference to the cache, so release the
+		// reference from creating it, allowing the cache to be freed when
+		// the DB is closed.
+		defer opts.Cache.Unref()
+	}
+	db, err := pebble.Open(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Datastore{
+		db:    db,
+		iters: make(map[*pebble.Iterator]struct{}),
+	}, nil
+}
+
+func (d *Datastore) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	d.closeLk.RLock()
+	defer d.closeLk.RUnlock()
+	if d.closed {
+		return nil, ErrClosed
+	}
+
+	val, closer, err := d.db.Get(key.Bytes())
+	if err != nil {
+		if errors.Is(err, pebble.ErrNotFound) {
+			return nil, ds.ErrNotFound
+		}
+		return nil, err
+	}
+	// The value is only valid until closer is closed, so copy it.
+	buf := make([]byte, len(val))
+	copy(buf, val)
+	if err = closer.Close(); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (d *Datastore) Has(ctx context.Context, key ds.Key) (bool, error) {
+	d.closeLk.RLock()
+	defer d.closeLk.RUnlock()
+	if d.closed {
+		return false, ErrClosed
+	}
+
+	_, closer, err := d.db.Get(key.Bytes())
+	if err != nil {
+		if errors.Is(err, pebble.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, closer.Close()
+}
+
+func (d *Datastore) GetSize(ctx context.Context, key ds.Key) (int, error) {
+	d.closeLk.RLock()
+	defer d.closeLk.RUnlock()
+	if d.closed {
+		return -1, ErrClosed
+	}
+
+	val, closer, err := d.db.Get(key.Bytes())
+	if err != nil {
+		if errors.Is(err, pebble.ErrNotFound) {
+			return -1, ds.ErrNotFound
+		}
+		return -1, err
+	}
+	size := len(val)
+	return size, closer.Close()
+}
+
+func (d *Datastore) Put(ctx context.Context, key ds.Key, value []byte) error {
+	d.closeLk.RLock()
+	defer d.closeLk.RUnlock()
+	if d.closed {
+		return ErrClosed
+	}
+	return d.db.Set(key.Bytes(), value, pebble.NoSync)
+}
+
+func (d *Datastore) Delete(ctx context.Context, key ds.Key) error {
+	d.closeLk.RLock()
+	defer d.closeLk.RUnlock()
+	if d.closed {
+		return ErrClosed
+	}
+	return d.db.Delete(key.Bytes(), pebble.NoSync)
+}
+
+// Sync syncs the write-ahead log to disk, which makes all previous writes
+// durable regardless of prefix.
+func (d *Datastore) Sync(ctx context.Context, prefix ds.Key) error {
+	d.closeLk.RLock()
+	defer d.closeLk.RUnlock()
+	if d.closed {
+		return ErrClosed
+	}
+	return d.db.LogData(nil, pebble.Sync)
+}
+
+func (d *Datastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	d.closeLk.RLock()
+	defer d.closeLk.RUnlock()
+	if d.closed {
+		return nil, ErrClosed
+	}
+
+	// Make a copy of the query for the fallback naive query implementation.
+	// Do not modify the original so that Results.Query() returns the
+	// original query.
+	qNaive := q
+	var iterOpts pebble.IterOptions
+	prefix := ds.NewKey(q.Prefix).String()
+	if prefix != "/" {
+		iterOpts.LowerBound = []byte(prefix + "/")
+		iterOpts.UpperBound = prefixEnd(iterOpts.LowerBound)
+		qNaive.Prefix = ""
+	}
+	iter := d.db.NewIter(&iterOpts)
+	d.itersLk.Lock()
+	d.iters[iter] = struct{}{}
+	d.itersLk.Unlock()
+
+	first := iter.First
+	next := iter.Next
+	if len(q.Orders) != 0 {
+		switch q.Orders[0].(type) {
+		case dsq.OrderByKey, *dsq.OrderByKey:
+			qNaive.Orders = nil
+		case dsq.OrderByKeyDescending, *dsq.OrderByKeyDescending:
+			first = iter.Last
+			next = iter.Prev
+			qNaive.Orders = nil
+		}
+	}
+
+	var started bool
+	r := dsq.ResultsFromIterator(q, dsq.Iterator{
+		Next: func() (dsq.Result, bool) {
+			d.closeLk.RLock()
+			defer d.closeLk.RUnlock()
+			if d.closed {
+				return dsq.Result{Error: ErrClosed}, true
+			}
+
+			var ok bool
+			if started {
+				ok = next()
+			} else {
+				ok = first()
+				started = true
+			}
+			if !ok {
+				if err := iter.Error(); err != nil {
+					return dsq.Result{Error: err}, true
+				}
+				return dsq.Result{}, false
+			}
+
+			val := iter.Value()
+			e := dsq.Entry{
+				Key:  string(iter.Key()),
+				Size: len(val),
+			}
+			if !q.KeysOnly {
+				e.Value = make([]byte, len(val))
+				copy(e.Value, val)
+			}
+			return dsq.Result{Entry: e}, true
+		},
+		Close: func() error {
+			d.closeLk.RLock()
+			defer d.closeLk.RUnlock()
+			if d.closed {
+				// Iterator was closed when the datastore was closed.
+				return nil
+			}
+			d.itersLk.Lock()
+			_, ok := d.iters[iter]
+			delete(d.iters, iter)
+			d.itersLk.Unlock()
+			if !ok {
+				return nil
+			}
+			return iter.Close()
+		},
+	})
+	return dsq.NaiveQueryApply(qNaive, r), nil
+}
+
+// Close syncs the write-ahead log and closes the datastore. The iterators of
+// queries that are still open are closed, and the results of these queries
+// return ErrClosed.
+func (d *Datastore) Close() error {
+	d.closeLk.Lock()
+	defer d.closeLk.Unlock()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+
+	d.itersLk.Lock()
+	for iter := range d.iters {
+		iter.Close()
+	}
+	d.iters = nil
+	d.itersLk.Unlock()
+
+	err := d.db.LogData(nil, pebble.Sync)
+	if cerr := d.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (d *Datastore) Batch(ctx context.Context) (ds.Batch, error) {
+	d.closeLk.RLock()
+	defer d.closeLk.RUnlock()
+	if d.closed {
+		return nil, ErrClosed
+	}
+	return &batch{
+		b:  d.db.NewBatch(),
+		ds: d,
+	}, nil
+}
+
+type batch struct {
+	b  *pebble.Batch
+	ds *Datastore
+}
+
+func (b *batch) Put(ctx context.Context, key ds.Key, value []byte) error {
+	return b.b.Set(key.Bytes(), value, nil)
+}
+
+func (b *batch) Delete(ctx context.Context, key ds.Key) error {
+	return b.b.Delete(key.Bytes(), nil)
+}
+
+func (b *batch) Commit(ctx context.Context) error {
+	b.ds.closeLk.RLock()
+	defer b.ds.closeLk.RUnlock()
+	if b.ds.closed {
+		return ErrClosed
+	}
+	err := b.b.Commit(pebble.NoSync)
+	if cerr := b.b.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// prefixEnd returns the smallest key that is greater than all keys that start
+// with prefix.
+func prefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		end[i]++
+		if end[i] != 0 {
+			return end[:i+1]
+		}
+	}
+	return nil
+}
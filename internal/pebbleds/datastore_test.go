@@ -0,0 +1,52 @@
+package pebbleds_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dstest "github.com/ipfs/go-datastore/test"
+	"github.com/ipni/storetheindex/internal/pebbleds"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuite(t *testing.T) {
+	ds, err := pebbleds.New(t.TempDir(), nil)
+	require.NoError(t, err)
+	defer ds.Close()
+
+	dstest.SubtestAll(t, ds)
+}
+
+func TestReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	ds, err := pebbleds.New(dir, nil)
+	require.NoError(t, err)
+	key := datastore.NewKey("/sync/abc")
+	require.NoError(t, ds.Put(ctx, key, []byte("value")))
+	require.NoError(t, ds.Close())
+
+	_, err = ds.Get(ctx, key)
+	require.ErrorIs(t, err, pebbleds.ErrClosed)
+
+	ds, err = pebbleds.New(dir, nil)
+	require.NoError(t, err)
+	val, err := ds.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), val)
+
+	// Closing the datastore closes the iterators of open queries.
+	results, err := ds.Query(ctx, query.Query{Prefix: "/sync"})
+	require.NoError(t, err)
+	result, ok := results.NextSync()
+	require.True(t, ok)
+	require.NoError(t, result.Error)
+	require.NoError(t, ds.Close())
+	result, ok = results.NextSync()
+	require.True(t, ok)
+	require.ErrorIs(t, result.Error, pebbleds.ErrClosed)
+	require.NoError(t, results.Close())
+}
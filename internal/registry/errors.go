@@ -9,8 +9,11 @@ var (
 	ErrFrozen              = errors.New("indexer frozen")
 	ErrMissingProviderAddr = errors.New("advertisement missing provider address")
 	ErrNotAllowed          = errors.New("peer not allowed by policy")
+	ErrNotRegistered       = errors.New("provider not registered")
 	ErrNoDiscovery         = errors.New("discovery not available")
 	ErrNoFreeze            = errors.New("freeze not configured")
+	ErrNotFrozen           = errors.New("indexer not frozen")
+	ErrNoPolling           = errors.New("polling not configured")
 	ErrNotVerified         = errors.New("provider cannot be verified")
 	ErrPublisherNotAllowed = errors.New("publisher not allowed by policy")
 	ErrTooSoon             = errors.New("not enough time since previous discovery")
@@ -0,0 +1,152 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Label is an operator-defined value attached to a provider. Labels are
+// identified by key, such as "org" or "tier".
+type Label struct {
+	Value string
+	// Public labels are included in public provider information. Labels are
+	// private by default.
+	Public bool `json:",omitempty"`
+}
+
+// MatchLabels returns true if the provider's labels match all of the
+// selectors. A selector is either "key=value", which matches a label having
+// that key and value, or "key", which matches any label with that key. If
+// publicOnly is true, then only public labels are matched.
+func (p *ProviderInfo) MatchLabels(selectors []string, publicOnly bool) bool {
+	for _, selector := range selectors {
+		if !matchLabel(p.Labels, selector, publicOnly) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetLabel sets the value of a provider's label, replacing any existing label
+// with the same key. The label is persisted with the provider information.
+func (r *Registry) SetLabel(ctx context.Context, providerID peer.ID, key string, label Label) error {
+	if err := validateLabelKey(key); err != nil {
+		return err
+	}
+	errChan := make(chan error)
+	r.actions <- func() {
+		info, ok := r.providers[providerID]
+		if !ok {
+			errChan <- ErrNotRegistered
+			return
+		}
+		labels := make(map[string]Label, len(info.Labels)+1)
+		for k, v := range info.Labels {
+			labels[k] = v
+		}
+		labels[key] = label
+		errChan <- r.syncSetLabels(ctx, info, labels)
+	}
+	return <-errChan
+}
+
+// DeleteLabel removes a provider's label. Returns true if the provider had
+// the label.
+func (r *Registry) DeleteLabel(ctx context.Context, providerID peer.ID, key string) (bool, error) {
+	type result struct {
+		ok  bool
+		err error
+	}
+	resChan := make(chan result)
+	r.actions <- func() {
+		info, ok := r.providers[providerID]
+		if !ok {
+			resChan <- result{err: ErrNotRegistered}
+			return
+		}
+		if _, ok = info.Labels[key]; !ok {
+			resChan <- result{}
+			return
+		}
+		var labels map[string]Label
+		if len(info.Labels) > 1 {
+			labels = make(map[string]Label, len(info.Labels)-1)
+			for k, v := range info.Labels {
+				if k != key {
+					labels[k] = v
+				}
+			}
+		}
+		resChan <- result{true, r.syncSetLabels(ctx, info, labels)}
+	}
+	res := <-resChan
+	return res.ok, res.err
+}
+
+// HasLabel returns true if the peer is a provider that has a label matching
+// any of the selectors. Selectors have the same form as for MatchLabels.
+func (r *Registry) HasLabel(peerID peer.ID, selectors []string) bool {
+	if len(selectors) == 0 {
+		return false
+	}
+	r.labelMutex.RLock()
+	defer r.labelMutex.RUnlock()
+
+	labels, ok := r.labels[peerID]
+	if !ok {
+		return false
+	}
+	for _, selector := range selectors {
+		if matchLabel(labels, selector, false) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Registry) syncSetLabels(ctx context.Context, info *ProviderInfo, labels map[string]Label) error {
+	newInfo := *info
+	newInfo.Labels = labels
+	if err := r.syncPersistProvider(ctx, &newInfo); err != nil {
+		return fmt.Errorf("could not persist provider: %w", err)
+	}
+	r.providers[info.AddrInfo.ID] = &newInfo
+	r.syncIndexLabels(info.AddrInfo.ID, labels)
+	return nil
+}
+
+// syncIndexLabels updates the labels used to evaluate configuration that
+// selects providers by label.
+func (r *Registry) syncIndexLabels(providerID peer.ID, labels map[string]Label) {
+	r.labelMutex.Lock()
+	defer r.labelMutex.Unlock()
+
+	if len(labels) == 0 {
+		delete(r.labels, providerID)
+		return
+	}
+	r.labels[providerID] = labels
+}
+
+func matchLabel(labels map[string]Label, selector string, publicOnly bool) bool {
+	key, value, hasValue := strings.Cut(selector, "=")
+	label, ok := labels[key]
+	if !ok || (publicOnly && !label.Public) {
+		return false
+	}
+	return !hasValue || label.Value == value
+}
+
+func validateLabelKey(key string) error {
+	if key == "" {
+		return errors.New("empty label key")
+	}
+	if strings.ContainsAny(key, "=,") {
+		return errors.New("label key must not contain '=' or ','")
+	}
+	return nil
+}
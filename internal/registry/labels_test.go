@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipni/storetheindex/config"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabels(t *testing.T) {
+	ctx := context.Background()
+
+	provID, err := peer.Decode(limitedID)
+	require.NoError(t, err)
+	otherID, err := peer.Decode(limitedID2)
+	require.NoError(t, err)
+	maddr, err := multiaddr.NewMultiaddr(minerAddr)
+	require.NoError(t, err)
+
+	cfg := config.Discovery{
+		Policy: config.Policy{
+			Allow:        true,
+			ExceptLabels: []string{"tier=blocked"},
+			Publish:      true,
+		},
+		PollInterval:    config.Duration(time.Hour),
+		PollRetryAfter:  config.Duration(time.Hour),
+		PollStopAfter:   config.Duration(10 * time.Hour),
+		DeactivateAfter: config.Duration(10 * time.Hour),
+		PollOverrides: []config.Polling{
+			{
+				Label:    "tier=gold",
+				Interval: config.Duration(2 * time.Hour),
+			},
+		},
+	}
+
+	dstore := datastore.NewMapDatastore()
+	r, err := New(ctx, cfg, dstore)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	prov := peer.AddrInfo{ID: provID, Addrs: []multiaddr.Multiaddr{maddr}}
+	err = r.Update(ctx, prov, prov, cid.Undef, nil, 0)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, r.SetLabel(ctx, otherID, "org", Label{Value: "foo"}), ErrNotRegistered)
+	require.Error(t, r.SetLabel(ctx, provID, "", Label{Value: "foo"}))
+	require.Error(t, r.SetLabel(ctx, provID, "a=b", Label{Value: "foo"}))
+
+	require.NoError(t, r.SetLabel(ctx, provID, "org", Label{Value: "foo", Public: true}))
+	require.NoError(t, r.SetLabel(ctx, provID, "tier", Label{Value: "gold"}))
+
+	info, _ := r.ProviderInfo(provID)
+	require.Len(t, info.Labels, 2)
+	require.True(t, info.MatchLabels([]string{"org=foo", "tier"}, false))
+	require.False(t, info.MatchLabels([]string{"org=bar"}, false))
+	require.True(t, info.MatchLabels([]string{"org=foo"}, true))
+	require.False(t, info.MatchLabels([]string{"tier=gold"}, true), "private label matched as public")
+	require.True(t, r.HasLabel(provID, []string{"org=bar", "tier=gold"}))
+	require.False(t, r.HasLabel(otherID, []string{"org"}))
+
+	// Polling override selected by label.
+	status, err := r.PollStatus(provID)
+	require.NoError(t, err)
+	require.True(t, status.Override)
+	require.Equal(t, 2*time.Hour, status.Interval)
+
+	// Check that labels are kept when provider info is updated.
+	err = r.Update(ctx, prov, prov, cid.Undef, nil, 0)
+	require.NoError(t, err)
+	info, _ = r.ProviderInfo(provID)
+	require.Len(t, info.Labels, 2)
+
+	// Check that labels are persisted.
+	r.Close()
+	r, err = New(ctx, cfg, dstore)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+	info, _ = r.ProviderInfo(provID)
+	require.Equal(t, Label{Value: "foo", Public: true}, info.Labels["org"])
+	require.True(t, r.HasLabel(provID, []string{"tier=gold"}))
+
+	// Label in policy ExceptLabels blocks provider.
+	require.True(t, r.Allowed(provID))
+	require.NoError(t, r.SetLabel(ctx, provID, "tier", Label{Value: "blocked"}))
+	require.False(t, r.Allowed(provID))
+
+	ok, err := r.DeleteLabel(ctx, provID, "tier")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, r.Allowed(provID))
+	ok, err = r.DeleteLabel(ctx, provID, "tier")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	info, _ = r.ProviderInfo(provID)
+	require.Len(t, info.Labels, 1)
+}
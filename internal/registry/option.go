@@ -9,6 +9,8 @@ import (
 type regConfig struct {
 	freezeAtPercent float64
 	freezeDirs      []string
+	pressureFunc    func(int)
+	pressureLevels  []float64
 }
 
 // Option is a function that sets a value in a regConfig.
@@ -35,3 +37,16 @@ func WithFreezer(freezeDirs []string, freezeAtPercent float64) Option {
 		return nil
 	}
 }
+
+// WithPressureLevels configures disk usage percentages, below the freeze-at
+// percent, at which the indexer is under increasing levels of disk pressure.
+// The pressureFunc is called with the new level whenever the level changes.
+// Level 0 means there is no disk pressure. Pressure levels are evaluated by
+// the freezer, so these cannot be used when freezing is disabled.
+func WithPressureLevels(pressureLevels []float64, pressureFunc func(level int)) Option {
+	return func(c *regConfig) error {
+		c.pressureLevels = pressureLevels
+		c.pressureFunc = pressureFunc
+		return nil
+	}
+}
@@ -1,6 +1,7 @@
 package policy
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 
@@ -10,9 +11,10 @@ import (
 )
 
 type Policy struct {
-	allow   peerutil.Policy
-	publish peerutil.Policy
-	rwmutex sync.RWMutex
+	allow        peerutil.Policy
+	exceptLabels []string
+	publish      peerutil.Policy
+	rwmutex      sync.RWMutex
 }
 
 func New(cfg config.Policy) (*Policy, error) {
@@ -26,9 +28,16 @@ func New(cfg config.Policy) (*Policy, error) {
 		return nil, fmt.Errorf("bad publish policy: %s", err)
 	}
 
+	for _, selector := range cfg.ExceptLabels {
+		if selector == "" {
+			return nil, errors.New("bad allow policy: empty label in ExceptLabels")
+		}
+	}
+
 	return &Policy{
-		allow:   allow,
-		publish: publish,
+		allow:        allow,
+		exceptLabels: cfg.ExceptLabels,
+		publish:      publish,
 	}, nil
 }
 
@@ -39,6 +48,21 @@ func (p *Policy) Allowed(peerID peer.ID) bool {
 	return p.allow.Eval(peerID)
 }
 
+// AllowDefault returns true if peers are allowed by default.
+func (p *Policy) AllowDefault() bool {
+	p.rwmutex.RLock()
+	defer p.rwmutex.RUnlock()
+	return p.allow.Default()
+}
+
+// ExceptLabels returns the label selectors that identify providers that are
+// exceptions to the allow policy.
+func (p *Policy) ExceptLabels() []string {
+	p.rwmutex.RLock()
+	defer p.rwmutex.RUnlock()
+	return p.exceptLabels
+}
+
 // PublishAllowed returns true if policy allows the publisher to publish
 // advertisements for the identified provider, and the provider is allowed.
 func (p *Policy) PublishAllowed(publisherID, providerID peer.ID) bool {
@@ -94,6 +118,7 @@ func (p *Policy) Copy(other *Policy) {
 
 	other.rwmutex.RLock()
 	p.allow = other.allow
+	p.exceptLabels = other.exceptLabels
 	p.publish = other.publish
 	other.rwmutex.RUnlock()
 }
@@ -106,6 +131,7 @@ func (p *Policy) ToConfig() config.Policy {
 	return config.Policy{
 		Allow:         p.allow.Default(),
 		Except:        p.allow.ExceptStrings(),
+		ExceptLabels:  p.exceptLabels,
 		Publish:       p.publish.Default(),
 		PublishExcept: p.publish.ExceptStrings(),
 	}
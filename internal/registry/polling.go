@@ -0,0 +1,270 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipni/storetheindex/config"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// PollStatus describes how a provider's publisher is polled when there is no
+// contact from the publisher, and when polling will next take action.
+type PollStatus struct {
+	ProviderID peer.ID
+	// Override is true if the provider has a polling override.
+	Override bool
+	// Persisted is true if the override was set at runtime and is stored in
+	// the datastore, instead of coming from the config file.
+	Persisted bool
+	// Effective polling values for the provider.
+	Interval        time.Duration
+	RetryAfter      time.Duration
+	StopAfter       time.Duration
+	DeactivateAfter time.Duration
+	// LastContact is the last time the publisher contacted the indexer since
+	// the indexer started. The times below are only set if this is set.
+	LastContact time.Time
+	// NextPoll is when polling starts if there is no further contact.
+	NextPoll time.Time
+	// Deactivate is when the provider is excluded from find results if there
+	// is no further contact.
+	Deactivate time.Time
+	// Remove is when the provider is removed if there is no further contact.
+	Remove time.Time
+}
+
+// PollStatus returns the polling status of the specified provider. Returns
+// nil if the provider is not registered and has no polling override.
+func (r *Registry) PollStatus(providerID peer.ID) (*PollStatus, error) {
+	if r.pollDone == nil {
+		return nil, ErrNoPolling
+	}
+	statusChan := make(chan *PollStatus)
+	r.actions <- func() {
+		_, registered := r.providers[providerID]
+		_, overridden := r.pollOverrides[providerID]
+		if !registered && !overridden {
+			statusChan <- nil
+			return
+		}
+		statusChan <- r.syncPollStatus(providerID)
+	}
+	return <-statusChan, nil
+}
+
+// ListPollOverrides returns the polling status of all providers that have
+// polling overrides.
+func (r *Registry) ListPollOverrides() ([]*PollStatus, error) {
+	if r.pollDone == nil {
+		return nil, ErrNoPolling
+	}
+	statusChan := make(chan []*PollStatus)
+	r.actions <- func() {
+		statuses := make([]*PollStatus, 0, len(r.pollOverrides))
+		for _, providerID := range sortedPeerIDs(r.pollOverrides) {
+			statuses = append(statuses, r.syncPollStatus(providerID))
+		}
+		statusChan <- statuses
+	}
+	return <-statusChan, nil
+}
+
+// SetPollOverride sets the polling override for the provider identified by
+// override.ProviderID. Any zero values in the override use the normal polling
+// values. The override is persisted in the datastore, and takes precedence
+// over any override for the same provider in the config file.
+func (r *Registry) SetPollOverride(ctx context.Context, override config.Polling) error {
+	if r.pollDone == nil {
+		return ErrNoPolling
+	}
+	providerID, err := peer.Decode(override.ProviderID)
+	if err != nil {
+		return fmt.Errorf("cannot decode provider ID: %w", err)
+	}
+	if override.Interval < 0 || override.RetryAfter < 0 || override.StopAfter < 0 || override.DeactivateAfter < 0 {
+		return errors.New("polling override values must not be negative")
+	}
+	errChan := make(chan error)
+	r.actions <- func() {
+		errChan <- r.syncSetPollOverride(ctx, providerID, override)
+	}
+	return <-errChan
+}
+
+// DeletePollOverride removes the polling override, that was set at runtime,
+// for the specified provider. The provider then uses the override from the
+// config file, if there is one, or the normal polling values. Returns true if
+// there was an override to delete.
+func (r *Registry) DeletePollOverride(ctx context.Context, providerID peer.ID) (bool, error) {
+	if r.pollDone == nil {
+		return false, ErrNoPolling
+	}
+	type result struct {
+		ok  bool
+		err error
+	}
+	resChan := make(chan result)
+	r.actions <- func() {
+		ok, err := r.syncDeletePollOverride(ctx, providerID)
+		resChan <- result{ok, err}
+	}
+	res := <-resChan
+	return res.ok, res.err
+}
+
+// pollRetryAfter returns the shortest retry time of the normal polling and all
+// overrides. This is how often the registry checks whether to poll.
+func (r *Registry) pollRetryAfter(poll polling) time.Duration {
+	retryChan := make(chan time.Duration)
+	r.actions <- func() {
+		retryAfter := poll.retryAfter
+		for _, override := range r.pollOverrides {
+			if override.retryAfter < retryAfter {
+				retryAfter = override.retryAfter
+			}
+		}
+		for _, override := range r.labelPollOverrides {
+			if override.poll.retryAfter < retryAfter {
+				retryAfter = override.poll.retryAfter
+			}
+		}
+		retryChan <- retryAfter
+	}
+	retryAfter := <-retryChan
+	if retryAfter < time.Minute {
+		retryAfter = time.Minute
+	}
+	return retryAfter
+}
+
+func (r *Registry) syncPollStatus(providerID peer.ID) *PollStatus {
+	poll := r.poll
+	status := &PollStatus{
+		ProviderID: providerID,
+	}
+	info, registered := r.providers[providerID]
+	if override, ok := r.pollOverrides[providerID]; ok {
+		poll = override
+		status.Override = true
+		_, status.Persisted = r.persistedPolls[providerID]
+	} else if registered {
+		if override, ok = r.labelPollOverride(info); ok {
+			poll = override
+			status.Override = true
+		}
+	}
+	status.Interval = poll.interval
+	status.RetryAfter = poll.retryAfter
+	status.StopAfter = poll.stopAfter
+	status.DeactivateAfter = poll.deactivateAfter
+
+	if registered && !info.lastContactTime.IsZero() {
+		status.LastContact = info.lastContactTime
+		status.NextPoll = info.lastContactTime.Add(poll.interval)
+		status.Deactivate = status.NextPoll.Add(poll.deactivateAfter)
+		status.Remove = status.NextPoll.Add(poll.stopAfter)
+	}
+	return status
+}
+
+// labelPollOverride returns the first polling override, configured by label,
+// that matches one of the provider's labels.
+func (r *Registry) labelPollOverride(info *ProviderInfo) (polling, bool) {
+	if len(info.Labels) == 0 {
+		return polling{}, false
+	}
+	for _, override := range r.labelPollOverrides {
+		if matchLabel(info.Labels, override.selector, false) {
+			return override.poll, true
+		}
+	}
+	return polling{}, false
+}
+
+func (r *Registry) syncSetPollOverride(ctx context.Context, providerID peer.ID, override config.Polling) error {
+	override.ProviderID = providerID.String()
+	if r.dstore != nil {
+		value, err := json.Marshal(&override)
+		if err != nil {
+			return err
+		}
+		dsKey := peerIDToDsKey(pollOverrideKeyPath, providerID)
+		if err = r.dstore.Put(ctx, dsKey, value); err != nil {
+			return err
+		}
+		if err = r.dstore.Sync(ctx, dsKey); err != nil {
+			return err
+		}
+	}
+	r.persistedPolls[providerID] = override
+	r.pollOverrides[providerID] = makePollOverride(r.poll, override)
+	log.Infow("Set polling override", "provider", providerID)
+	return nil
+}
+
+func (r *Registry) syncDeletePollOverride(ctx context.Context, providerID peer.ID) (bool, error) {
+	if _, ok := r.persistedPolls[providerID]; !ok {
+		return false, nil
+	}
+	if r.dstore != nil {
+		dsKey := peerIDToDsKey(pollOverrideKeyPath, providerID)
+		if err := r.dstore.Delete(ctx, dsKey); err != nil {
+			return false, err
+		}
+		if err := r.dstore.Sync(ctx, dsKey); err != nil {
+			return false, err
+		}
+	}
+	delete(r.persistedPolls, providerID)
+	if override, ok := r.cfgPollOverrides[providerID]; ok {
+		r.pollOverrides[providerID] = override
+	} else {
+		delete(r.pollOverrides, providerID)
+	}
+	log.Infow("Deleted polling override", "provider", providerID)
+	return true, nil
+}
+
+func loadPollOverrides(ctx context.Context, dstore datastore.Datastore) (map[peer.ID]config.Polling, error) {
+	overrides := make(map[peer.ID]config.Polling)
+
+	if dstore == nil {
+		return overrides, nil
+	}
+
+	results, err := dstore.Query(ctx, query.Query{
+		Prefix: pollOverrideKeyPath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, fmt.Errorf("cannot read polling override: %w", result.Error)
+		}
+		ent := result.Entry
+
+		peerID, err := peer.Decode(path.Base(ent.Key))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode provider ID: %w", err)
+		}
+
+		var override config.Polling
+		if err = json.Unmarshal(ent.Value, &override); err != nil {
+			log.Errorw("Cannot load polling override", "err", err, "provider", peerID)
+			continue
+		}
+		overrides[peerID] = override
+	}
+
+	return overrides, nil
+}
@@ -0,0 +1,154 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipni/storetheindex/config"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollOverrides(t *testing.T) {
+	ctx := context.Background()
+
+	provID, err := peer.Decode(limitedID)
+	require.NoError(t, err)
+	cfgProvID, err := peer.Decode(limitedID2)
+	require.NoError(t, err)
+	maddr, err := multiaddr.NewMultiaddr(minerAddr)
+	require.NoError(t, err)
+
+	cfg := config.Discovery{
+		Policy: config.Policy{
+			Allow:   true,
+			Publish: true,
+		},
+		PollInterval:    config.Duration(time.Hour),
+		PollRetryAfter:  config.Duration(time.Hour),
+		PollStopAfter:   config.Duration(10 * time.Hour),
+		DeactivateAfter: config.Duration(5 * time.Hour),
+		PollOverrides: []config.Polling{
+			{
+				ProviderID: cfgProvID.String(),
+				Interval:   config.Duration(2 * time.Hour),
+			},
+		},
+	}
+
+	dstore := datastore.NewMapDatastore()
+	r, err := New(ctx, cfg, dstore)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	prov := peer.AddrInfo{ID: provID, Addrs: []multiaddr.Multiaddr{maddr}}
+	err = r.Update(ctx, prov, prov, cid.Undef, nil, 0)
+	require.NoError(t, err)
+	r.Saw(provID)
+
+	status, err := r.PollStatus(provID)
+	require.NoError(t, err)
+	require.NotNil(t, status)
+	require.False(t, status.Override)
+	require.Equal(t, time.Hour, status.Interval)
+	require.False(t, status.LastContact.IsZero())
+	require.Equal(t, status.LastContact.Add(time.Hour), status.NextPoll)
+	require.Equal(t, status.NextPoll.Add(5*time.Hour), status.Deactivate)
+	require.Equal(t, status.NextPoll.Add(10*time.Hour), status.Remove)
+
+	// Override from config file applies to unregistered provider.
+	status, err = r.PollStatus(cfgProvID)
+	require.NoError(t, err)
+	require.True(t, status.Override)
+	require.False(t, status.Persisted)
+	require.Equal(t, 2*time.Hour, status.Interval)
+	require.True(t, status.LastContact.IsZero())
+
+	err = r.SetPollOverride(ctx, config.Polling{
+		ProviderID: provID.String(),
+		Interval:   config.Duration(30 * time.Minute),
+		StopAfter:  config.Duration(time.Hour),
+	})
+	require.NoError(t, err)
+	err = r.SetPollOverride(ctx, config.Polling{
+		ProviderID: cfgProvID.String(),
+		Interval:   config.Duration(3 * time.Hour),
+	})
+	require.NoError(t, err)
+
+	status, err = r.PollStatus(provID)
+	require.NoError(t, err)
+	require.True(t, status.Override)
+	require.True(t, status.Persisted)
+	require.Equal(t, 30*time.Minute, status.Interval)
+	require.Equal(t, time.Hour, status.RetryAfter)
+	require.Equal(t, time.Hour, status.StopAfter)
+	require.Equal(t, 5*time.Hour, status.DeactivateAfter)
+
+	require.Error(t, r.SetPollOverride(ctx, config.Polling{ProviderID: "bad"}))
+
+	// Check that overrides are loaded from datastore.
+	r.Close()
+	r, err = New(ctx, cfg, dstore)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	statuses, err := r.ListPollOverrides()
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	for _, status = range statuses {
+		require.True(t, status.Persisted)
+		switch status.ProviderID {
+		case provID:
+			require.Equal(t, 30*time.Minute, status.Interval)
+		case cfgProvID:
+			require.Equal(t, 3*time.Hour, status.Interval)
+		default:
+			t.Fatal("unexpected provider in poll overrides")
+		}
+	}
+
+	// Deleting runtime override reverts to config file override.
+	ok, err := r.DeletePollOverride(ctx, cfgProvID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	status, err = r.PollStatus(cfgProvID)
+	require.NoError(t, err)
+	require.True(t, status.Override)
+	require.False(t, status.Persisted)
+	require.Equal(t, 2*time.Hour, status.Interval)
+
+	// Deleting runtime override reverts to normal polling.
+	ok, err = r.DeletePollOverride(ctx, provID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	status, err = r.PollStatus(provID)
+	require.NoError(t, err)
+	require.False(t, status.Override)
+	require.Equal(t, time.Hour, status.Interval)
+
+	ok, err = r.DeletePollOverride(ctx, provID)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestPollOverridesNoPolling(t *testing.T) {
+	cfg := config.Discovery{
+		Policy: config.Policy{
+			Allow:   true,
+			Publish: true,
+		},
+	}
+	r, err := New(context.Background(), cfg, nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = r.PollStatus(peer.ID("x"))
+	require.ErrorIs(t, err, ErrNoPolling)
+	err = r.SetPollOverride(context.Background(), config.Polling{})
+	require.ErrorIs(t, err, ErrNoPolling)
+}
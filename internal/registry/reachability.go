@@ -0,0 +1,229 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ipni/go-libipni/maurl"
+	"github.com/ipni/go-libipni/mautil"
+	"github.com/ipni/storetheindex/internal/metrics"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"go.opencensus.io/stats"
+)
+
+// probeConcurrency is the maximum number of providers probed at once.
+const probeConcurrency = 16
+
+// Reachability holds the result of the most recent reachability probe of a
+// provider's addresses.
+type Reachability struct {
+	// Reachable is true if any of the provider's addresses responded.
+	Reachable bool
+	// Latency is the time it took for the first address to respond.
+	Latency time.Duration
+	// ProbeTime is the time that the probe completed.
+	ProbeTime time.Time
+	// Error describes why the provider was not reachable.
+	Error string `json:",omitempty"`
+}
+
+// StartProbing starts periodically probing the addresses of all registered
+// providers, at the configured Discovery.ProbeInterval, to determine whether
+// they are reachable. Providers' libp2p addresses are dialed using the given
+// host. If the host is nil, then only HTTP addresses are probed.
+func (r *Registry) StartProbing(h host.Host) error {
+	if r.probeInterval == 0 {
+		return errors.New("reachability probing not configured")
+	}
+	if r.probeDone != nil {
+		return errors.New("reachability probing already started")
+	}
+	r.probeDone = make(chan struct{})
+	go r.runProbing(h)
+	return nil
+}
+
+// DemoteUnreachable returns true if results from unreachable providers should
+// be placed after all other results.
+func (r *Registry) DemoteUnreachable() bool {
+	return r.demoteUnreachable && r.probeDone != nil
+}
+
+func (r *Registry) runProbing(h host.Host) {
+	defer close(r.probeDone)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	httpClient := &http.Client{
+		Timeout: r.probeTimeout,
+	}
+
+	// Do first probe soon after startup, to have reachability information
+	// before the first interval elapses.
+	firstProbe := time.Minute
+	if r.probeInterval < firstProbe {
+		firstProbe = r.probeInterval
+	}
+	timer := time.NewTimer(firstProbe)
+	for {
+		select {
+		case <-timer.C:
+			r.probeProviders(ctx, h, httpClient)
+			timer.Reset(r.probeInterval)
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (r *Registry) probeProviders(ctx context.Context, h host.Host, httpClient *http.Client) {
+	infos := r.AllProviderInfo()
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[peer.ID]*Reachability, len(infos))
+	sem := make(chan struct{}, probeConcurrency)
+
+	for _, info := range infos {
+		if len(info.AddrInfo.Addrs) == 0 {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		wg.Add(1)
+		go func(addrInfo peer.AddrInfo) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			reach := probeProvider(ctx, h, httpClient, addrInfo, r.probeTimeout)
+			mutex.Lock()
+			results[addrInfo.ID] = reach
+			mutex.Unlock()
+		}(info.AddrInfo)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	var unreachable int
+	done := make(chan struct{})
+	r.actions <- func() {
+		for providerID, reach := range results {
+			info, ok := r.providers[providerID]
+			if !ok {
+				continue
+			}
+			newInfo := *info
+			newInfo.reachability = reach
+			r.providers[providerID] = &newInfo
+			if !reach.Reachable {
+				log.Infow("Provider unreachable", "provider", providerID, "err", reach.Error)
+				unreachable++
+			}
+		}
+		close(done)
+	}
+	<-done
+
+	stats.Record(context.Background(), metrics.UnreachableProviderCount.M(int64(unreachable)))
+	log.Infow("Finished probing providers", "probed", len(results), "unreachable", unreachable)
+}
+
+// probeProvider tries to reach a provider at each of its addresses and returns
+// the result from the first address to respond.
+func probeProvider(ctx context.Context, h host.Host, httpClient *http.Client, addrInfo peer.AddrInfo, timeout time.Duration) *Reachability {
+	httpAddrs := mautil.FindHTTPAddrs(addrInfo.Addrs)
+	p2pAddrs := multiaddr.FilterAddrs(addrInfo.Addrs, func(a multiaddr.Multiaddr) bool {
+		for _, httpAddr := range httpAddrs {
+			if a.Equal(httpAddr) {
+				return false
+			}
+		}
+		return true
+	})
+
+	var lastErr error
+	for _, maddr := range httpAddrs {
+		latency, err := probeHTTP(ctx, httpClient, maddr)
+		if err == nil {
+			return &Reachability{
+				Reachable: true,
+				Latency:   latency,
+				ProbeTime: time.Now(),
+			}
+		}
+		lastErr = err
+	}
+
+	if h != nil && len(p2pAddrs) != 0 {
+		latency, err := probeLibp2p(ctx, h, peer.AddrInfo{ID: addrInfo.ID, Addrs: p2pAddrs}, timeout)
+		if err == nil {
+			return &Reachability{
+				Reachable: true,
+				Latency:   latency,
+				ProbeTime: time.Now(),
+			}
+		}
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no addresses to probe")
+	}
+	return &Reachability{
+		ProbeTime: time.Now(),
+		Error:     lastErr.Error(),
+	}
+}
+
+func probeHTTP(ctx context.Context, httpClient *http.Client, maddr multiaddr.Multiaddr) (time.Duration, error) {
+	u, err := maurl.ToURL(maddr)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	rsp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	rsp.Body.Close()
+	// Any response means the provider is reachable, since probing does not
+	// know what resource paths the provider serves.
+	return time.Since(start), nil
+}
+
+func probeLibp2p(ctx context.Context, h host.Host, addrInfo peer.AddrInfo, timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := h.Connect(ctx, addrInfo); err != nil {
+		return 0, fmt.Errorf("cannot connect over libp2p: %w", err)
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipni/go-libipni/maurl"
+	"github.com/ipni/storetheindex/config"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeReachability(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	probeHost, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer probeHost.Close()
+
+	// Provider that is reachable over libp2p.
+	p2pProvider, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer p2pProvider.Close()
+
+	// Provider that is reachable over HTTP.
+	httpProvider, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer httpProvider.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	httpAddr := mustHTTPMultiaddr(t, ts.URL)
+
+	// Provider that is not reachable.
+	goneProvider, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	goneAddrs := goneProvider.Addrs()
+	goneProvider.Close()
+
+	cfg := config.Discovery{
+		Policy: config.Policy{
+			Allow:   true,
+			Publish: true,
+		},
+		ProbeInterval:     config.Duration(100 * time.Millisecond),
+		ProbeTimeout:      config.Duration(time.Second),
+		DemoteUnreachable: true,
+	}
+	r, err := New(ctx, cfg, nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	require.False(t, r.DemoteUnreachable())
+
+	providers := []peer.AddrInfo{
+		{ID: p2pProvider.ID(), Addrs: p2pProvider.Addrs()},
+		{ID: httpProvider.ID(), Addrs: []multiaddr.Multiaddr{httpAddr}},
+		{ID: goneProvider.ID(), Addrs: goneAddrs},
+	}
+	for _, provider := range providers {
+		err = r.Update(ctx, provider, peer.AddrInfo{}, cid.Undef, nil, 0)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, r.StartProbing(probeHost))
+	require.Error(t, r.StartProbing(probeHost), "expected error starting probing twice")
+	require.True(t, r.DemoteUnreachable())
+
+	probed := func(providerID peer.ID) *Reachability {
+		info, _ := r.ProviderInfo(providerID)
+		require.NotNil(t, info)
+		return info.Reachability()
+	}
+	require.Eventually(t, func() bool {
+		for _, provider := range providers {
+			if probed(provider.ID) == nil {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 100*time.Millisecond, "providers were not probed")
+
+	reach := probed(p2pProvider.ID())
+	require.True(t, reach.Reachable)
+	require.Empty(t, reach.Error)
+	require.NotZero(t, reach.Latency)
+
+	reach = probed(httpProvider.ID())
+	require.True(t, reach.Reachable)
+
+	info, _ := r.ProviderInfo(goneProvider.ID())
+	require.True(t, info.Unreachable())
+	require.NotEmpty(t, info.Reachability().Error)
+
+	// Check that reachability is kept when provider info is updated.
+	err = r.Update(ctx, providers[0], peer.AddrInfo{}, cid.Undef, nil, 0)
+	require.NoError(t, err)
+	require.NotNil(t, probed(p2pProvider.ID()))
+}
+
+func TestProbeNotConfigured(t *testing.T) {
+	r, err := New(context.Background(), discoveryCfg, nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	require.Error(t, r.StartProbing(nil))
+	require.False(t, r.DemoteUnreachable())
+}
+
+func mustHTTPMultiaddr(t *testing.T, rawURL string) multiaddr.Multiaddr {
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	maddr, err := maurl.FromURL(u)
+	require.NoError(t, err)
+	return maddr
+}
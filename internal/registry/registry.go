@@ -34,6 +34,8 @@ const (
 	providerKeyPath       = "/registry/pinfo"
 	assignmentsKeyPath    = "/assignments-v2"
 	oldAssignmentsKeyPath = "/assignments-v1"
+	// pollOverrideKeyPath is where polling overrides set at runtime are stored.
+	pollOverrideKeyPath = "/registry/pollover"
 )
 
 var log = logging.Logger("indexer/registry")
@@ -51,6 +53,23 @@ type Registry struct {
 	providers map[peer.ID]*ProviderInfo
 	sequences *sequences
 
+	// Reachability probing configuration.
+	demoteUnreachable bool
+	probeDone         chan struct{}
+	probeInterval     time.Duration
+	probeTimeout      time.Duration
+
+	// Polling configuration. The override maps are only accessed by actions.
+	poll polling
+	// cfgPollOverrides are the overrides from the config file.
+	cfgPollOverrides map[peer.ID]polling
+	// pollOverrides are the effective per-provider overrides.
+	pollOverrides map[peer.ID]polling
+	// labelPollOverrides apply to providers with matching labels.
+	labelPollOverrides []labelPolling
+	// persistedPolls are overrides that were set at runtime.
+	persistedPolls map[peer.ID]config.Polling
+
 	policy *policy.Policy
 
 	// assigned tracks peers assigned by assigner service.
@@ -61,6 +80,11 @@ type Registry struct {
 	// index data from.
 	preferred map[peer.ID]struct{}
 
+	// labels mirrors provider labels for evaluating configuration that
+	// selects providers by label, without using actions.
+	labels     map[peer.ID]map[string]Label
+	labelMutex sync.RWMutex
+
 	syncChan chan *ProviderInfo
 }
 
@@ -91,6 +115,10 @@ type ProviderInfo struct {
 	// FrozenAtTime is the time that the FrozenAt advertisement was received.
 	FrozenAtTime time.Time
 
+	// Labels are operator-defined values attached to the provider, keyed by
+	// label name.
+	Labels map[string]Label `json:",omitempty"`
+
 	// lastContactTime is the last time the publisher contacted the indexer.
 	// This is not persisted, so that the time since last contact is reset when
 	// the indexer is started. If not reset, then it would appear the publisher
@@ -101,6 +129,8 @@ type ProviderInfo struct {
 	deleted bool
 	// inactive means polling the publisher with no response yet.
 	inactive bool
+	// reachability is the result of the most recent reachability probe.
+	reachability *Reachability
 	// stopCid is used to tell the autosync goroutine to set the latest CID
 	// to stop the sync at.
 	stopCid cid.Cid
@@ -150,6 +180,12 @@ type polling struct {
 	deactivateAfter time.Duration
 }
 
+// labelPolling is a polling override for providers with a matching label.
+type labelPolling struct {
+	selector string
+	poll     polling
+}
+
 func (p *ProviderInfo) Deleted() bool {
 	return p.deleted
 }
@@ -158,6 +194,18 @@ func (p *ProviderInfo) Inactive() bool {
 	return p.inactive
 }
 
+// Reachability returns the result of the most recent reachability probe of
+// the provider's addresses, or nil if the provider has not been probed.
+func (p *ProviderInfo) Reachability() *Reachability {
+	return p.reachability
+}
+
+// Unreachable returns true if the provider did not respond to its most recent
+// reachability probe.
+func (p *ProviderInfo) Unreachable() bool {
+	return p.reachability != nil && !p.reachability.Reachable
+}
+
 // StopCid returns the CID of the advertisement to stop at when handling
 // handoff from another indexer that is frozen.
 func (p *ProviderInfo) StopCid() cid.Cid {
@@ -255,6 +303,9 @@ func New(ctx context.Context, cfg config.Discovery, dstore datastore.Datastore,
 	if err != nil {
 		return nil, err
 	}
+	if opts.freezeAtPercent < 0 && len(opts.pressureLevels) != 0 {
+		return nil, errors.New("disk pressure levels cannot be used when freezing is disabled")
+	}
 
 	// Create policy from config.
 	regPolicy, err := policy.New(cfg.Policy)
@@ -272,7 +323,11 @@ func New(ctx context.Context, cfg config.Discovery, dstore datastore.Datastore,
 		closing:   make(chan struct{}),
 		filterIPs: cfg.FilterIPs,
 		policy:    regPolicy,
-		sequences: newSequences(0),
+		sequences: newSequences(time.Duration(cfg.ReplayWindow)),
+
+		demoteUnreachable: cfg.DemoteUnreachable,
+		probeInterval:     time.Duration(cfg.ProbeInterval),
+		probeTimeout:      time.Duration(cfg.ProbeTimeout),
 
 		dstore:   dstore,
 		syncChan: make(chan *ProviderInfo, 1),
@@ -284,6 +339,16 @@ func New(ctx context.Context, cfg config.Discovery, dstore datastore.Datastore,
 	}
 	log.Infow("Loaded providers into registry", "count", len(r.providers))
 
+	if err = r.sequences.load(ctx, dstore, cfg.ReplayNonces); err != nil {
+		return nil, fmt.Errorf("cannot load sequences from datastore: %w", err)
+	}
+	r.labels = make(map[peer.ID]map[string]Label)
+	for providerID, info := range r.providers {
+		if len(info.Labels) != 0 {
+			r.labels[providerID] = info.Labels
+		}
+	}
+
 	if cfg.UseAssigner {
 		r.assigned, err = loadPersistedAssignments(ctx, dstore, cfg.RemoveOldAssignments)
 		if err != nil {
@@ -294,7 +359,16 @@ func New(ctx context.Context, cfg config.Discovery, dstore datastore.Datastore,
 	}
 
 	if opts.freezeAtPercent >= 0 {
-		r.freezer, err = freeze.New(opts.freezeDirs, opts.freezeAtPercent, dstore, r.freeze)
+		var freezeOpts []freeze.Option
+		if len(opts.pressureLevels) != 0 {
+			freezeOpts = append(freezeOpts, freeze.WithPressureLevels(opts.pressureLevels, func(level int) {
+				stats.Record(context.Background(), metrics.DiskPressureLevel.M(int64(level)))
+				if opts.pressureFunc != nil {
+					opts.pressureFunc(level)
+				}
+			}))
+		}
+		r.freezer, err = freeze.New(opts.freezeDirs, opts.freezeAtPercent, dstore, r.freeze, freezeOpts...)
 		if err != nil {
 			return nil, fmt.Errorf("cannot create freezer: %s", err)
 		}
@@ -314,12 +388,24 @@ func New(ctx context.Context, cfg config.Discovery, dstore datastore.Datastore,
 			return nil, fmt.Errorf("invalid polling config: %s", err)
 		}
 
-		pollOverrides, err := makePollOverrideMap(poll, cfg.PollOverrides)
+		r.poll = poll
+		r.cfgPollOverrides, r.labelPollOverrides, err = makePollOverrideMap(poll, cfg.PollOverrides)
 		if err != nil {
 			return nil, err
 		}
+		r.persistedPolls, err = loadPollOverrides(ctx, dstore)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load polling overrides from datastore: %w", err)
+		}
+		r.pollOverrides = make(map[peer.ID]polling, len(r.cfgPollOverrides)+len(r.persistedPolls))
+		for peerID, override := range r.cfgPollOverrides {
+			r.pollOverrides[peerID] = override
+		}
+		for peerID, ovCfg := range r.persistedPolls {
+			r.pollOverrides[peerID] = makePollOverride(poll, ovCfg)
+		}
 		r.pollDone = make(chan struct{})
-		go r.runPollCheck(poll, pollOverrides)
+		go r.runPollCheck(poll)
 	}
 
 	go r.run()
@@ -343,38 +429,52 @@ func validatePolling(poll polling) error {
 	return nil
 }
 
-func makePollOverrideMap(poll polling, cfgPollOverrides []config.Polling) (map[peer.ID]polling, error) {
+func makePollOverrideMap(poll polling, cfgPollOverrides []config.Polling) (map[peer.ID]polling, []labelPolling, error) {
 	if len(cfgPollOverrides) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	pollOverrides := make(map[peer.ID]polling, len(cfgPollOverrides))
+	var labelOverrides []labelPolling
 	for _, ovCfg := range cfgPollOverrides {
+		if ovCfg.ProviderID == "" && ovCfg.Label != "" {
+			labelOverrides = append(labelOverrides, labelPolling{
+				selector: ovCfg.Label,
+				poll:     makePollOverride(poll, ovCfg),
+			})
+			continue
+		}
 		peerID, err := peer.Decode(ovCfg.ProviderID)
 		if err != nil {
-			return nil, fmt.Errorf("cannot decode provider ID %q in PollOverrides: %s", ovCfg.ProviderID, err)
-		}
-		override := polling{
-			interval:        time.Duration(ovCfg.Interval),
-			retryAfter:      time.Duration(ovCfg.RetryAfter),
-			stopAfter:       time.Duration(ovCfg.StopAfter),
-			deactivateAfter: time.Duration(ovCfg.DeactivateAfter),
-		}
-		if override.interval == 0 {
-			override.interval = poll.interval
-		}
-		if override.retryAfter == 0 {
-			override.retryAfter = poll.retryAfter
+			return nil, nil, fmt.Errorf("cannot decode provider ID %q in PollOverrides: %s", ovCfg.ProviderID, err)
 		}
-		if override.stopAfter == 0 {
-			override.stopAfter = poll.stopAfter
-		}
-		if override.deactivateAfter == 0 {
-			override.deactivateAfter = poll.deactivateAfter
-		}
-		pollOverrides[peerID] = override
+		pollOverrides[peerID] = makePollOverride(poll, ovCfg)
 	}
-	return pollOverrides, nil
+	return pollOverrides, labelOverrides, nil
+}
+
+// makePollOverride creates a polling override from its configuration, using
+// the normal polling values for any that are not set.
+func makePollOverride(poll polling, ovCfg config.Polling) polling {
+	override := polling{
+		interval:        time.Duration(ovCfg.Interval),
+		retryAfter:      time.Duration(ovCfg.RetryAfter),
+		stopAfter:       time.Duration(ovCfg.StopAfter),
+		deactivateAfter: time.Duration(ovCfg.DeactivateAfter),
+	}
+	if override.interval == 0 {
+		override.interval = poll.interval
+	}
+	if override.retryAfter == 0 {
+		override.retryAfter = poll.retryAfter
+	}
+	if override.stopAfter == 0 {
+		override.stopAfter = poll.stopAfter
+	}
+	if override.deactivateAfter == 0 {
+		override.deactivateAfter = poll.deactivateAfter
+	}
+	return override
 }
 
 // Close waits for polling and actions to finish and then stops the registry.
@@ -387,6 +487,9 @@ func (r *Registry) Close() {
 		if r.pollDone != nil {
 			<-r.pollDone
 		}
+		if r.probeDone != nil {
+			<-r.probeDone
+		}
 		// Stop the main run goroutine.
 		close(r.actions)
 	})
@@ -412,24 +515,15 @@ func (r *Registry) run() {
 	}
 }
 
-func (r *Registry) runPollCheck(poll polling, pollOverrides map[peer.ID]polling) {
-	retryAfter := poll.retryAfter
-	for i := range pollOverrides {
-		if pollOverrides[i].retryAfter < retryAfter {
-			retryAfter = pollOverrides[i].retryAfter
-		}
-	}
-
-	if retryAfter < time.Minute {
-		retryAfter = time.Minute
-	}
-	timer := time.NewTimer(retryAfter)
+func (r *Registry) runPollCheck(poll polling) {
+	timer := time.NewTimer(r.pollRetryAfter(poll))
 running:
 	for {
 		select {
 		case <-timer.C:
-			r.pollProviders(poll, pollOverrides)
-			timer.Reset(retryAfter)
+			r.pollProviders(poll, r.pollOverrides)
+			// Overrides may have changed, so recalculate the retry time.
+			timer.Reset(r.pollRetryAfter(poll))
 		case <-r.closing:
 			break running
 		}
@@ -474,7 +568,18 @@ func (r *Registry) Allowed(peerID peer.ID) bool {
 			return false
 		}
 	}
-	return r.policy.Allowed(peerID)
+	return r.policyAllowed(peerID)
+}
+
+// policyAllowed checks if the peer is allowed by policy. A peer that is not in
+// the policy's exceptions, but is a provider having a label that matches the
+// policy's ExceptLabels, is treated as an exception.
+func (r *Registry) policyAllowed(peerID peer.ID) bool {
+	allowed := r.policy.Allowed(peerID)
+	if allowed == r.policy.AllowDefault() && r.HasLabel(peerID, r.policy.ExceptLabels()) {
+		return !allowed
+	}
+	return allowed
 }
 
 // PublishAllowed checks if a peer is allowed to publish for other providers.
@@ -534,7 +639,7 @@ func (r *Registry) ListPreferredPeers() ([]peer.ID, error) {
 
 	peers := make([]peer.ID, 0, len(r.preferred))
 	for peerID := range r.preferred {
-		if !r.policy.Allowed(peerID) {
+		if !r.policyAllowed(peerID) {
 			continue
 		}
 		peers = append(peers, peerID)
@@ -550,7 +655,7 @@ func (r *Registry) AssignPeer(publisherID peer.ID) error {
 	if r.assigned == nil {
 		return ErrNoAssigner
 	}
-	if !r.policy.Allowed(publisherID) {
+	if !r.policyAllowed(publisherID) {
 		return ErrNotAllowed
 	}
 	if r.Frozen() {
@@ -651,7 +756,7 @@ func validateExtProviders(extendedProviders *ExtendedProviders) error {
 // previous publisher information.
 func (r *Registry) Update(ctx context.Context, provider, publisher peer.AddrInfo, adCid cid.Cid, extendedProviders *ExtendedProviders, lag int) error {
 	// Do not accept update if provider is not allowed.
-	if !r.policy.Allowed(provider.ID) {
+	if !r.policyAllowed(provider.ID) {
 		return ErrNotAllowed
 	}
 
@@ -674,6 +779,10 @@ func (r *Registry) Update(ctx context.Context, provider, publisher peer.AddrInfo
 
 			FrozenAt:     info.FrozenAt,
 			FrozenAtTime: info.FrozenAtTime,
+
+			Labels: info.Labels,
+
+			reachability: info.reachability,
 		}
 
 		// If new addrs provided, update to use these.
@@ -723,7 +832,7 @@ func (r *Registry) Update(ctx context.Context, provider, publisher peer.AddrInfo
 
 	if newPublisher {
 		// Check if new publisher is allowed.
-		if !r.policy.Allowed(publisher.ID) {
+		if !r.policyAllowed(publisher.ID) {
 			return apierror.New(ErrPublisherNotAllowed, http.StatusForbidden)
 		}
 		if !r.policy.PublishAllowed(publisher.ID, info.AddrInfo.ID) {
@@ -794,7 +903,7 @@ func (r *Registry) ProviderInfo(providerID peer.ID) (*ProviderInfo, bool) {
 		return nil, false
 	}
 
-	return pinfo, r.policy.Allowed(providerID)
+	return pinfo, r.policyAllowed(providerID)
 }
 
 // AllProviderInfo returns information for all registered providers that are
@@ -828,7 +937,7 @@ func (r *Registry) Handoff(ctx context.Context, publisherID, frozenID peer.ID, f
 	if r.assigned == nil {
 		return ErrNoAssigner
 	}
-	if !r.policy.Allowed(publisherID) {
+	if !r.policyAllowed(publisherID) {
 		return ErrPublisherNotAllowed
 	}
 
@@ -871,7 +980,7 @@ func (r *Registry) Handoff(ctx context.Context, publisherID, frozenID peer.ID, f
 
 	// If this indexer does not allow this provider, then this publisher cannot
 	// be handed off to this indexer.
-	if !r.policy.Allowed(provInfo.AddrInfo.ID) {
+	if !r.policyAllowed(provInfo.AddrInfo.ID) {
 		return ErrNotAllowed
 	}
 	// If this indexer does not allow the publisher to publish for the
@@ -887,9 +996,15 @@ func (r *Registry) Handoff(ctx context.Context, publisherID, frozenID peer.ID, f
 	}
 
 	// If source indexer has ingested any ads for the provider, then start a
-	// sync with the frozen at ad as the ad to stop at.
-	if provInfo.FrozenAt != cid.Undef {
-		regInfo.stopCid = provInfo.FrozenAt
+	// sync with the frozen at ad as the ad to stop at. If the source indexer
+	// is not frozen, as when publishers are rebalanced across indexers, then
+	// stop at the last ad that the source indexer processed.
+	stopCid := provInfo.FrozenAt
+	if stopCid == cid.Undef {
+		stopCid = provInfo.LastAdvertisement
+	}
+	if stopCid != cid.Undef {
+		regInfo.stopCid = stopCid
 
 		select {
 		case r.syncChan <- regInfo:
@@ -926,7 +1041,7 @@ func (r *Registry) ImportProviders(ctx context.Context, fromURL *url.URL) (int,
 				"provider", regInfo.AddrInfo.ID, "publisher", regInfo.Publisher)
 		}
 
-		if !r.policy.Allowed(regInfo.Publisher) {
+		if !r.policyAllowed(regInfo.Publisher) {
 			log.Infow("Cannot register provider", "err", ErrPublisherNotAllowed,
 				"provider", regInfo.AddrInfo.ID, "publisher", regInfo.Publisher)
 			continue
@@ -1022,6 +1137,15 @@ func (r *Registry) Frozen() bool {
 	return r.freezer.Frozen()
 }
 
+// PressureLevel returns the current disk pressure level. Level 0 means there
+// is no disk pressure.
+func (r *Registry) PressureLevel() int {
+	if r.freezer == nil {
+		return 0
+	}
+	return r.freezer.Level()
+}
+
 func (r *Registry) ValueStoreUsage() (*disk.UsageStats, error) {
 	if r.freezer == nil {
 		return nil, ErrNoFreeze
@@ -1029,6 +1153,47 @@ func (r *Registry) ValueStoreUsage() (*disk.UsageStats, error) {
 	return r.freezer.Usage()
 }
 
+// UnfreezeRunning takes a running indexer out of frozen mode. The freezer resumes
+// monitoring disk usage, and provider information is reverted back to its
+// unfrozen state. Returns the last advertisement processed before freezing,
+// for each publisher that was frozen. If a previous call unfroze the freezer
+// but failed to unfreeze all providers, then calling again unfreezes the
+// remaining providers. Returns ErrNotFrozen if the indexer is not frozen and
+// no providers are frozen.
+func (r *Registry) UnfreezeRunning(ctx context.Context) (map[peer.ID]cid.Cid, error) {
+	if r.freezer == nil {
+		return nil, ErrNoFreeze
+	}
+	frozen := r.freezer.Frozen()
+	if frozen {
+		if err := r.freezer.Unfreeze(ctx); err != nil {
+			return nil, fmt.Errorf("cannot unfreeze freezer: %w", err)
+		}
+	}
+
+	type result struct {
+		unfrozen map[peer.ID]cid.Cid
+		err      error
+	}
+	resChan := make(chan result)
+	r.actions <- func() {
+		if !frozen && !r.anyFrozenProviders() {
+			resChan <- result{err: ErrNotFrozen}
+			return
+		}
+		unfrozen, err := r.syncUnfreeze(ctx)
+		resChan <- result{unfrozen, err}
+	}
+	res := <-resChan
+	if res.err != nil {
+		if errors.Is(res.err, ErrNotFrozen) {
+			return nil, res.err
+		}
+		return nil, fmt.Errorf("cannot unfreeze providers: %w", res.err)
+	}
+	return res.unfrozen, nil
+}
+
 // Unfreeze reverts the freezer and provider information back to its unfrozen
 // state. This must only be called when the registry is not running.
 func Unfreeze(ctx context.Context, freezeDirs []string, freezeAtPercent float64, dstore datastore.Datastore) (map[peer.ID]cid.Cid, error) {
@@ -1078,6 +1243,51 @@ func Unfreeze(ctx context.Context, freezeDirs []string, freezeAtPercent float64,
 	return unfrozen, nil
 }
 
+// anyFrozenProviders returns true if any provider has frozen information.
+func (r *Registry) anyFrozenProviders() bool {
+	for _, info := range r.providers {
+		if !info.FrozenAtTime.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Registry) syncUnfreeze(ctx context.Context) (map[peer.ID]cid.Cid, error) {
+	unfrozen := make(map[peer.ID]cid.Cid)
+	for id, info := range r.providers {
+		if info.FrozenAtTime.IsZero() {
+			continue
+		}
+		unfrozen[info.Publisher] = info.FrozenAt
+
+		unfrozenInfo := *info
+		unfrozenInfo.LastAdvertisement = info.FrozenAt
+		unfrozenInfo.LastAdvertisementTime = info.FrozenAtTime
+		unfrozenInfo.FrozenAt = cid.Undef
+		unfrozenInfo.FrozenAtTime = time.Time{}
+
+		if r.dstore != nil {
+			value, err := json.Marshal(&unfrozenInfo)
+			if err != nil {
+				return nil, err
+			}
+			// Only change the provider after it is persisted, so that a
+			// failed unfreeze can be retried.
+			if err = r.dstore.Put(ctx, info.dsKey(), value); err != nil {
+				return nil, err
+			}
+		}
+		r.providers[id] = &unfrozenInfo
+	}
+	if r.dstore != nil && len(unfrozen) != 0 {
+		if err := r.dstore.Sync(ctx, datastore.NewKey(providerKeyPath)); err != nil {
+			return nil, err
+		}
+	}
+	return unfrozen, nil
+}
+
 func (r *Registry) syncFreeze(now time.Time) error {
 	ctx := context.Background()
 	for id, info := range r.providers {
@@ -1111,6 +1321,10 @@ func (r *Registry) syncFreeze(now time.Time) error {
 }
 
 func (r *Registry) syncRegister(ctx context.Context, info *ProviderInfo) error {
+	// Keep labels that were set since info was copied from the registry.
+	if prev, ok := r.providers[info.AddrInfo.ID]; ok {
+		info.Labels = prev.Labels
+	}
 	r.providers[info.AddrInfo.ID] = info
 	err := r.syncPersistProvider(ctx, info)
 	if err != nil {
@@ -1143,10 +1357,10 @@ func (r *Registry) pollProviders(normalPoll polling, pollOverrides map[peer.ID]p
 			// Reset poll in case previously overridden.
 			poll := normalPoll
 			// If the provider is not allowed, then do not poll or de-list.
-			if !r.policy.Allowed(peerID) {
+			if !r.policyAllowed(peerID) {
 				continue
 			}
-			if info.Publisher.Validate() != nil || !r.policy.Allowed(info.Publisher) {
+			if info.Publisher.Validate() != nil || !r.policyAllowed(info.Publisher) {
 				// No publisher.
 				continue
 			}
@@ -1161,6 +1375,9 @@ func (r *Registry) pollProviders(normalPoll polling, pollOverrides map[peer.ID]p
 				}
 			}
 			override, ok := pollOverrides[peerID]
+			if !ok {
+				override, ok = r.labelPollOverride(info)
+			}
 			if ok {
 				poll = override
 			}
@@ -1216,6 +1433,7 @@ func (r *Registry) pollProviders(normalPoll polling, pollOverrides map[peer.ID]p
 func (r *Registry) syncRemoveProvider(ctx context.Context, providerID peer.ID) error {
 	// Remove the provider from the registry.
 	delete(r.providers, providerID)
+	r.syncIndexLabels(providerID, nil)
 
 	if r.dstore == nil {
 		return nil
@@ -1364,10 +1582,8 @@ func loadPersistedProviders(ctx context.Context, dstore datastore.Datastore, fil
 }
 
 func loadPersistedAssignments(ctx context.Context, dstore datastore.Datastore, deleteOld bool) (map[peer.ID]peer.ID, error) {
-	assigned := make(map[peer.ID]peer.ID)
-
 	if dstore == nil {
-		return assigned, nil
+		return make(map[peer.ID]peer.ID), nil
 	}
 
 	err := migrateOldAssignments(ctx, dstore, oldAssignmentsKeyPath, deleteOld)
@@ -1376,25 +1592,33 @@ func loadPersistedAssignments(ctx context.Context, dstore datastore.Datastore, d
 	}
 
 	// Load all assigned publishers from datastore.
-	q := query.Query{
-		Prefix:   assignmentsKeyPath,
-		KeysOnly: true,
+	assigned := make(map[peer.ID]peer.ID)
+	if err = readPersistedAssignments(ctx, dstore, assignmentsKeyPath, assigned); err != nil {
+		return nil, err
 	}
-	results, err := dstore.Query(ctx, q)
+	return assigned, nil
+}
+
+// readPersistedAssignments reads the assigned publishers stored under prefix,
+// and the indexer each was handed off from, into assigned.
+func readPersistedAssignments(ctx context.Context, dstore datastore.Datastore, prefix string, assigned map[peer.ID]peer.ID) error {
+	results, err := dstore.Query(ctx, query.Query{
+		Prefix: prefix,
+	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer results.Close()
 
 	for result := range results.Next() {
 		if result.Error != nil {
-			return nil, fmt.Errorf("cannot read assignment data: %w", result.Error)
+			return fmt.Errorf("cannot read assignment data: %w", result.Error)
 		}
 		ent := result.Entry
 
 		peerID, err := peer.Decode(path.Base(ent.Key))
 		if err != nil {
-			return nil, fmt.Errorf("cannot decode assigned peer ID: %w", err)
+			return fmt.Errorf("cannot decode assigned peer ID: %w", err)
 		}
 
 		var fromID peer.ID
@@ -1406,8 +1630,7 @@ func loadPersistedAssignments(ctx context.Context, dstore datastore.Datastore, d
 		}
 		assigned[peerID] = fromID
 	}
-
-	return assigned, nil
+	return nil
 }
 
 func loadPreferredAssignments(providers map[peer.ID]*ProviderInfo, assigned map[peer.ID]peer.ID) map[peer.ID]struct{} {
@@ -3,9 +3,11 @@ package registry
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -674,6 +676,14 @@ func TestRegistry_loadPersistedProvidersFiltersNilAddrGracefully(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestPressureLevelsRequireFreezer(t *testing.T) {
+	cfg := config.NewDiscovery()
+	_, err := New(context.Background(), cfg, datastore.NewMapDatastore(),
+		WithFreezer([]string{t.TempDir()}, -1),
+		WithPressureLevels([]float64{80.0}, nil))
+	require.ErrorContains(t, err, "freezing is disabled")
+}
+
 func TestFreezeUnfreeze(t *testing.T) {
 	cfg := config.Discovery{
 		Policy: config.Policy{
@@ -787,6 +797,127 @@ func TestFreezeUnfreeze(t *testing.T) {
 	require.Zero(t, len(unfrozen))
 }
 
+func TestUnfreezeRunning(t *testing.T) {
+	cfg := config.Discovery{
+		Policy: config.Policy{
+			Allow:   true,
+			Publish: true,
+		},
+	}
+
+	ctx := context.Background()
+	dstore := datastore.NewMapDatastore()
+	freezeDirs := []string{t.TempDir()}
+	r, err := New(ctx, cfg, dstore, WithFreezer(freezeDirs, 90.0))
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	_, err = r.UnfreezeRunning(ctx)
+	require.ErrorIs(t, err, ErrNotFrozen)
+
+	peerID, err := peer.Decode(limitedID)
+	require.NoError(t, err)
+	pubID, err := peer.Decode(publisherID)
+	require.NoError(t, err)
+	maddr, err := multiaddr.NewMultiaddr(minerAddr)
+	require.NoError(t, err)
+	prov := peer.AddrInfo{
+		ID:    peerID,
+		Addrs: []multiaddr.Multiaddr{maddr},
+	}
+	mh, err := multihash.Sum([]byte("somedata"), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	adCid := cid.NewCidV1(cid.Raw, mh)
+
+	err = r.Update(ctx, prov, peer.AddrInfo{ID: pubID}, adCid, nil, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, r.Freeze())
+	require.True(t, r.Frozen())
+
+	unfrozen, err := r.UnfreezeRunning(ctx)
+	require.NoError(t, err)
+	require.False(t, r.Frozen())
+	require.Equal(t, map[peer.ID]cid.Cid{pubID: adCid}, unfrozen)
+
+	info, _ := r.ProviderInfo(peerID)
+	require.False(t, info.FrozenAt.Defined())
+	require.True(t, info.FrozenAtTime.IsZero())
+	require.Equal(t, adCid, info.LastAdvertisement)
+
+	// Check that unfrozen state is persisted.
+	r.Close()
+	r, err = New(ctx, cfg, dstore, WithFreezer(freezeDirs, 90.0))
+	require.NoError(t, err)
+	require.False(t, r.Frozen())
+	info, _ = r.ProviderInfo(peerID)
+	require.True(t, info.FrozenAtTime.IsZero())
+
+	// Check that the indexer can be frozen again.
+	require.NoError(t, r.Freeze())
+	require.True(t, r.Frozen())
+}
+
+// failPutDatastore is a datastore that fails to put values when fail is set.
+type failPutDatastore struct {
+	datastore.Datastore
+	fail atomic.Bool
+}
+
+func (d *failPutDatastore) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	if d.fail.Load() {
+		return errors.New("put failed")
+	}
+	return d.Datastore.Put(ctx, key, value)
+}
+
+func TestUnfreezeRunningRetry(t *testing.T) {
+	cfg := config.Discovery{
+		Policy: config.Policy{
+			Allow:   true,
+			Publish: true,
+		},
+	}
+
+	ctx := context.Background()
+	dstore := &failPutDatastore{Datastore: datastore.NewMapDatastore()}
+	freezeDirs := []string{t.TempDir()}
+	r, err := New(ctx, cfg, dstore, WithFreezer(freezeDirs, 90.0))
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	peerID, err := peer.Decode(limitedID)
+	require.NoError(t, err)
+	pubID, err := peer.Decode(publisherID)
+	require.NoError(t, err)
+	maddr, err := multiaddr.NewMultiaddr(minerAddr)
+	require.NoError(t, err)
+	adCid := test.RandomCids(1)[0]
+	err = r.Update(ctx, peer.AddrInfo{ID: peerID, Addrs: []multiaddr.Multiaddr{maddr}}, peer.AddrInfo{ID: pubID}, adCid, nil, 0)
+	require.NoError(t, err)
+	require.NoError(t, r.Freeze())
+
+	// Freezer is unfrozen, but providers cannot be.
+	dstore.fail.Store(true)
+	_, err = r.UnfreezeRunning(ctx)
+	require.ErrorContains(t, err, "cannot unfreeze providers")
+	require.False(t, r.Frozen())
+	info, _ := r.ProviderInfo(peerID)
+	require.False(t, info.FrozenAtTime.IsZero())
+
+	// Retry unfreezes the providers.
+	dstore.fail.Store(false)
+	unfrozen, err := r.UnfreezeRunning(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[peer.ID]cid.Cid{pubID: adCid}, unfrozen)
+	info, _ = r.ProviderInfo(peerID)
+	require.True(t, info.FrozenAtTime.IsZero())
+	require.Equal(t, adCid, info.LastAdvertisement)
+
+	_, err = r.UnfreezeRunning(ctx)
+	require.ErrorIs(t, err, ErrNotFrozen)
+}
+
 func TestHandoff(t *testing.T) {
 	cfg := config.Discovery{
 		Policy: config.Policy{
@@ -878,6 +1009,66 @@ func TestHandoff(t *testing.T) {
 	require.ErrorIs(t, r.AssignPeer(pubID2), ErrFrozen)
 }
 
+func TestHandoffNotFrozen(t *testing.T) {
+	cfg := config.Discovery{
+		Policy: config.Policy{
+			Allow:   true,
+			Publish: true,
+		},
+		UseAssigner: true,
+	}
+
+	ctx := context.Background()
+	r, err := New(ctx, cfg, datastore.NewMapDatastore())
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	pubID, err := peer.Decode(publisherID)
+	require.NoError(t, err)
+	pubAddr, err := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/9999")
+	require.NoError(t, err)
+	pubAddrInfo := peer.AddrInfo{
+		ID:    pubID,
+		Addrs: []multiaddr.Multiaddr{pubAddr},
+	}
+
+	mh, err := multihash.Sum([]byte("somedata"), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	adCid := cid.NewCidV1(cid.Raw, mh)
+
+	// Source indexer is not frozen, so it has no FrozenAt.
+	sourceServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer req.Body.Close()
+		pInfos := []model.ProviderInfo{{
+			AddrInfo:              pubAddrInfo,
+			LastAdvertisement:     adCid,
+			LastAdvertisementTime: time.Now().Format(time.RFC3339),
+			Publisher:             &pubAddrInfo,
+		}}
+		data, err := json.Marshal(pInfos)
+		if err != nil {
+			panic(err.Error())
+		}
+		writeJsonResponse(w, http.StatusOK, data)
+	}))
+	defer sourceServer.Close()
+
+	sourceURL, err := url.Parse(sourceServer.URL)
+	require.NoError(t, err)
+	sourceID, err := peer.Decode(limitedID)
+	require.NoError(t, err)
+
+	err = r.Handoff(ctx, pubID, sourceID, sourceURL)
+	require.NoError(t, err)
+
+	select {
+	case pinfo := <-r.SyncChan():
+		require.Equal(t, adCid, pinfo.StopCid(), "Sync should stop at last ad of source indexer")
+	default:
+		t.Fatal("Expected sync channel to be written")
+	}
+}
+
 func writeJsonResponse(w http.ResponseWriter, status int, body []byte) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
@@ -1,21 +1,51 @@
 package registry
 
 import (
+	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"path"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipni/storetheindex/internal/metrics"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 )
 
 const defaultMaxAge = 48 * time.Hour
 const seqRetireInterval = time.Hour
 
+const (
+	// seqKeyPath is where the last seen sequence number of each peer is
+	// stored.
+	seqKeyPath = "/registry/seq"
+	// nonceKeyPath is where sequence numbers seen from each peer are stored,
+	// when sequence numbers are used as nonces.
+	nonceKeyPath = "/registry/nonce"
+)
+
+// auditLog records security-relevant events, such as rejected replays.
+var auditLog = logging.Logger("indexer/audit")
+
 type sequences struct {
+	dstore     datastore.Datastore
 	lastRetire time.Time
 	maxAge     time.Duration
 	mutex      sync.Mutex
-	seqs       map[peer.ID]uint64
+	// nonces, if true, means sequence numbers are used as nonces.
+	nonces bool
+	// seqs holds the last sequence number seen from each peer.
+	seqs map[peer.ID]uint64
+	// seen holds all sequence numbers seen from each peer, within maxAge,
+	// when sequence numbers are used as nonces.
+	seen map[peer.ID]map[uint64]struct{}
 }
 
 func newSequences(maxAge time.Duration) *sequences {
@@ -25,42 +55,181 @@ func newSequences(maxAge time.Duration) *sequences {
 	return &sequences{
 		maxAge: maxAge,
 		seqs:   make(map[peer.ID]uint64),
+		seen:   make(map[peer.ID]map[uint64]struct{}),
 	}
 }
 
-func (s *sequences) check(id peer.ID, sequence uint64) error {
+// load reads persisted sequence numbers that are still within maxAge from the
+// datastore, and uses the datastore to persist new sequence numbers.
+func (s *sequences) load(ctx context.Context, dstore datastore.Datastore, nonces bool) error {
+	s.dstore = dstore
+	s.nonces = nonces
+	if dstore == nil {
+		return nil
+	}
+
 	oldestAllowed := uint64(time.Now().Add(-s.maxAge).UnixNano())
-	if sequence < oldestAllowed {
-		return errors.New("sequence too small")
+	var expired []datastore.Key
+
+	prefix := seqKeyPath
+	if nonces {
+		prefix = nonceKeyPath
+	}
+	results, err := dstore.Query(ctx, query.Query{
+		Prefix: prefix,
+	})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	for result := range results.Next() {
+		if result.Error != nil {
+			return fmt.Errorf("cannot read sequence data: %w", result.Error)
+		}
+		ent := result.Entry
+		if len(ent.Value) != 8 {
+			log.Errorw("Invalid persisted sequence", "key", ent.Key)
+			continue
+		}
+		seq := binary.BigEndian.Uint64(ent.Value)
+		if seq < oldestAllowed {
+			expired = append(expired, datastore.NewKey(ent.Key))
+			continue
+		}
+		var idStr string
+		if nonces {
+			idStr = path.Base(path.Dir(ent.Key))
+		} else {
+			idStr = path.Base(ent.Key)
+		}
+		peerID, err := peer.Decode(idStr)
+		if err != nil {
+			log.Errorw("Cannot decode peer ID of persisted sequence", "err", err, "key", ent.Key)
+			continue
+		}
+		if nonces {
+			s.addSeen(peerID, seq)
+		} else {
+			s.seqs[peerID] = seq
+		}
 	}
 
+	for _, key := range expired {
+		if err = dstore.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sequences) check(id peer.ID, sequence uint64) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	prevSeq, ok := s.seqs[id]
-	if ok && sequence <= prevSeq {
-		return errors.New("sequence less than or equal to last seen")
+	oldestAllowed := uint64(time.Now().Add(-s.maxAge).UnixNano())
+	if sequence < oldestAllowed {
+		return s.reject(id, sequence, "sequence too small")
+	}
+
+	if s.nonces {
+		if _, ok := s.seen[id][sequence]; ok {
+			return s.reject(id, sequence, "sequence already seen")
+		}
+		s.addSeen(id, sequence)
+	} else {
+		prevSeq, ok := s.seqs[id]
+		if ok && sequence <= prevSeq {
+			return s.reject(id, sequence, "sequence less than or equal to last seen")
+		}
+		s.seqs[id] = sequence
+	}
+
+	if err := s.persist(id, sequence); err != nil {
+		log.Errorw("Cannot persist sequence", "err", err, "peer", id)
 	}
-	s.seqs[id] = sequence
 
 	if time.Since(s.lastRetire) > seqRetireInterval {
+		s.lastRetire = time.Now()
 		go s.retire()
 	}
 	return nil
 }
 
-func (s *sequences) retire() {
-	oldestAllowed := uint64(time.Now().Add(-s.maxAge).UnixNano())
-	active := make(map[peer.ID]uint64)
+func (s *sequences) addSeen(id peer.ID, sequence uint64) {
+	peerSeen, ok := s.seen[id]
+	if !ok {
+		peerSeen = make(map[uint64]struct{})
+		s.seen[id] = peerSeen
+	}
+	peerSeen[sequence] = struct{}{}
+}
+
+func (s *sequences) reject(id peer.ID, sequence uint64, reason string) error {
+	_ = stats.RecordWithOptions(context.Background(),
+		stats.WithTags(tag.Insert(metrics.ErrKind, reason)),
+		stats.WithMeasurements(metrics.ReplayRejectCount.M(1)))
+	auditLog.Warnw("Rejected replayed request", "peer", id, "sequence", sequence, "reason", reason)
+	return errors.New(reason)
+}
 
+func (s *sequences) persist(id peer.ID, sequence uint64) error {
+	if s.dstore == nil {
+		return nil
+	}
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, sequence)
+	return s.dstore.Put(context.Background(), s.dsKey(id, sequence), value)
+}
+
+func (s *sequences) dsKey(id peer.ID, sequence uint64) datastore.Key {
+	if s.nonces {
+		return datastore.NewKey(path.Join(nonceKeyPath, id.String(), strconv.FormatUint(sequence, 10)))
+	}
+	return peerIDToDsKey(seqKeyPath, id)
+}
+
+func (s *sequences) retire() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	for id, seq := range s.seqs {
-		if seq > oldestAllowed {
-			active[id] = seq
+	oldestAllowed := uint64(time.Now().Add(-s.maxAge).UnixNano())
+	var expired []datastore.Key
+
+	if s.nonces {
+		for id, peerSeen := range s.seen {
+			for seq := range peerSeen {
+				if seq <= oldestAllowed {
+					delete(peerSeen, seq)
+					expired = append(expired, s.dsKey(id, seq))
+				}
+			}
+			if len(peerSeen) == 0 {
+				delete(s.seen, id)
+			}
+		}
+	} else {
+		active := make(map[peer.ID]uint64)
+		for id, seq := range s.seqs {
+			if seq > oldestAllowed {
+				active[id] = seq
+			} else {
+				expired = append(expired, s.dsKey(id, seq))
+			}
 		}
+		s.seqs = active
 	}
-	s.seqs = active
 	s.lastRetire = time.Now()
+
+	if s.dstore == nil {
+		return
+	}
+	// Delete while holding lock, so that a new sequence from the same peer is
+	// not persisted and then deleted.
+	for _, key := range expired {
+		if err := s.dstore.Delete(context.Background(), key); err != nil {
+			log.Errorw("Cannot delete expired sequence", "err", err)
+			return
+		}
+	}
 }
@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipni/storetheindex/config"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequencePersisted(t *testing.T) {
+	ctx := context.Background()
+	peerID, err := peer.Decode(limitedID)
+	require.NoError(t, err)
+
+	cfg := config.Discovery{
+		Policy:       config.Policy{Allow: true},
+		ReplayWindow: config.Duration(time.Hour),
+	}
+	dstore := datastore.NewMapDatastore()
+	r, err := New(ctx, cfg, dstore)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	seq := uint64(time.Now().UnixNano())
+	require.NoError(t, r.CheckSequence(peerID, seq))
+	require.Error(t, r.CheckSequence(peerID, seq))
+	require.Error(t, r.CheckSequence(peerID, seq-1))
+
+	// Sequence older than replay window is rejected.
+	require.Error(t, r.CheckSequence(peerID, uint64(time.Now().Add(-2*time.Hour).UnixNano())))
+
+	// Check that last sequence is remembered after restart.
+	r.Close()
+	r, err = New(ctx, cfg, dstore)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	require.Error(t, r.CheckSequence(peerID, seq))
+	require.NoError(t, r.CheckSequence(peerID, seq+1))
+}
+
+func TestSequenceNonces(t *testing.T) {
+	ctx := context.Background()
+	peerID, err := peer.Decode(limitedID)
+	require.NoError(t, err)
+
+	cfg := config.Discovery{
+		Policy:       config.Policy{Allow: true},
+		ReplayNonces: true,
+	}
+	dstore := datastore.NewMapDatastore()
+	r, err := New(ctx, cfg, dstore)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	seq := uint64(time.Now().UnixNano())
+	require.NoError(t, r.CheckSequence(peerID, seq))
+	// Nonces do not need to increase.
+	require.NoError(t, r.CheckSequence(peerID, seq-1))
+	require.Error(t, r.CheckSequence(peerID, seq))
+
+	// Check that nonces are remembered after restart.
+	r.Close()
+	r, err = New(ctx, cfg, dstore)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	require.Error(t, r.CheckSequence(peerID, seq))
+	require.Error(t, r.CheckSequence(peerID, seq-1))
+	require.NoError(t, r.CheckSequence(peerID, seq-2))
+
+	// Check that expired nonces are retired.
+	r.sequences.mutex.Lock()
+	r.sequences.maxAge = time.Nanosecond
+	r.sequences.mutex.Unlock()
+	r.sequences.retire()
+	r.sequences.mutex.Lock()
+	require.Empty(t, r.sequences.seen)
+	r.sequences.mutex.Unlock()
+}
@@ -0,0 +1,253 @@
+package registry
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipni/storetheindex/internal/freeze"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// SnapshotVersion is the version of the registry snapshot format written by
+// ExportSnapshot.
+const SnapshotVersion = 1
+
+// maxSnapshotLine is the maximum size of a single record in a snapshot.
+const maxSnapshotLine = 4 << 20
+
+// snapshotHeader is the first record in a registry snapshot.
+type snapshotHeader struct {
+	Version int
+	Created time.Time
+	// FrozenAt is the time the indexer became frozen, or omitted if the
+	// indexer was not frozen.
+	FrozenAt *time.Time `json:",omitempty"`
+}
+
+// snapshotRecord is one line of a registry snapshot following the header.
+// Exactly one field is set in each record.
+type snapshotRecord struct {
+	Provider  *ProviderInfo       `json:",omitempty"`
+	Assigned  *snapshotAssignment `json:",omitempty"`
+	Preferred peer.ID             `json:",omitempty"`
+}
+
+// snapshotAssignment is an assigned publisher and the frozen indexer, if any,
+// that the publisher was handed off from.
+type snapshotAssignment struct {
+	Publisher peer.ID
+	Continued peer.ID `json:",omitempty"`
+}
+
+// SnapshotStats reports the number of each kind of record exported or
+// imported.
+type SnapshotStats struct {
+	Providers int
+	Assigned  int
+	Preferred int
+	Frozen    bool
+	// Skipped is the number of imported providers that were already
+	// registered and were not overwritten.
+	Skipped int
+}
+
+// ExportSnapshot writes all persisted registry information in dstore to w as
+// newline-delimited JSON. The first line is a header that holds the snapshot
+// version and the indexer's frozen state. Each following line holds a
+// provider, an assignment, or a preferred peer. This must only be called when
+// the registry is not running.
+func ExportSnapshot(ctx context.Context, dstore datastore.Datastore, w io.Writer) (SnapshotStats, error) {
+	var stats SnapshotStats
+
+	providers, err := loadPersistedProviders(ctx, dstore, false)
+	if err != nil {
+		return stats, fmt.Errorf("cannot load provider info: %w", err)
+	}
+	// Read assignments without migrating those stored under the old key
+	// path, since exporting does not modify the datastore. Old assignments
+	// have no handoff information.
+	assigned := make(map[peer.ID]peer.ID)
+	err = readPersistedAssignments(ctx, dstore, oldAssignmentsKeyPath, assigned)
+	if err == nil {
+		err = readPersistedAssignments(ctx, dstore, assignmentsKeyPath, assigned)
+	}
+	if err != nil {
+		return stats, fmt.Errorf("cannot load assignments: %w", err)
+	}
+	preferred := loadPreferredAssignments(providers, assigned)
+
+	header := snapshotHeader{
+		Version: SnapshotVersion,
+		Created: time.Now().UTC(),
+	}
+	frozenAt, frozen, err := freeze.FrozenTime(ctx, dstore)
+	if err != nil {
+		return stats, fmt.Errorf("cannot read frozen state: %w", err)
+	}
+	if frozen {
+		header.FrozenAt = &frozenAt
+		stats.Frozen = true
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err = enc.Encode(&header); err != nil {
+		return stats, err
+	}
+
+	// Write records in a stable order so that snapshots can be compared.
+	for _, providerID := range sortedPeerIDs(providers) {
+		if err = enc.Encode(&snapshotRecord{Provider: providers[providerID]}); err != nil {
+			return stats, err
+		}
+		stats.Providers++
+	}
+	for _, publisherID := range sortedPeerIDs(assigned) {
+		rec := snapshotRecord{
+			Assigned: &snapshotAssignment{
+				Publisher: publisherID,
+				Continued: assigned[publisherID],
+			},
+		}
+		if err = enc.Encode(&rec); err != nil {
+			return stats, err
+		}
+		stats.Assigned++
+	}
+	for _, publisherID := range sortedPeerIDs(preferred) {
+		if err = enc.Encode(&snapshotRecord{Preferred: publisherID}); err != nil {
+			return stats, err
+		}
+		stats.Preferred++
+	}
+
+	if err = bw.Flush(); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// ImportSnapshot reads a registry snapshot, written by ExportSnapshot, from r
+// and stores its contents in dstore. Providers that are already in dstore are
+// only replaced if overwrite is true. Preferred peers are not stored, since
+// they are derived from provider and assignment information when the
+// registry starts. If the snapshot records that the indexer was frozen, then
+// the frozen state is restored. This must only be called when the registry
+// is not running.
+func ImportSnapshot(ctx context.Context, dstore datastore.Datastore, r io.Reader, overwrite bool) (SnapshotStats, error) {
+	var stats SnapshotStats
+
+	if dstore == nil {
+		return stats, errors.New("no datastore")
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSnapshotLine)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return stats, fmt.Errorf("cannot read snapshot header: %w", err)
+		}
+		return stats, errors.New("empty snapshot")
+	}
+	var header snapshotHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return stats, fmt.Errorf("cannot decode snapshot header: %w", err)
+	}
+	if header.Version != SnapshotVersion {
+		return stats, fmt.Errorf("unsupported snapshot version %d", header.Version)
+	}
+
+	existing, err := loadPersistedProviders(ctx, dstore, false)
+	if err != nil {
+		return stats, fmt.Errorf("cannot load provider info: %w", err)
+	}
+
+	var line int
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec snapshotRecord
+		if err = json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return stats, fmt.Errorf("cannot decode snapshot record %d: %w", line, err)
+		}
+
+		switch {
+		case rec.Provider != nil:
+			info := rec.Provider
+			if err = info.AddrInfo.ID.Validate(); err != nil {
+				return stats, fmt.Errorf("invalid provider id in snapshot record %d: %w", line, err)
+			}
+			if _, ok := existing[info.AddrInfo.ID]; ok && !overwrite {
+				stats.Skipped++
+				continue
+			}
+			value, err := json.Marshal(info)
+			if err != nil {
+				return stats, err
+			}
+			if err = dstore.Put(ctx, info.dsKey(), value); err != nil {
+				return stats, err
+			}
+			stats.Providers++
+		case rec.Assigned != nil:
+			publisherID := rec.Assigned.Publisher
+			if err = publisherID.Validate(); err != nil {
+				return stats, fmt.Errorf("invalid publisher id in snapshot record %d: %w", line, err)
+			}
+			var value []byte
+			if rec.Assigned.Continued.Validate() == nil {
+				value, err = json.Marshal(rec.Assigned.Continued)
+				if err != nil {
+					return stats, err
+				}
+			} else {
+				value = []byte{}
+			}
+			if err = dstore.Put(ctx, peerIDToDsKey(assignmentsKeyPath, publisherID), value); err != nil {
+				return stats, err
+			}
+			stats.Assigned++
+		case rec.Preferred != "":
+			stats.Preferred++
+		default:
+			return stats, fmt.Errorf("empty snapshot record %d", line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return stats, fmt.Errorf("cannot read snapshot: %w", err)
+	}
+
+	if header.FrozenAt != nil {
+		if err = freeze.SetFrozenTime(ctx, dstore, *header.FrozenAt); err != nil {
+			return stats, fmt.Errorf("cannot restore frozen state: %w", err)
+		}
+		stats.Frozen = true
+	}
+
+	if err = dstore.Sync(ctx, datastore.NewKey(providerKeyPath)); err != nil {
+		return stats, err
+	}
+	if err = dstore.Sync(ctx, datastore.NewKey(assignmentsKeyPath)); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+func sortedPeerIDs[T any](m map[peer.ID]T) []peer.ID {
+	ids := make([]peer.ID, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
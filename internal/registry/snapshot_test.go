@@ -0,0 +1,138 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipni/go-libipni/test"
+	"github.com/ipni/storetheindex/config"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotExportImport(t *testing.T) {
+	cfg := config.Discovery{
+		Policy: config.Policy{
+			Allow:   true,
+			Publish: true,
+		},
+		UseAssigner: true,
+	}
+	ctx := context.Background()
+
+	provID, err := peer.Decode(limitedID)
+	require.NoError(t, err)
+	pubID, err := peer.Decode(publisherID)
+	require.NoError(t, err)
+	epID, err := peer.Decode(limitedID2)
+	require.NoError(t, err)
+	assignedID, err := peer.Decode(limitedID3)
+	require.NoError(t, err)
+	maddr, err := multiaddr.NewMultiaddr(minerAddr)
+	require.NoError(t, err)
+	maddr2, err := multiaddr.NewMultiaddr(minerAddr2)
+	require.NoError(t, err)
+
+	mh, err := multihash.Sum([]byte("somedata"), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	adCid := cid.NewCidV1(cid.Raw, mh)
+
+	srcStore := datastore.NewMapDatastore()
+	r, err := New(ctx, cfg, srcStore, WithFreezer([]string{t.TempDir()}, 90.0))
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	extProviders := &ExtendedProviders{
+		Providers: []ExtendedProviderInfo{
+			{
+				PeerID:   epID,
+				Metadata: []byte("metadata"),
+				Addrs:    []multiaddr.Multiaddr{maddr2},
+			},
+		},
+	}
+	prov := peer.AddrInfo{ID: provID, Addrs: []multiaddr.Multiaddr{maddr}}
+	pub := peer.AddrInfo{ID: pubID, Addrs: []multiaddr.Multiaddr{maddr}}
+	err = r.Update(ctx, prov, pub, adCid, extProviders, 0)
+	require.NoError(t, err)
+	require.NoError(t, r.AssignPeer(assignedID))
+	// Publisher handed off from a frozen indexer.
+	handoffID, _, _ := test.RandomIdentity()
+	frozenID, _, _ := test.RandomIdentity()
+	require.NoError(t, r.assignPeer(handoffID, frozenID))
+	require.NoError(t, r.Freeze())
+	r.Close()
+
+	// Assignment stored under the old key path is exported without being
+	// migrated.
+	oldAssignedID, _, _ := test.RandomIdentity()
+	oldKey := peerIDToDsKey(oldAssignmentsKeyPath, oldAssignedID)
+	require.NoError(t, srcStore.Put(ctx, oldKey, []byte{}))
+
+	var buf bytes.Buffer
+	stats, err := ExportSnapshot(ctx, srcStore, &buf)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Providers)
+	require.Equal(t, 3, stats.Assigned)
+	require.Equal(t, 1, stats.Preferred)
+	require.True(t, stats.Frozen)
+	snapshot := buf.Bytes()
+	has, err := srcStore.Has(ctx, oldKey)
+	require.NoError(t, err)
+	require.True(t, has)
+
+	dstStore := datastore.NewMapDatastore()
+	stats, err = ImportSnapshot(ctx, dstStore, bytes.NewReader(snapshot), false)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Providers)
+	require.Equal(t, 3, stats.Assigned)
+	require.Equal(t, 1, stats.Preferred)
+	require.True(t, stats.Frozen)
+
+	// Importing again without overwrite skips existing providers.
+	stats, err = ImportSnapshot(ctx, dstStore, bytes.NewReader(snapshot), false)
+	require.NoError(t, err)
+	require.Zero(t, stats.Providers)
+	require.Equal(t, 1, stats.Skipped)
+
+	r, err = New(ctx, cfg, dstStore, WithFreezer([]string{t.TempDir()}, 90.0))
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	require.True(t, r.Frozen())
+
+	info, _ := r.ProviderInfo(provID)
+	require.NotNil(t, info)
+	require.Equal(t, pubID, info.Publisher)
+	require.Equal(t, adCid, info.FrozenAt)
+	require.NotNil(t, info.ExtendedProviders)
+	require.Equal(t, 1, len(info.ExtendedProviders.Providers))
+	require.Equal(t, epID, info.ExtendedProviders.Providers[0].PeerID)
+	require.Equal(t, []byte("metadata"), info.ExtendedProviders.Providers[0].Metadata)
+
+	assigned, continued, err := r.ListAssignedPeers()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []peer.ID{assignedID, handoffID, oldAssignedID}, assigned)
+	for i := range assigned {
+		if assigned[i] == handoffID {
+			require.Equal(t, frozenID, continued[i])
+		} else {
+			require.Empty(t, continued[i])
+		}
+	}
+
+	preferred, err := r.ListPreferredPeers()
+	require.NoError(t, err)
+	require.Equal(t, []peer.ID{pubID}, preferred)
+}
+
+func TestSnapshotImportBadVersion(t *testing.T) {
+	snapshot := []byte(`{"Version":99,"Created":"2023-01-01T00:00:00Z"}` + "\n")
+	_, err := ImportSnapshot(context.Background(), datastore.NewMapDatastore(), bytes.NewReader(snapshot), false)
+	require.ErrorContains(t, err, "unsupported snapshot version")
+}
@@ -38,13 +38,21 @@ func main() {
 		Commands: []*cli.Command{
 			command.AdminCmd,
 			command.AssignerCmd,
+			command.BackupCmd,
+			command.ConvertDatastoreCmd,
 			command.DaemonCmd,
+			command.ExportProviderCmd,
 			command.FindCmd,
 			command.ImportCmd,
 			command.InitCmd,
 			command.LoadtestCmd,
 			command.LogCmd,
+			command.MigrateValueStoreCmd,
+			command.MirrorCmd,
 			command.ProvidersCmd,
+			command.ReconcileCountsCmd,
+			command.RegistryCmd,
+			command.RestoreCmd,
 			command.SPAddrCmd,
 		},
 	}
@@ -13,12 +13,18 @@ import (
 	"sort"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/ipfs/go-cid"
 	"github.com/ipni/go-indexer-core"
 	"github.com/ipni/storetheindex/admin/model"
+	sticfg "github.com/ipni/storetheindex/config"
+	"github.com/ipni/storetheindex/internal/counter"
+	"github.com/ipni/storetheindex/internal/freeze"
 	"github.com/ipni/storetheindex/internal/httpserver"
 	"github.com/ipni/storetheindex/internal/importer"
 	"github.com/ipni/storetheindex/internal/ingest"
+	"github.com/ipni/storetheindex/internal/maintenance"
 	"github.com/ipni/storetheindex/internal/registry"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
@@ -27,14 +33,25 @@ import (
 
 type adminHandler struct {
 	ctx                context.Context
+	backupFunc         BackupFunc
+	backupStatus       *model.BackupStatus
+	backupMutex        sync.Mutex
 	id                 peer.ID
 	indexer            indexer.Interface
 	ingester           *ingest.Ingester
+	maintainer         *maintenance.Maintainer
 	reg                *registry.Registry
 	reloadErrChan      chan<- chan error
 	pendingSyncs       sync.WaitGroup
 	pendingsSyncsPeers map[string]struct{}
 	pendingSyncsLock   sync.Mutex
+	reconcileFunc      ReconcileFunc
+	reconcileStatus    *model.ReconcileStatus
+	reconcileMutex     sync.Mutex
+	rebuildStatus      *model.RebuildStatus
+	rebuildMutex       sync.Mutex
+	unfreezeStatus     *model.UnfreezeStatus
+	unfreezeMutex      sync.Mutex
 }
 
 func newHandler(ctx context.Context, id peer.ID, indexer indexer.Interface, ingester *ingest.Ingester, reg *registry.Registry, reloadErrChan chan<- chan error) *adminHandler {
@@ -638,6 +655,537 @@ func (h *adminHandler) freeze(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+func (h *adminHandler) unfreeze(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.unfreezeMutex.Lock()
+		var data []byte
+		var err error
+		if h.unfreezeStatus != nil {
+			data, err = json.Marshal(h.unfreezeStatus)
+		}
+		h.unfreezeMutex.Unlock()
+		if err != nil {
+			log.Errorw("Error marshaling unfreeze status", "err", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if data == nil {
+			http.Error(w, "indexer has not been unfrozen", http.StatusNotFound)
+			return
+		}
+		httpserver.WriteJsonResponse(w, http.StatusOK, data)
+	case http.MethodPut:
+		h.startUnfreeze(w, r)
+	default:
+		w.Header().Set("Allow", http.MethodGet)
+		w.Header().Add("Allow", http.MethodPut)
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *adminHandler) startUnfreeze(w http.ResponseWriter, r *http.Request) {
+	h.unfreezeMutex.Lock()
+	defer h.unfreezeMutex.Unlock()
+
+	if h.unfreezeStatus != nil && h.unfreezeStatus.Running {
+		http.Error(w, "unfreeze already in progress", http.StatusConflict)
+		return
+	}
+
+	unfrozen, err := h.reg.UnfreezeRunning(r.Context())
+	if err != nil {
+		if errors.Is(err, registry.ErrNoFreeze) || errors.Is(err, registry.ErrNotFrozen) || errors.Is(err, freeze.ErrUsageTooHigh) {
+			log.Infow("Cannot unfreeze indexer", "reason", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Errorw("Cannot unfreeze indexer", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	log.Infow("Indexer unfrozen", "publishers", len(unfrozen))
+
+	status := &model.UnfreezeStatus{
+		Running:    h.ingester != nil && len(unfrozen) != 0,
+		Started:    time.Now(),
+		Publishers: len(unfrozen),
+	}
+	if status.Running {
+		h.pendingSyncs.Add(1)
+		go func() {
+			defer h.pendingSyncs.Done()
+			h.resyncUnfrozen(unfrozen)
+		}()
+	} else {
+		status.Finished = &status.Started
+	}
+	h.unfreezeStatus = status
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		log.Errorw("Error marshaling unfreeze status", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	httpserver.WriteJsonResponse(w, http.StatusOK, data)
+}
+
+// resyncUnfrozen re-syncs unfrozen publishers and records the progress in the
+// unfreeze status.
+func (h *adminHandler) resyncUnfrozen(unfrozen map[peer.ID]cid.Cid) {
+	updateStatus := func(update func(*model.UnfreezeStatus)) {
+		h.unfreezeMutex.Lock()
+		update(h.unfreezeStatus)
+		h.unfreezeMutex.Unlock()
+	}
+
+	err := h.ingester.UnfreezeRunning(h.ctx, unfrozen, func(pubID peer.ID, err error) {
+		updateStatus(func(status *model.UnfreezeStatus) {
+			if err != nil {
+				status.Errors = append(status.Errors, fmt.Sprintf("%s: %s", pubID, err))
+			} else {
+				status.Synced++
+			}
+		})
+	})
+	if err != nil {
+		log.Errorw("Cannot re-sync unfrozen publishers", "err", err)
+	}
+
+	updateStatus(func(status *model.UnfreezeStatus) {
+		if err != nil {
+			status.Errors = append(status.Errors, err.Error())
+		}
+		now := time.Now()
+		status.Finished = &now
+		status.Running = false
+	})
+	log.Info("Finished re-syncing unfrozen publishers")
+}
+
+func (h *adminHandler) backup(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.backupMutex.Lock()
+		var data []byte
+		var err error
+		if h.backupStatus != nil {
+			data, err = json.Marshal(h.backupStatus)
+		}
+		h.backupMutex.Unlock()
+		if err != nil {
+			log.Errorw("Error marshaling backup status", "err", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if data == nil {
+			http.Error(w, "no backup has been taken", http.StatusNotFound)
+			return
+		}
+		httpserver.WriteJsonResponse(w, http.StatusOK, data)
+	case http.MethodPut:
+		h.startBackup(w, r)
+	default:
+		w.Header().Set("Allow", http.MethodGet)
+		w.Header().Add("Allow", http.MethodPut)
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *adminHandler) startBackup(w http.ResponseWriter, r *http.Request) {
+	if h.backupFunc == nil {
+		http.Error(w, "backup not configured", http.StatusBadRequest)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = time.Now().UTC().Format("20060102T150405Z")
+	}
+
+	h.backupMutex.Lock()
+	defer h.backupMutex.Unlock()
+
+	if h.backupStatus != nil && h.backupStatus.Running {
+		http.Error(w, "backup already in progress", http.StatusConflict)
+		return
+	}
+
+	status := &model.BackupStatus{
+		Name:    name,
+		Running: true,
+		Started: time.Now(),
+	}
+	h.backupStatus = status
+
+	h.pendingSyncs.Add(1)
+	go func() {
+		defer h.pendingSyncs.Done()
+		h.writeBackup(name)
+	}()
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		log.Errorw("Error marshaling backup status", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	httpserver.WriteJsonResponse(w, http.StatusOK, data)
+}
+
+// writeBackup writes the named backup and records the result in the backup
+// status.
+func (h *adminHandler) writeBackup(name string) {
+	log.Infow("Starting backup", "name", name)
+	manifest, err := h.backupFunc(h.ctx, name)
+
+	h.backupMutex.Lock()
+	defer h.backupMutex.Unlock()
+
+	// Replace the status so that previously returned status is not modified.
+	status := *h.backupStatus
+	if err != nil {
+		log.Errorw("Backup failed", "name", name, "err", err)
+		status.Error = err.Error()
+	} else {
+		log.Infow("Finished backup", "name", name)
+		status.Publishers = len(manifest.Heads)
+		status.DatastoreKeys = manifest.DatastoreKeys
+		status.ValueStoreFiles = len(manifest.ValueStoreFiles)
+	}
+	now := time.Now()
+	status.Finished = &now
+	status.Running = false
+	h.backupStatus = &status
+}
+
+// ----- index count handlers -----
+func (h *adminHandler) reconcile(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.reconcileMutex.Lock()
+		var data []byte
+		var err error
+		if h.reconcileStatus != nil {
+			data, err = json.Marshal(h.reconcileStatus)
+		}
+		h.reconcileMutex.Unlock()
+		if err != nil {
+			log.Errorw("Error marshaling reconcile status", "err", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if data == nil {
+			http.Error(w, "index counts have not been reconciled", http.StatusNotFound)
+			return
+		}
+		httpserver.WriteJsonResponse(w, http.StatusOK, data)
+	case http.MethodPut:
+		h.startReconcile(w, r)
+	default:
+		w.Header().Set("Allow", http.MethodGet)
+		w.Header().Add("Allow", http.MethodPut)
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *adminHandler) startReconcile(w http.ResponseWriter, r *http.Request) {
+	if h.reconcileFunc == nil {
+		http.Error(w, "index count reconciliation not configured", http.StatusBadRequest)
+		return
+	}
+
+	source := r.URL.Query().Get("source")
+	switch source {
+	case "":
+		source = model.ReconcileSourceValueStore
+	case model.ReconcileSourceValueStore, model.ReconcileSourceMirror:
+	default:
+		http.Error(w, "invalid source", http.StatusBadRequest)
+		return
+	}
+	var rewrite bool
+	if rewriteStr := r.URL.Query().Get("rewrite"); rewriteStr != "" {
+		var err error
+		rewrite, err = strconv.ParseBool(rewriteStr)
+		if err != nil {
+			http.Error(w, "invalid rewrite", http.StatusBadRequest)
+			return
+		}
+	}
+
+	h.reconcileMutex.Lock()
+	defer h.reconcileMutex.Unlock()
+
+	if h.reconcileStatus != nil && h.reconcileStatus.Running {
+		http.Error(w, "index count reconciliation already in progress", http.StatusConflict)
+		return
+	}
+
+	status := &model.ReconcileStatus{
+		Source:  source,
+		Rewrite: rewrite,
+		Running: true,
+		Started: time.Now(),
+	}
+	h.reconcileStatus = status
+
+	h.pendingSyncs.Add(1)
+	go func() {
+		defer h.pendingSyncs.Done()
+		h.reconcileCounts(source, rewrite)
+	}()
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		log.Errorw("Error marshaling reconcile status", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	httpserver.WriteJsonResponse(w, http.StatusOK, data)
+}
+
+// reconcileCounts reconciles index counts with the source and records the
+// result in the reconcile status.
+func (h *adminHandler) reconcileCounts(source string, rewrite bool) {
+	log.Infow("Starting index count reconciliation", "source", source, "rewrite", rewrite)
+	report, err := h.reconcileFunc(h.ctx, source, rewrite)
+
+	h.reconcileMutex.Lock()
+	defer h.reconcileMutex.Unlock()
+
+	// Replace the status so that previously returned status is not modified.
+	status := *h.reconcileStatus
+	if report != nil {
+		status.Providers = report.Providers
+		status.Contexts = report.Contexts
+		status.Discrepancies = report.Discrepancies
+		status.ProviderDiscrepancies = make([]model.CountDiscrepancy, len(report.ProviderDiscrepancies))
+		for i, pd := range report.ProviderDiscrepancies {
+			status.ProviderDiscrepancies[i] = model.CountDiscrepancy{
+				ProviderID: pd.ProviderID,
+				Stored:     pd.Stored,
+				Actual:     pd.Actual,
+			}
+		}
+		status.ContextDiscrepancies = contextDiscrepanciesToModel(report.ContextDiscrepancies)
+		status.Skipped = report.Skipped
+		status.Rewritten = report.Rewritten
+		status.Changed = report.Changed
+	}
+	if err != nil {
+		log.Errorw("Index count reconciliation failed", "err", err)
+		status.Error = err.Error()
+	} else {
+		log.Infow("Finished index count reconciliation", "discrepancies", status.Discrepancies,
+			"rewritten", status.Rewritten)
+	}
+	now := time.Now()
+	status.Finished = &now
+	status.Running = false
+	h.reconcileStatus = &status
+}
+
+// ----- rebuild handlers -----
+func (h *adminHandler) rebuild(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.rebuildMutex.Lock()
+		var data []byte
+		var err error
+		if h.rebuildStatus != nil {
+			data, err = json.Marshal(h.rebuildStatus)
+		}
+		h.rebuildMutex.Unlock()
+		if err != nil {
+			log.Errorw("Error marshaling rebuild status", "err", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if data == nil {
+			http.Error(w, "no index rebuilt from mirror", http.StatusNotFound)
+			return
+		}
+		httpserver.WriteJsonResponse(w, http.StatusOK, data)
+	case http.MethodPut:
+		h.startRebuild(w, r)
+	default:
+		w.Header().Set("Allow", http.MethodGet)
+		w.Header().Add("Allow", http.MethodPut)
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *adminHandler) startRebuild(w http.ResponseWriter, r *http.Request) {
+	if h.ingester == nil {
+		http.Error(w, "ingester disabled", http.StatusServiceUnavailable)
+		return
+	}
+	publisherID, ok := decodePeerID(path.Base(r.URL.Path), w)
+	if !ok {
+		return
+	}
+
+	h.rebuildMutex.Lock()
+	defer h.rebuildMutex.Unlock()
+
+	if h.rebuildStatus != nil && h.rebuildStatus.Running {
+		http.Error(w, "rebuild from mirror already in progress", http.StatusConflict)
+		return
+	}
+
+	status := &model.RebuildStatus{
+		Publisher: publisherID,
+		Running:   true,
+		Started:   time.Now(),
+	}
+	h.rebuildStatus = status
+
+	h.pendingSyncs.Add(1)
+	go func() {
+		defer h.pendingSyncs.Done()
+		h.rebuildFromMirror(publisherID)
+	}()
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		log.Errorw("Error marshaling rebuild status", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	httpserver.WriteJsonResponse(w, http.StatusOK, data)
+}
+
+// rebuildFromMirror rebuilds the publisher's index from the advertisement
+// mirror and records the result in the rebuild status.
+func (h *adminHandler) rebuildFromMirror(publisherID peer.ID) {
+	log.Infow("Starting rebuild from mirror", "publisher", publisherID)
+	stats, err := h.ingester.RebuildFromMirror(h.ctx, publisherID)
+
+	h.rebuildMutex.Lock()
+	defer h.rebuildMutex.Unlock()
+
+	// Replace the status so that previously returned status is not modified.
+	status := *h.rebuildStatus
+	status.Ads = stats.Ads
+	status.Indexed = stats.Indexed
+	status.Removals = stats.Removals
+	status.Skipped = stats.Skipped
+	status.NoEntries = stats.NoEntries
+	status.Multihashes = stats.Multihashes
+	if err != nil {
+		log.Errorw("Rebuild from mirror failed", "publisher", publisherID, "err", err)
+		status.Error = err.Error()
+	}
+	now := time.Now()
+	status.Finished = &now
+	status.Running = false
+	h.rebuildStatus = &status
+}
+
+func contextDiscrepanciesToModel(cds []counter.ContextDiscrepancy) []model.CountDiscrepancy {
+	if len(cds) == 0 {
+		return nil
+	}
+	mcds := make([]model.CountDiscrepancy, len(cds))
+	for i, cd := range cds {
+		mcds[i] = model.CountDiscrepancy{
+			ProviderID: cd.ProviderID,
+			ContextID:  cd.ContextID,
+			Stored:     cd.Stored,
+			Actual:     cd.Actual,
+		}
+	}
+	return mcds
+}
+
+// ----- value store maintenance handlers -----
+func (h *adminHandler) valueStoreMaintenance(w http.ResponseWriter, r *http.Request) {
+	if h.maintainer == nil {
+		http.Error(w, "value store maintenance not available", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		op := maintenance.Operation(path.Base(r.URL.Path))
+		var limit time.Duration
+		var err error
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			limit, err = time.ParseDuration(limitStr)
+			if err != nil || limit < 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+		throttle := true
+		if throttleStr := r.URL.Query().Get("throttle"); throttleStr != "" {
+			throttle, err = strconv.ParseBool(throttleStr)
+			if err != nil {
+				http.Error(w, "invalid throttle", http.StatusBadRequest)
+				return
+			}
+		}
+		if _, err = h.maintainer.Start(op, limit, throttle); err != nil {
+			switch {
+			case errors.Is(err, maintenance.ErrRunning):
+				http.Error(w, err.Error(), http.StatusConflict)
+			case errors.Is(err, maintenance.ErrNotSupported):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				log.Errorw("Cannot start value store maintenance", "err", err)
+				http.Error(w, "", http.StatusInternalServerError)
+			}
+			return
+		}
+	default:
+		w.Header().Set("Allow", http.MethodGet)
+		w.Header().Add("Allow", http.MethodPut)
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, last := h.maintainer.Status()
+	status := model.MaintenanceStatus{
+		GCSupported:      h.maintainer.Supported(maintenance.GC),
+		CompactSupported: h.maintainer.Supported(maintenance.Compact),
+		Current:          maintenanceRunToModel(current),
+		Last:             maintenanceRunToModel(last),
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		log.Errorw("Error marshaling maintenance status", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	httpserver.WriteJsonResponse(w, http.StatusOK, data)
+}
+
+func maintenanceRunToModel(run *maintenance.Run) *model.MaintenanceRun {
+	if run == nil {
+		return nil
+	}
+	mr := &model.MaintenanceRun{
+		Operation:      string(run.Operation),
+		Running:        run.Finished.IsZero(),
+		Started:        run.Started,
+		TimeLimit:      sticfg.Duration(run.TimeLimit),
+		Throttled:      run.Throttled,
+		LimitReached:   run.LimitReached,
+		BytesReclaimed: run.BytesReclaimed(),
+	}
+	if !mr.Running {
+		finished := run.Finished
+		mr.Finished = &finished
+	}
+	if run.Err != nil {
+		mr.Error = run.Err.Error()
+	}
+	return mr
+}
+
 func (h *adminHandler) status(w http.ResponseWriter, r *http.Request) {
 	if !httpserver.MethodOK(w, r, http.MethodGet) {
 		return
@@ -653,9 +1201,10 @@ func (h *adminHandler) status(w http.ResponseWriter, r *http.Request) {
 	}
 
 	status := model.Status{
-		Frozen: h.reg.Frozen(),
-		ID:     h.id,
-		Usage:  usage,
+		Frozen:        h.reg.Frozen(),
+		ID:            h.id,
+		Usage:         usage,
+		PressureLevel: h.reg.PressureLevel(),
 	}
 
 	data, err := json.Marshal(status)
@@ -683,6 +1232,294 @@ func (h *adminHandler) healthCheckHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// ----- label handlers -----
+
+func (h *adminHandler) listLabeled(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.MethodOK(w, r, http.MethodGet) {
+		return
+	}
+
+	selectors := r.URL.Query()["label"]
+	var labeled []model.ProviderLabels
+	for _, info := range h.reg.AllProviderInfo() {
+		if len(info.Labels) == 0 || !info.MatchLabels(selectors, false) {
+			continue
+		}
+		labeled = append(labeled, model.ProviderLabels{
+			ProviderID: info.AddrInfo.ID,
+			Labels:     apiLabels(info.Labels),
+		})
+	}
+
+	if len(labeled) == 0 {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	sort.Slice(labeled, func(i, j int) bool {
+		return labeled[i].ProviderID < labeled[j].ProviderID
+	})
+
+	data, err := json.Marshal(labeled)
+	if err != nil {
+		log.Errorw("Error marshaling labeled providers", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	httpserver.WriteJsonResponse(w, http.StatusOK, data)
+}
+
+func (h *adminHandler) labels(w http.ResponseWriter, r *http.Request) {
+	providerID, ok := decodePeerID(path.Base(r.URL.Path), w)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.getLabels(w, providerID)
+	case http.MethodPut:
+		h.setLabel(w, r, providerID)
+	case http.MethodDelete:
+		h.deleteLabel(w, r, providerID)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *adminHandler) getLabels(w http.ResponseWriter, providerID peer.ID) {
+	info, _ := h.reg.ProviderInfo(providerID)
+	if info == nil {
+		http.Error(w, registry.ErrNotRegistered.Error(), http.StatusNotFound)
+		return
+	}
+
+	data, err := json.Marshal(apiLabels(info.Labels))
+	if err != nil {
+		log.Errorw("Error marshaling labels", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	httpserver.WriteJsonResponse(w, http.StatusOK, data)
+}
+
+func (h *adminHandler) setLabel(w http.ResponseWriter, r *http.Request, providerID peer.ID) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Errorw("Failed reading body", "err", err)
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	var label model.Label
+	if err = json.Unmarshal(body, &label); err != nil {
+		http.Error(w, fmt.Sprintf("cannot decode label: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	err = h.reg.SetLabel(r.Context(), providerID, label.Key, registry.Label{
+		Value:  label.Value,
+		Public: label.Public,
+	})
+	if err != nil {
+		labelError(w, err)
+		return
+	}
+
+	log.Infow("Set provider label", "provider", providerID, "key", label.Key)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *adminHandler) deleteLabel(w http.ResponseWriter, r *http.Request, providerID peer.ID) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "missing label key", http.StatusBadRequest)
+		return
+	}
+	ok, err := h.reg.DeleteLabel(r.Context(), providerID, key)
+	if err != nil {
+		labelError(w, err)
+		return
+	}
+	if !ok {
+		http.Error(w, "provider does not have label", http.StatusNotFound)
+		return
+	}
+
+	log.Infow("Deleted provider label", "provider", providerID, "key", key)
+	w.WriteHeader(http.StatusOK)
+}
+
+func labelError(w http.ResponseWriter, err error) {
+	log.Errorw("Cannot handle label request", "err", err)
+	if errors.Is(err, registry.ErrNotRegistered) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+func apiLabels(labels map[string]registry.Label) []model.Label {
+	apiLabels := make([]model.Label, 0, len(labels))
+	for key, label := range labels {
+		apiLabels = append(apiLabels, model.Label{
+			Key:    key,
+			Value:  label.Value,
+			Public: label.Public,
+		})
+	}
+	sort.Slice(apiLabels, func(i, j int) bool {
+		return apiLabels[i].Key < apiLabels[j].Key
+	})
+	return apiLabels
+}
+
+// ----- polling handlers -----
+
+func (h *adminHandler) listPollOverrides(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.MethodOK(w, r, http.MethodGet) {
+		return
+	}
+
+	statuses, err := h.reg.ListPollOverrides()
+	if err != nil {
+		pollError(w, err)
+		return
+	}
+
+	if len(statuses) == 0 {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	apiStatuses := make([]model.PollStatus, len(statuses))
+	for i := range statuses {
+		apiStatuses[i] = apiPollStatus(statuses[i])
+	}
+
+	data, err := json.Marshal(apiStatuses)
+	if err != nil {
+		log.Errorw("Error marshaling poll overrides", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	httpserver.WriteJsonResponse(w, http.StatusOK, data)
+}
+
+func (h *adminHandler) pollOverride(w http.ResponseWriter, r *http.Request) {
+	providerID, ok := decodePeerID(path.Base(r.URL.Path), w)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.getPollStatus(w, providerID)
+	case http.MethodPut:
+		h.setPollOverride(w, r, providerID)
+	case http.MethodDelete:
+		h.deletePollOverride(w, r, providerID)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *adminHandler) getPollStatus(w http.ResponseWriter, providerID peer.ID) {
+	status, err := h.reg.PollStatus(providerID)
+	if err != nil {
+		pollError(w, err)
+		return
+	}
+	if status == nil {
+		http.Error(w, "provider not found", http.StatusNotFound)
+		return
+	}
+
+	data, err := json.Marshal(apiPollStatus(status))
+	if err != nil {
+		log.Errorw("Error marshaling poll status", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	httpserver.WriteJsonResponse(w, http.StatusOK, data)
+}
+
+func (h *adminHandler) setPollOverride(w http.ResponseWriter, r *http.Request, providerID peer.ID) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Errorw("Failed reading body", "err", err)
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	var override model.PollOverride
+	if err = json.Unmarshal(body, &override); err != nil {
+		http.Error(w, fmt.Sprintf("cannot decode poll override: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	err = h.reg.SetPollOverride(r.Context(), sticfg.Polling{
+		ProviderID:      providerID.String(),
+		Interval:        override.Interval,
+		RetryAfter:      override.RetryAfter,
+		StopAfter:       override.StopAfter,
+		DeactivateAfter: override.DeactivateAfter,
+	})
+	if err != nil {
+		pollError(w, err)
+		return
+	}
+
+	log.Infow("Set polling override", "provider", providerID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *adminHandler) deletePollOverride(w http.ResponseWriter, r *http.Request, providerID peer.ID) {
+	ok, err := h.reg.DeletePollOverride(r.Context(), providerID)
+	if err != nil {
+		pollError(w, err)
+		return
+	}
+	if !ok {
+		http.Error(w, "no polling override set for provider", http.StatusNotFound)
+		return
+	}
+
+	log.Infow("Deleted polling override", "provider", providerID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func pollError(w http.ResponseWriter, err error) {
+	log.Errorw("Cannot handle polling request", "err", err)
+	if errors.Is(err, registry.ErrNoPolling) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+func apiPollStatus(status *registry.PollStatus) model.PollStatus {
+	apiStatus := model.PollStatus{
+		ProviderID:      status.ProviderID,
+		Override:        status.Override,
+		Persisted:       status.Persisted,
+		Interval:        sticfg.Duration(status.Interval),
+		RetryAfter:      sticfg.Duration(status.RetryAfter),
+		StopAfter:       sticfg.Duration(status.StopAfter),
+		DeactivateAfter: sticfg.Duration(status.DeactivateAfter),
+	}
+	if !status.LastContact.IsZero() {
+		apiStatus.LastContact = &status.LastContact
+		apiStatus.NextPoll = &status.NextPoll
+		apiStatus.Deactivate = &status.Deactivate
+		apiStatus.Remove = &status.Remove
+	}
+	return apiStatus
+}
+
 // ----- utility functions -----
 
 func decodePeerID(id string, w http.ResponseWriter) (peer.ID, bool) {
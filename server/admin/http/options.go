@@ -1,8 +1,13 @@
 package adminserver
 
 import (
+	"context"
 	"fmt"
 	"time"
+
+	"github.com/ipni/storetheindex/internal/backup"
+	"github.com/ipni/storetheindex/internal/counter"
+	"github.com/ipni/storetheindex/internal/maintenance"
 )
 
 const (
@@ -12,10 +17,20 @@ const (
 
 // config contains all options for the server.
 type config struct {
-	readTimeout  time.Duration
-	writeTimeout time.Duration
+	backupFunc    BackupFunc
+	maintainer    *maintenance.Maintainer
+	readTimeout   time.Duration
+	reconcileFunc ReconcileFunc
+	writeTimeout  time.Duration
 }
 
+// BackupFunc writes a backup of the running indexer with the given name.
+type BackupFunc func(ctx context.Context, name string) (*backup.Manifest, error)
+
+// ReconcileFunc reconciles the persisted index counts with counts from the
+// named source, and rewrites the counts that differ if rewrite is true.
+type ReconcileFunc func(ctx context.Context, source string, rewrite bool) (*counter.Report, error)
+
 // Option is a function that sets a value in a config.
 type Option func(*config) error
 
@@ -34,6 +49,35 @@ func getOpts(opts []Option) (config, error) {
 	return cfg, nil
 }
 
+// WithBackup configures the function that writes a backup when a backup is
+// requested through the admin API. Without this, backups are not available.
+func WithBackup(backupFunc BackupFunc) Option {
+	return func(c *config) error {
+		c.backupFunc = backupFunc
+		return nil
+	}
+}
+
+// WithMaintainer configures the value store maintainer used to run value
+// store garbage collection and compaction when requested through the admin
+// API.
+func WithMaintainer(maintainer *maintenance.Maintainer) Option {
+	return func(c *config) error {
+		c.maintainer = maintainer
+		return nil
+	}
+}
+
+// WithReconcile configures the function that reconciles index counts when
+// requested through the admin API. Without this, index count reconciliation
+// is not available.
+func WithReconcile(reconcileFunc ReconcileFunc) Option {
+	return func(c *config) error {
+		c.reconcileFunc = reconcileFunc
+		return nil
+	}
+}
+
 // WithReadTimeout configures server read timeout.
 func WithReadTimeout(t time.Duration) Option {
 	return func(c *config) error {
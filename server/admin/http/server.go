@@ -49,6 +49,9 @@ func New(listen string, id peer.ID, indexer indexer.Interface, ingester *ingest.
 
 	ctx, cancel := context.WithCancel(context.Background())
 	h := newHandler(ctx, id, indexer, ingester, reg, reloadErrChan)
+	h.backupFunc = opts.backupFunc
+	h.maintainer = opts.maintainer
+	h.reconcileFunc = opts.reconcileFunc
 
 	s := &Server{
 		cancel:   cancel,
@@ -64,16 +67,25 @@ func New(listen string, id peer.ID, indexer indexer.Interface, ingester *ingest.
 	mux.HandleFunc("/import/cidlist/", h.importCidList)
 
 	// Admin routes
+	mux.HandleFunc("/backup", h.backup)
 	mux.HandleFunc("/freeze", h.freeze)
 	mux.HandleFunc("/status", h.status)
+	mux.HandleFunc("/unfreeze", h.unfreeze)
 	mux.HandleFunc("/healthcheck", h.healthCheckHandler)
 	mux.HandleFunc("/importproviders", h.importProviders)
+	mux.HandleFunc("/indexcounts/reconcile", h.reconcile)
 	mux.HandleFunc("/reloadconfig", h.reloadConfig)
 
+	// Value store maintenance routes
+	mux.HandleFunc("/valuestore/compact", h.valueStoreMaintenance)
+	mux.HandleFunc("/valuestore/gc", h.valueStoreMaintenance)
+
 	// Ingester routes
 	mux.HandleFunc("/ingest/allow/", h.allowPeer)
 	mux.HandleFunc("/ingest/block/", h.blockPeer)
 	mux.HandleFunc("/ingest/sync/", h.sync)
+	mux.HandleFunc("/ingest/rebuild", h.rebuild)
+	mux.HandleFunc("/ingest/rebuild/", h.rebuild)
 
 	// Assignment routes
 	mux.HandleFunc("/ingest/assign/", h.assignPeer)
@@ -82,6 +94,14 @@ func New(listen string, id peer.ID, indexer indexer.Interface, ingester *ingest.
 	mux.HandleFunc("/ingest/unassign/", h.unassignPeer)
 	mux.HandleFunc("/ingest/preferred", h.listPreferredPeers)
 
+	// Label routes
+	mux.HandleFunc("/labels", h.listLabeled)
+	mux.HandleFunc("/labels/", h.labels)
+
+	// Polling routes
+	mux.HandleFunc("/polling", h.listPollOverrides)
+	mux.HandleFunc("/polling/", h.pollOverride)
+
 	// Metrics routes
 	mux.Handle("/metrics/", metrics.Start(append(coremetrics.DefaultViews, coremetrics.PebbleViews...)))
 	mux.Handle("/debug/pprof/", pprof.WithProfile())
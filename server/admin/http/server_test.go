@@ -3,6 +3,7 @@ package adminserver_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -16,7 +17,9 @@ import (
 	"github.com/ipni/go-indexer-core/store/memory"
 	"github.com/ipni/go-libipni/find/model"
 	"github.com/ipni/storetheindex/admin/client"
+	adminmodel "github.com/ipni/storetheindex/admin/model"
 	"github.com/ipni/storetheindex/config"
+	"github.com/ipni/storetheindex/internal/backup"
 	"github.com/ipni/storetheindex/internal/counter"
 	"github.com/ipni/storetheindex/internal/ingest"
 	"github.com/ipni/storetheindex/internal/registry"
@@ -223,6 +226,120 @@ func TestStatus(t *testing.T) {
 	te.close(t)
 }
 
+func TestBackup(t *testing.T) {
+	te := makeTestenv(t)
+	defer te.close(t)
+
+	// Backup not available without backup function.
+	_, err := te.client.Backup(context.Background(), "")
+	require.ErrorContains(t, err, "backup not configured")
+
+	backupNames := make(chan string, 1)
+	s, err := server.New("127.0.0.1:0", serverID, te.core, te.ingester, te.registry, nil,
+		server.WithBackup(func(ctx context.Context, name string) (*backup.Manifest, error) {
+			te.ingester.PauseIngest()
+			defer te.ingester.ResumeIngest()
+			backupNames <- name
+			return &backup.Manifest{Name: name, DatastoreKeys: 5}, nil
+		}))
+	require.NoError(t, err)
+	go s.Start()
+	defer s.Close()
+	c := setupClient(t, s.URL())
+
+	_, err = c.BackupStatus(context.Background())
+	require.ErrorContains(t, err, "no backup")
+
+	status, err := c.Backup(context.Background(), "test")
+	require.NoError(t, err)
+	require.Equal(t, "test", status.Name)
+	require.Equal(t, "test", <-backupNames)
+
+	require.Eventually(t, func() bool {
+		status, err = c.BackupStatus(context.Background())
+		return err == nil && !status.Running
+	}, time.Second, 10*time.Millisecond)
+	require.Empty(t, status.Error)
+	require.Equal(t, uint64(5), status.DatastoreKeys)
+	require.NotNil(t, status.Finished)
+}
+
+func TestReconcileCounts(t *testing.T) {
+	te := makeTestenv(t)
+	defer te.close(t)
+
+	// Reconciliation not available without reconcile function.
+	_, err := te.client.ReconcileCounts(context.Background(), "", false)
+	require.ErrorContains(t, err, "not configured")
+
+	providerID, err := peer.Decode(peerIDStr)
+	require.NoError(t, err)
+	indexCounts := counter.NewIndexCounts(datastore.NewMapDatastore())
+	indexCounts.AddCount(providerID, []byte("ctx"), 3)
+
+	s, err := server.New("127.0.0.1:0", serverID, te.core, te.ingester, te.registry, nil,
+		server.WithReconcile(func(ctx context.Context, source string, rewrite bool) (*counter.Report, error) {
+			if source != adminmodel.ReconcileSourceValueStore {
+				return nil, errors.New("unexpected source")
+			}
+			return indexCounts.Reconcile(ctx, counter.ValueStoreSource(te.core), rewrite)
+		}))
+	require.NoError(t, err)
+	go s.Start()
+	defer s.Close()
+	c := setupClient(t, s.URL())
+
+	_, err = c.ReconcileCountsStatus(context.Background())
+	require.ErrorContains(t, err, "not been reconciled")
+	_, err = c.ReconcileCounts(context.Background(), "unknown", false)
+	require.ErrorContains(t, err, "invalid source")
+
+	status, err := c.ReconcileCounts(context.Background(), "", true)
+	require.NoError(t, err)
+	require.Equal(t, adminmodel.ReconcileSourceValueStore, status.Source)
+	require.True(t, status.Rewrite)
+
+	require.Eventually(t, func() bool {
+		status, err = c.ReconcileCountsStatus(context.Background())
+		return err == nil && !status.Running
+	}, time.Second, 10*time.Millisecond)
+	require.Empty(t, status.Error)
+	require.Equal(t, 1, status.Discrepancies)
+	require.Equal(t, 1, status.Rewritten)
+	require.Equal(t, []adminmodel.CountDiscrepancy{{
+		ProviderID: providerID,
+		Stored:     3,
+	}}, status.ProviderDiscrepancies)
+	require.Len(t, status.ContextDiscrepancies, 1)
+	require.Equal(t, []byte("ctx"), status.ContextDiscrepancies[0].ContextID)
+
+	count, err := indexCounts.Provider(providerID)
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+func TestRebuildFromMirror(t *testing.T) {
+	te := makeTestenv(t)
+	defer te.close(t)
+
+	_, err := te.client.RebuildStatus(context.Background())
+	require.ErrorContains(t, err, "no index rebuilt")
+
+	publisherID, err := peer.Decode(peerIDStr)
+	require.NoError(t, err)
+	status, err := te.client.RebuildFromMirror(context.Background(), publisherID)
+	require.NoError(t, err)
+	require.Equal(t, publisherID, status.Publisher)
+
+	// Test ingester does not read from a mirror.
+	require.Eventually(t, func() bool {
+		status, err = te.client.RebuildStatus(context.Background())
+		return err == nil && !status.Running
+	}, time.Second, 10*time.Millisecond)
+	require.Contains(t, status.Error, "mirror is not readable")
+	require.NotNil(t, status.Finished)
+}
+
 func writeJsonResponse(w http.ResponseWriter, status int, body []byte) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
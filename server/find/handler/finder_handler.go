@@ -24,6 +24,23 @@ var log = logging.Logger("indexer/find")
 // way of estimating the number of entries in the primary value store.
 const avg_mh_size = 40
 
+// providerInfo extends the find API provider information with information
+// that is specific to this indexer.
+type providerInfo struct {
+	model.ProviderInfo
+	Reachability *reachability `json:",omitempty"`
+	// Labels contains only the provider's public labels.
+	Labels map[string]string `json:",omitempty"`
+}
+
+// reachability is the API representation of registry.Reachability.
+type reachability struct {
+	Reachable bool
+	Latency   string `json:",omitempty"`
+	ProbeTime string
+	Error     string `json:",omitempty"`
+}
+
 // FindHandler provides request handling functionality for the find server
 // that is common to all protocols.
 type FindHandler struct {
@@ -47,6 +64,7 @@ func NewFindHandler(indexer indexer.Interface, registry *registry.Registry, inde
 func (h *FindHandler) Find(mhashes []multihash.Multihash) (*model.FindResponse, error) {
 	results := make([]model.MultihashResult, 0, len(mhashes))
 	provInfos := map[peer.ID]*registry.ProviderInfo{}
+	demoteUnreachable := h.registry.DemoteUnreachable()
 
 	for i := range mhashes {
 		values, found, err := h.indexer.Get(mhashes[i])
@@ -59,6 +77,7 @@ func (h *FindHandler) Find(mhashes []multihash.Multihash) (*model.FindResponse,
 		}
 
 		provResults := make([]model.ProviderResult, 0, len(values))
+		var unreachableResults []model.ProviderResult
 		for j := range values {
 			iVal := values[j]
 			provID := iVal.ProviderID
@@ -68,9 +87,19 @@ func (h *FindHandler) Find(mhashes []multihash.Multihash) (*model.FindResponse,
 				continue
 			}
 
+			// Results from an unreachable provider, including results from
+			// its extended providers, go after all others.
+			unreachable := demoteUnreachable && pinfo.Unreachable()
+			addResult := func(provResult model.ProviderResult) {
+				if unreachable {
+					unreachableResults = append(unreachableResults, provResult)
+				} else {
+					provResults = append(provResults, provResult)
+				}
+			}
+
 			// Adding the main provider
-			provResult := providerResultFromValue(provID, iVal.ContextID, iVal.MetadataBytes, pinfo.AddrInfo.Addrs)
-			provResults = append(provResults, provResult)
+			addResult(providerResultFromValue(provID, iVal.ContextID, iVal.MetadataBytes, pinfo.AddrInfo.Addrs))
 
 			if pinfo.ExtendedProviders == nil {
 				continue
@@ -94,9 +123,7 @@ func (h *FindHandler) Find(mhashes []multihash.Multihash) (*model.FindResponse,
 						(len(epInfo.Metadata) == 0 || bytes.Equal(epInfo.Metadata, iVal.MetadataBytes)) {
 						continue
 					}
-					provResult := createExtendedProviderResult(epInfo, iVal)
-					provResults = append(provResults, *provResult)
-
+					addResult(*createExtendedProviderResult(epInfo, iVal))
 				}
 			}
 
@@ -113,11 +140,12 @@ func (h *FindHandler) Find(mhashes []multihash.Multihash) (*model.FindResponse,
 					(len(epInfo.Metadata) == 0 || bytes.Equal(epInfo.Metadata, iVal.MetadataBytes)) {
 					continue
 				}
-				provResult := createExtendedProviderResult(epInfo, iVal)
-				provResults = append(provResults, *provResult)
+				addResult(*createExtendedProviderResult(epInfo, iVal))
 			}
 
 		}
+		// Results from unreachable providers go after all others.
+		provResults = append(provResults, unreachableResults...)
 
 		// If there are no providers for this multihash, then do not return a
 		// result for it.
@@ -171,11 +199,17 @@ func (h *FindHandler) fetchProviderInfo(provID peer.ID,
 	return pinfo
 }
 
-func (h *FindHandler) ListProviders() ([]byte, error) {
+// ListProviders returns information about all providers. If labels are given,
+// then only providers having public labels that match all of the label
+// selectors are returned.
+func (h *FindHandler) ListProviders(labels ...string) ([]byte, error) {
 	infos := h.registry.AllProviderInfo()
 
-	responses := make([]model.ProviderInfo, len(infos))
-	for i, pInfo := range infos {
+	responses := make([]providerInfo, 0, len(infos))
+	for _, pInfo := range infos {
+		if !pInfo.MatchLabels(labels, true) {
+			continue
+		}
 		var indexCount uint64
 		if h.indexCounts != nil {
 			var err error
@@ -184,7 +218,7 @@ func (h *FindHandler) ListProviders() ([]byte, error) {
 				log.Errorw("Could not get provider index count", "err", err)
 			}
 		}
-		responses[i] = *registry.RegToApiProviderInfo(pInfo, indexCount)
+		responses = append(responses, apiProviderInfo(pInfo, indexCount))
 	}
 
 	return json.Marshal(responses)
@@ -204,8 +238,34 @@ func (h *FindHandler) GetProvider(providerID peer.ID) ([]byte, error) {
 			log.Errorw("Could not get provider index count", "err", err)
 		}
 	}
-	rsp := registry.RegToApiProviderInfo(info, indexCount)
-	return json.Marshal(rsp)
+	rsp := apiProviderInfo(info, indexCount)
+	return json.Marshal(&rsp)
+}
+
+func apiProviderInfo(pInfo *registry.ProviderInfo, indexCount uint64) providerInfo {
+	apiPI := providerInfo{
+		ProviderInfo: *registry.RegToApiProviderInfo(pInfo, indexCount),
+	}
+	if reach := pInfo.Reachability(); reach != nil {
+		apiPI.Reachability = &reachability{
+			Reachable: reach.Reachable,
+			ProbeTime: reach.ProbeTime.Format(time.RFC3339),
+			Error:     reach.Error,
+		}
+		if reach.Reachable {
+			apiPI.Reachability.Latency = reach.Latency.String()
+		}
+	}
+	for key, label := range pInfo.Labels {
+		if !label.Public {
+			continue
+		}
+		if apiPI.Labels == nil {
+			apiPI.Labels = make(map[string]string)
+		}
+		apiPI.Labels[key] = label.Value
+	}
+	return apiPI
 }
 
 func (h *FindHandler) RefreshStats() {
@@ -40,6 +40,7 @@ type Server struct {
 	listener    net.Listener
 	findHandler *handler.FindHandler
 	healthMsg   string
+	reg         *registry.Registry
 }
 
 func (s *Server) URL() string {
@@ -90,6 +91,7 @@ func New(listen string, indexer indexer.Interface, registry *registry.Registry,
 		server:      server,
 		listener:    l,
 		findHandler: handler.NewFindHandler(indexer, registry, opts.indexCounts),
+		reg:         registry,
 	}
 
 	s.healthMsg = "ready"
@@ -230,7 +232,7 @@ func (s *Server) listProviders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := s.findHandler.ListProviders()
+	data, err := s.findHandler.ListProviders(r.URL.Query()["label"]...)
 	if err != nil {
 		log.Errorw("cannot list providers", "err", err)
 		http.Error(w, "", http.StatusInternalServerError)
@@ -304,7 +306,13 @@ func (s *Server) health(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Cache-Control", "no-cache")
-	http.Error(w, s.healthMsg, http.StatusOK)
+	msg := s.healthMsg
+	if s.reg != nil {
+		if level := s.reg.PressureLevel(); level != 0 {
+			msg = fmt.Sprintf("%s (disk pressure level %d)", msg, level)
+		}
+	}
+	http.Error(w, msg, http.StatusOK)
 }
 
 func (s *Server) getIndexes(w http.ResponseWriter, mhs []multihash.Multihash, stream bool) {
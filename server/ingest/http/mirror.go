@@ -0,0 +1,342 @@
+package httpingestserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipni/go-libipni/dagsync/httpsync"
+	"github.com/ipni/storetheindex/carstore"
+	"github.com/ipni/storetheindex/internal/httpserver"
+	ic "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// MirrorPath is the path under which mirrored advertisement chains are
+// published. The chain of a publisher is at MirrorPath/<publisher-id>/.
+const MirrorPath = "/mirror/"
+
+const (
+	// entriesCacheSize is the number of entries chunk CIDs to remember the
+	// advertisement of.
+	entriesCacheSize = 4096
+	// maxEntriesCursors is the maximum number of CAR files that are kept open
+	// to continue reading entries from.
+	maxEntriesCursors = 64
+	// cursorIdleTimeout is how long a CAR file is kept open after reading an
+	// entries chunk from it.
+	cursorIdleTimeout = time.Minute
+)
+
+// mirrorPublisher serves advertisement chains from the mirror using the
+// dagsync HTTP publisher protocol. Advertisement and entries blocks are served
+// as stored in the CAR files, so the original advertisement signatures are
+// kept. The head is signed by the indexer, since the publisher's key is not
+// available, so a subscriber must sync using the indexer's peer ID.
+type mirrorPublisher struct {
+	carReader *carstore.CarReader
+	privKey   ic.PrivKey
+	// entryAds maps the CID of an entries chunk to the CID of the
+	// advertisement whose CAR file contains it. Subscribers fetch an
+	// advertisement before its entries, so this is filled as advertisements
+	// are served and as entries are read from CAR files.
+	entryAds *lru.Cache[cid.Cid, cid.Cid]
+	// cursors holds CAR files being read, by the CID of the next entries
+	// chunk to be requested from them.
+	cursors      map[cid.Cid]*entriesCursor
+	cursorsMutex sync.Mutex
+}
+
+// entriesCursor is a CAR file that entries chunks are being read from.
+type entriesCursor struct {
+	adCid   cid.Cid
+	entries <-chan carstore.EntryBlock
+	cancel  context.CancelFunc
+	used    time.Time
+}
+
+// signedHead matches httpsync.SignedHeadSchema.
+type signedHead struct {
+	Head   cidlink.Link
+	Sig    []byte
+	Pubkey []byte
+}
+
+func newMirrorPublisher(carReader *carstore.CarReader, privKey ic.PrivKey) (*mirrorPublisher, error) {
+	entryAds, err := lru.New[cid.Cid, cid.Cid](entriesCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	return &mirrorPublisher{
+		carReader: carReader,
+		privKey:   privKey,
+		entryAds:  entryAds,
+		cursors:   make(map[cid.Cid]*entriesCursor),
+	}, nil
+}
+
+func (m *mirrorPublisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.MethodOK(w, r, http.MethodGet) {
+		return
+	}
+
+	pubID, ask, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, MirrorPath), "/")
+	if !ok || ask == "" || strings.Contains(ask, "/") {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	publisher, err := peer.Decode(pubID)
+	if err != nil {
+		http.Error(w, "invalid publisher id", http.StatusBadRequest)
+		return
+	}
+
+	if ask == "head" {
+		m.serveHead(w, r, publisher)
+		return
+	}
+	c, err := cid.Decode(ask)
+	if err != nil {
+		http.Error(w, "invalid request: not a cid", http.StatusBadRequest)
+		return
+	}
+	m.serveBlock(w, r, c)
+}
+
+func (m *mirrorPublisher) serveHead(w http.ResponseWriter, r *http.Request, publisher peer.ID) {
+	head, err := m.carReader.ReadHead(r.Context(), publisher)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "", http.StatusNoContent)
+			return
+		}
+		log.Errorw("Cannot read mirrored head", "err", err, "publisher", publisher)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := m.encodeSignedHead(head)
+	if err != nil {
+		log.Errorw("Cannot encode signed head", "err", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(data)
+}
+
+func (m *mirrorPublisher) encodeSignedHead(head cid.Cid) ([]byte, error) {
+	sig, err := m.privKey.Sign(head.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := ic.MarshalPublicKey(m.privKey.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+	node := bindnode.Wrap(&signedHead{
+		Head:   cidlink.Link{Cid: head},
+		Sig:    sig,
+		Pubkey: pubKey,
+	}, httpsync.SignedHeadSchema())
+	var buf bytes.Buffer
+	if err = dagjson.Encode(node.Representation(), &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (m *mirrorPublisher) serveBlock(w http.ResponseWriter, r *http.Request, c cid.Cid) {
+	data, err := m.loadBlock(r.Context(), c)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "cid not found", http.StatusNotFound)
+			return
+		}
+		log.Errorw("Cannot read mirrored block", "err", err, "cid", c)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+// loadBlock returns the data of the advertisement or entries chunk
+// identified by c. Returns fs.ErrNotExist if the block is not in the mirror.
+func (m *mirrorPublisher) loadBlock(ctx context.Context, c cid.Cid) ([]byte, error) {
+	// Check for a known entries chunk first, to avoid looking for a CAR file
+	// named for the chunk.
+	if adCid, ok := m.entryAds.Get(c); ok {
+		return m.loadEntries(ctx, adCid, c)
+	}
+
+	// Reading only the advertisement does not read the whole CAR file.
+	adBlock, err := m.carReader.Read(ctx, c, true)
+	if err != nil {
+		return nil, err
+	}
+	ad, err := adBlock.Advertisement()
+	if err != nil {
+		return nil, err
+	}
+	if lnk, ok := ad.Entries.(cidlink.Link); ok {
+		m.entryAds.Add(lnk.Cid, c)
+	}
+	return adBlock.Data, nil
+}
+
+// loadEntries returns the data of the entries chunk from the CAR file of the
+// advertisement. A subscriber fetches the chunks of an advertisement in order,
+// which is the order they are stored in the CAR file, so reading continues
+// from where the previous chunk was read instead of reading the CAR file from
+// its start for each chunk.
+func (m *mirrorPublisher) loadEntries(ctx context.Context, adCid, c cid.Cid) ([]byte, error) {
+	cur := m.takeCursor(c)
+	if cur == nil || cur.adCid != adCid {
+		if cur != nil {
+			cur.close()
+		}
+		var err error
+		cur, err = m.openCursor(adCid)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entBlock, err := cur.readTo(ctx, c, m.entryAds)
+	if err != nil {
+		cur.close()
+		return nil, err
+	}
+	// Keep reading from here when the next chunk is requested.
+	chunk, err := entBlock.EntryChunk()
+	if err == nil && chunk.Next != nil {
+		if lnk, ok := chunk.Next.(cidlink.Link); ok {
+			m.entryAds.Add(lnk.Cid, adCid)
+			m.putCursor(lnk.Cid, cur)
+			return entBlock.Data, nil
+		}
+	}
+	cur.close()
+	return entBlock.Data, nil
+}
+
+// openCursor starts reading the entries of the advertisement's CAR file.
+func (m *mirrorPublisher) openCursor(adCid cid.Cid) (*entriesCursor, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	adBlock, err := m.carReader.Read(ctx, adCid, false)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if adBlock.Entries == nil {
+		cancel()
+		return nil, fs.ErrNotExist
+	}
+	return &entriesCursor{
+		adCid:   adCid,
+		entries: adBlock.Entries,
+		cancel:  cancel,
+	}, nil
+}
+
+// takeCursor removes and returns the cursor positioned before the entries
+// chunk c, or nil if there is no such cursor.
+func (m *mirrorPublisher) takeCursor(c cid.Cid) *entriesCursor {
+	m.cursorsMutex.Lock()
+	defer m.cursorsMutex.Unlock()
+
+	cur, ok := m.cursors[c]
+	if !ok {
+		return nil
+	}
+	delete(m.cursors, c)
+	return cur
+}
+
+// putCursor keeps the cursor positioned before the entries chunk c. Cursors
+// that have not been used for longer than cursorIdleTimeout are closed, and if
+// there are too many cursors the least recently used one is closed.
+func (m *mirrorPublisher) putCursor(c cid.Cid, cur *entriesCursor) {
+	now := time.Now()
+	cur.used = now
+
+	var closing []*entriesCursor
+	m.cursorsMutex.Lock()
+	var oldestCid cid.Cid
+	var oldest *entriesCursor
+	for k, other := range m.cursors {
+		if now.Sub(other.used) > cursorIdleTimeout {
+			delete(m.cursors, k)
+			closing = append(closing, other)
+			continue
+		}
+		if oldest == nil || other.used.Before(oldest.used) {
+			oldestCid = k
+			oldest = other
+		}
+	}
+	if prev, ok := m.cursors[c]; ok {
+		closing = append(closing, prev)
+	} else if len(m.cursors) >= maxEntriesCursors {
+		delete(m.cursors, oldestCid)
+		closing = append(closing, oldest)
+	}
+	m.cursors[c] = cur
+	m.cursorsMutex.Unlock()
+
+	for _, other := range closing {
+		other.close()
+	}
+}
+
+// close closes all CAR files being read.
+func (m *mirrorPublisher) close() {
+	m.cursorsMutex.Lock()
+	cursors := m.cursors
+	m.cursors = make(map[cid.Cid]*entriesCursor)
+	m.cursorsMutex.Unlock()
+
+	for _, cur := range cursors {
+		cur.close()
+	}
+}
+
+// readTo reads entries blocks until the block identified by c, and returns
+// that block. The chunks read along the way are remembered as belonging to the
+// cursor's advertisement.
+func (ec *entriesCursor) readTo(ctx context.Context, c cid.Cid, entryAds *lru.Cache[cid.Cid, cid.Cid]) (carstore.EntryBlock, error) {
+	for {
+		select {
+		case entBlock, ok := <-ec.entries:
+			if !ok {
+				return carstore.EntryBlock{}, fs.ErrNotExist
+			}
+			if entBlock.Err != nil {
+				return carstore.EntryBlock{}, entBlock.Err
+			}
+			if entBlock.Cid == c {
+				return entBlock, nil
+			}
+			entryAds.Add(entBlock.Cid, ec.adCid)
+		case <-ctx.Done():
+			return carstore.EntryBlock{}, ctx.Err()
+		}
+	}
+}
+
+// close stops reading the CAR file.
+func (ec *entriesCursor) close() {
+	ec.cancel()
+	for range ec.entries {
+	}
+}
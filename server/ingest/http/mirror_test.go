@@ -0,0 +1,172 @@
+package httpingestserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+	"github.com/ipni/go-libipni/dagsync/httpsync"
+	"github.com/ipni/go-libipni/ingest/schema"
+	"github.com/ipni/go-libipni/maurl"
+	"github.com/ipni/storetheindex/carstore"
+	"github.com/ipni/storetheindex/filestore"
+	"github.com/ipni/storetheindex/test/typehelpers"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	p2ptest "github.com/libp2p/go-libp2p/core/test"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorPublisher(t *testing.T) {
+	ctx := context.Background()
+
+	// Write a publisher's chain to the mirror.
+	srcStore := datastore.NewMapDatastore()
+	srcLsys := mkLinkSystem(srcStore)
+	pubPriv, _, err := p2ptest.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	publisher, err := peer.IDFromPrivateKey(pubPriv)
+	require.NoError(t, err)
+	headCid := typehelpers.RandomAdBuilder{
+		EntryBuilders: []typehelpers.EntryBuilder{
+			typehelpers.RandomEntryChunkBuilder{ChunkCount: 3, EntriesPerChunk: 10},
+			typehelpers.RandomEntryChunkBuilder{ChunkCount: 2, EntriesPerChunk: 10},
+		},
+	}.Build(t, srcLsys, pubPriv).(cidlink.Link).Cid
+
+	fileStore, err := filestore.NewLocal(t.TempDir())
+	require.NoError(t, err)
+	carw, err := carstore.NewWriter(srcStore, fileStore)
+	require.NoError(t, err)
+	count, err := carw.WriteChain(ctx, headCid, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	_, err = carw.WriteHead(ctx, headCid, publisher)
+	require.NoError(t, err)
+
+	countStore := &countingFileStore{Interface: fileStore}
+	carr, err := carstore.NewReader(countStore)
+	require.NoError(t, err)
+	indexerID, indexerPriv, err := ident.Decode()
+	require.NoError(t, err)
+	s, err := New("127.0.0.1:0", nil, nil, nil, WithMirror(carr, indexerPriv))
+	require.NoError(t, err)
+	go s.Start()
+	t.Cleanup(func() { s.Close() })
+
+	mirrorURL, err := url.Parse(s.URL())
+	require.NoError(t, err)
+	mirrorURL.Path = path.Join(MirrorPath, publisher.String())
+
+	resp, err := http.Get(mirrorURL.String() + "/" + cid.NewCidV1(cid.Raw, headCid.Hash()).String())
+	require.NoError(t, err)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	countStore.gets.Store(0)
+
+	// Sync the chain from the mirror into an empty datastore.
+	dstStore := datastore.NewMapDatastore()
+	dstLsys := mkLinkSystem(dstStore)
+	maddr, err := maurl.FromURL(mirrorURL)
+	require.NoError(t, err)
+	sync := httpsync.NewSync(dstLsys, nil, nil)
+	defer sync.Close()
+	syncer, err := sync.NewSyncer(indexerID, []multiaddr.Multiaddr{maddr}, nil)
+	require.NoError(t, err)
+
+	head, err := syncer.GetHead(ctx)
+	require.NoError(t, err)
+	require.Equal(t, headCid, head)
+
+	// Sync each advertisement and its entries, as an indexer does.
+	for adCid := head; adCid != cid.Undef; {
+		err = syncer.Sync(ctx, adCid, selectorparse.CommonSelector_MatchPoint)
+		require.NoError(t, err)
+		node, err := dstLsys.Load(ipld.LinkContext{}, cidlink.Link{Cid: adCid}, schema.AdvertisementPrototype)
+		require.NoError(t, err)
+		ad, err := schema.UnwrapAdvertisement(node)
+		require.NoError(t, err)
+
+		// Original signature is kept.
+		signerID, err := ad.VerifySignature()
+		require.NoError(t, err)
+		require.Equal(t, publisher, signerID)
+
+		err = syncer.Sync(ctx, ad.Entries.(cidlink.Link).Cid, selectorparse.CommonSelector_ExploreAllRecursively)
+		require.NoError(t, err)
+
+		if ad.PreviousID == nil {
+			break
+		}
+		adCid = ad.PreviousID.(cidlink.Link).Cid
+	}
+
+	// Each CAR file is read once for its advertisement, and once with its
+	// manifest for all of its entries chunks. No other files are looked for.
+	require.Equal(t, int32(6), countStore.gets.Load())
+
+	// Check that all blocks were synced.
+	results, err := srcStore.Query(ctx, dsq.Query{KeysOnly: true})
+	require.NoError(t, err)
+	entries, err := results.Rest()
+	require.NoError(t, err)
+	for _, entry := range entries {
+		has, err := dstStore.Has(ctx, datastore.NewKey(entry.Key))
+		require.NoError(t, err)
+		require.True(t, has, "block not synced from mirror")
+	}
+
+	// Publisher that is not in the mirror has no head.
+	resp, err = http.Get(s.URL() + path.Join(MirrorPath, indexerID.String(), "head"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+// countingFileStore counts the files, other than head files, that are read
+// or looked for in a file store.
+type countingFileStore struct {
+	filestore.Interface
+	gets atomic.Int32
+}
+
+func (c *countingFileStore) Get(ctx context.Context, path string) (*filestore.File, io.ReadCloser, error) {
+	if !strings.HasSuffix(path, carstore.HeadFileSuffix) {
+		c.gets.Add(1)
+	}
+	return c.Interface.Get(ctx, path)
+}
+
+func mkLinkSystem(ds datastore.Datastore) ipld.LinkSystem {
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = func(lctx ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
+		c := lnk.(cidlink.Link).Cid
+		val, err := ds.Get(lctx.Ctx, datastore.NewKey(c.String()))
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewBuffer(val), nil
+	}
+	lsys.StorageWriteOpener = func(lctx ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+		buf := bytes.NewBuffer(nil)
+		return buf, func(lnk ipld.Link) error {
+			c := lnk.(cidlink.Link).Cid
+			return ds.Put(lctx.Ctx, datastore.NewKey(c.String()), buf.Bytes())
+		}, nil
+	}
+	return lsys
+}
@@ -1,8 +1,12 @@
 package httpingestserver
 
 import (
+	"errors"
 	"fmt"
 	"time"
+
+	"github.com/ipni/storetheindex/carstore"
+	ic "github.com/libp2p/go-libp2p/core/crypto"
 )
 
 const (
@@ -15,6 +19,8 @@ type serverConfig struct {
 	readTimeout  time.Duration
 	writeTimeout time.Duration
 	version      string
+	carReader    *carstore.CarReader
+	privKey      ic.PrivKey
 }
 
 // Option is a function that sets a value in a serverConfig.
@@ -58,3 +64,20 @@ func WithVersion(ver string) Option {
 		return nil
 	}
 }
+
+// WithMirror publishes the advertisement chains in the mirror read by
+// carReader, using the dagsync HTTP publisher protocol. The head of each chain
+// is signed with privKey.
+func WithMirror(carReader *carstore.CarReader, privKey ic.PrivKey) Option {
+	return func(c *serverConfig) error {
+		if carReader == nil {
+			return errors.New("nil car reader")
+		}
+		if privKey == nil {
+			return errors.New("private key required to sign head")
+		}
+		c.carReader = carReader
+		c.privKey = privKey
+		return nil
+	}
+}
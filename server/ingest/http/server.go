@@ -24,6 +24,8 @@ type Server struct {
 	listener      net.Listener
 	ingestHandler *handler.IngestHandler
 	healthMsg     string
+	reg           *registry.Registry
+	mirrorPub     *mirrorPublisher
 }
 
 func (s *Server) URL() string {
@@ -51,6 +53,7 @@ func New(listen string, indexer indexer.Interface, ingester *ingest.Ingester, re
 		server:        server,
 		listener:      l,
 		ingestHandler: handler.NewIngestHandler(indexer, ingester, registry),
+		reg:           registry,
 	}
 
 	s.healthMsg = "ready"
@@ -62,6 +65,15 @@ func New(listen string, indexer indexer.Interface, ingester *ingest.Ingester, re
 	mux.HandleFunc("/health", s.getHealth)
 	mux.HandleFunc("/register", s.postRegisterProvider)
 
+	if opts.carReader != nil {
+		mirrorPub, err := newMirrorPublisher(opts.carReader, opts.privKey)
+		if err != nil {
+			return nil, err
+		}
+		mux.Handle(MirrorPath, mirrorPub)
+		s.mirrorPub = mirrorPub
+	}
+
 	// Depricated
 	mux.HandleFunc("/ingest/announce", s.putAnnounce)
 
@@ -75,7 +87,11 @@ func (s *Server) Start() error {
 
 func (s *Server) Close() error {
 	log.Info("ingest http server shutdown")
-	return s.server.Shutdown(context.Background())
+	err := s.server.Shutdown(context.Background())
+	if s.mirrorPub != nil {
+		s.mirrorPub.close()
+	}
+	return err
 }
 
 func (s *Server) putAnnounce(w http.ResponseWriter, r *http.Request) {
@@ -112,7 +128,13 @@ func (s *Server) getHealth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Cache-Control", "no-cache")
-	http.Error(w, s.healthMsg, http.StatusOK)
+	msg := s.healthMsg
+	if s.reg != nil {
+		if level := s.reg.PressureLevel(); level != 0 {
+			msg = fmt.Sprintf("%s (disk pressure level %d)", msg, level)
+		}
+	}
+	http.Error(w, msg, http.StatusOK)
 }
 
 func (s *Server) postRegisterProvider(w http.ResponseWriter, r *http.Request) {
@@ -116,6 +116,21 @@ func (b RandomAdBuilder) build(t *testing.T, lsys ipld.LinkSystem, signingKey cr
 	return headLink
 }
 
+// BuildRemovalChain builds a chain of three advertisements, each with two
+// chunks of ten seeded entries, followed by an advertisement that removes the
+// context ID of the first advertisement. Returns the link to the head of the
+// chain.
+func BuildRemovalChain(t *testing.T, lsys ipld.LinkSystem, signingKey crypto.PrivKey) datamodel.Link {
+	return RandomAdBuilder{
+		EntryBuilders: []EntryBuilder{
+			RandomEntryChunkBuilder{ChunkCount: 2, EntriesPerChunk: 10, Seed: 1},
+			RandomEntryChunkBuilder{ChunkCount: 2, EntriesPerChunk: 10, Seed: 2},
+			RandomEntryChunkBuilder{ChunkCount: 2, EntriesPerChunk: 10, Seed: 3},
+		},
+		AddRmWithNoEntries: true,
+	}.Build(t, lsys, signingKey)
+}
+
 type EntryBuilder interface {
 	Build(t *testing.T, lsys ipld.LinkSystem) datamodel.Link
 	GetAddrs() []string